@@ -0,0 +1,169 @@
+// Package certs manages the certificate authority and certificates used
+// to secure the connection between Parity and the mirror daemon, and the
+// development CA used to serve projects over HTTPS (see DevCA).
+//
+// Files are laid out the same way as mirror's own PKI, so that the
+// mirror daemon can use them directly via MIRROR_HOME:
+//
+//	~/.parity/pki/ca/ca.pem                  CA certificate
+//	~/.parity/pki/ca/key.pem                 CA key (never leaves the host)
+//	~/.parity/pki/certs/cert.pem             Client certificate
+//	~/.parity/pki/certs/cert-key.pem         Client key
+//	~/.parity/pki/certs/server-cert.pem      Server (mirror daemon) certificate
+//	~/.parity/pki/certs/server-key.pem       Server (mirror daemon) key
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/mirror/pki"
+)
+
+const (
+	organisation = "parity"
+	bits         = 2048
+)
+
+// Certs is a set of CA, client and server certificates rooted at Dir
+type Certs struct {
+	Dir string
+}
+
+// Dir is the default location of Parity's certificates
+func Dir() string {
+	return filepath.Join(mirror.GetHomeDir(), ".parity", "pki")
+}
+
+// New returns the default set of certificates
+func New() *Certs {
+	return &Certs{Dir: Dir()}
+}
+
+// Config returns the mirror PKI configuration for these certificates
+func (c *Certs) Config() *pki.Config {
+	return &pki.Config{
+		CaCertPath:     filepath.Join(c.Dir, "ca", "ca.pem"),
+		CaKeyPath:      filepath.Join(c.Dir, "ca", "key.pem"),
+		ClientCertPath: filepath.Join(c.Dir, "certs", "cert.pem"),
+		ClientKeyPath:  filepath.Join(c.Dir, "certs", "cert-key.pem"),
+		ServerCertPath: filepath.Join(c.Dir, "certs", "server-cert.pem"),
+		ServerKeyPath:  filepath.Join(c.Dir, "certs", "server-key.pem"),
+	}
+}
+
+// Exists returns true if the CA and all certificates have been generated
+func (c *Certs) Exists() bool {
+	conf := c.Config()
+	for _, f := range []string{conf.CaCertPath, conf.CaKeyPath, conf.ClientCertPath, conf.ClientKeyPath, conf.ServerCertPath, conf.ServerKeyPath} {
+		if _, err := os.Stat(f); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Generate creates a new CA, along with a client certificate and a server
+// certificate valid for the given hosts, replacing any existing ones
+func (c *Certs) Generate(hosts []string) error {
+	conf := c.Config()
+	if len(hosts) == 0 {
+		return fmt.Errorf("At least one host is required for the server certificate")
+	}
+	if err := os.RemoveAll(c.Dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(conf.CaCertPath), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(conf.ClientCertPath), 0700); err != nil {
+		return err
+	}
+
+	if err := pki.GenerateCACertificate(conf.CaCertPath, conf.CaKeyPath, organisation, bits); err != nil {
+		return fmt.Errorf("Unable to generate CA certificate: %s", err.Error())
+	}
+	if err := pki.GenerateCertificate(hosts, conf.ServerCertPath, conf.ServerKeyPath, conf.CaCertPath, conf.CaKeyPath, organisation, bits); err != nil {
+		return fmt.Errorf("Unable to generate server certificate: %s", err.Error())
+	}
+
+	// A single empty host creates a client only certificate
+	if err := pki.GenerateCertificate([]string{""}, conf.ClientCertPath, conf.ClientKeyPath, conf.CaCertPath, conf.CaKeyPath, organisation, bits); err != nil {
+		return fmt.Errorf("Unable to generate client certificate: %s", err.Error())
+	}
+	return nil
+}
+
+// ClientTLSConfig returns a TLS configuration that presents the client
+// certificate and only trusts servers signed by Parity's CA
+func (c *Certs) ClientTLSConfig() (*tls.Config, error) {
+	if !c.Exists() {
+		return nil, fmt.Errorf("No certificates found in '%s'. Please run 'parity install' or 'parity certs rotate'", c.Dir)
+	}
+	return (&pki.PKI{Config: c.Config()}).GetClientTLSConfig()
+}
+
+// ServerTLSConfig returns the TLS configuration used by the mirror daemon,
+// requiring clients to present a certificate signed by Parity's CA
+func (c *Certs) ServerTLSConfig() (*tls.Config, error) {
+	return (&pki.PKI{Config: c.Config()}).GetServerTLSConfig()
+}
+
+// Verify checks that the CA, client and server certificates are currently
+// valid and signed by the CA, returning the earliest expiry
+func (c *Certs) Verify() (time.Time, error) {
+	conf := c.Config()
+	return VerifyChain(conf.CaCertPath, conf.ClientCertPath, conf.ServerCertPath)
+}
+
+// VerifyChain checks that the CA certificate in caFile, and the
+// certificates in files, are currently valid and that each is signed by
+// the CA. It returns the earliest expiry.
+func VerifyChain(caFile string, files ...string) (time.Time, error) {
+	ca, err := readCertificate(caFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	expiry := ca.NotAfter
+	if now.Before(ca.NotBefore) || now.After(ca.NotAfter) {
+		return expiry, fmt.Errorf("The CA certificate '%s' is not valid (valid from %s to %s)", caFile, ca.NotBefore, ca.NotAfter)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	for _, file := range files {
+		cert, err := readCertificate(file)
+		if err != nil {
+			return expiry, err
+		}
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+		opts := x509.VerifyOptions{Roots: pool, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+		if _, err := cert.Verify(opts); err != nil {
+			return expiry, fmt.Errorf("The certificate '%s' is not valid: %s", file, err.Error())
+		}
+	}
+	return expiry, nil
+}
+
+// readCertificate reads a PEM encoded certificate
+func readCertificate(file string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("'%s' does not contain a PEM encoded certificate", file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
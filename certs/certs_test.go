@@ -0,0 +1,129 @@
+package certs
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// handshake starts a TLS server using server and connects to it using client
+func handshake(t *testing.T, server, client *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	defer l.Close()
+
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Client certificate failures are only reported on first read
+	_, err = conn.Read(make([]byte, 1))
+	if err != nil && err.Error() == "EOF" {
+		return nil
+	}
+	return err
+}
+
+func TestCerts_MutualTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-certs")
+	defer os.RemoveAll(dir)
+	c := &Certs{Dir: dir}
+	if err := c.Generate([]string{"127.0.0.1", "localhost"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	server, err := c.ServerTLSConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	client, err := c.ClientTLSConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if err := handshake(t, server, client); err != nil {
+		t.Fatalf("Expected handshake to succeed, got: %s", err.Error())
+	}
+}
+
+func TestCerts_RejectsClientWithoutCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-certs")
+	defer os.RemoveAll(dir)
+	c := &Certs{Dir: dir}
+	if err := c.Generate([]string{"127.0.0.1", "localhost"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	server, _ := c.ServerTLSConfig()
+	client, _ := c.ClientTLSConfig()
+	client.Certificates = nil
+	if err := handshake(t, server, client); err == nil {
+		t.Fatalf("Expected server to reject a client without a certificate")
+	}
+}
+
+func TestCerts_RejectsRotatedCertificates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-certs")
+	defer os.RemoveAll(dir)
+	c := &Certs{Dir: dir}
+	if err := c.Generate([]string{"127.0.0.1", "localhost"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	server, _ := c.ServerTLSConfig()
+	if err := c.Generate([]string{"127.0.0.1"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	client, _ := c.ClientTLSConfig()
+	if err := handshake(t, server, client); err == nil {
+		t.Fatalf("Expected client to reject a server signed by the old CA")
+	}
+}
+
+func TestCerts_ClientTLSConfigWithoutCertificates(t *testing.T) {
+	c := &Certs{Dir: "/tmp/parity-certs-does-not-exist"}
+	if _, err := c.ClientTLSConfig(); err == nil {
+		t.Fatalf("Expected an error when no certificates exist")
+	}
+}
+
+func TestCerts_Verify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-certs")
+	defer os.RemoveAll(dir)
+	c := &Certs{Dir: dir}
+	if err := c.Generate([]string{"127.0.0.1", "localhost"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	expiry, err := c.Verify()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !expiry.After(time.Now()) {
+		t.Fatalf("Expected certificates to expire in the future, got %s", expiry)
+	}
+
+	// Certificates signed by another CA are rejected
+	otherDir, _ := ioutil.TempDir("", "parity-certs")
+	defer os.RemoveAll(otherDir)
+	other := &Certs{Dir: otherDir}
+	other.Generate([]string{"127.0.0.1"})
+	if _, err := VerifyChain(other.Config().CaCertPath, c.Config().ClientCertPath); err == nil {
+		t.Fatalf("Expected certificate signed by another CA to be rejected")
+	}
+	if _, err := VerifyChain(c.Config().CaKeyPath); err == nil {
+		t.Fatalf("Expected a key to be rejected as a CA certificate")
+	}
+}
@@ -0,0 +1,288 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/mirror/pki"
+)
+
+// devOrganisation names the development CA in trust stores
+const devOrganisation = "Parity development CA"
+
+// renewBefore is how long before expiry a development certificate is
+// replaced with a new one
+const renewBefore = 30 * 24 * time.Hour
+
+// leafValidity is how long development certificates are valid for. macOS
+// rejects server certificates valid for longer than 825 days.
+const leafValidity = 825 * 24 * time.Hour
+
+// DevCA is a certificate authority for development hostnames, e.g.
+// web.myproject.parity.local, so that projects can be served over HTTPS.
+//
+// It is separate from the CA securing file synchronisation: trusting it in
+// a browser doesn't extend to the mirror daemon, and 'parity certs rotate'
+// doesn't invalidate it. Files are laid out as:
+//
+//	~/.parity/dev-pki/ca.pem                 CA certificate, to add to trust stores
+//	~/.parity/dev-pki/ca-key.pem             CA key (never leaves the host)
+//	~/.parity/dev-pki/certs/<name>.pem       Certificate for the hostnames in <name>
+//	~/.parity/dev-pki/certs/<name>-key.pem   Key for the certificate
+type DevCA struct {
+	Dir string
+
+	mutex sync.Mutex
+	cache map[string]*tls.Certificate
+}
+
+// DevDir is the default location of the development CA
+func DevDir() string {
+	return filepath.Join(mirror.GetHomeDir(), ".parity", "dev-pki")
+}
+
+// NewDevCA returns the default development CA
+func NewDevCA() *DevCA {
+	return &DevCA{Dir: DevDir()}
+}
+
+// CertFile is the CA certificate
+func (c *DevCA) CertFile() string {
+	return filepath.Join(c.Dir, "ca.pem")
+}
+
+// KeyFile is the CA key
+func (c *DevCA) KeyFile() string {
+	return filepath.Join(c.Dir, "ca-key.pem")
+}
+
+// Init creates the CA, unless it already exists and is valid
+func (c *DevCA) Init() error {
+	if _, err := VerifyChain(c.CertFile()); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(c.Dir, "certs"), 0700); err != nil {
+		return err
+	}
+	if err := pki.GenerateCACertificate(c.CertFile(), c.KeyFile(), devOrganisation, bits); err != nil {
+		return fmt.Errorf("Unable to generate development CA certificate: %s", err.Error())
+	}
+	return nil
+}
+
+// Issue returns a certificate and key valid for all of the hostnames,
+// which may include wildcards (e.g. *.myproject.parity.local). Existing
+// certificates are reused until they near expiry.
+func (c *DevCA) Issue(hostnames ...string) (certFile string, keyFile string, err error) {
+	if len(hostnames) == 0 {
+		return "", "", fmt.Errorf("At least one hostname is required for a certificate")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.Init(); err != nil {
+		return "", "", err
+	}
+	name := strings.Replace(strings.ToLower(hostnames[0]), "*", "_wildcard", 1)
+	if strings.ContainsAny(name, `/\`) {
+		return "", "", fmt.Errorf("Invalid hostname '%s'", hostnames[0])
+	}
+	certFile = filepath.Join(c.Dir, "certs", name+".pem")
+	keyFile = filepath.Join(c.Dir, "certs", name+"-key.pem")
+	if c.covers(certFile, hostnames) {
+		return certFile, keyFile, nil
+	}
+
+	if err := c.generate(hostnames, certFile, keyFile); err != nil {
+		return "", "", fmt.Errorf("Unable to generate certificate for %s: %s", strings.Join(hostnames, ", "), err.Error())
+	}
+	return certFile, keyFile, nil
+}
+
+// generate writes a server certificate for the hostnames, signed by the
+// CA, and its key
+func (c *DevCA) generate(hostnames []string, certFile, keyFile string) error {
+	ca, err := tls.LoadX509KeyPair(c.CertFile(), c.KeyFile())
+	if err != nil {
+		return err
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return err
+	}
+
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{devOrganisation}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(leafValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hostnames {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return ioutil.WriteFile(keyFile, keyPEM, 0600)
+}
+
+// covers returns true if the certificate in certFile was issued by the
+// CA, isn't about to expire and is valid for all of the hostnames.
+// Certificates valid for longer than leafValidity, as issued by earlier
+// versions, are replaced.
+func (c *DevCA) covers(certFile string, hostnames []string) bool {
+	expiry, err := VerifyChain(c.CertFile(), certFile)
+	if err != nil || time.Until(expiry) < renewBefore {
+		return false
+	}
+	cert, err := readCertificate(certFile)
+	if err != nil || cert.NotAfter.Sub(cert.NotBefore) > leafValidity {
+		return false
+	}
+	for _, h := range hostnames {
+		if !hasName(cert, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasName returns true if the certificate was issued for the hostname or
+// IP address. Wildcards must match exactly.
+func hasName(cert *x509.Certificate, hostname string) bool {
+	if strings.HasPrefix(hostname, "*.") {
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, hostname) {
+				return true
+			}
+		}
+		return false
+	}
+	return cert.VerifyHostname(hostname) == nil
+}
+
+// GetCertificate returns a function for tls.Config that issues a
+// certificate for each hostname under domain as it's requested. Clients
+// that don't send a hostname are given a certificate for the domain.
+func (c *DevCA) GetCertificate(domain string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		hostname := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+		if hostname == "" {
+			hostname = domain
+		}
+		if hostname != domain && !strings.HasSuffix(hostname, "."+domain) {
+			return nil, fmt.Errorf("Not issuing a certificate for %s, which is outside of %s", hostname, domain)
+		}
+
+		c.mutex.Lock()
+		cert, ok := c.cache[hostname]
+		c.mutex.Unlock()
+		if ok && time.Until(cert.Leaf.NotAfter) > renewBefore {
+			return cert, nil
+		}
+
+		certFile, keyFile, err := c.Issue(hostname)
+		if err != nil {
+			return nil, err
+		}
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return nil, err
+		}
+
+		c.mutex.Lock()
+		if c.cache == nil {
+			c.cache = make(map[string]*tls.Certificate)
+		}
+		c.cache[hostname] = &pair
+		c.mutex.Unlock()
+		return &pair, nil
+	}
+}
+
+// TrustInstructions explains how to add the CA certificate in caFile to
+// the trust stores of the given operating system (e.g. runtime.GOOS)
+func TrustInstructions(goos string, caFile string) string {
+	var steps string
+	switch goos {
+	case "darwin":
+		steps = fmt.Sprintf(`Add it to the System keychain (used by Safari and Chrome):
+
+  sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %[1]s
+
+To remove it later, delete the '%[2]s' certificate in Keychain Access.`, caFile, devOrganisation)
+	case "linux":
+		steps = fmt.Sprintf(`Add it to the system trust store. On Debian and Ubuntu:
+
+  sudo cp %[1]s /usr/local/share/ca-certificates/parity-dev.crt
+  sudo update-ca-certificates
+
+On Fedora, CentOS and RHEL:
+
+  sudo cp %[1]s /etc/pki/ca-trust/source/anchors/parity-dev.pem
+  sudo update-ca-trust
+
+Chrome uses its own store, add it there with certutil (from libnss3-tools or nss-tools):
+
+  certutil -d sql:$HOME/.pki/nssdb -A -t "C,," -n "%[2]s" -i %[1]s`, caFile, devOrganisation)
+	case "windows":
+		steps = fmt.Sprintf(`Add it to the Trusted Root Certification Authorities store from an
+elevated PowerShell prompt (used by Edge and Chrome):
+
+  Import-Certificate -FilePath "%[1]s" -CertStoreLocation Cert:\LocalMachine\Root`, caFile)
+	default:
+		steps = "Add it to your operating system's trust store as a trusted root certificate."
+	}
+
+	return fmt.Sprintf(`Parity's development CA certificate is %s
+
+%s
+
+Firefox keeps its own trust store: import the certificate in Settings >
+Privacy & Security > Certificates > View Certificates > Authorities, and
+trust it to identify websites.
+
+Containers that make HTTPS requests to other services need it too, e.g.
+mount it with 'parity certs issue --out' and add it to the image's store.`, caFile, steps)
+}
@@ -0,0 +1,110 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevCA_Issue(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-dev-pki")
+	defer os.RemoveAll(dir)
+	ca := &DevCA{Dir: dir}
+
+	certFile, keyFile, err := ca.Issue("myproject.parity.local", "*.myproject.parity.local")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.HasSuffix(certFile, "myproject.parity.local.pem") || !strings.HasSuffix(keyFile, "myproject.parity.local-key.pem") {
+		t.Fatalf("Unexpected certificate files %s and %s", certFile, keyFile)
+	}
+	if _, err := VerifyChain(ca.CertFile(), certFile); err != nil {
+		t.Fatalf("Expected the certificate to be signed by the CA, got: %s", err.Error())
+	}
+	cert, _ := readCertificate(certFile)
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity > 825*24*time.Hour {
+		t.Fatalf("Expected the certificate to be valid for at most 825 days, got %s", validity)
+	}
+	for _, h := range []string{"myproject.parity.local", "web.myproject.parity.local"} {
+		if err := cert.VerifyHostname(h); err != nil {
+			t.Fatalf("Expected the certificate to be valid for %s, got: %s", h, err.Error())
+		}
+	}
+
+	// The certificate is reused while it's valid for the hostnames
+	if _, _, err := ca.Issue("myproject.parity.local", "*.myproject.parity.local"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if reissued, _ := readCertificate(certFile); reissued.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Fatalf("Expected the existing certificate to be reused")
+	}
+
+	// Adding a hostname replaces it
+	if _, _, err := ca.Issue("myproject.parity.local", "*.myproject.parity.local", "127.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	reissued, _ := readCertificate(certFile)
+	if reissued.SerialNumber.Cmp(cert.SerialNumber) == 0 || reissued.VerifyHostname("127.0.0.1") != nil {
+		t.Fatalf("Expected a new certificate valid for 127.0.0.1")
+	}
+}
+
+func TestDevCA_IssueInvalidHostname(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-dev-pki")
+	defer os.RemoveAll(dir)
+	ca := &DevCA{Dir: dir}
+
+	if _, _, err := ca.Issue(); err == nil {
+		t.Fatalf("Expected an error without hostnames")
+	}
+	if _, _, err := ca.Issue("../parity.local"); err == nil {
+		t.Fatalf("Expected an error for a hostname containing a path")
+	}
+}
+
+func TestDevCA_GetCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-dev-pki")
+	defer os.RemoveAll(dir)
+	ca := &DevCA{Dir: dir}
+
+	if err := ca.Init(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	server := &tls.Config{GetCertificate: ca.GetCertificate("parity.local")}
+	pool := x509.NewCertPool()
+	data, _ := ioutil.ReadFile(ca.CertFile())
+	if !pool.AppendCertsFromPEM(data) {
+		t.Fatalf("Expected a PEM encoded CA certificate")
+	}
+
+	client := &tls.Config{RootCAs: pool, ServerName: "web.myproject.parity.local"}
+	if err := handshake(t, server, client); err != nil {
+		t.Fatalf("Expected handshake to succeed, got: %s", err.Error())
+	}
+	cert, _ := ca.GetCertificate("parity.local")(&tls.ClientHelloInfo{ServerName: "web.myproject.parity.local"})
+	if cached, _ := ca.GetCertificate("parity.local")(&tls.ClientHelloInfo{ServerName: "WEB.myproject.parity.local."}); cached != cert {
+		t.Fatalf("Expected the certificate to be cached")
+	}
+
+	client = &tls.Config{RootCAs: pool, ServerName: "example.com"}
+	if err := handshake(t, server, client); err == nil {
+		t.Fatalf("Expected no certificate for a hostname outside the domain")
+	}
+}
+
+func TestTrustInstructions(t *testing.T) {
+	for goos, expected := range map[string]string{
+		"darwin":  "security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain /ca.pem",
+		"linux":   "update-ca-certificates",
+		"windows": `Import-Certificate -FilePath "/ca.pem" -CertStoreLocation Cert:\LocalMachine\Root`,
+		"plan9":   "operating system's trust store",
+	} {
+		if instructions := TrustInstructions(goos, "/ca.pem"); !strings.Contains(instructions, expected) || !strings.Contains(instructions, "Firefox") {
+			t.Fatalf("Expected the %s instructions to contain '%s', got: %s", goos, expected, instructions)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/install"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/cli"
+)
+
+// CertsCommand groups the certificate management commands
+type CertsCommand struct {
+	Meta config.Meta
+}
+
+// Run shows the help for the certificate commands
+func (c *CertsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// Help text for the command
+func (c *CertsCommand) Help() string {
+	helpText := `
+Usage: parity certs <subcommand> [options]
+
+  Manages the certificates used to secure file synchronisation between
+  Parity and the mirror daemon running in the Docker Machine, and the
+  development CA used to serve projects over HTTPS.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *CertsCommand) Synopsis() string {
+	return "Manage Parity's certificates"
+}
+
+// CertsRotateCommand replaces Parity's CA and certificates
+type CertsRotateCommand struct {
+	Meta       config.Meta
+	Hostname   string
+	ConfigFile string
+}
+
+// Run rotates the certificates
+func (c *CertsRotateCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("certs rotate", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.Hostname, "hostname", "parity.local", "Additional hostname for the mirror daemon certificate")
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	docker, err := app.LoadDockerEnvironment(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	if err := install.RotateCertificates(docker, c.Hostname); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *CertsRotateCommand) Help() string {
+	helpText := `
+Usage: parity certs rotate [options]
+
+  Generates a new CA, client and server certificates, installs them into the
+  running Docker Machine and restarts the mirror daemon. Certificates issued
+  by the previous CA are no longer trusted.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --hostname                 Additional hostname for the mirror daemon certificate. Defaults to 'parity.local'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *CertsRotateCommand) Synopsis() string {
+	return "Replace Parity's certificates"
+}
+
+// CertsIssueCommand issues development certificates for a project's
+// hostnames
+type CertsIssueCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+	Domain     string
+	Out        string
+}
+
+// Run issues the certificate
+func (c *CertsIssueCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("certs issue", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&c.Domain, "domain", hosts.DefaultDomain, "The domain the project's hostnames are under")
+	cmdFlags.StringVar(&c.Out, "out", "", "Directory to copy the certificate, key and CA certificate to")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	hostnames := cmdFlags.Args()
+	if len(hostnames) == 0 {
+		conf, err := app.LoadConfig(c.ConfigFile)
+		if err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+		if hosts.Label(conf.Name) == "" {
+			c.Meta.Ui.Error(fmt.Sprintf("A project 'name' is required in %s, or specify the hostnames", c.ConfigFile))
+			return 1
+		}
+		project := hosts.ServiceHostnames(utils.ProjectNameSafe(conf.Name), c.Domain, nil)[0]
+		hostnames = []string{project, "*." + project}
+	}
+
+	ca := certs.NewDevCA()
+	certFile, keyFile, err := ca.Issue(hostnames...)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	if c.Out != "" {
+		files := map[string]string{
+			certFile:      filepath.Base(certFile),
+			keyFile:       filepath.Base(keyFile),
+			ca.CertFile(): "ca.pem",
+		}
+		if err := os.MkdirAll(c.Out, 0700); err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+		for from, name := range files {
+			if err := copyFile(from, filepath.Join(c.Out, name)); err != nil {
+				c.Meta.Ui.Error(fmt.Sprintf("Unable to copy %s to %s: %s", from, c.Out, err.Error()))
+				return 1
+			}
+		}
+		certFile, keyFile = filepath.Join(c.Out, filepath.Base(certFile)), filepath.Join(c.Out, filepath.Base(keyFile))
+	}
+
+	c.Meta.Ui.Output(fmt.Sprintf("Certificate for %s", strings.Join(hostnames, ", ")))
+	c.Meta.Ui.Output(fmt.Sprintf("  Certificate: %s", certFile))
+	c.Meta.Ui.Output(fmt.Sprintf("  Key:         %s", keyFile))
+	c.Meta.Ui.Output("Run 'parity certs trust' to trust Parity's development CA")
+
+	return 0
+}
+
+// copyFile copies a certificate or key, keeping it private to the user
+func copyFile(from string, to string) error {
+	data, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, data, 0600)
+}
+
+// Help text for the command
+func (c *CertsIssueCommand) Help() string {
+	helpText := `
+Usage: parity certs issue [options] [hostname...]
+
+  Issues a certificate from Parity's development CA, valid for each of the
+  hostnames. Defaults to the project's hostname and all names under it, e.g.
+  myproject.parity.local and *.myproject.parity.local. The certificate is
+  reused until it nears expiry.
+
+  The 'router' plugin issues certificates automatically. Use --out to copy
+  the certificate, key and CA certificate into the project (e.g.
+  .parity/certs), to mount them into containers with a Compose volume.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --domain                   The domain the project's hostnames are under. Defaults to 'parity.local'.
+  --out                      Directory to copy the certificate, key and CA certificate to.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *CertsIssueCommand) Synopsis() string {
+	return "Issue a development certificate"
+}
+
+// CertsTrustCommand shows how to trust the development CA
+type CertsTrustCommand struct {
+	Meta config.Meta
+}
+
+// Run prints the trust store instructions
+func (c *CertsTrustCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("certs trust", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	ca := certs.NewDevCA()
+	if err := ca.Init(); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	c.Meta.Ui.Output(certs.TrustInstructions(runtime.GOOS, ca.CertFile()))
+
+	return 0
+}
+
+// Help text for the command
+func (c *CertsTrustCommand) Help() string {
+	helpText := `
+Usage: parity certs trust
+
+  Shows how to add Parity's development CA to your operating system's and
+  browsers' trust stores, so that certificates it issues are trusted. The
+  CA is created if it doesn't exist.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *CertsTrustCommand) Synopsis() string {
+	return "Show how to trust the development CA"
+}
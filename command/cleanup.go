@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/mefellows/parity/config"
+	app "github.com/mefellows/parity/parity"
 	"github.com/mefellows/parity/utils"
 )
 
@@ -26,8 +27,16 @@ func (c *CleanupCommand) Run(args []string) int {
 		return 1
 	}
 
+	docker, err := app.LoadDockerEnvironment(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
 	c.Meta.Ui.Output("Cleaning up Docker images and containers")
-	utils.Cleanup()
+	if err := utils.Cleanup(docker); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
 
 	return 0
 }
@@ -36,11 +36,76 @@ func init() {
 				Meta: meta,
 			}, nil
 		},
+		"certs": func() (cli.Command, error) {
+			return &CertsCommand{
+				Meta: meta,
+			}, nil
+		},
+		"certs issue": func() (cli.Command, error) {
+			return &CertsIssueCommand{
+				Meta: meta,
+			}, nil
+		},
+		"certs rotate": func() (cli.Command, error) {
+			return &CertsRotateCommand{
+				Meta: meta,
+			}, nil
+		},
+		"certs trust": func() (cli.Command, error) {
+			return &CertsTrustCommand{
+				Meta: meta,
+			}, nil
+		},
 		"cleanup": func() (cli.Command, error) {
 			return &CleanupCommand{
 				Meta: meta,
 			}, nil
 		},
+		"dns": func() (cli.Command, error) {
+			return &DNSCommand{
+				Meta: meta,
+			}, nil
+		},
+		"dns serve": func() (cli.Command, error) {
+			return &DNSServeCommand{
+				Meta: meta,
+			}, nil
+		},
+		"dns setup": func() (cli.Command, error) {
+			return &DNSSetupCommand{
+				Meta: meta,
+			}, nil
+		},
+		"doctor": func() (cli.Command, error) {
+			return &DoctorCommand{
+				Meta: meta,
+			}, nil
+		},
+		"hosts": func() (cli.Command, error) {
+			return &HostsCommand{
+				Meta: meta,
+			}, nil
+		},
+		"hosts add": func() (cli.Command, error) {
+			return &HostsAddCommand{
+				Meta: meta,
+			}, nil
+		},
+		"hosts list": func() (cli.Command, error) {
+			return &HostsListCommand{
+				Meta: meta,
+			}, nil
+		},
+		"hosts remove": func() (cli.Command, error) {
+			return &HostsRemoveCommand{
+				Meta: meta,
+			}, nil
+		},
+		"hosts sync": func() (cli.Command, error) {
+			return &HostsSyncCommand{
+				Meta: meta,
+			}, nil
+		},
 		"init": func() (cli.Command, error) {
 			return &InitCommand{
 				Meta: meta,
@@ -56,6 +121,11 @@ func init() {
 				Meta: meta,
 			}, nil
 		},
+		"uninstall": func() (cli.Command, error) {
+			return &UninstallCommand{
+				Meta: meta,
+			}, nil
+		},
 		"interactive": func() (cli.Command, error) {
 			return &InteractiveCommand{
 				Meta: meta,
@@ -66,16 +136,81 @@ func init() {
 				Meta: meta,
 			}, nil
 		},
+		"mirror-daemon": func() (cli.Command, error) {
+			return &MirrorDaemonCommand{
+				Meta: meta,
+			}, nil
+		},
 		"run": func() (cli.Command, error) {
 			return &RunCommand{
 				Meta: meta,
 			}, nil
 		},
+		"secrets": func() (cli.Command, error) {
+			return &SecretsCommand{
+				Meta: meta,
+			}, nil
+		},
+		"secrets get": func() (cli.Command, error) {
+			return &SecretsGetCommand{
+				Meta: meta,
+			}, nil
+		},
+		"secrets list": func() (cli.Command, error) {
+			return &SecretsListCommand{
+				Meta: meta,
+			}, nil
+		},
+		"secrets rm": func() (cli.Command, error) {
+			return &SecretsRmCommand{
+				Meta: meta,
+			}, nil
+		},
+		"secrets set": func() (cli.Command, error) {
+			return &SecretsSetCommand{
+				Meta: meta,
+			}, nil
+		},
 		"setup": func() (cli.Command, error) {
 			return &SetupCommand{
 				Meta: meta,
 			}, nil
 		},
+		"snapshot": func() (cli.Command, error) {
+			return &SnapshotCommand{
+				Meta: meta,
+			}, nil
+		},
+		"snapshot list": func() (cli.Command, error) {
+			return &SnapshotListCommand{
+				Meta: meta,
+			}, nil
+		},
+		"snapshot restore": func() (cli.Command, error) {
+			return &SnapshotRestoreCommand{
+				Meta: meta,
+			}, nil
+		},
+		"snapshot rm": func() (cli.Command, error) {
+			return &SnapshotRmCommand{
+				Meta: meta,
+			}, nil
+		},
+		"snapshot save": func() (cli.Command, error) {
+			return &SnapshotSaveCommand{
+				Meta: meta,
+			}, nil
+		},
+		"sync": func() (cli.Command, error) {
+			return &SyncCommand{
+				Meta: meta,
+			}, nil
+		},
+		"sync stats": func() (cli.Command, error) {
+			return &SyncStatsCommand{
+				Meta: meta,
+			}, nil
+		},
 		"version": func() (cli.Command, error) {
 			return &VersionCommand{}, nil
 		},
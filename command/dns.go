@@ -0,0 +1,240 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/dns"
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/log"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/cli"
+)
+
+// dnsRefreshInterval is how often records are refreshed from the running
+// Compose services
+const dnsRefreshInterval = 5 * time.Second
+
+// DNSCommand groups the DNS server commands
+type DNSCommand struct {
+	Meta config.Meta
+}
+
+// Run shows the help for the DNS commands
+func (c *DNSCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// Help text for the command
+func (c *DNSCommand) Help() string {
+	helpText := `
+Usage: parity dns <subcommand> [options]
+
+  Runs a DNS server answering for Parity's hostnames (e.g.
+  web.myproject.parity.local), as an alternative to managing host entries
+  with 'parity hosts'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *DNSCommand) Synopsis() string {
+	return "Resolve Parity's hostnames with a local DNS server"
+}
+
+// DNSServeCommand runs the DNS server
+type DNSServeCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+	Addr       string
+	Domain     string
+	IP         string
+}
+
+// Run serves DNS queries until interrupted
+func (c *DNSServeCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("dns serve", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&c.Addr, "addr", dns.DefaultAddress, "The address to listen on")
+	cmdFlags.StringVar(&c.Domain, "domain", hosts.DefaultDomain, "The domain to answer for")
+	cmdFlags.StringVar(&c.IP, "ip", "", "The address to resolve all names to, e.g. the router's. Defaults to the Docker host")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	docker, err := app.LoadDockerEnvironment(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	defer docker.Close()
+
+	ip := c.IP
+	if ip == "" {
+		host := docker.Host
+		if docker.Native || host == "" {
+			host = "127.0.0.1"
+		}
+		if ip, err = hosts.ResolveIP(host); err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+	} else if net.ParseIP(ip) == nil {
+		c.Meta.Ui.Error(fmt.Sprintf("Invalid IP address '%s'", ip))
+		return 1
+	}
+
+	zone := dns.NewZone(c.Domain, net.ParseIP(ip))
+	refresh := func() error {
+		// Per-service records are only needed when resolving to the Docker host
+		if c.IP != "" {
+			return nil
+		}
+		return dns.Refresh(zone, docker)
+	}
+	if err := refresh(); err != nil {
+		log.Warn("Unable to find running Compose services, only %s will resolve: %s", c.Domain, err.Error())
+	}
+	server := &dns.Server{Addr: c.Addr, Zone: zone}
+	if err := server.Start(); err != nil {
+		c.Meta.Ui.Error(fmt.Sprintf("Unable to start DNS server on %s: %s", c.Addr, err.Error()))
+		return 1
+	}
+	defer server.Close()
+
+	addr := server.UDPAddr().(*net.UDPAddr)
+	c.Meta.Ui.Output(fmt.Sprintf("Answering for *.%s (%s) on %s", c.Domain, ip, addr))
+	c.Meta.Ui.Output(fmt.Sprintf("Try 'dig @%s -p %d %s', and see 'parity dns setup' to resolve it system-wide", addr.IP, addr.Port, c.Domain))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(dnsRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-interrupt:
+			return 0
+		case <-ticker.C:
+			if err := refresh(); err != nil {
+				log.Debug("Unable to refresh DNS records: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Help text for the command
+func (c *DNSServeCommand) Help() string {
+	helpText := `
+Usage: parity dns serve [options]
+
+  Runs a DNS server answering for the domain (e.g. parity.local) and all names
+  under it. Running Compose services get their own records, e.g.
+  web.myproject.parity.local, and all other names resolve to the Docker host.
+  Queries for names outside the domain are refused.
+
+  See 'parity dns setup' to send queries for the domain to this server.
+
+Options:
+
+  --addr                     The address to listen on (UDP and TCP). Defaults to 127.0.0.1:10053.
+  --config                   Path to the configuration file, used for any 'host' settings. Defaults to ./parity.yml.
+  --domain                   The domain to answer for. Defaults to 'parity.local'.
+  --ip                       The address to resolve all names to, e.g. the 'router' plugin's. Defaults to the Docker host.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *DNSServeCommand) Synopsis() string {
+	return "Run the DNS server"
+}
+
+// DNSSetupCommand configures the system resolver to use the DNS server
+type DNSSetupCommand struct {
+	Meta    config.Meta
+	Addr    string
+	Domain  string
+	Install bool
+}
+
+// Run prints, or applies, the resolver configuration
+func (c *DNSSetupCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("dns setup", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.Addr, "addr", dns.DefaultAddress, "The address the DNS server listens on")
+	cmdFlags.StringVar(&c.Domain, "domain", hosts.DefaultDomain, "The domain the DNS server answers for")
+	cmdFlags.BoolVar(&c.Install, "install", false, "Create the resolver configuration file")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	setup, err := dns.Resolver(runtime.GOOS, c.Domain, c.Addr)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	if !c.Install {
+		c.Meta.Ui.Output(setup.Instructions)
+		return 0
+	}
+	if setup.File == "" {
+		c.Meta.Ui.Error("The resolver can't be configured automatically on this platform:\n\n" + setup.Instructions)
+		return 1
+	}
+
+	if err := os.MkdirAll(filepath.Dir(setup.File), 0755); err == nil {
+		err = ioutil.WriteFile(setup.File, []byte(setup.Content), 0644)
+	}
+	if err != nil {
+		c.Meta.Ui.Error(fmt.Sprintf("Unable to create %s, try again with 'sudo -E': %s", setup.File, err.Error()))
+		return 1
+	}
+	c.Meta.Ui.Output(fmt.Sprintf("Created %s", setup.File))
+	if runtime.GOOS == "linux" {
+		c.Meta.Ui.Output("Restart systemd-resolved to apply it: 'sudo systemctl restart systemd-resolved'")
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *DNSSetupCommand) Help() string {
+	helpText := `
+Usage: parity dns setup [options]
+
+  Shows how to send queries for the domain to Parity's DNS server. With
+  --install, creates the resolver configuration file (/etc/resolver on macOS,
+  a systemd-resolved drop-in on Linux), which requires elevated privileges.
+
+Options:
+
+  --addr                     The address the DNS server listens on. Defaults to 127.0.0.1:10053.
+  --domain                   The domain the DNS server answers for. Defaults to 'parity.local'.
+  --install                  Create the resolver configuration file.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *DNSSetupCommand) Synopsis() string {
+	return "Configure the system to use the DNS server"
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/doctor"
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/utils"
+)
+
+type DoctorCommand struct {
+	Meta        config.Meta
+	ConfigFile  string
+	ComposeFile string
+	Hostname    string
+	JSON        bool
+}
+
+func (c *DoctorCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&c.ComposeFile, "compose", utils.DefaultComposeFile(), "Specifies the Docker Compose file path")
+	cmdFlags.StringVar(&c.Hostname, "hostname", hosts.DefaultDomain, "The host entry created by 'parity install --dns'")
+	cmdFlags.BoolVar(&c.JSON, "json", false, "Print the report as JSON")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	d := &doctor.Doctor{
+		ConfigFile:  c.ConfigFile,
+		ComposeFile: c.ComposeFile,
+		Hostname:    c.Hostname,
+	}
+	report := d.Run()
+	if d.Docker != nil {
+		defer d.Docker.Close()
+	}
+
+	if c.JSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+		c.Meta.Ui.Output(string(data))
+	} else {
+		c.Meta.Ui.Output(report.String())
+	}
+
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
+
+func (c *DoctorCommand) Help() string {
+	helpText := `
+Usage: parity doctor [options]
+
+  Diagnose problems with Parity's environment.
+
+  Checks the configuration and Compose files, the Docker API and its TLS
+  certificates, SSH access to the Docker host, the mirror daemon and its
+  certificates, VirtualBox shared folders, free disk space on the Docker host,
+  clock skew and the host entry created by 'parity install --dns'.
+
+  Exits with status 1 if any check fails.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --compose                  Path to the Docker Compose file. Defaults to ./docker-compose.yml.
+  --hostname                 The host entry created by 'parity install --dns'.
+  --json                     Print the report as JSON.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *DoctorCommand) Synopsis() string {
+	return "Diagnose problems with the Parity environment"
+}
@@ -0,0 +1,354 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/hosts"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/cli"
+)
+
+// HostsCommand groups the hosts file commands
+type HostsCommand struct {
+	Meta config.Meta
+}
+
+// Run shows the help for the hosts commands
+func (c *HostsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// Help text for the command
+func (c *HostsCommand) Help() string {
+	helpText := `
+Usage: parity hosts <subcommand> [options]
+
+  Manages Parity's entries in the hosts file (e.g. /etc/hosts). Entries are
+  kept in a block between '# BEGIN parity' and '# END parity' lines, and the
+  rest of the file is left untouched.
+
+  Changing the hosts file requires elevated privileges, e.g. 'sudo -E'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *HostsCommand) Synopsis() string {
+	return "Manage Parity's host entries"
+}
+
+// dockerHostIP is the IP address host entries point at: the Docker host,
+// or the loopback address when Docker runs natively
+func dockerHostIP(configFile string) (string, error) {
+	docker, err := app.LoadDockerEnvironment(configFile)
+	if err != nil {
+		return "", err
+	}
+	defer docker.Close()
+	if docker.Native || docker.Host == "" {
+		return "127.0.0.1", nil
+	}
+	return hosts.ResolveIP(docker.Host)
+}
+
+// HostsAddCommand maps hostnames to the Docker host
+type HostsAddCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+	HostsFile  string
+	IP         string
+}
+
+// Run adds the host entries
+func (c *HostsAddCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("hosts add", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&c.HostsFile, "hosts-file", hosts.DefaultPath(), "Specifies the hosts file path")
+	cmdFlags.StringVar(&c.IP, "ip", "", "IP address to map the hostnames to. Defaults to the Docker host")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	hostnames := cmdFlags.Args()
+	if len(hostnames) == 0 {
+		hostnames = []string{hosts.DefaultDomain}
+	}
+
+	ip := c.IP
+	if ip == "" {
+		var err error
+		if ip, err = dockerHostIP(c.ConfigFile); err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	f, err := hosts.Load(c.HostsFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	f.Add(ip, hostnames...)
+	if err := f.Save(); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	for _, h := range hostnames {
+		c.Meta.Ui.Output(fmt.Sprintf("Added %s -> %s", h, ip))
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *HostsAddCommand) Help() string {
+	helpText := `
+Usage: parity hosts add [options] [hostname...]
+
+  Maps each hostname to the Docker host, replacing any existing entry for it.
+  Defaults to 'parity.local'.
+
+Options:
+
+  --config                   Path to the configuration file, used for any 'host' settings. Defaults to ./parity.yml.
+  --hosts-file               Path to the hosts file. Defaults to the system hosts file.
+  --ip                       IP address to map the hostnames to. Defaults to the Docker host.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *HostsAddCommand) Synopsis() string {
+	return "Add host entries for the Docker host"
+}
+
+// HostsListCommand lists Parity's host entries
+type HostsListCommand struct {
+	Meta      config.Meta
+	HostsFile string
+}
+
+// Run lists the host entries
+func (c *HostsListCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("hosts list", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.HostsFile, "hosts-file", hosts.DefaultPath(), "Specifies the hosts file path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	f, err := hosts.Load(c.HostsFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	if len(f.Entries) == 0 {
+		c.Meta.Ui.Output(fmt.Sprintf("No Parity host entries in %s", c.HostsFile))
+		return 0
+	}
+	for _, e := range f.Entries {
+		c.Meta.Ui.Output(fmt.Sprintf("%-16s %s", e.IP, e.Hostname))
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *HostsListCommand) Help() string {
+	helpText := `
+Usage: parity hosts list [options]
+
+  Lists Parity's host entries.
+
+Options:
+
+  --hosts-file               Path to the hosts file. Defaults to the system hosts file.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *HostsListCommand) Synopsis() string {
+	return "List Parity's host entries"
+}
+
+// HostsRemoveCommand removes Parity's host entries
+type HostsRemoveCommand struct {
+	Meta      config.Meta
+	HostsFile string
+	All       bool
+}
+
+// Run removes the host entries
+func (c *HostsRemoveCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("hosts remove", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.HostsFile, "hosts-file", hosts.DefaultPath(), "Specifies the hosts file path")
+	cmdFlags.BoolVar(&c.All, "all", false, "Remove all of Parity's host entries")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	hostnames := cmdFlags.Args()
+	if len(hostnames) == 0 && !c.All {
+		c.Meta.Ui.Error("Specify the hostnames to remove, or '--all'")
+		return 1
+	}
+
+	f, err := hosts.Load(c.HostsFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	removed := 0
+	if c.All {
+		removed = f.RemoveAll()
+	} else {
+		removed = f.Remove(hostnames...)
+	}
+	if removed > 0 {
+		if err := f.Save(); err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+	}
+	c.Meta.Ui.Output(fmt.Sprintf("Removed %d host entries", removed))
+
+	return 0
+}
+
+// Help text for the command
+func (c *HostsRemoveCommand) Help() string {
+	helpText := `
+Usage: parity hosts remove [options] [hostname...]
+
+  Removes Parity's entries for the given hostnames. Entries outside of
+  Parity's block in the hosts file are never removed.
+
+Options:
+
+  --all                      Remove all of Parity's host entries.
+  --hosts-file               Path to the hosts file. Defaults to the system hosts file.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *HostsRemoveCommand) Synopsis() string {
+	return "Remove Parity's host entries"
+}
+
+// HostsSyncCommand creates host entries for each Compose service
+type HostsSyncCommand struct {
+	Meta        config.Meta
+	ConfigFile  string
+	ComposeFile string
+	HostsFile   string
+	Domain      string
+	IP          string
+	DryRun      bool
+}
+
+// Run syncs the project's host entries with its Compose services
+func (c *HostsSyncCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("hosts sync", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&c.ComposeFile, "compose", utils.DefaultComposeFile(), "Specifies the Docker Compose file path")
+	cmdFlags.StringVar(&c.HostsFile, "hosts-file", hosts.DefaultPath(), "Specifies the hosts file path")
+	cmdFlags.StringVar(&c.Domain, "domain", hosts.DefaultDomain, "The domain to create hostnames under")
+	cmdFlags.StringVar(&c.IP, "ip", "", "IP address to map the hostnames to. Defaults to the Docker host")
+	cmdFlags.BoolVar(&c.DryRun, "dry-run", false, "Show the entries that would be created, without changing the hosts file")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	conf, err := app.LoadConfig(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	if hosts.Label(conf.Name) == "" {
+		c.Meta.Ui.Error(fmt.Sprintf("A project 'name' is required in %s to create host entries", c.ConfigFile))
+		return 1
+	}
+	services, err := utils.ReadComposeServices(c.ComposeFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	ip := c.IP
+	if ip == "" {
+		if ip, err = dockerHostIP(c.ConfigFile); err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	hostnames := hosts.ServiceHostnames(utils.ProjectNameSafe(conf.Name), c.Domain, services)
+	entries := make([]hosts.Entry, len(hostnames))
+	for i, h := range hostnames {
+		entries[i] = hosts.Entry{IP: ip, Hostname: h}
+		c.Meta.Ui.Output(fmt.Sprintf("%-16s %s", ip, h))
+	}
+	if c.DryRun {
+		return 0
+	}
+
+	f, err := hosts.Load(c.HostsFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	// The project's hostname is the first, the domain the services are under
+	f.Sync(hostnames[0], entries)
+	if err := f.Save(); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *HostsSyncCommand) Help() string {
+	helpText := `
+Usage: parity hosts sync [options]
+
+  Creates a host entry for the project (e.g. myproject.parity.local) and for
+  each service in the Compose file (e.g. web.myproject.parity.local), all
+  pointing at the Docker host. Entries for services that no longer exist
+  are removed.
+
+Options:
+
+  --compose                  Path to the Docker Compose file. Defaults to ./docker-compose.yml.
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --domain                   The domain to create hostnames under. Defaults to 'parity.local'.
+  --dry-run                  Show the entries that would be created, without changing the hosts file.
+  --hosts-file               Path to the hosts file. Defaults to the system hosts file.
+  --ip                       IP address to map the hostnames to, e.g. the 'router' plugin's. Defaults to the Docker host.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *HostsSyncCommand) Synopsis() string {
+	return "Create host entries for each Compose service"
+}
@@ -5,28 +5,58 @@ import (
 	"strings"
 
 	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/hosts"
 	"github.com/mefellows/parity/install"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/utils"
 )
 
 type InstallCommand struct {
-	Meta     config.Meta
-	Dns      bool
-	Hostname string
+	Meta       config.Meta
+	Dns        bool
+	Hostname   string
+	ConfigFile string
+	DryRun     bool
+	Mirror     string
+	Offline    bool
 }
 
 func (c *InstallCommand) Run(args []string) int {
 	cmdFlags := flag.NewFlagSet("install", flag.ContinueOnError)
 	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
 
-	cmdFlags.BoolVar(&c.Dns, "dns", false, "Create a host entry to your Docker environment at 'parity.dev'")
-	cmdFlags.StringVar(&c.Hostname, "hostname", "parity.dev", "Create a host entry to your Docker environment at 'parity.dev'")
+	cmdFlags.BoolVar(&c.Dns, "dns", false, "Create a host entry to your Docker environment at 'parity.local'")
+	cmdFlags.StringVar(&c.Hostname, "hostname", hosts.DefaultDomain, "The host entry to create with '--dns'")
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.BoolVar(&c.DryRun, "dry-run", false, "Show the changes that would be made, without making them")
+	cmdFlags.StringVar(&c.Mirror, "mirror-binary", "", "Install this Parity binary (linux_amd64) as the mirror daemon, instead of the bundled one")
+	cmdFlags.BoolVar(&c.Offline, "offline", false, "Never download the mirror daemon")
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	docker, err := app.LoadDockerEnvironment(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
 	c.Meta.Ui.Output("Installing Parity")
-	install.InstallParity(install.InstallConfig{Dns: c.Dns, DevHost: c.Hostname})
+	defer docker.Close()
+	err = install.InstallParity(install.InstallConfig{
+		Dns:          c.Dns,
+		DevHost:      c.Hostname,
+		Docker:       docker,
+		DryRun:       c.DryRun,
+		MirrorBinary: c.Mirror,
+		Offline:      c.Offline,
+	})
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
 
 	return 0
 }
@@ -35,12 +65,20 @@ func (c *InstallCommand) Help() string {
 	helpText := `
 Usage: parity install [options]
 
-  Install Parity as a local daemon and into the running Docker Machine
+  Install Parity as a local daemon and into the running Docker Machine.
+
+  Each step is checked first and skipped if already in place, so install can
+  be run again to resume a failed install or to upgrade Parity. Completed steps
+  are recorded in ~/.parity/install.json.
 
 Options:
 
-  --dns                      Create a host entry to your Docker environment at 'parity.dev'
-  --hostname                 Specify the host entry for ''--dns'.
+  --config                   Path to the configuration file, used for any 'host' settings. Defaults to ./parity.yml.
+  --dry-run                  Show the changes that would be made, without making them.
+  --dns                      Create a host entry to your Docker environment at 'parity.local'.
+  --hostname                 Specify the host entry for '--dns'. Defaults to 'parity.local'.
+  --mirror-binary            Install this Parity binary (linux_amd64) as the mirror daemon, instead of the bundled one.
+  --offline                  Never download the mirror daemon.
 `
 
 	return strings.TrimSpace(helpText)
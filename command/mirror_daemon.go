@@ -0,0 +1,67 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/sync"
+)
+
+// MirrorDaemonCommand runs the file sync daemon on the Docker host
+type MirrorDaemonCommand struct {
+	Meta    config.Meta
+	Address string
+}
+
+// Run serves the daemon until it fails
+func (c *MirrorDaemonCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("mirror-daemon", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.Address, "address", sync.DefaultDaemonAddress, "The address to listen on")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	tlsConfig, err := (&certs.Certs{Dir: mirror.GetMirrorDir()}).ServerTLSConfig()
+	if err != nil {
+		c.Meta.Ui.Error("Unable to read the daemon's certificates: " + err.Error())
+		return 1
+	}
+	daemon := &sync.Daemon{Address: c.Address, TLSConfig: tlsConfig}
+	if err := daemon.Serve(); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *MirrorDaemonCommand) Help() string {
+	helpText := `
+Usage: parity mirror-daemon [options]
+
+  Runs the file sync daemon that 'parity run' and 'parity sync' send files
+  to. 'parity install' installs Parity on the Docker host and starts the
+  daemon there, so this is rarely run by hand.
+
+  Clients must present a certificate signed by Parity's CA. The daemon's
+  certificates are read from $MIRROR_HOME (default ~/.mirror.d).
+
+Options:
+
+  --address                  The address to listen on. Defaults to 0.0.0.0:8123.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *MirrorDaemonCommand) Synopsis() string {
+	return "Run the file sync daemon on the Docker host"
+}
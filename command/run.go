@@ -9,6 +9,7 @@ import (
 
 	"github.com/mefellows/parity/config"
 	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/snapshot"
 	"github.com/mefellows/parity/utils"
 )
 
@@ -18,6 +19,7 @@ type RunCommand struct {
 	Verbose    bool
 	ConfigFile string
 	X          bool
+	Snapshot   string
 }
 
 // Run Parity
@@ -28,6 +30,7 @@ func (c *RunCommand) Run(args []string) int {
 	cmdFlags.BoolVar(&c.Verbose, "verbose", true, "Enable verbose output")
 	cmdFlags.BoolVar(&c.X, "x", false, "Enable X redirection (Mac OSX Only)")
 	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Enable verbose output")
+	cmdFlags.StringVar(&c.Snapshot, "from-snapshot", "", "Restore a snapshot of the project's volumes before starting")
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -37,7 +40,14 @@ func (c *RunCommand) Run(args []string) int {
 		log.SetOutput(ioutil.Discard)
 	}
 
-	parity := app.New(&config.Config{Ui: c.Meta.Ui, ConfigFile: c.ConfigFile})
+	if c.Snapshot != "" {
+		if err := snapshot.ValidateName(c.Snapshot); err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	parity := app.New(&config.Config{Ui: c.Meta.Ui, ConfigFile: c.ConfigFile, Snapshot: c.Snapshot})
 	parity.Run()
 
 	return 0
@@ -56,6 +66,7 @@ Usage: parity run [options]
 Options:
 
   --config                    Path to the configuration file. Defaults to ./parity.yml.
+  --from-snapshot             Replace the project's volumes with a snapshot (see 'parity snapshot') before starting.
   --verbose                   Enable verbose logging.
 `
 
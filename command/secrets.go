@@ -0,0 +1,442 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/mefellows/parity/config"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/secrets"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/cli"
+)
+
+// SecretsCommand groups the secrets management commands
+type SecretsCommand struct {
+	Meta config.Meta
+}
+
+// Run shows the help for the secrets commands
+func (c *SecretsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// Help text for the command
+func (c *SecretsCommand) Help() string {
+	helpText := `
+Usage: parity secrets <subcommand> [options]
+
+  Manages the secrets in the 'secrets' section of parity.yml, which
+  'parity run' delivers to containers as environment variables or files.
+
+  Secrets are kept encrypted in the project (the 'file' provider, in
+  .parity/secrets.json) or in your home directory (the 'keychain'
+  provider), or read from your environment or a command's output when
+  needed. They are never written to disk unencrypted.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SecretsCommand) Synopsis() string {
+	return "Manage the project's secrets"
+}
+
+// secretsFlags are the options shared by the secrets commands
+type secretsFlags struct {
+	ConfigFile string
+	Provider   string
+}
+
+func (f *secretsFlags) register(cmdFlags *flag.FlagSet) {
+	cmdFlags.StringVar(&f.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&f.Provider, "provider", "", "The secrets provider")
+}
+
+// load reads parity.yml, and finds the provider of a secret: the one given
+// with --provider, the one it's configured with or the default
+func (f *secretsFlags) load(name string) (secrets.Provider, config.SecretConfig, error) {
+	conf, err := app.LoadConfig(f.ConfigFile)
+	if err != nil {
+		return nil, config.SecretConfig{}, err
+	}
+	sc := conf.Secrets[name]
+	if sc.Provider == "" {
+		sc.Provider = secrets.DefaultProvider
+	}
+
+	// Another provider doesn't share the secret's configuration
+	if f.Provider != "" && f.Provider != sc.Provider {
+		sc = config.SecretConfig{Provider: f.Provider}
+	}
+
+	p, err := secrets.NewProvider(sc.Provider, app.NewSecretsContext(conf))
+	return p, sc, err
+}
+
+// SecretsSetCommand saves a secret
+type SecretsSetCommand struct {
+	Meta config.Meta
+	secretsFlags
+}
+
+// Run saves the secret
+func (c *SecretsSetCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("secrets set", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+	c.register(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	if cmdFlags.NArg() < 1 || cmdFlags.NArg() > 2 {
+		c.Meta.Ui.Error("Expected a secret's name, and optionally its value")
+		return 1
+	}
+	name := cmdFlags.Arg(0)
+
+	p, sc, err := c.load(name)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	store, ok := p.(secrets.Store)
+	if !ok {
+		c.Meta.Ui.Error(fmt.Sprintf("Secrets can't be saved with the '%s' provider", sc.Provider))
+		return 1
+	}
+	if err := secrets.Validate(name, sc); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	value, err := c.value(cmdFlags.Args())
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	if sc.From != "" {
+		name = sc.From
+	}
+	if err := store.Set(name, value); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	c.Meta.Ui.Output(fmt.Sprintf("Saved secret '%s' with the '%s' provider", name, sc.Provider))
+
+	return 0
+}
+
+// value reads the secret from the arguments, stdin or a prompt
+func (c *SecretsSetCommand) value(args []string) (string, error) {
+	if len(args) == 2 {
+		return args[1], nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		data, err := ioutil.ReadAll(os.Stdin)
+		return strings.TrimRight(string(data), "\r\n"), err
+	}
+	return c.Meta.Ui.AskSecret(fmt.Sprintf("Value of %s:", args[0]))
+}
+
+// Help text for the command
+func (c *SecretsSetCommand) Help() string {
+	helpText := `
+Usage: parity secrets set [options] NAME [VALUE]
+
+  Encrypts and saves a secret. The value is read from standard input, or
+  prompted for, if not given (which keeps it out of your shell history).
+
+  The 'file' provider saves secrets in .parity/secrets.json (secrets_file
+  in parity.yml), which is safe to commit. The key is created in
+  ~/.parity/secrets/<project>.key; share it with your team, or set it in
+  $PARITY_SECRETS_KEY. The 'keychain' provider saves secrets for you
+  alone, in ~/.parity/keychain.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --provider                 'file' or 'keychain'. Defaults to the secret's provider in parity.yml, or 'file'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SecretsSetCommand) Synopsis() string {
+	return "Save a secret"
+}
+
+// SecretsGetCommand shows a secret
+type SecretsGetCommand struct {
+	Meta config.Meta
+	secretsFlags
+}
+
+// Run shows the secret
+func (c *SecretsGetCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("secrets get", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+	c.register(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	if cmdFlags.NArg() != 1 {
+		c.Meta.Ui.Error("Expected a secret's name")
+		return 1
+	}
+	name := cmdFlags.Arg(0)
+
+	p, sc, err := c.load(name)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	value, err := p.Get(name, sc.From)
+	if err == secrets.ErrNotFound {
+		c.Meta.Ui.Error(fmt.Sprintf("Secret '%s' not found by the '%s' provider", name, sc.Provider))
+		return 1
+	}
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	c.Meta.Ui.Output(value)
+
+	return 0
+}
+
+// Help text for the command
+func (c *SecretsGetCommand) Help() string {
+	helpText := `
+Usage: parity secrets get [options] NAME
+
+  Shows a secret's value, as containers would receive it.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --provider                 Defaults to the secret's provider in parity.yml, or 'file'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SecretsGetCommand) Synopsis() string {
+	return "Show a secret"
+}
+
+// SecretsRmCommand removes a saved secret
+type SecretsRmCommand struct {
+	Meta config.Meta
+	secretsFlags
+}
+
+// Run removes the secret
+func (c *SecretsRmCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("secrets rm", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+	c.register(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	if cmdFlags.NArg() != 1 {
+		c.Meta.Ui.Error("Expected a secret's name")
+		return 1
+	}
+	name := cmdFlags.Arg(0)
+
+	p, sc, err := c.load(name)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	store, ok := p.(secrets.Store)
+	if !ok {
+		c.Meta.Ui.Error(fmt.Sprintf("Secrets can't be removed from the '%s' provider", sc.Provider))
+		return 1
+	}
+	if sc.From != "" {
+		name = sc.From
+	}
+	if err := store.Remove(name); err != nil {
+		if err == secrets.ErrNotFound {
+			err = fmt.Errorf("Secret '%s' not found by the '%s' provider", name, sc.Provider)
+		}
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *SecretsRmCommand) Help() string {
+	helpText := `
+Usage: parity secrets rm [options] NAME
+
+  Removes a saved secret.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --provider                 'file' or 'keychain'. Defaults to the secret's provider in parity.yml, or 'file'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SecretsRmCommand) Synopsis() string {
+	return "Remove a saved secret"
+}
+
+// SecretsListCommand lists the project's secrets
+type SecretsListCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+}
+
+// Run lists the secrets
+func (c *SecretsListCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("secrets list", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	conf, err := app.LoadConfig(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	ctx := app.NewSecretsContext(conf)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPROVIDER\tDELIVERED AS\tSERVICES\tSTATUS")
+	listed := map[string]bool{}
+	for _, name := range sortedSecrets(conf.Secrets) {
+		sc := conf.Secrets[name]
+		if sc.Provider == "" {
+			sc.Provider = secrets.DefaultProvider
+		}
+		delivery := name
+		if sc.As == secrets.AsFile {
+			delivery = secrets.Dir + "/" + strings.ToLower(name)
+			if sc.File != "" {
+				delivery = secrets.Dir + "/" + sc.File
+			}
+		}
+		services := strings.Join(sc.Services, ",")
+		if services == "" {
+			services = "all"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, sc.Provider, delivery, services, secretStatus(name, sc, ctx))
+		if sc.Provider == secrets.DefaultProvider {
+			listed[name] = true
+		}
+	}
+
+	// Secrets saved in the project, that parity.yml doesn't use
+	if store, err := secrets.NewStore(secrets.DefaultProvider, ctx); err == nil {
+		names, _ := store.List()
+		for _, name := range names {
+			if !listed[name] && !usedAsFrom(conf.Secrets, name) {
+				fmt.Fprintf(w, "%s\t%s\t-\t-\tnot in %s\n", name, secrets.DefaultProvider, c.ConfigFile)
+			}
+		}
+	}
+	w.Flush()
+	c.Meta.Ui.Output(strings.TrimSpace(buf.String()))
+
+	return 0
+}
+
+// secretStatus checks that a secret is available, without decrypting it or
+// running commands
+func secretStatus(name string, sc config.SecretConfig, ctx *secrets.Context) string {
+	if err := secrets.Validate(name, sc); err != nil {
+		return "invalid"
+	}
+	p, err := secrets.NewProvider(sc.Provider, ctx)
+	if err != nil {
+		return "invalid"
+	}
+	if sc.From != "" {
+		name = sc.From
+	}
+	switch p := p.(type) {
+	case secrets.Store:
+		names, err := p.List()
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		for _, n := range names {
+			if n == name {
+				return "ok"
+			}
+		}
+		return "missing"
+	case *secrets.EnvProvider:
+		if _, err := p.Get(name, ""); err != nil {
+			return "missing"
+		}
+		return "ok"
+	}
+	return "-"
+}
+
+func sortedSecrets(configs map[string]config.SecretConfig) []string {
+	var names []string
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func usedAsFrom(configs map[string]config.SecretConfig, name string) bool {
+	for _, sc := range configs {
+		if (sc.Provider == "" || sc.Provider == secrets.DefaultProvider) && sc.From == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Help text for the command
+func (c *SecretsListCommand) Help() string {
+	helpText := `
+Usage: parity secrets list [options]
+
+  Lists the secrets in parity.yml, how containers receive them and whether
+  they're available, and any secrets saved in the project that parity.yml
+  doesn't use. Values are never shown, and commands are not run.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SecretsListCommand) Synopsis() string {
+	return "List the project's secrets"
+}
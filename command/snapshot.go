@@ -0,0 +1,350 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/config"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/snapshot"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/cli"
+)
+
+// SnapshotCommand groups the snapshot commands
+type SnapshotCommand struct {
+	Meta config.Meta
+}
+
+// Run shows the help for the snapshot commands
+func (c *SnapshotCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// Help text for the command
+func (c *SnapshotCommand) Help() string {
+	helpText := `
+Usage: parity snapshot <subcommand> [options]
+
+  Saves and restores the named volumes of the project's Compose services,
+  e.g. a database's data, so that you can return to a known state.
+
+  Snapshots are stored in ~/.parity/snapshots/<project>. Use
+  'parity run --from-snapshot <name>' to start the project from one.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SnapshotCommand) Synopsis() string {
+	return "Save and restore the project's volumes"
+}
+
+// snapshotProject reads the project's name from parity.yml, to find its
+// snapshots
+func snapshotProject(configFile string) (string, error) {
+	conf, err := app.LoadConfig(configFile)
+	if err != nil {
+		return "", err
+	}
+	project := utils.ProjectNameSafe(conf.Name)
+	if project == "" {
+		return "", fmt.Errorf("A project 'name' is required in %s", configFile)
+	}
+	return project, nil
+}
+
+// snapshotClient connects to the Docker host in parity.yml
+func snapshotClient(configFile string) (*dockerclient.Client, error) {
+	docker, err := app.LoadDockerEnvironment(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return docker.Client()
+}
+
+// SnapshotSaveCommand saves a snapshot
+type SnapshotSaveCommand struct {
+	Meta        config.Meta
+	ConfigFile  string
+	ComposeFile string
+	Services    string
+	Force       bool
+}
+
+// Run saves the snapshot
+func (c *SnapshotSaveCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("snapshot save", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.StringVar(&c.ComposeFile, "compose-file", utils.DefaultComposeFile(), "The project's Compose file")
+	cmdFlags.StringVar(&c.Services, "services", "", "Comma separated services whose volumes to save")
+	cmdFlags.BoolVar(&c.Force, "force", false, "Replace an existing snapshot")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	if cmdFlags.NArg() != 1 {
+		c.Meta.Ui.Error("Expected a snapshot name")
+		return 1
+	}
+	name := cmdFlags.Arg(0)
+
+	project, err := snapshotProject(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	named, err := utils.ReadComposeNamedVolumes(c.ComposeFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	var services []string
+	if c.Services != "" {
+		services = strings.Split(c.Services, ",")
+	}
+	volumes, err := snapshot.Select(named, services)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	client, err := snapshotClient(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	s, err := snapshot.Save(client, snapshot.NewStore(project), name, project, volumes, c.Force)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	c.Meta.Ui.Output(fmt.Sprintf("Saved snapshot '%s' of %d volume(s) (%s)", s.Name, len(s.Volumes), units.HumanSize(float64(s.Size()))))
+
+	return 0
+}
+
+// Help text for the command
+func (c *SnapshotSaveCommand) Help() string {
+	helpText := `
+Usage: parity snapshot save [options] NAME
+
+  Saves the named volumes of the project's services. Running containers
+  using the volumes are paused while they're saved, so that their files
+  are consistent. Bind mounted directories are not saved.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+  --compose-file             Path to the Compose file. Defaults to ./docker-compose.yml.
+  --services                 Comma separated services whose volumes to save, e.g. 'db,search'. Defaults to all.
+  --force                    Replace an existing snapshot of the same name.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SnapshotSaveCommand) Synopsis() string {
+	return "Save the project's volumes"
+}
+
+// SnapshotRestoreCommand restores a snapshot
+type SnapshotRestoreCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+}
+
+// Run restores the snapshot
+func (c *SnapshotRestoreCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("snapshot restore", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	if cmdFlags.NArg() != 1 {
+		c.Meta.Ui.Error("Expected a snapshot name")
+		return 1
+	}
+
+	project, err := snapshotProject(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	client, err := snapshotClient(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	s, err := snapshot.Restore(client, snapshot.NewStore(project), cmdFlags.Arg(0))
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	c.Meta.Ui.Output(fmt.Sprintf("Restored snapshot '%s' of %s", s.Name, strings.Join(s.Services(), ", ")))
+
+	return 0
+}
+
+// Help text for the command
+func (c *SnapshotRestoreCommand) Help() string {
+	helpText := `
+Usage: parity snapshot restore [options] NAME
+
+  Replaces the snapshot's volumes with their saved contents. Stop the
+  project first, or use 'parity run --from-snapshot NAME', as volumes in
+  use can't be replaced.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SnapshotRestoreCommand) Synopsis() string {
+	return "Restore the project's volumes from a snapshot"
+}
+
+// SnapshotListCommand lists the project's snapshots
+type SnapshotListCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+}
+
+// Run lists the snapshots
+func (c *SnapshotListCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("snapshot list", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	project, err := snapshotProject(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	snapshots, err := snapshot.NewStore(project).List()
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	if len(snapshots) == 0 {
+		c.Meta.Ui.Output("No snapshots, create one with 'parity snapshot save <name>'")
+		return 0
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCREATED\tSERVICES\tVOLUMES\tSIZE")
+	for _, s := range snapshots {
+		var volumes []string
+		for _, v := range s.Volumes {
+			volumes = append(volumes, v.Name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Created.Local().Format(time.RFC822), strings.Join(s.Services(), ","), strings.Join(volumes, ","), units.HumanSize(float64(s.Size())))
+	}
+	w.Flush()
+	c.Meta.Ui.Output(strings.TrimSpace(buf.String()))
+
+	return 0
+}
+
+// Help text for the command
+func (c *SnapshotListCommand) Help() string {
+	helpText := `
+Usage: parity snapshot list [options]
+
+  Lists the project's snapshots, oldest first.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SnapshotListCommand) Synopsis() string {
+	return "List the project's snapshots"
+}
+
+// SnapshotRmCommand removes a snapshot
+type SnapshotRmCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+}
+
+// Run removes the snapshot
+func (c *SnapshotRmCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("snapshot rm", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+	if cmdFlags.NArg() == 0 {
+		c.Meta.Ui.Error("Expected a snapshot name")
+		return 1
+	}
+
+	project, err := snapshotProject(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	store := snapshot.NewStore(project)
+	for _, name := range cmdFlags.Args() {
+		if err := store.Remove(name); err != nil {
+			if err == snapshot.ErrNotFound {
+				err = fmt.Errorf("Snapshot '%s' not found", name)
+			}
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *SnapshotRmCommand) Help() string {
+	helpText := `
+Usage: parity snapshot rm [options] NAME...
+
+  Removes snapshots.
+
+Options:
+
+  --config                   Path to the configuration file. Defaults to ./parity.yml.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SnapshotRmCommand) Synopsis() string {
+	return "Remove snapshots"
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mefellows/parity/config"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/utils"
+)
+
+// SyncCommand contains parameters required to run the Sync plugins
+type SyncCommand struct {
+	Meta       config.Meta
+	ConfigFile string
+	Watch      bool
+	Verify     bool
+	Repair     bool
+}
+
+// Run the Sync plugins
+func (c *SyncCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.BoolVar(&c.Watch, "watch", false, "Keep watching for changes after the initial sync")
+	cmdFlags.BoolVar(&c.Verify, "verify", false, "Compare the Docker host with the local files and report any drift")
+	cmdFlags.BoolVar(&c.Repair, "repair", false, "Repair any drift found during verification, deleting files only on the Docker host")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	parity := app.New(&config.Config{Ui: c.Meta.Ui, ConfigFile: c.ConfigFile})
+
+	if c.Verify {
+		drift, err := parity.Verify(c.Repair)
+		if err != nil {
+			c.Meta.Ui.Error(err.Error())
+			return 1
+		}
+		if drift > 0 && !c.Repair {
+			return 1
+		}
+		return 0
+	}
+
+	opts := app.SyncOptions{
+		Paths: cmdFlags.Args(),
+		Watch: c.Watch,
+		Progress: func(p app.SyncProgress) {
+			c.Meta.Ui.Output(fmt.Sprintf("Synced %s", p))
+		},
+	}
+	if err := parity.Sync(opts); err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Help text for the command
+func (c *SyncCommand) Help() string {
+	helpText := `
+Usage: parity sync [options] [directory...]
+
+  Synchronises files into the Docker host, without running Docker Compose.
+
+  Only the Sync plugins in parity.yml are loaded. By default the configured
+  volumes are synced, or just the given directories if provided. Progress
+  (files, bytes and an estimated time remaining) is reported during the
+  initial sync.
+
+  With --verify, content hashes of every synced file are compared instead,
+  and any missing, modified or extra files are reported. Exits with a
+  non-zero status if drift is found, unless --repair is given.
+
+Options:
+
+  --config                    Path to the configuration file. Defaults to ./parity.yml.
+  --watch                     Keep watching for changes after the initial sync. By default, exits once synced.
+  --verify                    Report any drift between the Docker host and local files.
+  --repair                    Repair any drift found, including deleting files that only exist on the Docker host.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SyncCommand) Synopsis() string {
+	return "Synchronise files into the Docker host"
+}
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/sync"
+)
+
+// SyncStatsCommand shows the metrics of a running sync
+type SyncStatsCommand struct {
+	Meta    config.Meta
+	Address string
+	JSON    bool
+}
+
+// Run the SyncStats command
+func (c *SyncStatsCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("sync stats", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.Address, "address", "127.0.0.1:8124", "Address of the sync metrics endpoint (stats_address in parity.yml)")
+	cmdFlags.BoolVar(&c.JSON, "json", false, "Output the raw metrics as JSON")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Get(fmt.Sprintf("http://%s/stats", c.Address))
+	if err != nil {
+		c.Meta.Ui.Error(fmt.Sprintf("Unable to fetch sync metrics, is 'parity run' or 'parity sync --watch' running? %s", err.Error()))
+		return 1
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil || res.StatusCode != http.StatusOK {
+		c.Meta.Ui.Error(fmt.Sprintf("Unable to fetch sync metrics: %s", res.Status))
+		return 1
+	}
+	if c.JSON {
+		c.Meta.Ui.Output(strings.TrimSpace(string(data)))
+		return 0
+	}
+
+	var stats sync.Stats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		c.Meta.Ui.Error(fmt.Sprintf("Unable to read sync metrics: %s", err.Error()))
+		return 1
+	}
+	c.Meta.Ui.Output(stats.String())
+
+	return 0
+}
+
+// Help text for the command
+func (c *SyncStatsCommand) Help() string {
+	helpText := `
+Usage: parity sync stats [options]
+
+  Shows the throughput and latency of a running sync.
+
+  While watching for changes, the mirror sync plugin serves its metrics
+  on a local HTTP endpoint (127.0.0.1:8124 by default). This includes the
+  number of files and bytes sent, per-file and per-batch latency, errors
+  and the number of changes waiting to be sent.
+
+Options:
+
+  --address                 Address of the sync metrics endpoint.
+  --json                    Output the raw metrics as JSON.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis for the command
+func (c *SyncStatsCommand) Synopsis() string {
+	return "Show sync throughput and latency"
+}
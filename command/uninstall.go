@@ -0,0 +1,69 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/install"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/utils"
+)
+
+type UninstallCommand struct {
+	Meta       config.Meta
+	Hostname   string
+	ConfigFile string
+	DryRun     bool
+}
+
+func (c *UninstallCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Meta.Ui.Output(c.Help()) }
+
+	cmdFlags.StringVar(&c.Hostname, "hostname", hosts.DefaultDomain, "The host entry created by 'parity install --dns'")
+	cmdFlags.StringVar(&c.ConfigFile, "config", utils.DefaultParityConfigurationFile(), "Specifies the Parity configuration file path")
+	cmdFlags.BoolVar(&c.DryRun, "dry-run", false, "Show the changes that would be made, without making them")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	docker, err := app.LoadDockerEnvironment(c.ConfigFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+	defer docker.Close()
+
+	err = install.UninstallParity(install.InstallConfig{Dns: true, DevHost: c.Hostname, Docker: docker, DryRun: c.DryRun})
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func (c *UninstallCommand) Help() string {
+	helpText := `
+Usage: parity uninstall [options]
+
+  Remove Parity from the running Docker Machine, reverting the steps made by
+  'parity install' in reverse order, and remove Parity's entries from the
+  hosts file.
+
+Options:
+
+  --config                   Path to the configuration file, used for any 'host' settings. Defaults to ./parity.yml.
+  --dry-run                  Show the changes that would be made, without making them.
+  --hostname                 The host entry created by 'parity install --dns'.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *UninstallCommand) Synopsis() string {
+	return "Uninstall Parity"
+}
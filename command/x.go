@@ -1,12 +1,20 @@
 package command
 
 import (
+	"encoding/hex"
 	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 
+	"github.com/mefellows/mirror/mirror"
 	"github.com/mefellows/parity/config"
+	app "github.com/mefellows/parity/parity"
 	"github.com/mefellows/parity/run"
 	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/parity/x11"
 )
 
 // XCommand contains parameters required to configure the X Server Proxy
@@ -28,8 +36,38 @@ func (c *XCommand) Run(args []string) int {
 		return 1
 	}
 
+	docker, err := app.LoadDockerEnvironment(c.ParityFile)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
 	c.Meta.Ui.Output("Starting X Proxy")
-	run.XServerProxy(c.Port)
+	xauthority := filepath.Join(mirror.GetHomeDir(), ".parity", "x11", "Xauthority")
+	session, err := run.XServerProxy(docker, c.Port, xauthority)
+	if err != nil {
+		c.Meta.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Meta.Ui.Output(fmt.Sprintf("Run containers with 'DISPLAY=%s'", session.Display))
+	for _, v := range session.Volumes {
+		c.Meta.Ui.Output(fmt.Sprintf("Mount '%s' in containers", v))
+	}
+	if session.Cookie != nil {
+		c.Meta.Ui.Output(fmt.Sprintf("Authenticate with the cookie in %s, e.g. mount it and set XAUTHORITY, or run:", session.Xauthority))
+		c.Meta.Ui.Output(fmt.Sprintf("  xauth add %s %s %s", session.Display, x11.MagicCookie, hex.EncodeToString(session.Cookie)))
+	}
+	if session.Proxy == nil {
+		return 0
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	<-interrupt
+	session.Close()
+	c.Meta.Ui.Output(session.Proxy.Stats().String())
 
 	return 0
 }
@@ -39,11 +77,17 @@ func (c *XCommand) Help() string {
 	helpText := `
 Usage: parity x [options]
 
-	Creates a X Quartz window proxy for any docker container.
+  Shares your X display ($DISPLAY) with Docker containers that aren't run by
+  Parity, e.g. XQuartz on macOS, or Xorg, Xwayland or a TCP display on Linux.
+
+  When containers can't reach the display directly, a proxy listens on the
+  port, only on the network shared with the Docker host, until interrupted.
+  Containers must authenticate to it with the cookie shown.
 
 Options:
 
-  --port		The X Server Proxy listener port. Defaults to 6000 (XQuartz default).
+  --config                   Path to the configuration file, used for any 'host' settings. Defaults to ./parity.yml.
+  --port                     The X Server Proxy listener port, for display number port - 6000. Defaults to 6000.
 `
 
 	return strings.TrimSpace(helpText)
@@ -51,5 +95,5 @@ Options:
 
 // Synopsis for the command
 func (c *XCommand) Synopsis() string {
-	return "Attach to a running Docker process"
+	return "Share the X display with Docker containers"
 }
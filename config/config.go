@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"regexp"
 
-	"github.com/mefellows/parity/log"
-
 	"github.com/mefellows/plugo/plugo"
 	"github.com/mitchellh/cli"
 )
@@ -14,21 +12,21 @@ type Config struct {
 	RawConfig  *plugo.RawConfig
 	ConfigFile string
 	Ui         cli.Ui
+	Snapshot   string // Restored before the project's containers start, see 'parity run --from-snapshot'
 }
 
 type Excludes []regexp.Regexp
 
 func (e *Excludes) String() string {
-	return fmt.Sprintf("%s", *e)
+	return fmt.Sprintf("%v", *e)
 }
 
 func (e *Excludes) Set(value string) error {
 	r, err := regexp.CompilePOSIX(value)
-	if err == nil {
-		*e = append(*e, *r)
-	} else {
-		log.Error("Error:", err.Error())
+	if err != nil {
+		return err
 	}
+	*e = append(*e, *r)
 
 	return nil
 }
@@ -41,4 +39,52 @@ type RootConfig struct {
 	Sync        []plugo.PluginConfig `mapstructure:"sync"`
 	Build       []plugo.PluginConfig `mapstructure:"build"`
 	Shell       []plugo.PluginConfig `mapstructure:"shell"`
+	Host        HostConfig           `mapstructure:"host"`
+	Forwards    []ForwardConfig      `mapstructure:"forwards"`
+
+	Env      map[string]string        `mapstructure:"env"`                      // Set in all services
+	EnvFile  string                   `yaml:"env_file" mapstructure:"env_file"` // Default .env, if it exists
+	Services map[string]ServiceConfig `mapstructure:"services"`                 // Per service settings, by Compose service name
+
+	Secrets     map[string]SecretConfig `mapstructure:"secrets"`                          // By the name containers see
+	SecretsFile string                  `yaml:"secrets_file" mapstructure:"secrets_file"` // Default .parity/secrets.json
+}
+
+// SecretConfig describes where a secret comes from, and how containers
+// receive it
+type SecretConfig struct {
+	Provider string   `yaml:"provider" mapstructure:"provider"` // file (default), keychain, env or command
+	From     string   `yaml:"from" mapstructure:"from"`         // e.g. the environment variable or command, default the secret's name
+	As       string   `yaml:"as" mapstructure:"as"`             // env (default) or file
+	File     string   `yaml:"file" mapstructure:"file"`         // File name in /run/secrets, default the secret's name in lower case
+	Services []string `yaml:"services" mapstructure:"services"` // Default all services
+}
+
+// ServiceConfig configures one of the project's Compose services
+type ServiceConfig struct {
+	Env map[string]string `yaml:"env" mapstructure:"env"` // Takes precedence over the Compose file's environment
+}
+
+// ForwardConfig forwards connections from Listen to Target, e.g. to reach a
+// Compose service's port from the host
+type ForwardConfig struct {
+	Name   string `yaml:"name" mapstructure:"name"`
+	Listen string `yaml:"listen" mapstructure:"listen"` // e.g. 127.0.0.1:5432 or /tmp/app.sock
+	Target string `yaml:"target" mapstructure:"target"` // e.g. container://db:5432, tcp://10.0.0.5:80 or unix:///var/run/app.sock
+}
+
+// HostConfig overrides how Parity connects to the Docker host, for when it
+// can't be detected from the environment, a Docker context or Docker Machine
+type HostConfig struct {
+	Address    string `yaml:"address" mapstructure:"address"`         // Hostname or IP, or a Docker API endpoint (e.g. tcp://10.0.0.5:2376)
+	Machine    string `yaml:"machine" mapstructure:"machine"`         // Name of the Docker Machine to use
+	Context    string `yaml:"context" mapstructure:"context"`         // Name of the Docker context to use
+	CertPath   string `yaml:"cert_path" mapstructure:"cert_path"`     // Directory containing the Docker API TLS certificates
+	SSHUser    string `yaml:"ssh_user" mapstructure:"ssh_user"`       // User to SSH in as (default 'docker')
+	SSHKey     string `yaml:"ssh_key" mapstructure:"ssh_key"`         // Private key to SSH in with
+	SSHPort    int    `yaml:"ssh_port" mapstructure:"ssh_port"`       // Default 22
+	MirrorPort int    `yaml:"mirror_port" mapstructure:"mirror_port"` // Default 8123
+
+	KnownHosts     string `yaml:"ssh_known_hosts" mapstructure:"ssh_known_hosts"`           // Default ~/.parity/known_hosts
+	StrictHostKeys bool   `yaml:"ssh_strict_host_keys" mapstructure:"ssh_strict_host_keys"` // Reject hosts not in ssh_known_hosts, instead of trusting them on first use
 }
@@ -0,0 +1,49 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/utils"
+)
+
+// ComposeRecords creates a record for each running Compose service and its
+// project, e.g. web.myproject.parity.local and myproject.parity.local.
+//
+// Services resolve to hostIP, the Docker host, which is where their ports
+// are published. When Docker runs natively, container addresses are
+// reachable directly, so services resolve to their container instead.
+func ComposeRecords(services []utils.ComposeService, domain string, hostIP net.IP, native bool) map[string]net.IP {
+	records := make(map[string]net.IP)
+	for _, s := range services {
+		project := hosts.Label(s.Project)
+		if project == "" {
+			continue
+		}
+		ip := hostIP
+		if native {
+			if containerIP := net.ParseIP(s.IP()); containerIP != nil {
+				ip = containerIP
+			}
+		}
+		hostnames := hosts.ServiceHostnames(project, domain, []string{s.Service})
+		records[hostnames[0]] = hostIP
+		records[hostnames[1]] = ip
+	}
+	return records
+}
+
+// Refresh replaces the zone's records with those of the Compose services
+// running on the Docker host
+func Refresh(zone *Zone, docker *utils.DockerEnvironment) error {
+	client, err := docker.Client()
+	if err != nil {
+		return err
+	}
+	services, err := utils.RunningComposeServices(client)
+	if err != nil {
+		return err
+	}
+	zone.SetRecords(ComposeRecords(services, zone.Domain, zone.Default, docker.Native))
+	return nil
+}
@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/utils"
+)
+
+func service(project string, name string, ip string) utils.ComposeService {
+	return utils.ComposeService{
+		Project: project,
+		Service: name,
+		Container: dockerclient.APIContainers{Networks: dockerclient.NetworkList{
+			Networks: map[string]dockerclient.ContainerNetwork{"bridge": {IPAddress: ip}},
+		}},
+	}
+}
+
+func TestComposeRecords(t *testing.T) {
+	host := net.ParseIP("192.168.99.100")
+	services := []utils.ComposeService{
+		service("myproject", "web", "172.17.0.2"),
+		service("myproject", "db_1", "172.17.0.3"),
+	}
+
+	records := ComposeRecords(services, "parity.local", host, false)
+	for _, name := range []string{"myproject.parity.local", "web.myproject.parity.local", "db-1.myproject.parity.local"} {
+		if !records[name].Equal(host) {
+			t.Fatalf("Expected %s to resolve to the Docker host, got %s", name, records[name])
+		}
+	}
+
+	records = ComposeRecords(services, "parity.local", host, true)
+	if ip := records["web.myproject.parity.local"]; !ip.Equal(net.ParseIP("172.17.0.2")) {
+		t.Fatalf("Expected the container address when running natively, got %s", ip)
+	}
+	if ip := records["myproject.parity.local"]; !ip.Equal(host) {
+		t.Fatalf("Expected the project to resolve to the Docker host, got %s", ip)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	setup, err := Resolver("darwin", "parity.local", "127.0.0.1:10053")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if setup.File != "/etc/resolver/parity.local" || setup.Content != "nameserver 127.0.0.1\nport 10053\n" {
+		t.Fatalf("Unexpected macOS resolver setup: %+v", setup)
+	}
+
+	setup, _ = Resolver("linux", "parity.local", "127.0.0.1:10053")
+	if !strings.Contains(setup.Content, "DNS=127.0.0.1:10053") || !strings.Contains(setup.Content, "Domains=~parity.local") {
+		t.Fatalf("Unexpected systemd-resolved configuration: %s", setup.Content)
+	}
+	if !strings.Contains(setup.Instructions, "server=/parity.local/127.0.0.1#10053") {
+		t.Fatalf("Expected dnsmasq instructions, got: %s", setup.Instructions)
+	}
+
+	setup, _ = Resolver("windows", "parity.local", "127.0.0.1:10053")
+	if setup.File != "" || !strings.Contains(setup.Instructions, "Add-DnsClientNrptRule") {
+		t.Fatalf("Expected manual Windows instructions, got %+v", setup)
+	}
+
+	if _, err := Resolver("linux", "parity.local", "127.0.0.1"); err == nil {
+		t.Fatalf("Expected an error for an address without a port")
+	}
+}
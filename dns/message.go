@@ -0,0 +1,270 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Record types and classes, see RFC 1035 and RFC 3596
+const (
+	TypeA    uint16 = 1
+	TypeNS   uint16 = 2
+	TypeSOA  uint16 = 6
+	TypeAAAA uint16 = 28
+	TypeANY  uint16 = 255
+
+	ClassIN uint16 = 1
+)
+
+// Response codes
+const (
+	RcodeSuccess        = 0
+	RcodeFormatError    = 1
+	RcodeServerFailure  = 2
+	RcodeNameError      = 3 // NXDOMAIN
+	RcodeNotImplemented = 4
+	RcodeRefused        = 5
+)
+
+const (
+	headerLen    = 12
+	maxUDPLen    = 512
+	maxLabelLen  = 63
+	maxNameLen   = 255
+	maxPointers  = 16
+	flagResponse = 1 << 15
+	flagAuth     = 1 << 10
+	flagTrunc    = 1 << 9
+	flagRecurse  = 1 << 8
+)
+
+var errShortMessage = errors.New("DNS message is too short")
+
+// Header is the fixed header of a DNS message
+type Header struct {
+	ID      uint16
+	Flags   uint16
+	QDCount uint16
+	ANCount uint16
+	NSCount uint16
+	ARCount uint16
+}
+
+// Opcode is the kind of query, 0 being a standard query
+func (h Header) Opcode() int {
+	return int(h.Flags>>11) & 0xF
+}
+
+// Response returns true if the message is a response
+func (h Header) Response() bool {
+	return h.Flags&flagResponse != 0
+}
+
+// Rcode is the response code
+func (h Header) Rcode() int {
+	return int(h.Flags & 0xF)
+}
+
+// Question is a query for records of a type
+type Question struct {
+	Name  string // Fully qualified, lower case and without the trailing '.'
+	Type  uint16
+	Class uint16
+}
+
+// Record is a resource record in a response
+type Record struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// Message is a parsed DNS message. Only the sections Parity needs are
+// kept: queries are expected to carry a single question, and additional
+// records (e.g. EDNS options) are ignored.
+type Message struct {
+	Header    Header
+	Questions []Question
+	Answers   []Record
+	Authority []Record
+}
+
+// ParseMessage decodes the header, questions and answers of a DNS message
+func ParseMessage(data []byte) (*Message, error) {
+	if len(data) < headerLen {
+		return nil, errShortMessage
+	}
+	m := &Message{Header: Header{
+		ID:      binary.BigEndian.Uint16(data[0:]),
+		Flags:   binary.BigEndian.Uint16(data[2:]),
+		QDCount: binary.BigEndian.Uint16(data[4:]),
+		ANCount: binary.BigEndian.Uint16(data[6:]),
+		NSCount: binary.BigEndian.Uint16(data[8:]),
+		ARCount: binary.BigEndian.Uint16(data[10:]),
+	}}
+
+	off := headerLen
+	for i := 0; i < int(m.Header.QDCount); i++ {
+		name, n, err := readName(data, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(data) {
+			return nil, errShortMessage
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(data[off:]),
+			Class: binary.BigEndian.Uint16(data[off+2:]),
+		})
+		off += 4
+	}
+
+	for _, section := range []struct {
+		count   uint16
+		records *[]Record
+	}{{m.Header.ANCount, &m.Answers}, {m.Header.NSCount, &m.Authority}} {
+		for i := 0; i < int(section.count); i++ {
+			name, n, err := readName(data, off)
+			if err != nil {
+				return nil, err
+			}
+			off = n
+			if off+10 > len(data) {
+				return nil, errShortMessage
+			}
+			r := Record{
+				Name:  name,
+				Type:  binary.BigEndian.Uint16(data[off:]),
+				Class: binary.BigEndian.Uint16(data[off+2:]),
+				TTL:   binary.BigEndian.Uint32(data[off+4:]),
+			}
+			length := int(binary.BigEndian.Uint16(data[off+8:]))
+			off += 10
+			if off+length > len(data) {
+				return nil, errShortMessage
+			}
+			r.Data = data[off : off+length]
+			off += length
+			*section.records = append(*section.records, r)
+		}
+	}
+	return m, nil
+}
+
+// Pack encodes the message. Names are written in full, without compression.
+func (m *Message) Pack() ([]byte, error) {
+	buf := make([]byte, headerLen, maxUDPLen)
+	binary.BigEndian.PutUint16(buf[0:], m.Header.ID)
+	binary.BigEndian.PutUint16(buf[2:], m.Header.Flags)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(buf[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(buf[10:], 0)
+
+	var err error
+	for _, q := range m.Questions {
+		if buf, err = appendName(buf, q.Name); err != nil {
+			return nil, err
+		}
+		buf = appendUint16(buf, q.Type)
+		buf = appendUint16(buf, q.Class)
+	}
+	for _, r := range append(append([]Record{}, m.Answers...), m.Authority...) {
+		if buf, err = appendName(buf, r.Name); err != nil {
+			return nil, err
+		}
+		buf = appendUint16(buf, r.Type)
+		buf = appendUint16(buf, r.Class)
+		buf = appendUint32(buf, r.TTL)
+		buf = appendUint16(buf, uint16(len(r.Data)))
+		buf = append(buf, r.Data...)
+	}
+	return buf, nil
+}
+
+// truncate drops the records of a response that doesn't fit in a UDP
+// datagram, setting the TC flag so that the client retries over TCP
+func truncate(m *Message, packed []byte) ([]byte, error) {
+	if len(packed) <= maxUDPLen {
+		return packed, nil
+	}
+	t := &Message{Header: m.Header, Questions: m.Questions}
+	t.Header.Flags |= flagTrunc
+	return t.Pack()
+}
+
+// readName reads a possibly compressed name at off, returning it and the
+// offset following it in data
+func readName(data []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	pointers := 0
+	length := 0
+	for {
+		if off >= len(data) {
+			return "", 0, errShortMessage
+		}
+		l := int(data[off])
+		switch {
+		case l == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), end, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(data) {
+				return "", 0, errShortMessage
+			}
+			if pointers++; pointers > maxPointers {
+				return "", 0, errors.New("DNS name has too many compression pointers")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(data[off:]) & 0x3FFF)
+		case l&0xC0 != 0:
+			return "", 0, fmt.Errorf("DNS name has an unsupported label type %#x", l&0xC0)
+		default:
+			if off+1+l > len(data) {
+				return "", 0, errShortMessage
+			}
+			if length += l + 1; length > maxNameLen {
+				return "", 0, errors.New("DNS name is too long")
+			}
+			labels = append(labels, string(data[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+// appendName encodes name as a sequence of labels
+func appendName(buf []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name)+2 > maxNameLen {
+		return nil, fmt.Errorf("DNS name '%s' is too long", name)
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > maxLabelLen {
+				return nil, fmt.Errorf("DNS name '%s' has an invalid label", name)
+			}
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+	return append(buf, 0), nil
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
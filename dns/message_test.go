@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessage_PackAndParse(t *testing.T) {
+	m := &Message{
+		Header:    Header{ID: 0xBEEF, Flags: flagResponse | flagAuth},
+		Questions: []Question{{Name: "web.myproject.parity.local", Type: TypeA, Class: ClassIN}},
+		Answers:   []Record{{Name: "web.myproject.parity.local", Type: TypeA, Class: ClassIN, TTL: 10, Data: []byte{10, 0, 0, 5}}},
+	}
+	data, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	parsed, err := ParseMessage(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if parsed.Header.ID != 0xBEEF || !parsed.Header.Response() || parsed.Header.ANCount != 1 {
+		t.Fatalf("Expected the header to round trip, got %+v", parsed.Header)
+	}
+	if !reflect.DeepEqual(parsed.Questions, m.Questions) || !reflect.DeepEqual(parsed.Answers, m.Answers) {
+		t.Fatalf("Expected the message to round trip, got %+v", parsed)
+	}
+}
+
+func TestParseMessage_Compression(t *testing.T) {
+	// A question for parity.local, and an answer whose name points at it
+	data := []byte{
+		0, 1, 0x80, 0, 0, 1, 0, 1, 0, 0, 0, 0,
+		6, 'P', 'a', 'r', 'i', 't', 'y', 5, 'l', 'o', 'c', 'a', 'l', 0, 0, 1, 0, 1,
+		0xC0, 12, 0, 1, 0, 1, 0, 0, 0, 10, 0, 4, 127, 0, 0, 1,
+	}
+	m, err := ParseMessage(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if m.Questions[0].Name != "parity.local" || m.Answers[0].Name != "parity.local" {
+		t.Fatalf("Expected names to be lower cased and decompressed, got '%s' and '%s'", m.Questions[0].Name, m.Answers[0].Name)
+	}
+}
+
+func TestParseMessage_Invalid(t *testing.T) {
+	cases := map[string][]byte{
+		"short header":  {0, 1, 0},
+		"short name":    {0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 6, 'p', 'a'},
+		"pointer loop":  {0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xC0, 12, 0, 1, 0, 1},
+		"no type":       {0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 'a', 0, 0},
+		"bad label":     {0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 1, 0, 1},
+		"short answers": {0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1},
+	}
+	for name, data := range cases {
+		if _, err := ParseMessage(data); err == nil {
+			t.Fatalf("Expected an error for a message with a %s", name)
+		}
+	}
+}
+
+func TestMessage_PackInvalidName(t *testing.T) {
+	m := &Message{Questions: []Question{{Name: "a..b", Type: TypeA, Class: ClassIN}}}
+	if _, err := m.Pack(); err == nil {
+		t.Fatalf("Expected an error for an empty label")
+	}
+}
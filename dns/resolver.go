@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+)
+
+// ResolverSetup describes how to configure the operating system to send
+// queries for a domain to Parity's DNS server
+type ResolverSetup struct {
+	// File is the resolver configuration file to create, if the setup can
+	// be automated
+	File    string
+	Content string
+
+	Instructions string
+}
+
+// Resolver returns the resolver setup for domain on an operating system
+// (as runtime.GOOS), for a server listening on addr
+func Resolver(goos string, domain string, addr string) (*ResolverSetup, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DNS server address '%s': %s", addr, err.Error())
+	}
+
+	switch goos {
+	case "darwin":
+		file := filepath.Join("/etc/resolver", domain)
+		return &ResolverSetup{
+			File:    file,
+			Content: fmt.Sprintf("nameserver %s\nport %s\n", host, port),
+			Instructions: fmt.Sprintf(`macOS sends queries for %[1]s to the servers listed in %[2]s.
+
+Create it with 'sudo -E parity dns setup --install', or by hand:
+
+  sudo mkdir -p /etc/resolver
+  printf 'nameserver %[3]s\nport %[4]s\n' | sudo tee %[2]s
+
+Check that it's in use with 'scutil --dns'.`, domain, file, host, port),
+		}, nil
+
+	case "linux":
+		file := fmt.Sprintf("/etc/systemd/resolved.conf.d/parity-%s.conf", domain)
+		return &ResolverSetup{
+			File:    file,
+			Content: fmt.Sprintf("[Resolve]\nDNS=%s\nDomains=~%s\n", addr, domain),
+			Instructions: fmt.Sprintf(`With systemd-resolved (version 246 or later), create %[2]s with
+'sudo -E parity dns setup --install', or by hand:
+
+  [Resolve]
+  DNS=%[3]s
+  Domains=~%[1]s
+
+and restart it with 'sudo systemctl restart systemd-resolved'.
+
+With dnsmasq (e.g. NetworkManager), add this line to its configuration instead:
+
+  server=/%[1]s/%[4]s#%[5]s`, domain, file, addr, host, port),
+		}, nil
+
+	case "windows":
+		instructions := fmt.Sprintf(`Windows can only send queries to DNS servers on port 53. Run the server
+with '--addr %[2]s:53' from an elevated prompt, then add a rule for %[1]s
+from an elevated PowerShell prompt:
+
+  Add-DnsClientNrptRule -Namespace ".%[1]s" -NameServers "%[2]s"`, domain, host)
+		return &ResolverSetup{Instructions: instructions}, nil
+	}
+
+	return &ResolverSetup{
+		Instructions: fmt.Sprintf("Configure your resolver to send queries for %s to %s", domain, addr),
+	}, nil
+}
@@ -0,0 +1,161 @@
+// Package dns is a small, authoritative DNS server for Parity's hostnames
+// (e.g. web.myproject.parity.local), so that new projects and services
+// resolve without editing the hosts file.
+//
+// It only answers for its zone: A and AAAA queries for names under the
+// domain resolve to the Docker host, or to a service's own record, and all
+// other queries are refused.
+package dns
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mefellows/parity/log"
+)
+
+// DefaultAddress is unprivileged, so that the server can run without root
+const DefaultAddress = "127.0.0.1:10053"
+
+// tcpTimeout bounds how long a TCP client may take to send a query
+const tcpTimeout = 10 * time.Second
+
+// Server answers DNS queries for a Zone over UDP and TCP
+type Server struct {
+	Addr string
+	Zone *Zone
+
+	udp  net.PacketConn
+	tcp  net.Listener
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// Start listens on Addr, serving queries in the background until Close is
+// called. Use port 0 to listen on any free port, see UDPAddr.
+func (s *Server) Start() error {
+	if s.Addr == "" {
+		s.Addr = DefaultAddress
+	}
+	udp, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	// Listen for TCP on the same port as UDP, which may have been chosen
+	// by the system
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	s.udp, s.tcp = udp, tcp
+
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// UDPAddr is the address the server is listening on
+func (s *Server) UDPAddr() net.Addr {
+	return s.udp.LocalAddr()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.udp.Close()
+		if e := s.tcp.Close(); err == nil {
+			err = e
+		}
+		s.wg.Wait()
+	})
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		res, err := s.handle(buf[:n], true)
+		if err != nil {
+			log.Debug("Ignoring DNS query from %s: %s", addr, err.Error())
+			continue
+		}
+		s.udp.WriteTo(res, addr)
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	var conns sync.WaitGroup
+	defer conns.Wait()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn answers queries on a TCP connection, each prefixed with its
+// length, until the client closes it
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		res, err := s.handle(query, false)
+		if err != nil {
+			log.Debug("Ignoring DNS query from %s: %s", conn.RemoteAddr(), err.Error())
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(res))); err != nil {
+			return
+		}
+		if _, err := conn.Write(res); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a query. Queries that can't be parsed are dropped, as
+// there is nothing meaningful to respond to.
+func (s *Server) handle(data []byte, udp bool) ([]byte, error) {
+	query, err := ParseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	res := s.Zone.Answer(query)
+	if len(res.Questions) == 1 {
+		log.Trace("DNS %s (type %d): rcode %d, %d answers", res.Questions[0].Name, res.Questions[0].Type, res.Header.Rcode(), len(res.Answers))
+	}
+	packed, err := res.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if udp {
+		return truncate(res, packed)
+	}
+	return packed, nil
+}
@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func testZone() *Zone {
+	z := NewZone("parity.local", net.ParseIP("192.168.99.100"))
+	z.SetRecords(map[string]net.IP{
+		"web.myproject.parity.local": net.ParseIP("172.17.0.2"),
+		"v6.myproject.parity.local":  net.ParseIP("fd00::2"),
+	})
+	return z
+}
+
+func query(name string, qtype uint16) []byte {
+	data, _ := (&Message{
+		Header:    Header{ID: 42, Flags: flagRecurse},
+		Questions: []Question{{Name: name, Type: qtype, Class: ClassIN}},
+	}).Pack()
+	return data
+}
+
+func queryUDP(t *testing.T, s *Server, name string, qtype uint16) *Message {
+	conn, err := net.Dial("udp", s.UDPAddr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %s", err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(query(name, qtype))
+
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("No response: %s", err.Error())
+	}
+	m, err := ParseMessage(buf[:n])
+	if err != nil {
+		t.Fatalf("Unable to parse response: %s", err.Error())
+	}
+	if m.Header.ID != 42 || !m.Header.Response() {
+		t.Fatalf("Expected a response to query 42, got %+v", m.Header)
+	}
+	return m
+}
+
+func TestServer_UDP(t *testing.T) {
+	s := &Server{Addr: "127.0.0.1:0", Zone: testZone()}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Unable to start DNS server: %s", err.Error())
+	}
+	defer s.Close()
+
+	cases := []struct {
+		name     string
+		qtype    uint16
+		rcode    int
+		expected net.IP
+	}{
+		{"web.myproject.parity.local", TypeA, RcodeSuccess, net.ParseIP("172.17.0.2")},
+		{"WEB.MyProject.Parity.Local", TypeA, RcodeSuccess, net.ParseIP("172.17.0.2")},
+		{"parity.local", TypeA, RcodeSuccess, net.ParseIP("192.168.99.100")},
+		{"api.other.parity.local", TypeA, RcodeSuccess, net.ParseIP("192.168.99.100")},
+		{"v6.myproject.parity.local", TypeAAAA, RcodeSuccess, net.ParseIP("fd00::2")},
+		{"web.myproject.parity.local", TypeAAAA, RcodeSuccess, nil},
+		{"example.com", TypeA, RcodeRefused, nil},
+		{"notparity.local", TypeA, RcodeRefused, nil},
+	}
+	for _, c := range cases {
+		res := queryUDP(t, s, c.name, c.qtype)
+		if res.Header.Rcode() != c.rcode {
+			t.Fatalf("Expected rcode %d for %s, got %d", c.rcode, c.name, res.Header.Rcode())
+		}
+		if c.expected == nil {
+			if len(res.Answers) != 0 {
+				t.Fatalf("Expected no answers for %s, got %v", c.name, res.Answers)
+			}
+			continue
+		}
+		if len(res.Answers) != 1 || !net.IP(res.Answers[0].Data).Equal(c.expected) {
+			t.Fatalf("Expected %s to resolve to %s, got %v", c.name, c.expected, res.Answers)
+		}
+		if res.Answers[0].TTL != DefaultTTL || res.Header.Flags&flagAuth == 0 {
+			t.Fatalf("Expected an authoritative answer with a TTL of %d", DefaultTTL)
+		}
+	}
+}
+
+func TestServer_NXDomain(t *testing.T) {
+	// Without a default address, only names with records exist
+	z := testZone()
+	z.Default = nil
+	s := &Server{Addr: "127.0.0.1:0", Zone: z}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Unable to start DNS server: %s", err.Error())
+	}
+	defer s.Close()
+
+	res := queryUDP(t, s, "missing.parity.local", TypeA)
+	if res.Header.Rcode() != RcodeNameError {
+		t.Fatalf("Expected NXDOMAIN, got %d", res.Header.Rcode())
+	}
+	if len(res.Authority) != 1 || res.Authority[0].Type != TypeSOA {
+		t.Fatalf("Expected the SOA record in the authority section, got %v", res.Authority)
+	}
+}
+
+func TestServer_TCP(t *testing.T) {
+	s := &Server{Addr: "127.0.0.1:0", Zone: testZone()}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Unable to start DNS server: %s", err.Error())
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.UDPAddr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %s", err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Several queries can be sent on one connection
+	for i := 0; i < 2; i++ {
+		q := query("web.myproject.parity.local", TypeA)
+		binary.Write(conn, binary.BigEndian, uint16(len(q)))
+		conn.Write(q)
+
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			t.Fatalf("No response: %s", err.Error())
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("Short response: %s", err.Error())
+		}
+		res, err := ParseMessage(buf)
+		if err != nil {
+			t.Fatalf("Unable to parse response: %s", err.Error())
+		}
+		if len(res.Answers) != 1 || !net.IP(res.Answers[0].Data).Equal(net.ParseIP("172.17.0.2")) {
+			t.Fatalf("Expected an answer for web.myproject.parity.local, got %v", res.Answers)
+		}
+	}
+}
+
+func TestZone_AnswerInvalidQueries(t *testing.T) {
+	z := testZone()
+	cases := map[string]struct {
+		query *Message
+		rcode int
+	}{
+		"response":           {&Message{Header: Header{Flags: flagResponse}, Questions: []Question{{Name: "parity.local", Type: TypeA, Class: ClassIN}}}, RcodeFormatError},
+		"no questions":       {&Message{}, RcodeFormatError},
+		"inverse query":      {&Message{Header: Header{Flags: 1 << 11}}, RcodeNotImplemented},
+		"chaos class":        {&Message{Questions: []Question{{Name: "parity.local", Type: TypeA, Class: 3}}}, RcodeRefused},
+		"multiple questions": {&Message{Questions: []Question{{Name: "a.parity.local"}, {Name: "b.parity.local"}}}, RcodeFormatError},
+	}
+	for name, c := range cases {
+		if res := z.Answer(c.query); res.Header.Rcode() != c.rcode {
+			t.Fatalf("Expected rcode %d for a %s, got %d", c.rcode, name, res.Header.Rcode())
+		}
+	}
+}
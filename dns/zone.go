@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/mefellows/parity/hosts"
+)
+
+// DefaultTTL is short, as records change as projects start and stop
+const DefaultTTL = 10
+
+// Zone holds the records of a domain, e.g. parity.local. Names under the
+// domain without a record of their own resolve to Default, so that any
+// hostname under the domain reaches the Docker host.
+type Zone struct {
+	Domain  string
+	Default net.IP
+	TTL     uint32
+
+	mutex   sync.RWMutex
+	records map[string]net.IP
+}
+
+// NewZone creates a zone answering for domain with ip
+func NewZone(domain string, ip net.IP) *Zone {
+	return &Zone{
+		Domain:  strings.ToLower(strings.TrimSuffix(domain, ".")),
+		Default: ip,
+		TTL:     DefaultTTL,
+		records: make(map[string]net.IP),
+	}
+}
+
+// SetRecords replaces the zone's records, keyed by hostname
+func (z *Zone) SetRecords(records map[string]net.IP) {
+	r := make(map[string]net.IP, len(records))
+	for name, ip := range records {
+		r[strings.ToLower(strings.TrimSuffix(name, "."))] = ip
+	}
+	z.mutex.Lock()
+	z.records = r
+	z.mutex.Unlock()
+}
+
+// Records returns a copy of the zone's records
+func (z *Zone) Records() map[string]net.IP {
+	z.mutex.RLock()
+	defer z.mutex.RUnlock()
+	r := make(map[string]net.IP, len(z.records))
+	for name, ip := range z.records {
+		r[name] = ip
+	}
+	return r
+}
+
+// Lookup returns the address of name, and whether name is in the zone at all
+func (z *Zone) Lookup(name string) (net.IP, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if !hosts.InDomain(name, z.Domain) {
+		return nil, false
+	}
+	z.mutex.RLock()
+	ip, ok := z.records[name]
+	z.mutex.RUnlock()
+	if ok {
+		return ip, true
+	}
+	return z.Default, true
+}
+
+// Answer builds the response to a query
+func (z *Zone) Answer(query *Message) *Message {
+	res := &Message{Header: Header{
+		ID:    query.Header.ID,
+		Flags: flagResponse | uint16(query.Header.Opcode())<<11 | query.Header.Flags&flagRecurse,
+	}}
+	rcode := func(code int) *Message {
+		res.Header.Flags |= uint16(code)
+		return res
+	}
+
+	if query.Header.Response() {
+		return rcode(RcodeFormatError)
+	}
+	if query.Header.Opcode() != 0 {
+		return rcode(RcodeNotImplemented)
+	}
+	if len(query.Questions) != 1 {
+		return rcode(RcodeFormatError)
+	}
+
+	q := query.Questions[0]
+	res.Questions = query.Questions
+	ip, ok := z.Lookup(q.Name)
+	if !ok || q.Class != ClassIN {
+		return rcode(RcodeRefused)
+	}
+	res.Header.Flags |= flagAuth
+	if ip == nil {
+		res.Authority = []Record{z.soa()}
+		return rcode(RcodeNameError)
+	}
+
+	switch {
+	case ip.To4() != nil && (q.Type == TypeA || q.Type == TypeANY):
+		res.Answers = []Record{{Name: q.Name, Type: TypeA, Class: ClassIN, TTL: z.TTL, Data: ip.To4()}}
+	case ip.To4() == nil && (q.Type == TypeAAAA || q.Type == TypeANY):
+		res.Answers = []Record{{Name: q.Name, Type: TypeAAAA, Class: ClassIN, TTL: z.TTL, Data: ip.To16()}}
+	case q.Type == TypeSOA && q.Name == z.Domain:
+		res.Answers = []Record{z.soa()}
+	default:
+		// The name exists, but has no records of this type
+		res.Authority = []Record{z.soa()}
+	}
+	return res
+}
+
+// soa is the zone's start of authority, which resolvers use to cache
+// negative answers
+func (z *Zone) soa() Record {
+	var data []byte
+	data, _ = appendName(data, "ns."+z.Domain)
+	data, _ = appendName(data, "hostmaster."+z.Domain)
+	data = appendUint32(data, 1)     // Serial
+	data = appendUint32(data, 3600)  // Refresh
+	data = appendUint32(data, 600)   // Retry
+	data = appendUint32(data, 86400) // Expire
+	data = appendUint32(data, z.TTL) // Minimum (negative caching) TTL
+	return Record{Name: z.Domain, Type: TypeSOA, Class: ClassIN, TTL: z.TTL, Data: data}
+}
@@ -0,0 +1,367 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/libcompose/docker"
+	"github.com/docker/libcompose/project"
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/hosts"
+	app "github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/sync"
+	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/parity/version"
+	"github.com/mefellows/plugo/plugo"
+)
+
+// minAPIVersion is the oldest Docker API version Parity is tested against
+const minAPIVersion = "1.21"
+
+// mirrorVersionFile is where 'parity install' records the version of the
+// mirror daemon on the Docker host
+const mirrorVersionFile = "/var/lib/boot2docker/parity/mirror.version"
+
+// certExpiryWarning is how long before a certificate expires to warn about it
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// Clock skew thresholds between this machine and the Docker host. Skew
+// breaks TLS and makes the mirror daemon sync the wrong files.
+const (
+	clockSkewWarning = 5 * time.Second
+	clockSkewFailure = time.Minute
+)
+
+// Disk usage thresholds for the Docker host, in percent
+const (
+	diskWarning = 85
+	diskFailure = 95
+)
+
+// apiTimeout bounds each request to the Docker API
+const apiTimeout = 10 * time.Second
+
+func (d *Doctor) checkConfig() Result {
+	if _, err := os.Stat(d.ConfigFile); os.IsNotExist(err) {
+		return result(CheckConfig, Warn, "Run 'parity init' to create one", "%s not found", d.ConfigFile)
+	}
+	c := &config.RootConfig{}
+	if err := (&plugo.ConfigLoader{}).LoadFromFile(d.ConfigFile, &c); err != nil {
+		return result(CheckConfig, Fail, "Check the YAML syntax of "+d.ConfigFile, "Unable to read %s: %s", d.ConfigFile, err.Error())
+	}
+	d.config = c
+
+	if errs := app.ValidateConfig(c); len(errs) > 0 {
+		problems := make([]string, len(errs))
+		for i, err := range errs {
+			problems[i] = err.Error()
+		}
+		return result(CheckConfig, Fail, "See the README for the available plugins and their settings", "%s", strings.Join(problems, "; "))
+	}
+	if c.Name == "" {
+		return result(CheckConfig, Warn, "Add a 'name' to "+d.ConfigFile, "No project name is set")
+	}
+	return result(CheckConfig, Pass, "", "%s is valid (project '%s')", d.ConfigFile, c.Name)
+}
+
+func (d *Doctor) checkCompose() Result {
+	if _, err := os.Stat(d.ComposeFile); os.IsNotExist(err) {
+		return result(CheckCompose, Warn, "Run 'parity init' to create one", "%s not found", d.ComposeFile)
+	}
+	p, err := docker.NewProject(&docker.Context{
+		Context: project.Context{
+			ComposeFiles: []string{d.ComposeFile},
+			ProjectName:  "parity-doctor",
+		},
+	})
+	if err != nil {
+		return result(CheckCompose, Fail, "Check the file with 'docker-compose config'", "Unable to parse %s: %s", d.ComposeFile, err.Error())
+	}
+	return result(CheckCompose, Pass, "", "%s defines %d service(s)", d.ComposeFile, len(p.Configs))
+}
+
+func (d *Doctor) checkDockerHost() Result {
+	if d.Docker == nil {
+		host := config.HostConfig{}
+		if d.config != nil {
+			host = d.config.Host
+		}
+		docker, err := utils.ResolveDockerEnvironment(host)
+		if err != nil {
+			return result(CheckDockerHost, Fail, "Check the 'host' settings in parity.yml, DOCKER_HOST or your Docker context", "%s", err.Error())
+		}
+		d.Docker = docker
+	}
+	if d.Docker.Native {
+		return result(CheckDockerHost, Pass, "", "Docker is running natively (%s)", d.endpoint())
+	}
+	return result(CheckDockerHost, Pass, "", "%s (%s)", d.Docker.Host, d.endpoint())
+}
+
+func (d *Doctor) checkDockerAPI() Result {
+	client, err := d.Docker.Client()
+	if err != nil {
+		return result(CheckDockerAPI, Fail, d.dockerHint(), "Unable to create a Docker client for %s: %s", d.endpoint(), err.Error())
+	}
+	client.HTTPClient.Timeout = apiTimeout
+	env, err := client.Version()
+	if err != nil {
+		return result(CheckDockerAPI, Fail, d.dockerHint(), "Unable to connect to Docker at %s: %s", d.endpoint(), err.Error())
+	}
+
+	api := env.Get("ApiVersion")
+	if compareVersions(api, minAPIVersion) < 0 {
+		return result(CheckDockerAPI, Warn, "Upgrade Docker", "Docker %s (API %s) is older than API %s", env.Get("Version"), api, minAPIVersion)
+	}
+	return result(CheckDockerAPI, Pass, "", "Docker %s (API %s)", env.Get("Version"), api)
+}
+
+func (d *Doctor) dockerHint() string {
+	if d.Docker.Machine != "" {
+		return fmt.Sprintf("Is Docker running? Try 'docker-machine start %s'", d.Docker.Machine)
+	}
+	return "Is Docker running? Check DOCKER_HOST or the 'host' settings in parity.yml"
+}
+
+func (d *Doctor) checkDockerTLS() Result {
+	endpoint := d.endpoint()
+	if !strings.HasPrefix(endpoint, "tcp://") {
+		return result(CheckDockerTLS, Pass, "", "Not required for %s", endpoint)
+	}
+	if !d.Docker.TLSVerify {
+		return result(CheckDockerTLS, Warn, "Set DOCKER_TLS_VERIFY=1 and DOCKER_CERT_PATH", "The Docker API at %s is not verified with TLS", endpoint)
+	}
+
+	hint := "Regenerate the certificates, e.g. 'docker-machine regenerate-certs'"
+	expiry, err := certs.VerifyChain(filepath.Join(d.Docker.CertPath, "ca.pem"), filepath.Join(d.Docker.CertPath, "cert.pem"))
+	if err != nil {
+		return result(CheckDockerTLS, Fail, hint, "%s", err.Error())
+	}
+	return expiryResult(CheckDockerTLS, hint, d.Docker.CertPath, expiry)
+}
+
+func (d *Doctor) checkClock() Result {
+	client, err := d.Docker.Client()
+	if err != nil {
+		return result(CheckClock, Skip, "", "%s", err.Error())
+	}
+	client.HTTPClient.Timeout = apiTimeout
+	info, err := client.Info()
+	if err != nil {
+		return result(CheckClock, Fail, d.dockerHint(), "Unable to get the Docker host's time: %s", err.Error())
+	}
+	remote, err := time.Parse(time.RFC3339Nano, info.SystemTime)
+	if err != nil {
+		return result(CheckClock, Warn, "", "Unable to read the Docker host's time '%s'", info.SystemTime)
+	}
+	return clockResult(time.Since(remote))
+}
+
+// clockResult grades the difference between this machine's clock and the
+// Docker host's
+func clockResult(skew time.Duration) Result {
+	if skew < 0 {
+		skew = -skew
+	}
+	skew = skew.Truncate(time.Millisecond)
+	hint := "Restart the Docker host to resync its clock, e.g. 'docker-machine restart'"
+	switch {
+	case skew >= clockSkewFailure:
+		return result(CheckClock, Fail, hint, "The Docker host's clock is %s out", skew)
+	case skew >= clockSkewWarning:
+		return result(CheckClock, Warn, hint, "The Docker host's clock is %s out", skew)
+	}
+	return result(CheckClock, Pass, "", "Within %s", clockSkewWarning)
+}
+
+func (d *Doctor) checkSSH() Result {
+	if err := d.Docker.Run("true", utils.CommandOptions{}); err != nil {
+		return result(CheckSSH, Fail, fmt.Sprintf("Check that %s can SSH in with %s", d.Docker.SSHUser, d.Docker.SSHKey),
+			"Unable to SSH into %s: %s", d.Docker.SSHAddress(), err.Error())
+	}
+	return result(CheckSSH, Pass, "", "%s@%s", d.Docker.SSHUser, d.Docker.SSHAddress())
+}
+
+func (d *Doctor) checkMirrorCerts() Result {
+	hint := "Run 'parity certs rotate'"
+	if !d.Certs.Exists() {
+		return result(CheckMirrorCerts, Fail, "Run 'parity install'", "No certificates in %s", d.Certs.Dir)
+	}
+	expiry, err := d.Certs.Verify()
+	if err != nil {
+		return result(CheckMirrorCerts, Fail, hint, "%s", err.Error())
+	}
+	return expiryResult(CheckMirrorCerts, hint, d.Certs.Dir, expiry)
+}
+
+// expiryResult warns if certificates that are otherwise valid expire soon
+func expiryResult(name string, hint string, dir string, expiry time.Time) Result {
+	if time.Until(expiry) < certExpiryWarning {
+		return result(name, Warn, hint, "The certificates in %s expire on %s", dir, expiry.Format("2006-01-02"))
+	}
+	return result(name, Pass, "", "Valid until %s", expiry.Format("2006-01-02"))
+}
+
+func (d *Doctor) checkMirror() Result {
+	v, err := sync.DaemonVersion(d.Docker.MirrorAddress())
+	if err != nil {
+		return result(CheckMirror, Fail, "Run 'parity install' to (re)start the mirror daemon", "%s", err.Error())
+	}
+	installed := ""
+	if out, err := d.Docker.RunCommandAndReturn("cat " + mirrorVersionFile); err == nil {
+		if fields := strings.Fields(out); len(fields) > 0 {
+			installed = fields[0]
+		}
+	}
+	return mirrorResult(d.Docker.MirrorAddress(), v, installed)
+}
+
+// mirrorResult grades the running mirror daemon's version, given the
+// version 'parity install' recorded on the Docker host (if any)
+func mirrorResult(address string, v *sync.VersionResponse, installed string) Result {
+	hint := "Run 'parity install' to upgrade it"
+	switch {
+	case v.Protocol == 0 && installed != "":
+		// Installed, but the daemon still running is from an older install
+		return result(CheckMirror, Warn, "Restart the Docker host to start the installed daemon, e.g. 'docker-machine restart'",
+			"The daemon running at %s is not the installed one (Parity %s)", address, installed)
+	case v.Protocol == 0:
+		return result(CheckMirror, Warn, "Run 'parity install' to replace it",
+			"The daemon running at %s is not Parity's, so deltas, batching and remote hashing are unavailable", address)
+	case v.Protocol != sync.ProtocolVersion:
+		return result(CheckMirror, Fail, hint, "Mirror daemon %s speaks protocol %d, Parity requires %d", v.Release, v.Protocol, sync.ProtocolVersion)
+	case v.Release != version.Version:
+		return result(CheckMirror, Warn, hint, "Mirror daemon %s is running, this is Parity %s", v.Release, version.Version)
+	}
+	return result(CheckMirror, Pass, "", "Mirror daemon %s at %s", v.Release, address)
+}
+
+func (d *Doctor) checkSharedFolders() Result {
+	if shares := d.Docker.FindSharedFolders(); len(shares) > 0 {
+		return result(CheckSharedFolder, Warn, "Run 'parity install' to unmount them",
+			"VirtualBox shares %s will hide synced files", strings.Join(shares, ", "))
+	}
+	return result(CheckSharedFolder, Pass, "", "No VirtualBox shares mounted")
+}
+
+func (d *Doctor) checkDisk() Result {
+	out, err := d.Docker.RunCommandAndReturn("df -P /var/lib/docker | tail -n 1")
+	if err != nil {
+		return result(CheckDisk, Warn, "", "Unable to check free space: %s", err.Error())
+	}
+	used, free, err := parseDf(out)
+	if err != nil {
+		return result(CheckDisk, Warn, "", "%s", err.Error())
+	}
+	return diskResult(used, free)
+}
+
+// diskResult grades the disk usage of the Docker host
+func diskResult(used int, free int64) Result {
+	hint := "Remove unused containers and images with 'parity cleanup'"
+	message := fmt.Sprintf("%d%% used, %s free", used, humanBytes(free))
+	switch {
+	case used >= diskFailure:
+		return result(CheckDisk, Fail, hint, "%s", message)
+	case used >= diskWarning:
+		return result(CheckDisk, Warn, hint, "%s", message)
+	}
+	return result(CheckDisk, Pass, "", "%s", message)
+}
+
+// parseDf reads the percentage used and bytes free from a line of 'df -P'
+// output, e.g. "/dev/sda1 18382728 1337420 16085956 8% /mnt/sda1"
+func parseDf(line string) (used int, free int64, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return 0, 0, fmt.Errorf("Unable to read disk usage from '%s'", strings.TrimSpace(line))
+	}
+	if used, err = strconv.Atoi(strings.TrimSuffix(fields[4], "%")); err != nil {
+		return 0, 0, fmt.Errorf("Unable to read disk usage from '%s'", strings.TrimSpace(line))
+	}
+	blocks, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Unable to read disk usage from '%s'", strings.TrimSpace(line))
+	}
+	return used, blocks * 1024, nil
+}
+
+// humanBytes formats a size in bytes, e.g. 1.5GB
+func humanBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", size, units[i])
+}
+
+func (d *Doctor) checkHosts() Result {
+	host := d.Docker.Host
+	if d.Docker.Native || host == "" {
+		host = "127.0.0.1"
+	}
+	ip, err := hosts.ResolveIP(host)
+	if err != nil {
+		return result(CheckHosts, Warn, "", "%s", err.Error())
+	}
+	hint := "Run 'sudo -E parity hosts add " + d.Hostname + "'"
+
+	file := d.HostsFile
+	if file == "" {
+		file = hosts.DefaultPath()
+	}
+	f, err := hosts.Load(file)
+	if err != nil {
+		return result(CheckHosts, Warn, "", "%s", err.Error())
+	}
+
+	actual, ok := f.Lookup(d.Hostname)
+	switch {
+	case !ok:
+		return result(CheckHosts, Warn, hint, "No host entry for %s", d.Hostname)
+	case actual != ip:
+		return result(CheckHosts, Fail, hint, "%s points at %s, not the Docker host %s", d.Hostname, actual, ip)
+	}
+	return result(CheckHosts, Pass, "", "%s -> %s", d.Hostname, ip)
+}
+
+// endpoint is the Docker API endpoint, for display
+func (d *Doctor) endpoint() string {
+	if d.Docker.Endpoint == "" {
+		return "unix:///var/run/docker.sock"
+	}
+	return d.Docker.Endpoint
+}
+
+// compareVersions compares dotted version numbers such as API versions,
+// returning -1, 0 or 1. Unparseable parts compare as 0.
+func compareVersions(a string, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
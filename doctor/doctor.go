@@ -0,0 +1,183 @@
+// Package doctor diagnoses problems with Parity's environment: the
+// configuration, the Docker host, the mirror daemon and the local machine.
+package doctor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Result is the outcome of a single check, with a hint on how to fix it
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// OK returns true if the check passed, possibly with a warning
+func (r Result) OK() bool {
+	return r.Status == Pass || r.Status == Warn
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Results  []Result `json:"results"`
+	Passed   int      `json:"passed"`
+	Warnings int      `json:"warnings"`
+	Failures int      `json:"failures"`
+	Skipped  int      `json:"skipped"`
+}
+
+// Add records the result of a check, returning it
+func (r *Report) Add(res Result) Result {
+	r.Results = append(r.Results, res)
+	switch res.Status {
+	case Pass:
+		r.Passed++
+	case Warn:
+		r.Warnings++
+	case Fail:
+		r.Failures++
+	case Skip:
+		r.Skipped++
+	}
+	return res
+}
+
+// skip records checks that can't be run, e.g. because the Docker host
+// isn't reachable
+func (r *Report) skip(reason string, names ...string) {
+	for _, name := range names {
+		r.Add(Result{Name: name, Status: Skip, Message: reason})
+	}
+}
+
+// Failed returns true if any check failed
+func (r *Report) Failed() bool {
+	return r.Failures > 0
+}
+
+var statusColours = map[Status]log.Colour{
+	Pass: log.GREEN,
+	Warn: log.YELLOW,
+	Fail: log.RED,
+	Skip: log.CYAN,
+}
+
+// String formats the report for the terminal
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	width := 0
+	for _, res := range r.Results {
+		if len(res.Name) > width {
+			width = len(res.Name)
+		}
+	}
+	for _, res := range r.Results {
+		status := log.Colorize(statusColours[res.Status], fmt.Sprintf("[%s]", res.Status))
+		fmt.Fprintf(&buf, "%s %-*s  %s\n", status, width, res.Name, res.Message)
+		if res.Hint != "" && res.Status != Pass {
+			fmt.Fprintf(&buf, "       %-*s  %s\n", width, "", res.Hint)
+		}
+	}
+	fmt.Fprintf(&buf, "\n%d passed, %d warnings, %d failed, %d skipped", r.Passed, r.Warnings, r.Failures, r.Skipped)
+	return buf.String()
+}
+
+// Doctor runs each check against the environment
+type Doctor struct {
+	ConfigFile  string
+	ComposeFile string
+
+	// Hostname is the host entry expected to point at the Docker host
+	Hostname string
+
+	// HostsFile defaults to the system hosts file
+	HostsFile string
+
+	// Certs are Parity's certificates for the mirror daemon
+	Certs *certs.Certs
+
+	// Docker is resolved from ConfigFile if not set
+	Docker *utils.DockerEnvironment
+
+	config *config.RootConfig
+}
+
+// Names of the checks, in the order they are run
+const (
+	CheckConfig       = "parity.yml"
+	CheckCompose      = "Compose file"
+	CheckDockerHost   = "Docker host"
+	CheckDockerAPI    = "Docker API"
+	CheckDockerTLS    = "Docker TLS"
+	CheckClock        = "Clock skew"
+	CheckSSH          = "SSH"
+	CheckMirrorCerts  = "Mirror certificates"
+	CheckMirror       = "Mirror daemon"
+	CheckSharedFolder = "Shared folders"
+	CheckDisk         = "Disk space"
+	CheckHosts        = "Host entry"
+)
+
+// Run runs all checks. Checks that depend on a failed check are skipped.
+func (d *Doctor) Run() *Report {
+	r := &Report{}
+	if d.Certs == nil {
+		d.Certs = certs.New()
+	}
+
+	r.Add(d.checkConfig())
+	r.Add(d.checkCompose())
+	if !r.Add(d.checkDockerHost()).OK() {
+		r.skip("The Docker host could not be found", CheckDockerAPI, CheckDockerTLS, CheckClock, CheckSSH,
+			CheckMirrorCerts, CheckMirror, CheckSharedFolder, CheckDisk, CheckHosts)
+		return r
+	}
+
+	if r.Add(d.checkDockerAPI()).OK() {
+		r.Add(d.checkDockerTLS())
+		r.Add(d.checkClock())
+	} else {
+		r.Add(d.checkDockerTLS())
+		r.skip("The Docker API is not reachable", CheckClock)
+	}
+
+	if d.Docker.Native {
+		r.skip("Docker is running natively, there is no VM", CheckSSH, CheckMirrorCerts, CheckMirror, CheckSharedFolder, CheckDisk)
+	} else {
+		ssh := r.Add(d.checkSSH())
+		r.Add(d.checkMirrorCerts())
+		r.Add(d.checkMirror())
+		if ssh.OK() {
+			r.Add(d.checkSharedFolders())
+			r.Add(d.checkDisk())
+		} else {
+			r.skip("Unable to SSH into the Docker host", CheckSharedFolder, CheckDisk)
+		}
+	}
+	r.Add(d.checkHosts())
+	return r
+}
+
+// result creates a Result, formatting its message
+func result(name string, status Status, hint string, format string, v ...interface{}) Result {
+	return Result{Name: name, Status: status, Message: strings.TrimSpace(fmt.Sprintf(format, v...)), Hint: hint}
+}
@@ -0,0 +1,287 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mefellows/parity/sync"
+	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/parity/version"
+)
+
+// setupDoctor creates a parity.yml, docker-compose.yml and hosts file in a
+// temp dir, and a fake Docker API reporting the given API version and time
+func setupDoctor(t *testing.T, apiVersion string, now time.Time) (*Doctor, func()) {
+	dir, err := ioutil.TempDir("", "parity-doctor")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	files := map[string]string{
+		"parity.yml":         "name: myproject\nloglevel: 2\n",
+		"docker-compose.yml": "web:\n  image: nginx\ndb:\n  image: postgres\n",
+		"hosts":              "127.0.0.1 localhost\n127.0.0.1 parity.local\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Unable to write %s: %s", name, err.Error())
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"Version": "1.12.0", "ApiVersion": "%s"}`, apiVersion)
+	})
+	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"SystemTime": "%s"}`, now.Format(time.RFC3339Nano))
+	})
+	server := httptest.NewServer(mux)
+
+	d := &Doctor{
+		ConfigFile:  filepath.Join(dir, "parity.yml"),
+		ComposeFile: filepath.Join(dir, "docker-compose.yml"),
+		Hostname:    "parity.local",
+		HostsFile:   filepath.Join(dir, "hosts"),
+		Docker: &utils.DockerEnvironment{
+			Endpoint: "tcp://" + strings.TrimPrefix(server.URL, "http://"),
+			Host:     "127.0.0.1",
+			Native:   true,
+		},
+	}
+	return d, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func findResult(t *testing.T, r *Report, name string) Result {
+	for _, res := range r.Results {
+		if res.Name == name {
+			return res
+		}
+	}
+	t.Fatalf("Expected a result for '%s'", name)
+	return Result{}
+}
+
+func TestDoctor_Run(t *testing.T) {
+	d, cleanup := setupDoctor(t, "1.24", time.Now())
+	defer cleanup()
+
+	r := d.Run()
+	expected := map[string]Status{
+		CheckConfig:       Pass,
+		CheckCompose:      Pass,
+		CheckDockerHost:   Pass,
+		CheckDockerAPI:    Pass,
+		CheckDockerTLS:    Warn,
+		CheckClock:        Pass,
+		CheckSSH:          Skip,
+		CheckMirrorCerts:  Skip,
+		CheckMirror:       Skip,
+		CheckSharedFolder: Skip,
+		CheckDisk:         Skip,
+		CheckHosts:        Pass,
+	}
+	for name, status := range expected {
+		if res := findResult(t, r, name); res.Status != status {
+			t.Fatalf("Expected '%s' to be %s, got %s: %s", name, status, res.Status, res.Message)
+		}
+	}
+	if r.Failed() {
+		t.Fatalf("Expected no failures, got %d", r.Failures)
+	}
+	if r.Passed+r.Warnings+r.Failures+r.Skipped != len(r.Results) {
+		t.Fatalf("Expected counts to add up to %d results", len(r.Results))
+	}
+	if !strings.Contains(findResult(t, r, CheckDockerAPI).Message, "1.12.0") {
+		t.Fatalf("Expected the Docker version, got '%s'", findResult(t, r, CheckDockerAPI).Message)
+	}
+}
+
+func TestDoctor_RunOldDockerAndSkewedClock(t *testing.T) {
+	d, cleanup := setupDoctor(t, "1.18", time.Now().Add(-10*time.Minute))
+	defer cleanup()
+
+	r := d.Run()
+	if res := findResult(t, r, CheckDockerAPI); res.Status != Warn {
+		t.Fatalf("Expected an old API version to warn, got %s", res.Status)
+	}
+	res := findResult(t, r, CheckClock)
+	if res.Status != Fail || res.Hint == "" {
+		t.Fatalf("Expected a skewed clock to fail with a hint, got %s: '%s'", res.Status, res.Hint)
+	}
+	if !r.Failed() {
+		t.Fatalf("Expected the report to fail")
+	}
+}
+
+func TestDoctor_RunDockerUnreachable(t *testing.T) {
+	d, cleanup := setupDoctor(t, "1.24", time.Now())
+	defer cleanup()
+	d.Docker.Endpoint = "tcp://127.0.0.1:1"
+
+	r := d.Run()
+	res := findResult(t, r, CheckDockerAPI)
+	if res.Status != Fail || !strings.Contains(res.Hint, "Is Docker running?") {
+		t.Fatalf("Expected the Docker API to fail with a hint, got %s: '%s'", res.Status, res.Hint)
+	}
+	if res := findResult(t, r, CheckClock); res.Status != Skip {
+		t.Fatalf("Expected the clock check to be skipped, got %s", res.Status)
+	}
+}
+
+func TestDoctor_RunMissingFiles(t *testing.T) {
+	d, cleanup := setupDoctor(t, "1.24", time.Now())
+	defer cleanup()
+	os.Remove(d.ConfigFile)
+	os.Remove(d.ComposeFile)
+
+	r := d.Run()
+	for _, name := range []string{CheckConfig, CheckCompose} {
+		res := findResult(t, r, name)
+		if res.Status != Warn || !strings.Contains(res.Hint, "parity init") {
+			t.Fatalf("Expected '%s' to warn with a hint to run 'parity init', got %s: '%s'", name, res.Status, res.Hint)
+		}
+	}
+}
+
+func TestDoctor_RunInvalidConfig(t *testing.T) {
+	d, cleanup := setupDoctor(t, "1.24", time.Now())
+	defer cleanup()
+	ioutil.WriteFile(d.ConfigFile, []byte("loglevel: 9\nsync:\n  - name: nosuchplugin\n"), 0644)
+
+	res := findResult(t, d.Run(), CheckConfig)
+	if res.Status != Fail {
+		t.Fatalf("Expected an invalid config to fail, got %s", res.Status)
+	}
+	for _, s := range []string{"loglevel", "nosuchplugin"} {
+		if !strings.Contains(res.Message, s) {
+			t.Fatalf("Expected the message to mention '%s', got '%s'", s, res.Message)
+		}
+	}
+}
+
+func TestDoctor_checkHosts(t *testing.T) {
+	d, cleanup := setupDoctor(t, "1.24", time.Now())
+	defer cleanup()
+
+	d.Hostname = "missing.local"
+	if res := d.checkHosts(); res.Status != Warn {
+		t.Fatalf("Expected a missing host entry to warn, got %s", res.Status)
+	}
+
+	d.Hostname = "parity.local"
+	d.Docker.Native = false
+	d.Docker.Host = "192.168.99.100"
+	res := d.checkHosts()
+	if res.Status != Fail || !strings.Contains(res.Message, "192.168.99.100") {
+		t.Fatalf("Expected a host entry pointing elsewhere to fail, got %s: '%s'", res.Status, res.Message)
+	}
+}
+
+func TestClockResult(t *testing.T) {
+	cases := map[time.Duration]Status{
+		0:                 Pass,
+		-2 * time.Second:  Pass,
+		10 * time.Second:  Warn,
+		-30 * time.Second: Warn,
+		2 * time.Minute:   Fail,
+	}
+	for skew, status := range cases {
+		if res := clockResult(skew); res.Status != status {
+			t.Fatalf("Expected a skew of %s to be %s, got %s", skew, status, res.Status)
+		}
+	}
+}
+
+func TestMirrorResult(t *testing.T) {
+	cases := []struct {
+		v         sync.VersionResponse
+		installed string
+		status    Status
+	}{
+		{sync.VersionResponse{Release: version.Version, Protocol: sync.ProtocolVersion}, version.Version, Pass},
+		{sync.VersionResponse{Release: "0.0.1", Protocol: sync.ProtocolVersion}, "0.0.1", Warn},
+		{sync.VersionResponse{Release: "9.0.0", Protocol: sync.ProtocolVersion + 1}, "9.0.0", Fail},
+		{sync.VersionResponse{}, "", Warn},
+		{sync.VersionResponse{}, version.Version, Warn},
+	}
+	for _, c := range cases {
+		res := mirrorResult("192.168.99.100:8123", &c.v, c.installed)
+		if res.Status != c.status {
+			t.Fatalf("Expected %v (installed '%s') to be %s, got %s: %s", c.v, c.installed, c.status, res.Status, res.Message)
+		}
+	}
+	res := mirrorResult("192.168.99.100:8123", &sync.VersionResponse{}, version.Version)
+	if !strings.Contains(res.Hint, "Restart") {
+		t.Fatalf("Expected a stale daemon to need restarting, got '%s'", res.Hint)
+	}
+}
+
+func TestParseDf(t *testing.T) {
+	used, free, err := parseDf("/dev/sda1              18382728   1337420  16085956   8% /mnt/sda1\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if used != 8 || free != 16085956*1024 {
+		t.Fatalf("Expected 8%% used and %d bytes free, got %d%% and %d", 16085956*1024, used, free)
+	}
+	if _, _, err := parseDf("df: /var/lib/docker: No such file or directory"); err == nil {
+		t.Fatalf("Expected an error for unexpected output")
+	}
+
+	cases := map[int]Status{8: Pass, 90: Warn, 97: Fail}
+	for used, status := range cases {
+		if res := diskResult(used, 1024); res.Status != status {
+			t.Fatalf("Expected %d%% used to be %s, got %s", used, status, res.Status)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.21", "1.21", 0},
+		{"1.9", "1.21", -1},
+		{"1.24", "1.21", 1},
+		{"2", "1.21", 1},
+		{"1.21.1", "1.21", 1},
+	}
+	for _, c := range cases {
+		if actual := compareVersions(c.a, c.b); actual != c.expected {
+			t.Fatalf("Expected compareVersions(%s, %s) to be %d, got %d", c.a, c.b, c.expected, actual)
+		}
+	}
+}
+
+func TestReport_JSON(t *testing.T) {
+	r := &Report{}
+	r.Add(Result{Name: "a", Status: Pass, Message: "ok"})
+	r.Add(Result{Name: "b", Status: Fail, Message: "broken", Hint: "fix it"})
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if decoded["failures"].(float64) != 1 || decoded["passed"].(float64) != 1 {
+		t.Fatalf("Expected counts in the JSON report, got '%s'", data)
+	}
+	if !strings.Contains(string(data), `"hint":"fix it"`) || strings.Count(string(data), `"hint"`) != 1 {
+		t.Fatalf("Expected only failing results to have a hint, got '%s'", data)
+	}
+	if !strings.Contains(r.String(), "fix it") {
+		t.Fatalf("Expected the hint in the report, got '%s'", r.String())
+	}
+}
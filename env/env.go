@@ -0,0 +1,249 @@
+// Package env reads .env files and layers the environment variables Run
+// plugins set in containers. Variables are kept as "KEY=value" entries, as
+// Docker and Compose expect them.
+package env
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultFile is the .env file read from the project directory
+const DefaultFile = ".env"
+
+// Lookup finds the value of a variable, e.g. os.LookupEnv
+type Lookup func(key string) (string, bool)
+
+var validKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// Split splits an entry into its key and value. ok is false for a bare
+// "KEY", which Compose takes from the environment.
+func Split(entry string) (key string, value string, ok bool) {
+	parts := strings.SplitN(entry, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ReadFile parses a .env file. A missing file has no variables.
+func ReadFile(file string, lookup Lookup) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars, err := Parse(f, lookup)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %s", file, err.Error())
+	}
+	return vars, nil
+}
+
+// Parse reads "KEY=value" lines, as written for docker-compose and most
+// dotenv libraries. Blank lines, comments and a leading 'export' are
+// ignored. Unquoted and double quoted values may refer to variables set
+// earlier in the file, or found by lookup, e.g. ${HOME}; single quoted
+// values are taken literally.
+func Parse(r io.Reader, lookup Lookup) ([]string, error) {
+	var vars []string
+	layered := Layered(&vars, lookup)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, ok := Split(line)
+		key = strings.TrimSpace(key)
+		if !ok || !validKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=value, got '%s'", n, line)
+		}
+		value, err := parseValue(strings.TrimSpace(value), layered)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		vars = append(vars, key+"="+value)
+	}
+	return vars, scanner.Err()
+}
+
+// parseValue unquotes and interpolates a value
+func parseValue(value string, lookup Lookup) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch value[0] {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote in %s", value)
+		}
+		return value[1 : end+1], nil
+	case '"':
+		var unescaped strings.Builder
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				return Interpolate(unescaped.String(), lookup)
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					unescaped.WriteByte('\n')
+				case 't':
+					unescaped.WriteByte('\t')
+				case '$':
+					unescaped.WriteString("$$")
+				default:
+					unescaped.WriteByte(value[i])
+				}
+			default:
+				unescaped.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated quote in %s", value)
+	}
+
+	// Unquoted values end at a comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return Interpolate(value, lookup)
+}
+
+// Interpolate replaces ${VAR} and $VAR with the value found by lookup, as
+// Compose does. ${VAR:-default} uses default when VAR is unset or empty,
+// ${VAR-default} only when it's unset, and $$ is a literal $.
+func Interpolate(s string, lookup Lookup) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			out.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in '%s'", s)
+			}
+			value, err := expand(s[i+2:i+end], lookup)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i += end
+		case next == '_' || isLetter(next):
+			end := i + 2
+			for end < len(s) && (s[end] == '_' || isLetter(s[end]) || (s[end] >= '0' && s[end] <= '9')) {
+				end++
+			}
+			value, _ := lookup(s[i+1 : end])
+			out.WriteString(value)
+			i = end - 1
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String(), nil
+}
+
+// expand resolves the contents of ${...}
+func expand(expr string, lookup Lookup) (string, error) {
+	name, def, sep := expr, "", ""
+	if i := strings.IndexAny(expr, ":-"); i >= 0 {
+		name = expr[:i]
+		if strings.HasPrefix(expr[i:], ":-") {
+			sep, def = ":-", expr[i+2:]
+		} else if expr[i] == '-' {
+			sep, def = "-", expr[i+1:]
+		} else {
+			return "", fmt.Errorf("invalid variable '${%s}'", expr)
+		}
+	}
+	if !validKey.MatchString(name) {
+		return "", fmt.Errorf("invalid variable '${%s}'", expr)
+	}
+	value, ok := lookup(name)
+	if (sep == ":-" && value == "") || (sep == "-" && !ok) {
+		return def, nil
+	}
+	return value, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// FromMap converts a map of variables, e.g. from parity.yml, into entries
+// sorted by key, interpolating their values
+func FromMap(m map[string]string, lookup Lookup) ([]string, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if !validKey.MatchString(key) {
+			return nil, fmt.Errorf("Invalid environment variable name '%s'", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	vars := make([]string, len(keys))
+	for i, key := range keys {
+		value, err := Interpolate(m[key], lookup)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for %s: %s", key, err.Error())
+		}
+		vars[i] = key + "=" + value
+	}
+	return vars, nil
+}
+
+// Layered looks variables up in vars (the last entry for a key wins), then
+// in fallback. vars is read on each lookup, so that it may grow.
+func Layered(vars *[]string, fallback Lookup) Lookup {
+	return func(key string) (string, bool) {
+		for i := len(*vars) - 1; i >= 0; i-- {
+			if k, value, ok := Split((*vars)[i]); ok && k == key {
+				return value, true
+			}
+		}
+		if fallback == nil {
+			return "", false
+		}
+		return fallback(key)
+	}
+}
+
+// Merge layers sets of variables, with later layers taking precedence.
+// Variables keep the position they first appear in.
+func Merge(layers ...[]string) []string {
+	var merged []string
+	index := map[string]int{}
+	for _, layer := range layers {
+		for _, entry := range layer {
+			key, _, _ := Split(entry)
+			if i, ok := index[key]; ok {
+				merged[i] = entry
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
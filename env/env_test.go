@@ -0,0 +1,163 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lookup(vars map[string]string) Lookup {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func TestParse(t *testing.T) {
+	file := `
+# Database settings
+export DB_HOST=db
+DB_PORT = 5432 # the default
+DB_URL=postgres://${DB_HOST}:$DB_PORT/app
+GREETING="Hello\n\"${USER}\""
+LITERAL='${DB_HOST} $$'
+PRICE=$$5
+EMPTY=
+HOME_DIR=${HOME}/src
+`
+	vars, err := Parse(strings.NewReader(file), lookup(map[string]string{"USER": "dev", "HOME": "/home/dev", "DB_HOST": "ignored"}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []string{
+		"DB_HOST=db",
+		"DB_PORT=5432",
+		"DB_URL=postgres://db:5432/app",
+		"GREETING=Hello\n\"dev\"",
+		"LITERAL=${DB_HOST} $$",
+		"PRICE=$5",
+		"EMPTY=",
+		"HOME_DIR=/home/dev/src",
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("Expected %q, got %q", expected, vars)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, file := range []string{
+		"NO_VALUE",
+		"1BAD=value",
+		"QUOTE=\"unterminated",
+		"QUOTE='unterminated",
+		"VAR=${UNTERMINATED",
+		"VAR=${BAD:x}",
+	} {
+		if _, err := Parse(strings.NewReader(file), nil); err == nil {
+			t.Fatalf("Expected an error parsing '%s'", file)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	l := lookup(map[string]string{"SET": "value", "EMPTY": ""})
+	for s, expected := range map[string]string{
+		"${SET}":             "value",
+		"$SET/path":          "value/path",
+		"${UNSET}":           "",
+		"${UNSET:-default}":  "default",
+		"${EMPTY:-default}":  "default",
+		"${EMPTY-default}":   "",
+		"${UNSET-default}":   "default",
+		"${SET:-default}":    "value",
+		"cost: $$10, $ sign": "cost: $10, $ sign",
+		"trailing $":         "trailing $",
+	} {
+		value, err := Interpolate(s, l)
+		if err != nil {
+			t.Fatalf("Unexpected error interpolating '%s': %s", s, err.Error())
+		}
+		if value != expected {
+			t.Fatalf("Expected '%s' to be '%s', got '%s'", s, expected, value)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parity-env")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	if vars, err := ReadFile(filepath.Join(dir, ".env"), nil); err != nil || vars != nil {
+		t.Fatalf("Expected no variables for a missing file, got %v (%v)", vars, err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("A=1\nB"), 0600)
+	if _, err := ReadFile(filepath.Join(dir, ".env"), nil); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("Expected an error for line 2, got %v", err)
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	vars, err := FromMap(map[string]string{"URL": "http://${HOST}", "DEBUG": "true"}, lookup(map[string]string{"HOST": "web"}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if expected := []string{"DEBUG=true", "URL=http://web"}; !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("Expected %q, got %q", expected, vars)
+	}
+	if _, err := FromMap(map[string]string{"BAD NAME": "x"}, nil); err == nil {
+		t.Fatalf("Expected an error for an invalid name")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	merged := Merge(
+		[]string{"A=1", "B=1"},
+		[]string{"C=2", "A=2"},
+		nil,
+		[]string{"B", "D=3"},
+	)
+	if expected := []string{"A=2", "B", "C=2", "D=3"}; !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("Expected %q, got %q", expected, merged)
+	}
+}
+
+func TestLayered(t *testing.T) {
+	vars := []string{"A=1", "A=2", "BARE"}
+	l := Layered(&vars, lookup(map[string]string{"B": "os", "BARE": "os"}))
+	if value, _ := l("A"); value != "2" {
+		t.Fatalf("Expected the last value, got '%s'", value)
+	}
+	if value, _ := l("BARE"); value != "os" {
+		t.Fatalf("Expected bare variables to fall back, got '%s'", value)
+	}
+	if value, ok := l("MISSING"); ok || value != "" {
+		t.Fatalf("Expected no value, got '%s'", value)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	for key, expected := range map[string]bool{
+		"DB_PASSWORD":           true,
+		"AWS_SECRET_ACCESS_KEY": true,
+		"GITHUB_TOKEN":          true,
+		"api-key":               true,
+		"KEYBOARD":              false,
+		"TOKENIZER_MODE":        false,
+		"PWD":                   false,
+		"HOME":                  false,
+	} {
+		if IsSecret(key) != expected {
+			t.Fatalf("Expected IsSecret(%s) to be %t", key, expected)
+		}
+	}
+	secrets := Secrets([]string{"DB_PASSWORD=hunter22", "DB_HOST=db", "API_TOKEN=", "SECRET"})
+	if !reflect.DeepEqual(secrets, []string{"hunter22"}) {
+		t.Fatalf("Expected only the password, got %q", secrets)
+	}
+}
@@ -0,0 +1,45 @@
+package env
+
+import (
+	"strings"
+)
+
+// secretWords mark a variable as holding a secret, when they appear as a
+// word of its name, e.g. DB_PASSWORD or AWS_SECRET_ACCESS_KEY
+var secretWords = map[string]bool{
+	"PASSWORD":    true,
+	"PASSWD":      true,
+	"PASS":        true,
+	"SECRET":      true,
+	"TOKEN":       true,
+	"KEY":         true,
+	"APIKEY":      true,
+	"CREDENTIAL":  true,
+	"CREDENTIALS": true,
+	"PRIVATE":     true,
+}
+
+// IsSecret guesses whether a variable holds a secret from its name
+func IsSecret(key string) bool {
+	words := strings.FieldsFunc(strings.ToUpper(key), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for _, word := range words {
+		if secretWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets returns the values of the variables that hold secrets, to be
+// masked in logs (see log.Mask)
+func Secrets(vars []string) []string {
+	var secrets []string
+	for _, entry := range vars {
+		if key, value, ok := Split(entry); ok && value != "" && IsSecret(key) {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
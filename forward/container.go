@@ -0,0 +1,69 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/mefellows/parity/utils"
+)
+
+// ContainerDialer connects to TCP and unix socket endpoints, and to the
+// ports of project's running Compose services. Services are reached on the
+// Docker host at their published port, or when Docker runs natively,
+// directly on the container's address.
+//
+// Services are looked up for each connection, so that forwards keep working
+// when containers are recreated.
+func ContainerDialer(docker *utils.DockerEnvironment, project string) Dialer {
+	return func(e Endpoint) (net.Conn, error) {
+		if e.Network != Container {
+			return Dial(e)
+		}
+		address, err := containerAddress(docker, project, e)
+		if err != nil {
+			return nil, err
+		}
+		return Dial(Endpoint{Network: TCP, Address: address})
+	}
+}
+
+// containerAddress finds the address of a service's port
+func containerAddress(docker *utils.DockerEnvironment, project string, e Endpoint) (string, error) {
+	name, p, _ := net.SplitHostPort(e.Address)
+	port, _ := strconv.ParseInt(p, 10, 64)
+
+	client, err := docker.Client()
+	if err != nil {
+		return "", err
+	}
+	services, err := utils.RunningComposeServices(client)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range services {
+		if s.Project != project || s.Service != name {
+			continue
+		}
+		return serviceAddress(s, port, docker.Host, docker.Native)
+	}
+	return "", fmt.Errorf("Service '%s' of project '%s' is not running", name, project)
+}
+
+// serviceAddress is the address to reach a container's port on
+func serviceAddress(s utils.ComposeService, port int64, dockerHost string, native bool) (string, error) {
+	if native {
+		if ip := s.IP(); ip != "" {
+			return net.JoinHostPort(ip, strconv.FormatInt(port, 10)), nil
+		}
+	}
+	for _, p := range s.Container.Ports {
+		if p.PrivatePort == port && p.PublicPort != 0 && (p.Type == "" || p.Type == "tcp") {
+			if native || dockerHost == "" {
+				dockerHost = "127.0.0.1"
+			}
+			return net.JoinHostPort(dockerHost, strconv.FormatInt(p.PublicPort, 10)), nil
+		}
+	}
+	return "", fmt.Errorf("Port %d of service '%s' is not published, add it to the service's 'ports' in the Compose file", port, s.Service)
+}
@@ -0,0 +1,348 @@
+// Package forward forwards connections between TCP and unix sockets, and to
+// the ports of running Compose services, e.g. to reach a database from the
+// host or to share the host's X server with containers.
+//
+// Each Forward listens on an Endpoint, and dials its target Endpoint for
+// every connection it accepts. Connections are tracked, so that closing a
+// Forward waits for them to finish before closing them.
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mefellows/parity/log"
+)
+
+// Endpoint networks
+const (
+	TCP       = "tcp"
+	Unix      = "unix"
+	Container = "container" // A Compose service's port, e.g. container://db:5432
+)
+
+// DefaultCloseTimeout is how long Close waits for connections to finish
+const DefaultCloseTimeout = 5 * time.Second
+
+// dialTimeout bounds how long connecting to a target may take
+const dialTimeout = 10 * time.Second
+
+// Endpoint is an address a Forward listens on or connects to
+type Endpoint struct {
+	Network string // TCP, Unix or Container
+	Address string // host:port, the socket's path, or service:port
+}
+
+// ParseEndpoint reads an endpoint, e.g.:
+//
+//	tcp://127.0.0.1:6000     TCP address
+//	127.0.0.1:6000           TCP address
+//	6000                     TCP port on the loopback interface
+//	unix:///tmp/.X11-unix/X0 Unix socket
+//	/var/run/docker.sock     Unix socket
+//	container://db:5432      Port of the Compose service 'db'
+func ParseEndpoint(s string) (Endpoint, error) {
+	s = strings.TrimSpace(s)
+	e := Endpoint{Network: TCP, Address: s}
+	if i := strings.Index(s, "://"); i >= 0 {
+		e.Network, e.Address = s[:i], s[i+3:]
+	} else if strings.HasPrefix(s, "/") || strings.HasPrefix(s, ".") {
+		e.Network = Unix
+	} else if _, err := strconv.Atoi(s); err == nil {
+		e.Address = net.JoinHostPort("127.0.0.1", s)
+	}
+
+	switch e.Network {
+	case TCP, Container:
+		host, port, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return e, fmt.Errorf("Invalid %s address '%s': %s", e.Network, s, err.Error())
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return e, fmt.Errorf("Invalid port in '%s'", s)
+		}
+		if e.Network == Container && host == "" {
+			return e, fmt.Errorf("A service is required in '%s', e.g. container://db:5432", s)
+		}
+	case Unix:
+		if e.Address == "" {
+			return e, fmt.Errorf("A socket path is required in '%s'", s)
+		}
+	default:
+		return e, fmt.Errorf("Unknown network '%s' in '%s', expected tcp, unix or container", e.Network, s)
+	}
+	return e, nil
+}
+
+func (e Endpoint) String() string {
+	return e.Network + "://" + e.Address
+}
+
+// Dialer connects to a target Endpoint
+type Dialer func(Endpoint) (net.Conn, error)
+
+// Dial connects to TCP and unix socket endpoints
+func Dial(e Endpoint) (net.Conn, error) {
+	if e.Network == Container {
+		return nil, fmt.Errorf("Connecting to %s requires a Docker host", e)
+	}
+	return net.DialTimeout(e.Network, e.Address, dialTimeout)
+}
+
+// Stats are a Forward's metrics
+type Stats struct {
+	Name     string `json:"name"`
+	Listen   string `json:"listen"`
+	Target   string `json:"target"`
+	Active   int64  `json:"active"`    // Connections currently open
+	Total    int64  `json:"total"`     // Connections accepted
+	Failed   int64  `json:"failed"`    // Connections that couldn't reach the target, or were rejected
+	BytesIn  int64  `json:"bytes_in"`  // Bytes sent from clients to the target
+	BytesOut int64  `json:"bytes_out"` // Bytes sent from the target to clients
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%s (%s -> %s): %d active, %d total, %d failed connections, %d bytes in, %d bytes out",
+		s.Name, s.Listen, s.Target, s.Active, s.Total, s.Failed, s.BytesIn, s.BytesOut)
+}
+
+// Forward accepts connections on Listen, and forwards each to Target
+type Forward struct {
+	// Counters are first, to be 64-bit aligned for the atomic package
+	active, total, failed, bytesIn, bytesOut int64
+
+	Name         string
+	Listen       Endpoint
+	Target       Endpoint
+	Dial         Dialer        // Defaults to Dial
+	CloseTimeout time.Duration // Defaults to DefaultCloseTimeout
+
+	// Handshake, if set, runs before forwarding each connection, e.g. to
+	// authenticate the client. Connections are closed if it fails.
+	Handshake func(client net.Conn, target net.Conn) error
+
+	listener net.Listener
+	mutex    sync.Mutex
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closing  chan struct{}
+	once     sync.Once
+}
+
+// New creates a Forward from listen and target endpoints, see ParseEndpoint
+func New(name string, listen string, target string) (*Forward, error) {
+	l, err := ParseEndpoint(listen)
+	if err != nil {
+		return nil, err
+	}
+	if l.Network == Container {
+		return nil, fmt.Errorf("Forward '%s' can't listen on a container, use it as the target", name)
+	}
+	t, err := ParseEndpoint(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Forward{Name: name, Listen: l, Target: t}, nil
+}
+
+// Start listens for connections, forwarding them in the background until
+// Close is called
+func (f *Forward) Start() error {
+	if f.Dial == nil {
+		f.Dial = Dial
+	}
+	if f.CloseTimeout == 0 {
+		f.CloseTimeout = DefaultCloseTimeout
+	}
+	if f.Listen.Network == Unix {
+		removeStaleSocket(f.Listen.Address)
+	}
+	l, err := net.Listen(f.Listen.Network, f.Listen.Address)
+	if err != nil {
+		return fmt.Errorf("Forward '%s' unable to listen on %s: %s", f.Name, f.Listen, err.Error())
+	}
+	f.listener = l
+	f.conns = make(map[net.Conn]struct{})
+	f.closing = make(chan struct{})
+
+	log.Debug("Forwarding %s to %s (%s)", f.Addr(), f.Target, f.Name)
+	f.wg.Add(1)
+	go f.accept()
+	return nil
+}
+
+// Addr is the address the Forward is listening on
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// removeStaleSocket removes a unix socket left behind by a previous run,
+// which would otherwise stop it being listened on again
+func removeStaleSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+func (f *Forward) accept() {
+	defer f.wg.Done()
+	for {
+		client, err := f.listener.Accept()
+		if err != nil {
+			select {
+			case <-f.closing:
+			default:
+				log.Error("Forward '%s' stopped accepting connections: %s", f.Name, err.Error())
+			}
+			return
+		}
+		atomic.AddInt64(&f.total, 1)
+		f.wg.Add(1)
+		go f.handle(client)
+	}
+}
+
+// handle forwards a connection until both sides have finished sending
+func (f *Forward) handle(client net.Conn) {
+	defer f.wg.Done()
+	defer client.Close()
+
+	target, err := f.Dial(f.Target)
+	if err != nil {
+		atomic.AddInt64(&f.failed, 1)
+		log.Warn("Forward '%s' unable to connect to %s: %s", f.Name, f.Target, err.Error())
+		return
+	}
+	defer target.Close()
+	if f.Handshake != nil {
+		if err := f.Handshake(client, target); err != nil {
+			atomic.AddInt64(&f.failed, 1)
+			log.Warn("Forward '%s' rejected %s: %s", f.Name, client.RemoteAddr(), err.Error())
+			return
+		}
+	}
+	if !f.track(client, target) {
+		return
+	}
+	defer f.untrack(client, target)
+	log.Debug("Forward '%s' connected %s to %s", f.Name, client.RemoteAddr(), f.Target)
+
+	done := make(chan struct{})
+	go func() {
+		f.copy(target, client, &f.bytesIn)
+		close(done)
+	}()
+	f.copy(client, target, &f.bytesOut)
+	<-done
+}
+
+// copy sends src to dst, then closes dst for writing so that the other side
+// sees the end of the stream, while still being able to respond
+func (f *Forward) copy(dst net.Conn, src net.Conn, counter *int64) {
+	io.Copy(&countingWriter{Writer: dst, counter: counter}, src)
+	if c, ok := dst.(interface {
+		CloseWrite() error
+	}); ok {
+		c.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+// countingWriter keeps a running count of the bytes written, so that
+// metrics include connections that are still open
+type countingWriter struct {
+	io.Writer
+	counter *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.counter, int64(n))
+	return n, err
+}
+
+// track records a connection, returning false if the Forward is closing
+func (f *Forward) track(conns ...net.Conn) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	select {
+	case <-f.closing:
+		return false
+	default:
+	}
+	for _, c := range conns {
+		f.conns[c] = struct{}{}
+	}
+	atomic.AddInt64(&f.active, 1)
+	return true
+}
+
+func (f *Forward) untrack(conns ...net.Conn) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, c := range conns {
+		delete(f.conns, c)
+	}
+	atomic.AddInt64(&f.active, -1)
+}
+
+// Close stops accepting connections and waits up to CloseTimeout for open
+// connections to finish, before closing them
+func (f *Forward) Close() error {
+	var err error
+	f.once.Do(func() {
+		if f.listener == nil {
+			return
+		}
+		f.mutex.Lock()
+		close(f.closing)
+		f.mutex.Unlock()
+		err = f.listener.Close()
+
+		finished := make(chan struct{})
+		go func() {
+			f.wg.Wait()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(f.CloseTimeout):
+			f.mutex.Lock()
+			log.Debug("Forward '%s' closing %d connections", f.Name, len(f.conns)/2)
+			for c := range f.conns {
+				c.Close()
+			}
+			f.mutex.Unlock()
+			<-finished
+		}
+	})
+	return err
+}
+
+// Stats returns the Forward's metrics
+func (f *Forward) Stats() Stats {
+	return Stats{
+		Name:     f.Name,
+		Listen:   f.Listen.String(),
+		Target:   f.Target.String(),
+		Active:   atomic.LoadInt64(&f.active),
+		Total:    atomic.LoadInt64(&f.total),
+		Failed:   atomic.LoadInt64(&f.failed),
+		BytesIn:  atomic.LoadInt64(&f.bytesIn),
+		BytesOut: atomic.LoadInt64(&f.bytesOut),
+	}
+}
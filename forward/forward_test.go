@@ -0,0 +1,231 @@
+package forward
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/utils"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	for s, expected := range map[string]Endpoint{
+		"tcp://127.0.0.1:6000":     {TCP, "127.0.0.1:6000"},
+		"0.0.0.0:6000":             {TCP, "0.0.0.0:6000"},
+		":6000":                    {TCP, ":6000"},
+		"6000":                     {TCP, "127.0.0.1:6000"},
+		"unix:///tmp/.X11-unix/X0": {Unix, "/tmp/.X11-unix/X0"},
+		"/var/run/docker.sock":     {Unix, "/var/run/docker.sock"},
+		"container://db:5432":      {Container, "db:5432"},
+	} {
+		e, err := ParseEndpoint(s)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing '%s': %s", s, err.Error())
+		}
+		if e != expected {
+			t.Fatalf("Expected '%s' to be %+v, got %+v", s, expected, e)
+		}
+	}
+
+	for _, s := range []string{"", "udp://127.0.0.1:53", "tcp://127.0.0.1", "127.0.0.1:http", "container://:5432", "unix://", "70000"} {
+		if _, err := ParseEndpoint(s); err == nil {
+			t.Fatalf("Expected an error parsing '%s'", s)
+		}
+	}
+}
+
+func TestNew_ContainerListen(t *testing.T) {
+	if _, err := New("db", "container://db:5432", "127.0.0.1:5432"); err == nil {
+		t.Fatalf("Expected an error listening on a container")
+	}
+}
+
+// echo serves lines back to clients, prefixed with "echo: "
+func echo(t *testing.T, network string, address string) net.Listener {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					conn.Write([]byte("echo: " + scanner.Text() + "\n"))
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+// roundTrip sends a line through the forward and returns the response
+func roundTrip(t *testing.T, f *Forward, line string) string {
+	conn, err := net.Dial(f.Addr().Network(), f.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %s", err.Error())
+	}
+	defer conn.Close()
+	conn.Write([]byte(line + "\n"))
+	res, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return res
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "parity-forward")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	return dir
+}
+
+func TestForward_Networks(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	tcpBackend := echo(t, "tcp", "127.0.0.1:0")
+	defer tcpBackend.Close()
+	unixBackend := echo(t, "unix", filepath.Join(dir, "backend.sock"))
+	defer unixBackend.Close()
+
+	for _, c := range []struct{ listen, target string }{
+		{"tcp://127.0.0.1:0", "tcp://" + tcpBackend.Addr().String()},
+		{"tcp://127.0.0.1:0", "unix://" + unixBackend.Addr().String()},
+		{"unix://" + filepath.Join(dir, "forward.sock"), "tcp://" + tcpBackend.Addr().String()},
+	} {
+		f, err := New("test", c.listen, c.target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if err := f.Start(); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if res := roundTrip(t, f, "hello"); res != "echo: hello\n" {
+			t.Fatalf("Expected 'echo: hello' from %s -> %s, got '%s'", c.listen, c.target, res)
+		}
+		f.Close()
+
+		stats := f.Stats()
+		if stats.Total != 1 || stats.Active != 0 || stats.Failed != 0 || stats.BytesIn != 6 || stats.BytesOut != 12 {
+			t.Fatalf("Unexpected stats for %s -> %s: %s", c.listen, c.target, stats)
+		}
+	}
+}
+
+func TestForward_TargetDown(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	f, _ := New("test", "127.0.0.1:0", addr)
+	if err := f.Start(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer f.Close()
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %s", err.Error())
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("Expected the connection to be closed")
+	}
+	if stats := f.Stats(); stats.Failed != 1 {
+		t.Fatalf("Expected a failed connection, got %s", stats)
+	}
+}
+
+func TestForward_GracefulClose(t *testing.T) {
+	backend := echo(t, "tcp", "127.0.0.1:0")
+	defer backend.Close()
+
+	f, _ := New("test", "127.0.0.1:0", backend.Addr().String())
+	f.CloseTimeout = 100 * time.Millisecond
+	if err := f.Start(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	addr := f.Addr().String()
+
+	// A connection that is never closed by the client
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Unable to connect: %s", err.Error())
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello\n"))
+	bufio.NewReader(conn).ReadString('\n')
+	if stats := f.Stats(); stats.Active != 1 {
+		t.Fatalf("Expected an active connection, got %s", stats)
+	}
+
+	start := time.Now()
+	f.Close()
+	if elapsed := time.Since(start); elapsed < f.CloseTimeout {
+		t.Fatalf("Expected Close to wait for the connection, returned after %s", elapsed)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("Expected the connection to be closed")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatalf("Expected the forward to stop listening")
+	}
+}
+
+func TestForward_RemovesStaleSocket(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// Leave a socket behind, as a process that was killed would
+	path := filepath.Join(dir, "forward.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	f, _ := New("test", path, "127.0.0.1:1")
+	if err := f.Start(); err != nil {
+		t.Fatalf("Expected the stale socket to be replaced, got: %s", err.Error())
+	}
+	f.Close()
+}
+
+func TestServiceAddress(t *testing.T) {
+	s := utils.ComposeService{
+		Project: "myproject",
+		Service: "db",
+		Container: dockerclient.APIContainers{
+			Ports: []dockerclient.APIPort{{PrivatePort: 5432, PublicPort: 32768, Type: "tcp"}, {PrivatePort: 6379}},
+			Networks: dockerclient.NetworkList{
+				Networks: map[string]dockerclient.ContainerNetwork{"bridge": {IPAddress: "172.17.0.2"}},
+			},
+		},
+	}
+
+	if addr, err := serviceAddress(s, 5432, "192.168.99.100", false); err != nil || addr != "192.168.99.100:32768" {
+		t.Fatalf("Expected the published port on the Docker host, got '%s' (%v)", addr, err)
+	}
+	if _, err := serviceAddress(s, 6379, "192.168.99.100", false); err == nil {
+		t.Fatalf("Expected an error for an unpublished port")
+	}
+	if addr, err := serviceAddress(s, 6379, "", true); err != nil || addr != "172.17.0.2:6379" {
+		t.Fatalf("Expected the container's address when running natively, got '%s' (%v)", addr, err)
+	}
+}
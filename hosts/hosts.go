@@ -0,0 +1,335 @@
+// Package hosts manages Parity's entries in the system hosts file.
+//
+// Entries are kept in a block delimited by marker comments, so that they
+// can be listed, updated and removed without touching anything else in the
+// file:
+//
+//	# BEGIN parity
+//	192.168.99.100 parity.local
+//	192.168.99.100 web.myproject.parity.local
+//	# END parity
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	beginMarker = "# BEGIN parity"
+	endMarker   = "# END parity"
+)
+
+// DefaultDomain is the domain Parity's hostnames are created under
+const DefaultDomain = "parity.local"
+
+// DefaultPath is the location of the system hosts file
+func DefaultPath() string {
+	if runtime.GOOS == "windows" {
+		root := os.Getenv("SystemRoot")
+		if root == "" {
+			root = `C:\Windows`
+		}
+		return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// Entry maps a hostname to an IP address
+type Entry struct {
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname"`
+}
+
+// File is a hosts file, split into Parity's entries and everything else
+type File struct {
+	Path    string
+	Entries []Entry
+
+	before  []string // Lines before the Parity block
+	after   []string // Lines after the Parity block
+	newline string
+}
+
+// Load reads the hosts file at path. A missing file has no entries.
+func Load(path string) (*File, error) {
+	f := &File{Path: path, newline: "\n"}
+	if runtime.GOOS == "windows" {
+		f.newline = "\r\n"
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read hosts file %s: %s", path, err.Error())
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		f.newline = "\r\n"
+	}
+
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	inBlock, seenBlock := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == beginMarker && !seenBlock:
+			inBlock, seenBlock = true, true
+		case trimmed == endMarker && inBlock:
+			inBlock = false
+		case inBlock:
+			fields := strings.Fields(trimmed)
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			for _, host := range fields[1:] {
+				if strings.HasPrefix(host, "#") {
+					break
+				}
+				f.Entries = append(f.Entries, Entry{IP: fields[0], Hostname: host})
+			}
+		case seenBlock:
+			f.after = append(f.after, line)
+		default:
+			f.before = append(f.before, line)
+		}
+	}
+	if inBlock {
+		return nil, fmt.Errorf("Hosts file %s has a '%s' line without a matching '%s'", path, beginMarker, endMarker)
+	}
+	return f, nil
+}
+
+// Add maps each hostname to ip, replacing any existing Parity entry for it.
+// A mapping for the hostname outside the Parity block, e.g. one created by
+// an older version of Parity, is removed so that it can't take precedence.
+func (f *File) Add(ip string, hostnames ...string) {
+	f.Remove(hostnames...)
+	for _, host := range hostnames {
+		f.before = removeHost(f.before, host)
+		f.after = removeHost(f.after, host)
+		f.Entries = append(f.Entries, Entry{IP: ip, Hostname: host})
+	}
+	f.sort()
+}
+
+// Remove deletes the Parity entries for hostnames, returning the number removed
+func (f *File) Remove(hostnames ...string) int {
+	removed := 0
+	var entries []Entry
+	for _, e := range f.Entries {
+		if contains(hostnames, e.Hostname) {
+			removed++
+			continue
+		}
+		entries = append(entries, e)
+	}
+	f.Entries = entries
+	return removed
+}
+
+// RemoveAll deletes all Parity entries, returning the number removed
+func (f *File) RemoveAll() int {
+	removed := len(f.Entries)
+	f.Entries = nil
+	return removed
+}
+
+// Sync makes the entries under domain exactly those in entries: missing
+// entries are added, changed ones updated and any others under domain are
+// removed. Entries outside of domain are left alone.
+func (f *File) Sync(domain string, entries []Entry) {
+	var kept []Entry
+	for _, e := range f.Entries {
+		if !InDomain(e.Hostname, domain) {
+			kept = append(kept, e)
+		}
+	}
+	f.Entries = kept
+	for _, e := range entries {
+		f.Add(e.IP, e.Hostname)
+	}
+}
+
+// Has returns true if hostname maps to ip in the Parity block
+func (f *File) Has(ip string, hostname string) bool {
+	for _, e := range f.Entries {
+		if e.IP == ip && e.Hostname == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup finds the IP address hostname maps to anywhere in the hosts file,
+// as the system resolver would: the first mapping wins
+func (f *File) Lookup(hostname string) (string, bool) {
+	var entries []Entry
+	for _, line := range f.before {
+		entries = append(entries, parseLine(line)...)
+	}
+	entries = append(entries, f.Entries...)
+	for _, line := range f.after {
+		entries = append(entries, parseLine(line)...)
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Hostname, hostname) {
+			return e.IP, true
+		}
+	}
+	return "", false
+}
+
+// Bytes renders the hosts file. The Parity block is left out entirely
+// when it has no entries.
+func (f *File) Bytes() []byte {
+	lines := append([]string{}, f.before...)
+	if len(f.Entries) > 0 {
+		lines = append(lines, beginMarker)
+		for _, e := range f.Entries {
+			lines = append(lines, fmt.Sprintf("%s %s", e.IP, e.Hostname))
+		}
+		lines = append(lines, endMarker)
+	}
+	lines = append(lines, f.after...)
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, f.newline) + f.newline)
+}
+
+// Save writes the hosts file, keeping its permissions
+func (f *File) Save() error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(f.Path); err == nil {
+		mode = info.Mode()
+	}
+	if err := ioutil.WriteFile(f.Path, f.Bytes(), mode); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("Unable to update hosts file %s: permission denied. Run again with elevated privileges (e.g. 'sudo -E')", f.Path)
+		}
+		return fmt.Errorf("Unable to update hosts file %s: %s", f.Path, err.Error())
+	}
+	return nil
+}
+
+// sort orders entries by hostname, so that they are easy to scan
+func (f *File) sort() {
+	sort.SliceStable(f.Entries, func(i, j int) bool {
+		return f.Entries[i].Hostname < f.Entries[j].Hostname
+	})
+}
+
+// InDomain returns true if hostname is domain, or a subdomain of it
+func InDomain(hostname string, domain string) bool {
+	hostname, domain = strings.ToLower(hostname), strings.ToLower(domain)
+	return hostname == domain || strings.HasSuffix(hostname, "."+domain)
+}
+
+// ServiceHostnames derives a hostname for each Compose service of a
+// project, e.g. web.myproject.parity.local, along with the project's own
+// hostname (myproject.parity.local)
+func ServiceHostnames(project string, domain string, services []string) []string {
+	base := Label(project) + "." + domain
+	hostnames := []string{base}
+	for _, s := range services {
+		hostnames = append(hostnames, Label(s)+"."+base)
+	}
+	sort.Strings(hostnames[1:])
+	return hostnames
+}
+
+// Label makes name a valid DNS label: lower case letters, digits and '-'
+func Label(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// ResolveIP returns host as an IP address, looking it up if it is a hostname
+func ResolveIP(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return "", fmt.Errorf("Unable to resolve the IP address of %s", host)
+	}
+	return ips[0].String(), nil
+}
+
+// parseLine reads the entries from a line of the hosts file
+func parseLine(line string) []Entry {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil
+	}
+	entries := make([]Entry, len(fields)-1)
+	for i, host := range fields[1:] {
+		entries[i] = Entry{IP: fields[0], Hostname: host}
+	}
+	return entries
+}
+
+// removeHost removes hostname from the mappings in lines, dropping any line
+// left without a hostname. Comments and other lines are left as they are.
+func removeHost(lines []string, hostname string) []string {
+	var result []string
+	for _, line := range lines {
+		entries := parseLine(line)
+		if len(entries) == 0 || !containsHost(entries, hostname) {
+			result = append(result, line)
+			continue
+		}
+		var hosts []string
+		for _, e := range entries {
+			if !strings.EqualFold(e.Hostname, hostname) {
+				hosts = append(hosts, e.Hostname)
+			}
+		}
+		if len(hosts) > 0 {
+			result = append(result, entries[0].IP+" "+strings.Join(hosts, " "))
+		}
+	}
+	return result
+}
+
+func containsHost(entries []Entry, hostname string) bool {
+	for _, e := range entries {
+		if strings.EqualFold(e.Hostname, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if strings.EqualFold(i, item) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package hosts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const system = `127.0.0.1 localhost
+# A comment
+10.0.0.1 intranet
+`
+
+func read(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Unable to read hosts file: %s", err.Error())
+	}
+	return string(data)
+}
+
+func TestFile_AddAndRemove(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-hosts")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(file, []byte(system), 0644)
+
+	f, err := Load(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	f.Add("192.168.99.100", "parity.local", "web.myproject.parity.local")
+	if err := f.Save(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	expected := system + `# BEGIN parity
+192.168.99.100 parity.local
+192.168.99.100 web.myproject.parity.local
+# END parity
+`
+	if actual := read(t, file); actual != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, actual)
+	}
+
+	// Re-adding updates the entry in place
+	f, _ = Load(file)
+	f.Add("192.168.99.101", "parity.local")
+	if !f.Has("192.168.99.101", "parity.local") || f.Has("192.168.99.100", "parity.local") || len(f.Entries) != 2 {
+		t.Fatalf("Expected parity.local to be updated, got %v", f.Entries)
+	}
+
+	if removed := f.Remove("parity.local", "missing.local"); removed != 1 {
+		t.Fatalf("Expected 1 entry to be removed, got %d", removed)
+	}
+	f.RemoveAll()
+	f.Save()
+	if actual := read(t, file); actual != system {
+		t.Fatalf("Expected the Parity block to be removed, leaving:\n%s\ngot:\n%s", system, actual)
+	}
+}
+
+func TestLoad_KeepsSurroundingLines(t *testing.T) {
+	content := "127.0.0.1 localhost\r\n# BEGIN parity\r\n10.0.0.5 parity.local\r\n# END parity\r\n10.0.0.1 intranet\r\n"
+	dir, _ := ioutil.TempDir("", "parity-hosts")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(file, []byte(content), 0644)
+
+	f, err := Load(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(f.Entries, []Entry{{IP: "10.0.0.5", Hostname: "parity.local"}}) {
+		t.Fatalf("Expected the entry in the Parity block, got %v", f.Entries)
+	}
+	if string(f.Bytes()) != content {
+		t.Fatalf("Expected the file to be unchanged, got %q", f.Bytes())
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	f, err := Load(filepath.Join(os.TempDir(), "parity-hosts-does-not-exist"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(f.Entries) != 0 || len(f.Bytes()) != 0 {
+		t.Fatalf("Expected an empty hosts file")
+	}
+}
+
+func TestLoad_Unterminated(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-hosts")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(file, []byte("# BEGIN parity\n10.0.0.5 parity.local\n"), 0644)
+
+	if _, err := Load(file); err == nil {
+		t.Fatalf("Expected an error for an unterminated Parity block")
+	}
+}
+
+func TestFile_AddReplacesLegacyEntries(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-hosts")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(file, []byte("127.0.0.1 localhost\n192.168.99.100 parity.local other.local\n"), 0644)
+
+	f, _ := Load(file)
+	f.Add("192.168.99.101", "parity.local")
+	expected := "127.0.0.1 localhost\n192.168.99.100 other.local\n# BEGIN parity\n192.168.99.101 parity.local\n# END parity\n"
+	if actual := string(f.Bytes()); actual != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestFile_Lookup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-hosts")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(file, []byte("10.0.0.9 parity.local # old\n# BEGIN parity\n10.0.0.5 parity.local\n10.0.0.5 web.parity.local\n# END parity\n"), 0644)
+
+	f, _ := Load(file)
+	if ip, ok := f.Lookup("PARITY.local"); !ok || ip != "10.0.0.9" {
+		t.Fatalf("Expected the first mapping to win, got '%s'", ip)
+	}
+	if ip, ok := f.Lookup("web.parity.local"); !ok || ip != "10.0.0.5" {
+		t.Fatalf("Expected web.parity.local to be found, got '%s'", ip)
+	}
+	if _, ok := f.Lookup("missing.local"); ok {
+		t.Fatalf("Expected missing.local not to be found")
+	}
+}
+
+func TestFile_Sync(t *testing.T) {
+	f := &File{newline: "\n"}
+	f.Add("10.0.0.5", "parity.local", "web.myproject.parity.local", "old.myproject.parity.local", "api.other.parity.local")
+
+	f.Sync("myproject.parity.local", []Entry{
+		{IP: "10.0.0.6", Hostname: "myproject.parity.local"},
+		{IP: "10.0.0.6", Hostname: "web.myproject.parity.local"},
+	})
+
+	expected := []Entry{
+		{IP: "10.0.0.5", Hostname: "api.other.parity.local"},
+		{IP: "10.0.0.6", Hostname: "myproject.parity.local"},
+		{IP: "10.0.0.5", Hostname: "parity.local"},
+		{IP: "10.0.0.6", Hostname: "web.myproject.parity.local"},
+	}
+	if !reflect.DeepEqual(f.Entries, expected) {
+		t.Fatalf("Expected %v, got %v", expected, f.Entries)
+	}
+}
+
+func TestServiceHostnames(t *testing.T) {
+	actual := ServiceHostnames("My Project", DefaultDomain, []string{"web", "db_1"})
+	expected := []string{"my-project.parity.local", "db-1.my-project.parity.local", "web.my-project.parity.local"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestInDomain(t *testing.T) {
+	cases := map[string]bool{
+		"myproject.parity.local":     true,
+		"web.myproject.parity.local": true,
+		"WEB.MyProject.parity.local": true,
+		"notmyproject.parity.local":  false,
+		"parity.local":               false,
+	}
+	for host, expected := range cases {
+		if InDomain(host, "myproject.parity.local") != expected {
+			t.Fatalf("Expected InDomain(%s) to be %t", host, expected)
+		}
+	}
+}
+
+func TestResolveIP(t *testing.T) {
+	if ip, err := ResolveIP("192.168.99.100"); err != nil || ip != "192.168.99.100" {
+		t.Fatalf("Expected the IP address to be returned as is, got '%s'", ip)
+	}
+	if ip, err := ResolveIP("localhost"); err != nil || !strings.HasPrefix(ip, "127.") && ip != "::1" {
+		t.Fatalf("Expected localhost to resolve to a loopback address, got '%s'", ip)
+	}
+}
@@ -70,7 +70,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _templatesBootlocalSh = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x5c\x8f\xbd\x4e\x04\x31\x0c\x84\x7b\x3f\x85\xef\xa8\x2f\x96\x10\xa2\x80\xf7\xa0\x41\x08\x65\x37\xce\x25\x22\x89\x57\x76\xc2\x22\x4e\xf7\xee\x2c\x3f\xdb\x50\x59\xb6\x35\x33\xdf\xdc\x1c\x68\xca\x8d\x2c\x01\xcc\x01\xe9\xdd\x2b\x95\x3c\xd1\x24\xd2\x6f\x83\xcc\x6f\xac\x04\x90\x23\x3e\xe3\x01\x4f\x11\x8f\x8e\x6a\x56\x15\x3d\xe2\xcb\x23\xf6\xc4\x0d\x10\xd7\x33\x77\x4c\xbd\x2f\xf6\x40\x74\xce\x3d\x8d\xc9\xcd\x52\xa9\x72\xe4\x52\x64\xb5\x3f\x0d\x29\x17\xf6\xc6\x46\x41\xd6\x56\xc4\x07\xba\x5c\xdc\x13\xab\x65\x69\xd7\xeb\x16\xdc\xc6\xc7\xab\xaf\xe1\xfe\xce\x7d\xe6\x65\x73\x1e\x6d\x9b\xf8\xff\x1e\x33\x80\x8d\x20\x38\x2f\xdf\x4c\x3b\x12\xd2\x30\xfd\x69\xf3\xbb\xc3\xfe\x38\x05\xcf\x55\x9a\xb3\x84\xd6\xbd\x76\xf8\x0a\x00\x00\xff\xff\x9f\xce\xf5\x1a\xf5\x00\x00\x00")
+var _templatesBootlocalSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x2d\xce\x4d\x0a\xc2\x30\x10\x05\xe0\x7d\x4e\xf1\xa4\x8b\x6e\x6a\x07\x44\x3c\x87\x37\x90\xfc\x49\x06\xd3\xa4\x4c\x12\xb5\xb7\xb7\x34\xae\x86\xc7\xe3\x7d\xcc\x70\x22\xc3\x89\x4a\x50\xca\x3a\xd0\x5b\x0b\x45\x36\x64\x72\xae\x17\x97\xed\xcb\x0b\x29\x35\xe0\xae\x85\xeb\x36\x16\x44\x4e\xed\xfb\xd0\x8b\xbb\x5d\xb1\x0f\xb5\x6c\x13\x3e\x81\x6d\x80\xb4\x54\x50\x83\xc7\xc2\x22\x59\xe0\xb4\x5f\x72\x9a\xc0\x05\x6d\x8d\x59\x3b\xef\x60\xb6\xdd\x1a\xd7\x03\x03\xa7\x52\x75\x8c\xa3\x2a\xcd\x65\xd8\x15\xe7\x27\x66\xea\xe5\xff\x80\x5a\x91\xe3\xc1\x9e\xd5\x4c\x5d\x3f\x77\x7d\x2e\x01\x3b\x22\x55\xfd\x00\x5b\x5e\x8d\x60\xc8\x00\x00\x00")
 
 func templatesBootlocalShBytes() ([]byte, error) {
 	return bindataRead(
@@ -85,12 +85,12 @@ func templatesBootlocalSh() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "templates/bootlocal.sh", size: 245, mode: os.FileMode(493), modTime: time.Unix(1458890949, 0)}
+	info := bindataFileInfo{name: "templates/bootlocal.sh", size: 200, mode: os.FileMode(509), modTime: time.Unix(1792434220, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _templatesMirrorDaemonSh = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x7c\x54\x5d\x6f\xe2\x3a\x10\x7d\x8e\x7f\xc5\xdc\x90\xcb\x47\x25\x1a\x68\x6f\x1f\x2e\x15\x48\x48\xa5\x57\x95\x4a\xa9\x68\xef\xbe\x6c\xbb\xab\xd4\x38\x60\x11\xec\xc8\x0e\xec\x76\x81\xff\xbe\xe3\x8f\xd0\x14\xb5\xcb\x0b\xce\xcc\x9c\x33\x33\x67\xc6\xae\xfd\x15\xbf\x70\x11\xeb\x05\xa9\x91\x1a\xc4\xac\xa0\x31\x17\xbc\x38\x9d\xc5\xab\x57\xfd\xaa\x0b\xb6\x42\xf3\xc3\xfa\xc5\x9d\x21\xe5\x19\x83\x54\x2a\x08\x57\x5c\x29\xa9\x42\xd0\x4c\x6d\x98\xb2\x68\xba\x58\x52\x29\x52\x3e\xef\xc1\xd9\xf9\x3f\x17\xf0\xef\x05\x74\x2e\x82\x66\xb7\x85\xbe\x19\xd3\x54\xf1\xbc\xe0\x52\xf4\xc0\x61\x3d\x14\x66\x09\x5b\x49\x61\x19\x72\x25\x29\xd3\x5a\x24\x2b\xd6\x73\x41\x86\xd6\x73\xda\xe2\x9c\xd5\xff\x9d\x1a\xd7\x71\x04\x56\xea\xbe\x7d\xa8\xa1\xe5\x33\x53\x38\x06\x6c\x12\x15\xab\xb5\x28\xf1\xe8\x20\xe4\x6e\x38\x1e\xf5\xcb\x7e\x48\x0f\xa2\xed\xf8\x66\x3a\x9d\x4c\xbf\xdf\x4e\xfe\xbb\xbe\xb9\x1d\xf5\xfa\x16\x96\xc9\x79\x09\xc3\xe3\xde\x06\x5e\x0d\x47\xe3\xc9\xdd\xe4\xfe\xf1\xa1\xd7\x0f\xdb\x6d\x2e\x34\xa3\x6b\xc5\xc2\x3d\xb9\xbf\xb9\x32\xd8\xfe\x87\x19\x6b\xa0\xe5\x5a\x51\x54\x72\x2d\xa8\x91\x04\x32\xfe\xa2\x12\xf5\x4a\xbe\x42\x3b\x75\x6d\x28\x8a\x33\xf0\xa3\x28\xc3\x34\x3c\x43\xbd\x0e\xa7\x7f\x88\x30\xe4\xf9\x3a\xcb\x80\x0b\x38\x28\x81\x4a\x17\x05\x17\x73\x5d\xe1\x3f\x38\x7d\x65\xef\xa8\x8f\x9d\x84\x4c\x47\x8f\x5f\x86\xb7\xfd\x0e\x21\xba\x48\x54\xd1\x6c\xc1\x96\x04\x8c\x2e\x24\xb4\x05\x84\x0f\xc6\x86\x09\x20\x32\x62\xf6\x20\x24\x81\x67\x75\xc3\x7d\x27\xd5\x1e\x06\x03\x08\x8f\x55\xde\x87\x70\x36\xa8\x77\xa1\x4e\x02\xd4\xae\x1f\x35\x73\x0d\x6d\x96\xc2\x0e\xe6\x8a\xe5\xe5\xca\xf8\x2f\xcf\xba\x83\xe4\xc7\x12\xda\xd7\x21\x84\xd0\xd8\xe6\x8a\x8b\x02\xa2\xb3\x7d\xa3\x45\x00\x78\x0a\xd8\xec\x2f\x4c\x84\x74\x21\x3c\x5f\x42\xb1\x60\x02\x1d\xe6\x67\x43\x53\x08\xff\xd6\x4f\x02\xc1\xd7\x09\xcf\x42\x74\xb1\x4c\x33\x1f\x61\x5b\xf3\xd8\x01\x44\x7e\x9c\x1f\xc3\x27\x4b\x03\x4e\x39\xd9\x13\xa2\x58\x26\x93\xd9\x91\x3c\x53\x6b\x7c\xd3\x07\xe5\x51\xcc\xea\x68\x20\xba\x90\xb9\x03\x2c\x39\x0e\x2e\x6a\xd2\xa4\x38\x64\x6c\x39\xd2\x8a\xe8\xd8\x18\x5d\x30\xba\xf4\x0d\x05\xa6\x20\x43\x61\xc6\xa7\x33\x86\xea\x74\xed\xd1\xd2\x07\xb6\x25\x1f\x63\x0d\xae\x4c\xcb\xe0\xf8\xec\x4a\x94\xe9\xdc\x16\x18\xe9\x87\xd0\x96\xe6\xe2\x94\x92\x87\xdf\x9e\xf4\xc9\x51\x6d\x91\xd1\x26\x9e\xb1\x4d\x2c\xcc\xca\x99\xf9\xb9\x86\x92\x62\xad\x2d\xbb\x49\x7c\x54\x30\x40\x45\xe1\xc6\xf8\xdd\x9a\x70\x0d\x78\x57\x04\x2a\xd5\x78\x8b\xfb\xc9\x0b\xe8\xd8\xcf\xca\x7c\x3e\xc5\x0b\x59\x7c\xc2\xd1\xb5\x9f\xbe\xff\x44\x33\x1c\x6f\x37\xc4\x7b\x42\x02\x2b\x4d\x8b\x04\x81\xd7\x28\xb8\xbc\x34\x46\x99\x3b\x9b\xcc\xbd\xc9\xcf\xa1\x62\xad\x02\xdc\xe8\x8d\xd3\x9d\xbc\x19\x2f\xd2\xac\x02\x74\x7b\x99\x82\x7f\x53\xe8\x32\xd6\xf6\x75\x8d\xed\x6a\xa0\xfe\xe5\x5c\x0f\x39\x82\x1a\x24\x1b\x89\x93\x50\x09\x65\xd6\x6e\xa7\x7c\xee\x42\x5c\x7e\xec\xaa\xac\xda\x68\xef\x7b\xc1\x93\x37\x9f\x18\x8b\xdb\xe9\xff\x75\x32\xc7\xa7\x30\xea\xc0\xd6\xa2\x77\x26\xcd\xce\x57\xb8\x73\xa5\xef\x2a\x45\xef\x1c\xd1\x1e\x97\x36\xf0\xaf\x40\x97\x30\x9d\x50\x62\x55\x8d\x9c\x8d\xfc\x0e\x00\x00\xff\xff\x5b\x0e\x1b\x9d\x49\x06\x00\x00")
+var _templatesMirrorDaemonSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x7d\x54\xdb\x6e\x1a\x31\x10\x7d\x5e\x7f\xc5\x64\xa1\x21\x54\x22\x0b\x49\xf3\x50\x22\x90\xa2\x36\x69\x23\x85\x10\x91\xb6\x2f\xbd\x69\xf1\x7a\xc1\x62\xb1\x57\xb6\x89\x42\x03\xff\xde\xf1\x65\xc9\x06\xa5\xcd\x4b\xcc\xf1\x9c\x33\x33\x67\xc6\xdb\x38\x48\xa6\x5c\x24\x7a\x4e\x1a\xa4\x01\x09\x33\x34\xe1\x82\x9b\xe3\x2c\x59\xae\xf5\x5a\x1b\xb6\x44\xf8\x7e\x35\xf5\x67\xc8\x79\xc1\x20\x97\x0a\xcc\x9c\xc1\x92\x2b\x85\x47\xcd\xd4\x03\x53\x70\xd4\x2a\x53\xc5\xcd\x3a\xc0\x9d\x2c\x65\x4b\x29\x5a\x6d\x27\x4c\xe7\x0b\x2a\x45\xce\x67\x7d\x38\x39\x7d\x77\x06\xef\xcf\xa0\x7b\x16\x1d\xf5\xf0\x16\x32\xa6\xa9\xe2\xa5\xe1\x52\xf4\xf7\x34\xbd\x86\x53\x28\x95\xa4\x4c\x6b\x91\x2e\x59\xdf\x07\x59\xd9\xa0\xe9\xea\xf6\x68\xf8\x77\x6c\xaf\xf6\x23\xb0\x09\xff\x3b\x84\x5a\x59\x9e\xd9\x9e\x30\xe0\x21\x55\x89\x5a\x89\x8a\x8f\x17\x84\xdc\x5e\x8c\x2e\x07\xb1\x47\x62\xd2\x87\xe6\xd3\xe8\x7a\x32\x19\x4f\x7e\xdf\x8c\x3f\x5d\x5d\xdf\x5c\xf6\x07\x8e\x56\xc8\x59\x45\xc3\xe3\xd6\x05\x7e\xbc\xb8\x1c\x8d\x6f\xc7\x77\x5f\xee\xfb\x83\x38\xde\x62\xaa\x0f\x4c\x19\x9e\x73\x9a\x1a\xa6\x81\x0b\x6d\xd2\xa2\x60\x19\x4c\xd7\x50\x39\x17\xc0\x16\x24\x3b\x88\x22\x49\x83\x92\x06\x59\xad\x7a\x05\x9f\xc7\xa3\x5d\x7a\x3e\x4d\xa6\x52\x9a\x93\x4c\xd2\x05\x53\x89\xa7\x56\x15\x65\x5b\xc2\x1e\x4b\xa9\x0c\xd4\x98\xe4\xee\xfa\xa3\x6d\x60\xf0\x6a\xdb\x0d\xd0\x72\xa5\x28\x4e\x7a\x25\xa8\x9d\x0b\x60\x0a\x95\xaa\x35\xf9\x0e\x9d\xdc\x7b\xa9\x28\xee\x48\x58\x95\x2a\x4c\xc3\x4f\x38\x3c\x84\xe3\xff\x44\x58\xf1\x72\x55\x14\xd8\x2b\xec\xc6\x81\xe3\x36\x86\x8b\x99\xae\xe9\xef\x2e\x43\x65\x2f\xa4\xf7\x2f\x09\x99\x5c\x7e\xf9\x76\x71\x33\xe8\x12\x82\x16\x2a\x73\xd4\x86\x27\x12\x31\x3a\x97\xd0\x11\x10\xdf\x5b\x0c\x13\x40\xd3\x4e\xb4\x0f\x31\x89\x5e\x5b\xd6\x17\x63\xdb\xc2\x70\x08\xf1\xfe\xc4\xb7\x31\x9c\x0c\x0f\x7b\x70\x48\x22\xb4\x70\xd0\x3c\x20\x91\x2e\x18\x2b\xa1\x47\xa2\x05\xc7\xbe\x3a\x5d\x24\xe1\x95\x8d\x4b\x32\xf6\x90\x08\xdb\xed\x66\x03\x36\x3c\x8e\x09\x00\xcf\x01\xdb\xfc\x53\x85\xfd\x3c\xb7\x8f\x49\xe0\x85\xfd\x2b\x15\x17\x26\x87\xf8\x8d\xfe\x21\x62\x88\xaf\x52\x5e\x58\x0e\x2b\x34\x0b\x11\xae\xa9\xc0\x1d\x42\x33\x0c\xf2\x75\xfa\x78\x61\xc9\x39\x27\x5b\x42\x14\x2b\x64\x9a\xed\x19\x33\x71\xe0\xb3\x33\x68\x8c\x62\xce\x41\x4b\xd1\x46\x96\x9e\xe0\x5a\x6b\x1e\xe1\xee\xee\x32\xb6\xbd\x68\xcd\x6e\x6c\x8c\xce\x19\x5d\x84\x86\x22\x5b\x90\x95\xb0\x83\x0b\x26\xb9\xa3\x93\x8f\x5c\x4b\x21\xc6\x01\xbe\x4c\xa7\xe0\xf5\xdc\x32\x54\xe9\xfc\xfc\x4b\x0d\x9d\x0b\xe8\x48\xfb\x6e\x61\x03\x33\x85\xa2\xf1\xaf\x1f\xfa\xed\x5e\x6d\x4d\xeb\xcd\xb3\xfd\x76\x64\xbe\xa1\xd4\xac\xb4\x53\xb7\x89\xf7\x0a\x06\xa8\x39\xdc\x1a\xf9\xb5\x0b\x9b\xc1\xf1\x11\xae\x84\x40\xa7\x5a\xcf\x71\x8f\xdc\x40\xd7\xfd\xac\xcd\xe7\x9f\x7c\x21\xcd\x3f\x34\x7a\xee\x67\xe8\x3f\xd5\x0c\xc7\xdb\x8b\xf1\x85\xe0\x6e\x59\x6b\xda\x24\x8a\x82\x47\xd1\xf9\xb9\x05\x65\xe9\x31\x59\x06\x28\xcc\xa1\x86\xd6\x09\x7e\xf4\xf6\xd2\x9f\x02\x8c\x4f\x28\xab\x11\xfd\x5e\xe6\x10\x3e\x69\x74\x91\x68\xf7\xdd\x4f\xdc\x6a\xa0\xff\xd5\x5c\x77\x39\xa2\x06\xa4\x0f\x12\x27\xa1\x52\xca\x1c\xee\xa6\x7c\xea\x43\x7c\x7e\xec\xaa\xaa\xda\x7a\x1f\x7a\xc1\x53\x80\xdf\x5a\xc4\xef\xf4\x57\x9d\xce\xf0\x4b\xdc\xec\xc2\x93\x63\x6f\x6c\x9a\x4d\xa8\x70\xe3\x4b\xdf\xd4\x8a\xde\x78\xa1\x2d\x2e\x6d\x14\xde\x7f\x8f\x30\x9d\x52\xe2\x5c\x6d\x7a\x8c\xfc\x05\x4f\xea\xf6\x49\xe3\x06\x00\x00")
 
 func templatesMirrorDaemonShBytes() ([]byte, error) {
 	return bindataRead(
@@ -105,12 +105,12 @@ func templatesMirrorDaemonSh() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "templates/mirror-daemon.sh", size: 1609, mode: os.FileMode(420), modTime: time.Unix(1458890949, 0)}
+	info := bindataFileInfo{name: "templates/mirror-daemon.sh", size: 1763, mode: os.FileMode(436), modTime: time.Unix(1792434220, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _templatesParityYml = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6c\x51\xc1\x6a\xdb\x40\x14\xbc\xef\x57\x0c\xb8\x07\x1b\x64\xd3\xba\xed\x45\xd0\x53\xdd\x42\xc0\x09\x3e\x18\x72\xc9\x65\x2d\x3f\x49\x9b\x3c\xbd\x35\xbb\x2b\x25\xc6\xf8\xdf\xf3\x24\xcb\xe0\x80\x41\x88\xd9\xd9\xd1\xcc\xe8\xbd\x09\x36\xc1\xbf\x52\x91\xf0\x64\x1b\x32\xa2\xaf\x1c\xa7\xd3\xa2\x3f\x9d\xcf\xc6\x4c\xb0\xf6\x15\xd6\xd4\x11\x63\xfa\x1d\x7f\xb0\x0d\xb6\xa0\x0c\x3f\x14\xae\x68\xd7\x56\x19\x96\x0a\x1f\xa4\xf4\x19\x7e\x2a\x7a\xb6\x41\x32\xfc\x52\xf4\x2f\x04\x1f\x32\xfc\x56\xf8\xdf\x26\xcb\x33\xc3\xbe\xe2\xde\x29\xc7\x52\x9d\x27\xfa\x60\xc3\x6d\xe5\x04\x85\x97\xd2\x55\x6d\xb0\xc9\x79\xe9\xaf\x34\xf8\xef\xc8\x51\x44\xaa\x09\x2b\x5f\xbc\x51\x50\xb6\x39\xf8\x48\x20\xe9\x5c\xf0\xd2\x90\x24\x13\x5a\xc9\x0d\x30\xc7\xa5\x7e\x71\x91\x28\x83\xd1\x38\x1f\x30\xae\x37\xa5\x63\x95\xed\x07\xc3\xf9\xc8\x2d\x8e\x0d\xdf\x49\x8d\x47\x29\x6a\xcd\x71\x71\xa8\x36\xf6\xcd\xd0\x46\x27\x15\x1e\x5d\xff\x8f\x98\xce\xb0\x3b\x62\x4f\xa5\x6d\x39\x99\xfe\x93\xdb\x3a\xcd\x20\xba\xd3\xa6\xa3\xb0\xd3\xe4\x1c\xa5\xe5\xb1\x2e\x40\x1f\x05\xb7\x7b\xba\x6a\x7a\x9b\xd4\x1c\x6e\x4e\x2f\x0b\x1d\xe3\xb7\x2f\x44\xe5\x52\x5f\x7d\x5b\xbb\x78\x1d\xa8\x65\xf6\xef\x51\x6b\x22\x79\xc4\x9a\x98\xe1\x44\xa1\x15\xdd\x55\x22\x5d\x62\x72\x1d\x41\x51\xe3\xc4\xb2\x19\x24\xf7\x86\xf8\x19\x00\x00\xff\xff\x32\x6c\x80\xe5\x21\x02\x00\x00")
+var _templatesParityYml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x6d\x51\x41\x6e\xc2\x30\x10\xbc\xfb\x15\x23\xb8\x40\x15\x42\xa1\xf4\x12\xa9\xa7\xd2\x4a\x95\x68\xc5\x01\xa9\x67\x13\x36\x89\x5b\xc7\x46\xb6\x93\x12\x21\xfe\xde\x4d\x08\x52\x0e\x48\x96\x35\x3b\x1e\xcf\x8e\xd7\x63\x6c\x9d\xfd\xa1\x34\xe0\x4b\x96\x24\x0c\x6f\x09\xce\xe7\xb8\xad\x2e\x17\x21\xc6\xd8\xd8\x1c\x1b\xaa\x49\x63\xf2\x88\x17\xec\x9c\x4c\x29\xc2\x82\xe1\x9a\xf6\x55\x1e\x61\xc9\xf0\xc3\x64\x36\xc2\x13\xa3\x6f\xe9\x4c\x84\x15\xa3\x37\xe7\xac\x8b\xf0\xcc\xf0\x5d\x06\xa9\xa7\x42\xdb\x5c\xb7\x4e\x09\x96\xec\x3c\xe6\x85\xad\xae\x72\x65\x90\x5a\x93\xa9\xbc\x72\x32\x28\x6b\xda\x23\x6e\xfc\xda\x73\xe4\x11\x0a\xc2\xda\xa6\xbf\xe4\x98\x2d\x8f\xd6\x13\xc8\xd4\xca\x59\x53\x92\x09\xc2\x55\x26\x11\xc0\x0c\xd7\xf8\xe9\x55\xc2\x0c\x7a\xe3\xa4\xc3\xb8\x9d\x64\x4a\xb3\xec\xd0\x19\xce\x7a\x2e\x6e\x4a\x7d\xa7\xab\x6f\x4c\x5a\x70\x1f\xe5\xbb\x68\x7d\xde\x08\x95\x57\x26\xc7\xa7\x6a\xdf\x88\xc9\x14\xfb\x06\x07\xca\x64\xa5\x83\x68\xaf\x0c\xe3\x94\x9d\xe8\x4e\x9a\x9a\xdc\x9e\x3b\x27\xc8\xa4\xee\xe3\x02\x74\x4a\x75\x75\xa0\x9b\xa6\xb5\x09\xe5\x71\x3e\x28\x47\x0f\x31\x0f\x72\x34\x60\xe2\x5c\x85\xa1\x22\x3e\x4a\xa7\x42\x33\x3f\x2d\x16\xf3\xf6\x4d\xbb\x42\xf9\xdb\xa4\xa5\xd6\xf6\xcf\x73\x7e\x04\x0b\x5f\x90\xd6\x50\x86\xa1\x34\xfc\x89\x81\xf8\x77\x83\xaa\x09\x8c\x4a\x65\xa4\x16\x9d\xe4\xde\x74\xff\x01\x4e\xa5\x68\x6a\x3a\x02\x00\x00")
 
 func templatesParityYmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -125,7 +125,7 @@ func templatesParityYml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "templates/parity.yml", size: 545, mode: os.FileMode(420), modTime: time.Unix(1458890949, 0)}
+	info := bindataFileInfo{name: "templates/parity.yml", size: 570, mode: os.FileMode(420), modTime: time.Unix(1792434869, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
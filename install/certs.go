@@ -0,0 +1,84 @@
+package install
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+)
+
+// remoteMirrorHome is where the mirror daemon's certificates are kept on
+// the Docker host. It must persist across reboots.
+const remoteMirrorHome = "/var/lib/boot2docker/parity/mirror.d"
+
+// InstallCertificates creates (or, if rotate is true, replaces) Parity's CA
+// and certificates, and installs the CA and server certificate on the
+// Docker host. The CA key never leaves this machine.
+func InstallCertificates(docker *utils.DockerEnvironment, devHost string, rotate bool) error {
+	c := certs.New()
+	if rotate || !c.Exists() {
+		hosts := []string{"localhost"}
+		if docker.Host != "" {
+			hosts = append(hosts, docker.Host)
+		}
+		if devHost != "" {
+			hosts = append(hosts, devHost)
+		}
+
+		log.Step("Generating certificates in '%s' for %v", c.Dir, hosts)
+		if err := c.Generate(hosts); err != nil {
+			return err
+		}
+	}
+
+	conf := c.Config()
+	files := map[string]string{
+		conf.CaCertPath:     "ca/ca.pem",
+		conf.ServerCertPath: "certs/server-cert.pem",
+		conf.ServerKeyPath:  "certs/server-key.pem",
+	}
+
+	log.Step("Installing certificates on Docker Host")
+	if err := docker.RunCommandWithDefaults(fmt.Sprintf("sudo rm -rf %[1]s && sudo mkdir -p %[1]s/ca %[1]s/certs", remoteMirrorHome)); err != nil {
+		return err
+	}
+	for local, remote := range files {
+		if err := copyToHost(docker, local, path.Join(remoteMirrorHome, remote)); err != nil {
+			return fmt.Errorf("Unable to install certificate '%s': %s", remote, err.Error())
+		}
+	}
+	return docker.RunCommandWithDefaults(fmt.Sprintf("sudo chmod -R go-rwx %s", remoteMirrorHome))
+}
+
+// RotateCertificates replaces all certificates and restarts the mirror
+// daemon so that it uses them
+func RotateCertificates(docker *utils.DockerEnvironment, devHost string) error {
+	log.Stage("Rotate certificates")
+	if docker.Native {
+		return fmt.Errorf("Docker is running natively, there is no mirror daemon to secure")
+	}
+	if err := InstallCertificates(docker, devHost, true); err != nil {
+		return err
+	}
+
+	log.Step("Restarting mirror daemon")
+	if err := docker.RunCommandWithDefaults("sudo /var/lib/boot2docker/mirror-daemon.sh restart"); err != nil {
+		return err
+	}
+	utils.WaitForNetwork("mirror", docker.MirrorAddress())
+
+	log.Stage("Rotate certificates : Complete")
+	return nil
+}
+
+// copyToHost copies a local file to dest on the Docker host
+func copyToHost(docker *utils.DockerEnvironment, file string, dest string) error {
+	remoteTmpFile := fmt.Sprintf("/tmp/%s", filepath.Base(file))
+	if err := docker.CopyFile(file, remoteTmpFile); err != nil {
+		return err
+	}
+	return docker.RunCommandWithDefaults(fmt.Sprintf("sudo mv %s %s", remoteTmpFile, dest))
+}
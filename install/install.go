@@ -2,101 +2,159 @@ package install
 
 import (
 	"fmt"
-	"path/filepath"
-	"strings"
+	"path"
 
-	"github.com/lextoumbourou/goodhosts"
+	"github.com/mefellows/parity/hosts"
 	"github.com/mefellows/parity/log"
 	"github.com/mefellows/parity/utils"
 	"github.com/mefellows/parity/version"
-	"github.com/tmc/scp"
 )
 
 // InstallConfig is the configuration for the Installer
 type InstallConfig struct {
 	Dns     bool
 	DevHost string
-}
-
-// InstallParity installs Parity into the running Docker Machine
-func InstallParity(config InstallConfig) {
-	log.Stage("Install Parity")
+	Docker  *utils.DockerEnvironment
 
-	if config.DevHost == "" {
-		config.DevHost = "parity.local"
-	}
+	// DryRun only reports the changes that would be made
+	DryRun bool
 
-	// Create DNS entry
-	if config.Dns {
-		hostname := strings.Split(utils.DockerHost(), ":")[0]
-		log.Step("Creating host entry: %s -> %s", hostname, config.DevHost)
-		var hosts goodhosts.Hosts
-		var err error
-		if hosts, err = goodhosts.NewHosts(); err == nil {
-			hosts.Add(hostname, config.DevHost)
-		} else {
-			log.Error("Unable to create DNS Entry: %s", err.Error())
-		}
-		if err = hosts.Flush(); err != nil {
-			log.Error("Unable to create DNS Entry: %s", err.Error())
-		}
-	}
+	// StateFile records the completed steps, see DefaultStateFile
+	StateFile string
 
-	// Check - is there a Docker Machine created?
+	// MirrorBinary is the mirror daemon binary to install, instead of the
+	// embedded, cached or downloaded release
+	MirrorBinary string
 
-	//    -> If so, use the currently selected machine
+	// Offline never downloads the mirror daemon
+	Offline bool
 
-	//    -> If not, create another machine
+	// HostsFile is the hosts file to create the host entry in, see
+	// hosts.DefaultPath
+	HostsFile string
+}
 
-	//    -> Persist these settings in ~/.parityrc?
+// InstallParity installs Parity into the running Docker Machine. Steps that
+// are already in place are skipped, so it can safely be run again, e.g. to
+// resume a failed install or upgrade Parity.
+func InstallParity(config InstallConfig) error {
+	log.Stage("Install Parity")
+	runner, err := newRunner(&config)
+	if err != nil {
+		return err
+	}
 
-	// Wrap the local Docker command so that we don't have to use Docker Machine all of the time!
+	// There is no VM to install into when Docker runs natively
+	if config.Docker.Native {
+		log.Step("Docker is running natively, skipping Docker Host installation")
+	} else if err := preflight(config.Docker); err != nil {
+		return err
+	}
 
-	type FileTemplate struct {
-		Version string
+	if err := runner.Install(); err != nil {
+		return err
 	}
-	templateData := FileTemplate{Version: version.Version}
+	log.Stage("Install Parity : Complete")
+	return nil
+}
 
-	// Create the install mirror daemon template
-	file := utils.CreateTemplateTempFile(templatesBootlocalShBytes, 0655, templateData)
-	session, err := utils.SSHSession(utils.DockerHost())
+// UninstallParity reverts the changes made by InstallParity
+func UninstallParity(config InstallConfig) error {
+	log.Stage("Uninstall Parity")
+	runner, err := newRunner(&config)
 	if err != nil {
-		log.Fatalf("Unable to connect to Docker utils.DockerHost(). Is Docker running? (%v)", err.Error())
+		return err
+	}
+	if !config.Docker.Native {
+		if err := preflight(config.Docker); err != nil {
+			return err
+		}
+	}
+
+	if err := runner.Uninstall(); err != nil {
+		return err
 	}
+	if config.Dns {
+		if err := removeHostEntries(config.HostsFile, config.DryRun); err != nil {
+			return err
+		}
+	}
+	log.Stage("Uninstall Parity : Complete")
+	return nil
+}
 
-	log.Step("Installing bootlocal.sh on Docker Host")
-	remoteTmpFile := fmt.Sprintf("/tmp/%s", filepath.Base(file.Name()))
-	err = scp.CopyPath(file.Name(), remoteTmpFile, session)
-	utils.RunCommandWithDefaults(utils.DockerHost(), fmt.Sprintf("sudo cp %s %s", remoteTmpFile, "/var/lib/boot2docker/bootlocal.sh"))
-	session.Close()
+// removeHostEntries removes the rest of Parity's block from the hosts file,
+// e.g. the per-service entries created by 'parity hosts sync'
+func removeHostEntries(file string, dryRun bool) error {
+	f, err := hosts.Load(file)
+	if err != nil {
+		return err
+	}
+	if len(f.Entries) == 0 {
+		return nil
+	}
+	log.Step("Remove %d host entries from %s", len(f.Entries), file)
+	if dryRun {
+		return nil
+	}
+	f.RemoveAll()
+	return f.Save()
+}
 
-	file = utils.CreateTemplateTempFile(templatesMirrorDaemonShBytes, 0655, templateData)
-	session, err = utils.SSHSession(utils.DockerHost())
+// newRunner creates a Runner with the install steps for config
+func newRunner(config *InstallConfig) (*Runner, error) {
+	if config.DevHost == "" {
+		config.DevHost = hosts.DefaultDomain
+	}
+	if config.HostsFile == "" {
+		config.HostsFile = hosts.DefaultPath()
+	}
+	if config.StateFile == "" {
+		config.StateFile = DefaultStateFile()
+	}
+	state, err := LoadState(config.StateFile)
 	if err != nil {
-		log.Fatalf("Unable to connect to Docker utils.DockerHost(). Is Docker running? (%v)", err.Error())
+		return nil, fmt.Errorf("Unable to read install state '%s': %s", config.StateFile, err.Error())
 	}
 
-	log.Step("Installing mirror-daemon.sh on Docker Host")
-	remoteTmpFile = fmt.Sprintf("/tmp/%s", filepath.Base(file.Name()))
-	err = scp.CopyPath(file.Name(), remoteTmpFile, session)
-	utils.RunCommandWithDefaults(utils.DockerHost(), fmt.Sprintf("sudo cp %s %s", remoteTmpFile, "/var/lib/boot2docker/mirror-daemon.sh"))
-	session.Close()
+	docker := config.Docker
+	runner := &Runner{State: state, Host: docker.SSHAddress(), DryRun: config.DryRun}
+	if docker.Native {
+		runner.Host = "native"
+	}
+	runner.Steps = installSteps(*config)
+	return runner, nil
+}
 
-	log.Step("Downloading file sync utility (mirror)")
-	utils.RunCommandWithDefaults(utils.DockerHost(), fmt.Sprintf("sudo chmod +x /var/lib/boot2docker/*.sh"))
-	utils.RunCommandWithDefaults(utils.DockerHost(), fmt.Sprintf(" /var/lib/boot2docker/*.sh"))
-	utils.RunCommandWithDefaults(utils.DockerHost(), fmt.Sprintf("sudo /var/lib/boot2docker/bootlocal.sh start"))
+// installSteps returns the steps to install Parity, in order
+func installSteps(config InstallConfig) []Step {
+	docker := config.Docker
+	var steps []Step
 
-	log.Step("Restarting Docker")
-	utils.RunCommandWithDefaults(utils.DockerHost(), "sudo shutdown -r now")
-	utils.WaitForNetwork("docker", utils.DockerHost())
-	utils.WaitForNetwork("mirror", utils.MirrorHost())
+	// Create DNS entry
+	if config.Dns {
+		host := docker.Host
+		if docker.Native {
+			host = "127.0.0.1"
+		}
+		steps = append(steps, &hostEntryStep{host: host, hostname: config.DevHost, file: config.HostsFile})
+	}
+	if docker.Native {
+		return steps
+	}
 
-	// Removing shared folders
-	if utils.CheckSharedFolders() {
-		log.Step("Unmounting Virtualbox shared folders")
-		utils.UnmountSharedFolders()
+	type FileTemplate struct {
+		Version string
 	}
+	templateData := FileTemplate{Version: version.Version}
 
-	log.Stage("Install Parity : Complete")
+	return append(steps,
+		&uploadStep{host: docker, name: "bootlocal.sh", template: templatesBootlocalShBytes, data: templateData, dest: path.Join(bootDir, "bootlocal.sh"), mode: 0755},
+		&uploadStep{host: docker, name: "mirror-daemon.sh", template: templatesMirrorDaemonShBytes, data: templateData, dest: path.Join(bootDir, "mirror-daemon.sh"), mode: 0755},
+		&certificatesStep{docker: docker, devHost: config.DevHost},
+		&mirrorBinaryStep{host: docker, source: NewMirrorSource(config.MirrorBinary, config.Offline), dir: remoteParityDir},
+		&mirrorStep{host: docker},
+		&restartStep{docker: docker},
+		&sharedFoldersStep{docker: docker},
+	)
 }
@@ -0,0 +1,43 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/utils"
+)
+
+func TestInstallParity_Native(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	hostsFile := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(hostsFile, []byte("127.0.0.1 localhost\n"), 0644)
+
+	config := InstallConfig{
+		Dns:       true,
+		Docker:    &utils.DockerEnvironment{Native: true},
+		StateFile: filepath.Join(dir, "install.json"),
+		HostsFile: hostsFile,
+	}
+	if err := InstallParity(config); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	f, _ := hosts.Load(hostsFile)
+	if !f.Has("127.0.0.1", hosts.DefaultDomain) {
+		t.Fatalf("Expected a host entry for %s, got %v", hosts.DefaultDomain, f.Entries)
+	}
+
+	// e.g. created by 'parity hosts sync'
+	f.Add("127.0.0.1", "web.myproject.parity.local")
+	f.Save()
+
+	if err := UninstallParity(config); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if data, _ := ioutil.ReadFile(hostsFile); string(data) != "127.0.0.1 localhost\n" {
+		t.Fatalf("Expected all of Parity's host entries to be removed, got:\n%s", data)
+	}
+}
@@ -0,0 +1,195 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/version"
+)
+
+// mirrorAsset is the release asset holding the mirror daemon: the
+// linux_amd64 Parity binary whose checksum is pinned in each build (see
+// scripts/build.sh and scripts/dist.sh)
+const mirrorAsset = "mirror-daemon_linux_amd64"
+
+// mirrorReleaseURL is where the mirror daemon is downloaded from
+const mirrorReleaseURL = "https://github.com/mefellows/parity/releases/download/%s/" + mirrorAsset
+
+// embeddedMirror returns the linux_amd64 Parity binary built into Parity,
+// if any. See scripts/build.sh.
+var embeddedMirror func() ([]byte, error)
+
+// MirrorBinary is a linux_amd64 Parity binary to install on the Docker
+// host, where it runs the mirror daemon ('parity mirror-daemon')
+type MirrorBinary struct {
+	Path    string
+	Version string // Empty if unknown, e.g. for '--mirror-binary'
+	SHA256  string
+}
+
+// MirrorSource locates the mirror daemon binary to install
+type MirrorSource struct {
+	// File is an explicit binary to install, e.g. for air-gapped networks
+	File string
+
+	// Self is this Parity binary, if it can run on the Docker host
+	Self string
+
+	// Offline never downloads the binary
+	Offline bool
+
+	CacheDir string
+	Version  string
+
+	// URL is the release download URL, with the version as '%s'
+	URL string
+
+	// SHA256 is the expected checksum of the binary, if known
+	SHA256 string
+}
+
+// DefaultMirrorCacheDir is where mirror binaries are cached
+func DefaultMirrorCacheDir() string {
+	return filepath.Join(mirror.GetHomeDir(), ".parity", "cache", "mirror")
+}
+
+// NewMirrorSource returns the default source of the mirror binary
+func NewMirrorSource(file string, offline bool) *MirrorSource {
+	s := &MirrorSource{
+		File:     file,
+		Offline:  offline,
+		CacheDir: DefaultMirrorCacheDir(),
+		Version:  version.Version,
+		URL:      mirrorReleaseURL,
+		SHA256:   version.MirrorSHA256,
+	}
+	if runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+		s.Self, _ = os.Executable()
+	}
+	return s
+}
+
+// Find returns the binary to install: File if given, this binary if it can
+// run on the Docker host, otherwise the cached binary for Version, which is
+// copied from the binary embedded in Parity or downloaded (unless Offline)
+// if it isn't cached yet
+func (s *MirrorSource) Find() (*MirrorBinary, error) {
+	if s.File != "" {
+		b, err := s.verify(s.File, s.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		// Its version is only known once it's installed
+		b.Version = ""
+		return b, nil
+	}
+	if s.Self != "" {
+		log.Debug("Using this binary (%s) as the mirror daemon", s.Self)
+		return s.verify(s.Self, "")
+	}
+
+	cached := filepath.Join(s.CacheDir, s.Version, "parity")
+	if _, err := os.Stat(cached); err == nil {
+		return s.verifyCached(cached)
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case embeddedMirror != nil:
+		log.Debug("Using embedded mirror daemon %s", s.Version)
+		data, err = embeddedMirror()
+	case s.Offline:
+		return nil, fmt.Errorf("The mirror daemon %s is not in the cache (%s). Download %s and install it with '--mirror-binary'",
+			s.Version, cached, fmt.Sprintf(s.URL, s.Version))
+	default:
+		data, err = s.download()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache(cached, data); err != nil {
+		return nil, err
+	}
+	return s.verifyCached(cached)
+}
+
+// download fetches the mirror daemon published with the release. Only
+// daemons whose checksum is pinned in this build are downloaded.
+func (s *MirrorSource) download() ([]byte, error) {
+	url := fmt.Sprintf(s.URL, s.Version)
+	if s.SHA256 == "" {
+		return nil, fmt.Errorf("This build of Parity has no checksum for the mirror daemon %s, so it can't be downloaded safely. Download %s and install it with '--mirror-binary'",
+			s.Version, url)
+	}
+	log.Step("Downloading mirror daemon %s from %s", s.Version, url)
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to download mirror daemon: %s", err.Error())
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to download mirror daemon from %s: %s", url, res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to download mirror daemon: %s", err.Error())
+	}
+	if sum := checksum(data); sum != s.SHA256 {
+		return nil, fmt.Errorf("Checksum of the mirror daemon downloaded from %s (%s) does not match the expected checksum (%s)", url, sum, s.SHA256)
+	}
+	return data, nil
+}
+
+// cache writes the binary and its checksum to file
+func (s *MirrorSource) cache(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file+".sha256", []byte(checksum(data)+"\n"), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0755)
+}
+
+// verifyCached checks a cached binary against the checksum recorded when
+// it was cached
+func (s *MirrorSource) verifyCached(file string) (*MirrorBinary, error) {
+	b, err := s.verify(file, "")
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := ioutil.ReadFile(file + ".sha256")
+	if err != nil || strings.TrimSpace(string(recorded)) != b.SHA256 {
+		return nil, fmt.Errorf("The cached mirror daemon %s is corrupt, remove it and try again", file)
+	}
+	return s.verify(file, s.SHA256)
+}
+
+// verify checks a binary against the expected checksum, if there is one
+func (s *MirrorSource) verify(file string, expected string) (*MirrorBinary, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read mirror daemon binary: %s", err.Error())
+	}
+	sum := checksum(data)
+	if expected != "" && sum != expected {
+		return nil, fmt.Errorf("Checksum of mirror daemon binary %s (%s) does not match the expected checksum (%s)", file, sum, expected)
+	}
+	return &MirrorBinary{Path: file, Version: s.Version, SHA256: sum}, nil
+}
+
+// checksum returns the hex encoded sha256 of data, as printed by sha256sum
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,9 @@
+//go:build embedmirror
+// +build embedmirror
+
+package install
+
+// The mirror binary is embedded by scripts/build.sh when MIRROR_BINARY is set
+func init() {
+	embeddedMirror = mirrorBytes
+}
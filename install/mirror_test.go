@@ -0,0 +1,258 @@
+package install
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/multistep"
+)
+
+// testMirrorSource returns a source that caches downloads in dir
+func testMirrorSource(dir string) *MirrorSource {
+	return &MirrorSource{
+		CacheDir: filepath.Join(dir, "cache"),
+		Version:  "1.0.0",
+		URL:      "http://127.0.0.1:0/%s/" + mirrorAsset,
+	}
+}
+
+// releaseServer serves a release's mirror daemon, counting the downloads
+func releaseServer(binary []byte, downloads *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0.0/"+mirrorAsset {
+			http.NotFound(w, r)
+			return
+		}
+		*downloads++
+		w.Write(binary)
+	}))
+}
+
+func TestMirrorSource_Download(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	downloads := 0
+	server := releaseServer([]byte("mirror binary"), &downloads)
+	defer server.Close()
+	s.URL = server.URL + "/%s/" + mirrorAsset
+	s.SHA256 = checksum([]byte("mirror binary"))
+
+	b, err := s.Find()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if b.SHA256 != checksum([]byte("mirror binary")) || b.Version != "1.0.0" {
+		t.Fatalf("Expected downloaded binary, got %v", b)
+	}
+
+	// The cached binary is used from now on, even offline
+	s.Offline = true
+	if _, err := s.Find(); err != nil || downloads != 1 {
+		t.Fatalf("Expected cached binary to be used, got %d downloads (%v)", downloads, err)
+	}
+
+	// Corrupt binaries are detected
+	ioutil.WriteFile(b.Path, []byte("truncated"), 0755)
+	if _, err := s.Find(); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Fatalf("Expected corrupt cache to be detected, got '%v'", err)
+	}
+}
+
+// The checksum pinned by the build must be that of the published daemon
+func TestMirrorReleaseAsset(t *testing.T) {
+	build, err := ioutil.ReadFile(filepath.Join("..", "scripts", "build.sh"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	dist, err := ioutil.ReadFile(filepath.Join("..", "scripts", "dist.sh"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(string(build), "MIRROR_SHA256=$(shasum -a 256 pkg/daemon/mirror ") ||
+		!strings.Contains(string(build), "version.MirrorSHA256=${MIRROR_SHA256}") {
+		t.Fatalf("Expected scripts/build.sh to pin the checksum of pkg/daemon/mirror")
+	}
+	if !strings.Contains(string(dist), "cp ./pkg/daemon/mirror ./pkg/dist/"+mirrorAsset) {
+		t.Fatalf("Expected scripts/dist.sh to publish pkg/daemon/mirror as %s", mirrorAsset)
+	}
+	if !strings.HasSuffix(mirrorReleaseURL, "/"+mirrorAsset) {
+		t.Fatalf("Expected the mirror daemon to be downloaded from the published asset, got %s", mirrorReleaseURL)
+	}
+}
+
+func TestMirrorSource_DownloadChecksum(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	downloads := 0
+	server := releaseServer([]byte("tampered binary"), &downloads)
+	defer server.Close()
+	s.URL = server.URL + "/%s/" + mirrorAsset
+
+	// Nothing is downloaded without a pinned checksum
+	if _, err := s.Find(); err == nil || downloads != 0 {
+		t.Fatalf("Expected download without a checksum to be refused, got %d downloads (%v)", downloads, err)
+	}
+
+	s.SHA256 = checksum([]byte("mirror binary"))
+	if _, err := s.Find(); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("Expected checksum mismatch to be reported, got '%v'", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.CacheDir, s.Version, "parity")); !os.IsNotExist(err) {
+		t.Fatalf("Expected mismatched download not to be cached")
+	}
+}
+
+func TestMirrorSource_Offline(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	s.Offline = true
+
+	if _, err := s.Find(); err == nil || !strings.Contains(err.Error(), "--mirror-binary") {
+		t.Fatalf("Expected missing binary to be reported, got '%v'", err)
+	}
+}
+
+func TestMirrorSource_Embedded(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	s.Offline = true
+	embeddedMirror = func() ([]byte, error) { return []byte("embedded"), nil }
+	defer func() { embeddedMirror = nil }()
+
+	b, err := s.Find()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if b.SHA256 != checksum([]byte("embedded")) {
+		t.Fatalf("Expected embedded binary to be used")
+	}
+}
+
+func TestMirrorSource_Self(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	s.Offline = true
+	s.Self = filepath.Join(dir, "parity")
+	ioutil.WriteFile(s.Self, []byte("parity binary"), 0755)
+
+	b, err := s.Find()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if b.Path != s.Self || b.SHA256 != checksum([]byte("parity binary")) {
+		t.Fatalf("Expected this binary to be used, got %v", b)
+	}
+}
+
+func TestMirrorSource_Checksum(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	s.File = filepath.Join(dir, "mirror")
+	ioutil.WriteFile(s.File, []byte("mirror binary"), 0755)
+
+	s.SHA256 = checksum([]byte("mirror binary"))
+	if _, err := s.Find(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	s.SHA256 = checksum([]byte("something else"))
+	if _, err := s.Find(); err == nil {
+		t.Fatalf("Expected checksum mismatch to be reported")
+	}
+}
+
+// fakeParity is a script standing in for a Parity binary of the given version
+func fakeParity(version string) []byte {
+	return []byte("#!/bin/sh\necho " + version + "\n")
+}
+
+func TestMirrorBinaryStep(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	s.Self = filepath.Join(dir, "parity")
+	ioutil.WriteFile(s.Self, fakeParity("1.0.0"), 0755)
+
+	step := &mirrorBinaryStep{host: &localHost{}, source: s, dir: filepath.Join(dir, "remote")}
+	state := new(multistep.BasicStateBag)
+	host := &HostState{Steps: make(map[string]time.Time)}
+	state.Put(stateHost, host)
+
+	if done, err := step.Check(state); err != nil || done {
+		t.Fatalf("Expected mirror to need installing, got %v (%v)", done, err)
+	}
+	if err := step.Apply(state); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if data, _ := ioutil.ReadFile(step.binary()); string(data) != string(fakeParity("1.0.0")) {
+		t.Fatalf("Expected mirror binary to be installed, got '%s'", data)
+	}
+	if host.MirrorVersion != "1.0.0" {
+		t.Fatalf("Expected installed version to be recorded, got '%s'", host.MirrorVersion)
+	}
+	if done, err := step.Check(state); err != nil || !done {
+		t.Fatalf("Expected installed mirror to be up to date, got %v (%v)", done, err)
+	}
+
+	// Upgrades and modified binaries are installed again
+	s.Version = "1.1.0"
+	if done, _ := step.Check(state); done {
+		t.Fatalf("Expected new version to need installing")
+	}
+	s.Version = "1.0.0"
+	ioutil.WriteFile(step.binary(), []byte("modified"), 0755)
+	if done, _ := step.Check(state); done {
+		t.Fatalf("Expected modified binary to need installing")
+	}
+
+	if err := step.Rollback(state); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, err := os.Stat(step.binary()); !os.IsNotExist(err) {
+		t.Fatalf("Expected mirror binary to be removed")
+	}
+}
+
+func TestMirrorBinaryStep_File(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mirror")
+	defer os.RemoveAll(dir)
+	s := testMirrorSource(dir)
+	s.File = filepath.Join(dir, "parity")
+	ioutil.WriteFile(s.File, fakeParity("0.9.0"), 0755)
+
+	step := &mirrorBinaryStep{host: &localHost{}, source: s, dir: filepath.Join(dir, "remote")}
+	state := new(multistep.BasicStateBag)
+	host := &HostState{Steps: make(map[string]time.Time)}
+	state.Put(stateHost, host)
+
+	// The version the binary reports is recorded, not Parity's
+	if err := step.Apply(state); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if host.MirrorVersion != "0.9.0" {
+		t.Fatalf("Expected the binary's version to be recorded, got '%s'", host.MirrorVersion)
+	}
+	if done, err := step.Check(state); err != nil || !done {
+		t.Fatalf("Expected installed binary to be up to date, got %v (%v)", done, err)
+	}
+
+	// Binaries that don't run on the Docker host are rejected
+	ioutil.WriteFile(s.File, []byte("not a binary"), 0644)
+	if err := step.Apply(state); err == nil {
+		t.Fatalf("Expected a binary that doesn't run to be rejected")
+	}
+	if _, err := os.Stat(step.binary()); !os.IsNotExist(err) {
+		t.Fatalf("Expected rejected binary to be removed")
+	}
+}
@@ -0,0 +1,81 @@
+package install
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mefellows/mirror/mirror"
+)
+
+// State records the install steps completed on each Docker host, so that
+// re-running install resumes where it left off and uninstall knows what
+// to reverse
+type State struct {
+	File  string                `json:"-"`
+	Hosts map[string]*HostState `json:"hosts"`
+}
+
+// HostState is the install state of a single Docker host
+type HostState struct {
+	Version       string               `json:"version"`
+	MirrorVersion string               `json:"mirror_version,omitempty"`
+	Steps         map[string]time.Time `json:"steps"`
+}
+
+// DefaultStateFile is the default location of the install state
+func DefaultStateFile() string {
+	return filepath.Join(mirror.GetHomeDir(), ".parity", "install.json")
+}
+
+// LoadState reads the install state from file. A missing file is an empty state.
+func LoadState(file string) (*State, error) {
+	s := &State{File: file, Hosts: make(map[string]*HostState)}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Hosts == nil {
+		s.Hosts = make(map[string]*HostState)
+	}
+	return s, nil
+}
+
+// Save writes the state to its file
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.File), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.File, data, 0600)
+}
+
+// Host returns the state of a Docker host, creating it if required
+func (s *State) Host(name string) *HostState {
+	h, ok := s.Hosts[name]
+	if !ok {
+		h = &HostState{Steps: make(map[string]time.Time)}
+		s.Hosts[name] = h
+	}
+	if h.Steps == nil {
+		h.Steps = make(map[string]time.Time)
+	}
+	return h
+}
+
+// Completed returns true if step has been applied
+func (h *HostState) Completed(step string) bool {
+	_, ok := h.Steps[step]
+	return ok
+}
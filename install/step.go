@@ -0,0 +1,198 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/parity/version"
+	"github.com/mitchellh/multistep"
+)
+
+// Keys shared between steps in the multistep state bag
+const (
+	stateError = "error"
+	stateHost  = "host"
+
+	// stateRestart is set by steps that change the mirror daemon's
+	// configuration, so that it is restarted
+	stateRestart = "restart"
+)
+
+// Host runs commands on the Docker host, see utils.DockerEnvironment
+type Host interface {
+	Run(command string, opts utils.CommandOptions) error
+	CopyFile(file string, dest string) error
+}
+
+// Step is a single part of the installation. Steps are idempotent: Check
+// reports whether the step is already in place, in which case it is skipped.
+type Step interface {
+	// Name identifies the step in the install state
+	Name() string
+
+	// Description is shown when the step is applied
+	Description() string
+
+	Check(state multistep.StateBag) (bool, error)
+	Apply(state multistep.StateBag) error
+
+	// Rollback reverses Apply. It is called if Apply fails, and by uninstall.
+	Rollback(state multistep.StateBag) error
+}
+
+// Runner applies or reverses a list of steps on a Docker host, recording
+// its progress in State
+type Runner struct {
+	Steps []Step
+	State *State
+
+	// Host is the Docker host's key in State
+	Host string
+
+	// DryRun only reports the changes that would be made
+	DryRun bool
+}
+
+// Install applies each step that isn't already in place. If a step fails,
+// it is rolled back and the steps before it are kept, so that running
+// install again resumes from the failed step.
+func (r *Runner) Install() error {
+	state := new(multistep.BasicStateBag)
+	state.Put(stateHost, r.State.Host(r.Host))
+
+	steps := make([]multistep.Step, len(r.Steps))
+	for i, s := range r.Steps {
+		steps[i] = &installStep{step: s, runner: r}
+	}
+	runner := &multistep.BasicRunner{Steps: steps}
+
+	// Stop after the current step if interrupted
+	interrupt := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			log.Warn("Interrupted, stopping after the current step")
+			runner.Cancel()
+		case <-done:
+		}
+	}()
+
+	runner.Run(state)
+	close(done)
+
+	if err, ok := state.GetOk(stateError); ok {
+		return err.(error)
+	}
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return fmt.Errorf("Install interrupted, run 'parity install' again to resume")
+	}
+	return nil
+}
+
+// Uninstall rolls back, in reverse order, each step that has been applied
+func (r *Runner) Uninstall() error {
+	host := r.State.Host(r.Host)
+	state := new(multistep.BasicStateBag)
+	state.Put(stateHost, host)
+
+	for i := len(r.Steps) - 1; i >= 0; i-- {
+		step := r.Steps[i]
+		applied := host.Completed(step.Name())
+		if !applied {
+			if ok, err := step.Check(state); err == nil && ok {
+				applied = true
+			}
+		}
+		if !applied {
+			continue
+		}
+
+		if r.DryRun {
+			log.Step("Revert: %s (dry run)", step.Description())
+			continue
+		}
+		log.Step("Revert: %s", step.Description())
+		if err := step.Rollback(state); err != nil {
+			return fmt.Errorf("Unable to revert '%s': %s", step.Description(), err.Error())
+		}
+		delete(host.Steps, step.Name())
+		if err := r.State.Save(); err != nil {
+			return err
+		}
+	}
+
+	if r.DryRun {
+		return nil
+	}
+	delete(r.State.Hosts, r.Host)
+	return r.State.Save()
+}
+
+// installStep adapts a Step to a multistep.Step
+type installStep struct {
+	step   Step
+	runner *Runner
+	failed bool
+}
+
+func (s *installStep) Run(state multistep.StateBag) multistep.StepAction {
+	host := state.Get(stateHost).(*HostState)
+	description := s.step.Description()
+
+	done, err := s.step.Check(state)
+	if err != nil {
+		state.Put(stateError, fmt.Errorf("Unable to check '%s': %s", description, err.Error()))
+		return multistep.ActionHalt
+	}
+	if done {
+		log.Step("%s (already done)", description)
+		return multistep.ActionContinue
+	}
+	if s.runner.DryRun {
+		log.Step("%s (dry run)", description)
+		return multistep.ActionContinue
+	}
+
+	log.Step("%s", description)
+	if err := s.step.Apply(state); err != nil {
+		// A step that was in place before is left as it is
+		s.failed = !host.Completed(s.step.Name())
+		state.Put(stateError, fmt.Errorf("'%s' failed: %s", description, err.Error()))
+		return multistep.ActionHalt
+	}
+
+	host.Steps[s.step.Name()] = time.Now()
+	host.Version = version.Version
+	if err := s.runner.State.Save(); err != nil {
+		state.Put(stateError, fmt.Errorf("Unable to save install state: %s", err.Error()))
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (s *installStep) Cleanup(state multistep.StateBag) {
+	if !s.failed {
+		return
+	}
+	log.Warn("Rolling back: %s", s.step.Description())
+	if err := s.step.Rollback(state); err != nil {
+		log.Error("Unable to roll back '%s': %s", s.step.Description(), err.Error())
+	}
+}
+
+// remoteTest runs a test command on the Docker host, returning false if it
+// exits with a non-zero status
+func remoteTest(host Host, command string) (bool, error) {
+	err := host.Run(command, utils.CommandOptions{})
+	if _, ok := err.(*utils.CommandError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,126 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/multistep"
+)
+
+// remoteParityDir is where the Parity binary running the mirror daemon, and
+// its version, are installed on the Docker host. It must persist across
+// reboots.
+const remoteParityDir = bootDir + "/parity"
+
+// mirrorBinaryStep uploads the linux_amd64 Parity binary that runs the mirror
+// daemon to the Docker host, so that the host never needs to download it
+type mirrorBinaryStep struct {
+	host   Host
+	source *MirrorSource
+	dir    string
+}
+
+func (s *mirrorBinaryStep) binary() string {
+	return path.Join(s.dir, "parity")
+}
+
+func (s *mirrorBinaryStep) versionFile() string {
+	return path.Join(s.dir, "mirror.version")
+}
+
+func (s *mirrorBinaryStep) Name() string {
+	return "mirror binary"
+}
+
+func (s *mirrorBinaryStep) Description() string {
+	if s.source.File != "" {
+		return fmt.Sprintf("Install file sync daemon (%s) on Docker Host", s.source.File)
+	}
+	return fmt.Sprintf("Install file sync daemon (parity %s) on Docker Host", s.source.Version)
+}
+
+// Check compares the installed version with the one to install, and the
+// installed binary with the checksum recorded when it was installed. An
+// explicit binary's version is only known once installed, so only its
+// checksum is compared.
+func (s *mirrorBinaryStep) Check(state multistep.StateBag) (bool, error) {
+	var out bytes.Buffer
+	command := fmt.Sprintf("sudo cat %s && sudo sha256sum %s", s.versionFile(), s.binary())
+	err := s.host.Run(command, utils.CommandOptions{Stdout: &out})
+	if _, ok := err.(*utils.CommandError); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// e.g. "1.0.0 <sha256>\n<sha256>  /var/lib/boot2docker/parity/parity"
+	fields := strings.Fields(out.String())
+	if len(fields) < 3 || fields[1] != fields[2] || (s.source.File == "" && fields[0] != s.source.Version) {
+		return false, nil
+	}
+	if s.source.File != "" || s.source.Self != "" || s.source.SHA256 != "" {
+		b, err := s.source.Find()
+		if err != nil {
+			return false, err
+		}
+		return fields[1] == b.SHA256, nil
+	}
+	return true, nil
+}
+
+func (s *mirrorBinaryStep) Apply(state multistep.StateBag) error {
+	b, err := s.source.Find()
+	if err != nil {
+		return err
+	}
+
+	tmp := fmt.Sprintf("/tmp/parity-mirror-%s", b.SHA256[:12])
+	if err := s.host.CopyFile(b.Path, tmp); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	command := fmt.Sprintf("sudo sh -c 'mkdir -p %[1]s && mv %[2]s %[3]s && chmod 0755 %[3]s && sha256sum %[3]s'",
+		s.dir, tmp, s.binary())
+	if err := s.host.Run(command, utils.CommandOptions{Stdout: &out}); err != nil {
+		return err
+	}
+	if fields := strings.Fields(out.String()); len(fields) == 0 || fields[0] != b.SHA256 {
+		s.host.Run(fmt.Sprintf("sudo rm -f %s", s.binary()), utils.CommandOptions{})
+		return fmt.Errorf("Checksum of the uploaded mirror daemon does not match %s (%s)", b.Path, b.SHA256)
+	}
+
+	// Record the version the binary reports, which also checks that it is
+	// a Parity binary that runs on the Docker host
+	out.Reset()
+	if err := s.host.Run(fmt.Sprintf("%s version", s.binary()), utils.CommandOptions{Stdout: &out}); err != nil {
+		s.host.Run(fmt.Sprintf("sudo rm -f %s", s.binary()), utils.CommandOptions{})
+		return fmt.Errorf("Unable to run the mirror daemon %s on the Docker host, is it a linux_amd64 Parity binary? %s", b.Path, err.Error())
+	}
+	installed := strings.TrimSpace(out.String())
+	if b.Version != "" && installed != b.Version {
+		log.Warn("The mirror daemon %s is Parity %s, expected %s", b.Path, installed, b.Version)
+	}
+
+	command = fmt.Sprintf("sudo sh -c 'echo %s %s > %s'", installed, b.SHA256, s.versionFile())
+	if err := s.host.Run(command, utils.CommandOptions{}); err != nil {
+		return err
+	}
+	if host, ok := state.Get(stateHost).(*HostState); ok {
+		host.MirrorVersion = installed
+	}
+	state.Put(stateRestart, true)
+	return nil
+}
+
+func (s *mirrorBinaryStep) Rollback(state multistep.StateBag) error {
+	if host, ok := state.Get(stateHost).(*HostState); ok {
+		host.MirrorVersion = ""
+	}
+	return s.host.Run(fmt.Sprintf("sudo rm -f %s %s", s.binary(), s.versionFile()), utils.CommandOptions{})
+}
@@ -0,0 +1,150 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/multistep"
+)
+
+// fakeStep records the calls made to it in log
+type fakeStep struct {
+	name    string
+	applied bool
+	fail    bool
+	log     *[]string
+}
+
+func (s *fakeStep) Name() string        { return s.name }
+func (s *fakeStep) Description() string { return "Fake " + s.name }
+
+func (s *fakeStep) Check(state multistep.StateBag) (bool, error) {
+	return s.applied, nil
+}
+
+func (s *fakeStep) Apply(state multistep.StateBag) error {
+	*s.log = append(*s.log, "apply "+s.name)
+	if s.fail {
+		return fmt.Errorf("%s failed", s.name)
+	}
+	s.applied = true
+	return nil
+}
+
+func (s *fakeStep) Rollback(state multistep.StateBag) error {
+	*s.log = append(*s.log, "rollback "+s.name)
+	s.applied = false
+	return nil
+}
+
+// testRunner returns a runner of three fake steps, keeping its state in
+// dir, and the log of the calls made to the steps
+func testRunner(t *testing.T, dir string) (*Runner, *[]string) {
+	state, err := LoadState(filepath.Join(dir, "install.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	log := &[]string{}
+	runner := &Runner{State: state, Host: "192.168.99.100:22"}
+	for _, name := range []string{"one", "two", "three"} {
+		runner.Steps = append(runner.Steps, &fakeStep{name: name, log: log})
+	}
+	return runner, log
+}
+
+func TestRunner_Install(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	runner, log := testRunner(t, dir)
+
+	if err := runner.Install(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []string{"apply one", "apply two", "apply three"}
+	if !reflect.DeepEqual(*log, expected) {
+		t.Fatalf("Expected %v, got %v", expected, *log)
+	}
+
+	state, _ := LoadState(runner.State.File)
+	for _, name := range []string{"one", "two", "three"} {
+		if !state.Host(runner.Host).Completed(name) {
+			t.Fatalf("Expected step '%s' to be recorded", name)
+		}
+	}
+
+	// Steps already in place are skipped
+	*log = nil
+	if err := runner.Install(); err != nil || len(*log) != 0 {
+		t.Fatalf("Expected no steps to be applied, got %v (%v)", *log, err)
+	}
+}
+
+func TestRunner_InstallFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	runner, log := testRunner(t, dir)
+	runner.Steps[1].(*fakeStep).fail = true
+
+	if err := runner.Install(); err == nil {
+		t.Fatalf("Expected install to fail")
+	}
+	expected := []string{"apply one", "apply two", "rollback two"}
+	if !reflect.DeepEqual(*log, expected) {
+		t.Fatalf("Expected %v, got %v", expected, *log)
+	}
+	if state, _ := LoadState(runner.State.File); state.Host(runner.Host).Completed("two") {
+		t.Fatalf("Expected failed step not to be recorded")
+	}
+
+	// Running again resumes from the failed step
+	*log = nil
+	runner.Steps[1].(*fakeStep).fail = false
+	if err := runner.Install(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected = []string{"apply two", "apply three"}
+	if !reflect.DeepEqual(*log, expected) {
+		t.Fatalf("Expected %v, got %v", expected, *log)
+	}
+}
+
+func TestRunner_DryRun(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	runner, log := testRunner(t, dir)
+	runner.DryRun = true
+
+	if err := runner.Install(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(*log) != 0 {
+		t.Fatalf("Expected no steps to be applied, got %v", *log)
+	}
+	if _, err := os.Stat(runner.State.File); !os.IsNotExist(err) {
+		t.Fatalf("Expected install state not to be written")
+	}
+}
+
+func TestRunner_Uninstall(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	runner, log := testRunner(t, dir)
+	runner.Install()
+
+	*log = nil
+	if err := runner.Uninstall(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []string{"rollback three", "rollback two", "rollback one"}
+	if !reflect.DeepEqual(*log, expected) {
+		t.Fatalf("Expected %v, got %v", expected, *log)
+	}
+	state, _ := LoadState(runner.State.File)
+	if _, ok := state.Hosts[runner.Host]; ok {
+		t.Fatalf("Expected host to be removed from the install state")
+	}
+}
@@ -1 +1,85 @@
 package install
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/multistep"
+)
+
+// uploadStep installs a file rendered from a template on the Docker host.
+// A file that was there before Parity was installed is backed up, and
+// restored on rollback.
+type uploadStep struct {
+	host     Host
+	name     string
+	template func() ([]byte, error)
+	data     interface{}
+	dest     string
+	mode     os.FileMode
+}
+
+func (s *uploadStep) Name() string {
+	return "upload " + s.name
+}
+
+func (s *uploadStep) Description() string {
+	return fmt.Sprintf("Install %s on Docker Host", s.name)
+}
+
+// Check compares the file on the Docker host with the rendered template
+func (s *uploadStep) Check(state multistep.StateBag) (bool, error) {
+	content, err := s.content()
+	if err != nil {
+		return false, err
+	}
+
+	var remote bytes.Buffer
+	err = s.host.Run(fmt.Sprintf("sudo cat %s", s.dest), utils.CommandOptions{Stdout: &remote})
+	if _, ok := err.(*utils.CommandError); ok {
+		return false, nil
+	}
+	return bytes.Equal(content, remote.Bytes()), err
+}
+
+func (s *uploadStep) Apply(state multistep.StateBag) error {
+	content, err := s.content()
+	if err != nil {
+		return err
+	}
+
+	backup := ""
+	if host, ok := state.Get(stateHost).(*HostState); !ok || !host.Completed(s.Name()) {
+		backup = fmt.Sprintf("if [ -f %[1]s ] && [ ! -f %[1]s.parity-backup ]; then cp -p %[1]s %[1]s.parity-backup; fi; ", s.dest)
+	}
+	command := fmt.Sprintf("sudo sh -c '%[1]scat > %[2]s.tmp && chmod %[3]o %[2]s.tmp && mv %[2]s.tmp %[2]s'", backup, s.dest, s.mode)
+	if err := s.host.Run(command, utils.CommandOptions{Stdin: bytes.NewReader(content)}); err != nil {
+		return err
+	}
+	state.Put(stateRestart, true)
+	return nil
+}
+
+func (s *uploadStep) Rollback(state multistep.StateBag) error {
+	return s.host.Run(fmt.Sprintf("sudo sh -c 'if [ -f %[1]s.parity-backup ]; then mv %[1]s.parity-backup %[1]s; else rm -f %[1]s %[1]s.tmp; fi'", s.dest), utils.CommandOptions{})
+}
+
+// content renders the file's template
+func (s *uploadStep) content() ([]byte, error) {
+	data, err := s.template()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(s.name).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, s.data); err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
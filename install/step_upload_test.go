@@ -1 +1,117 @@
 package install
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/multistep"
+)
+
+// localHost runs Docker host commands in a local shell
+type localHost struct{}
+
+func (h *localHost) Run(command string, opts utils.CommandOptions) error {
+	cmd := exec.Command("sh", "-c", strings.Replace(command, "sudo ", "", -1))
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return &utils.CommandError{Command: command, ExitStatus: 1}
+		}
+		return err
+	}
+	return nil
+}
+
+func (h *localHost) CopyFile(file string, dest string) error {
+	return exec.Command("cp", file, dest).Run()
+}
+
+func TestUploadStep(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	step := &uploadStep{
+		host:     &localHost{},
+		name:     "bootlocal.sh",
+		template: func() ([]byte, error) { return []byte("mirror {{.Version}}\n"), nil },
+		data:     struct{ Version string }{"1.0.0"},
+		dest:     filepath.Join(dir, "bootlocal.sh"),
+		mode:     0755,
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put(stateHost, &HostState{Steps: make(map[string]time.Time)})
+
+	if done, err := step.Check(state); err != nil || done {
+		t.Fatalf("Expected missing file to need installing, got %v (%v)", done, err)
+	}
+	if err := step.Apply(state); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	data, _ := ioutil.ReadFile(step.dest)
+	if string(data) != "mirror 1.0.0\n" {
+		t.Fatalf("Expected rendered template to be installed, got '%s'", data)
+	}
+	if info, _ := os.Stat(step.dest); info.Mode().Perm() != 0755 {
+		t.Fatalf("Expected file mode 0755, got %s", info.Mode())
+	}
+	if _, ok := state.GetOk(stateRestart); !ok {
+		t.Fatalf("Expected mirror daemon to be restarted")
+	}
+	if done, err := step.Check(state); err != nil || !done {
+		t.Fatalf("Expected installed file to be up to date, got %v (%v)", done, err)
+	}
+
+	// A new version must be installed again
+	step.data = struct{ Version string }{"1.1.0"}
+	if done, _ := step.Check(state); done {
+		t.Fatalf("Expected changed file to need installing")
+	}
+
+	if err := step.Rollback(state); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, err := os.Stat(step.dest); !os.IsNotExist(err) {
+		t.Fatalf("Expected file to be removed on rollback")
+	}
+}
+
+func TestUploadStep_Backup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-install")
+	defer os.RemoveAll(dir)
+	step := &uploadStep{
+		host:     &localHost{},
+		name:     "bootlocal.sh",
+		template: func() ([]byte, error) { return []byte("mirror {{.Version}}\n"), nil },
+		data:     struct{ Version string }{"1.0.0"},
+		dest:     filepath.Join(dir, "bootlocal.sh"),
+		mode:     0755,
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put(stateHost, &HostState{Steps: make(map[string]time.Time)})
+	ioutil.WriteFile(step.dest, []byte("original\n"), 0644)
+
+	step.Apply(state)
+	state.Get(stateHost).(*HostState).Steps[step.Name()] = time.Now()
+
+	// Upgrading must not replace the backup of the original file
+	step.data = struct{ Version string }{"1.1.0"}
+	step.Apply(state)
+
+	if err := step.Rollback(state); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	data, _ := ioutil.ReadFile(step.dest)
+	if string(data) != "original\n" {
+		t.Fatalf("Expected original file to be restored, got '%s'", data)
+	}
+	if _, err := os.Stat(step.dest + ".parity-backup"); !os.IsNotExist(err) {
+		t.Fatalf("Expected backup to be removed")
+	}
+}
@@ -0,0 +1,235 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"time"
+
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/multistep"
+)
+
+// bootDir persists across boot2docker reboots
+const bootDir = "/var/lib/boot2docker"
+
+// preflight checks that Parity can be installed into the Docker host,
+// before any changes are made
+func preflight(docker *utils.DockerEnvironment) error {
+	log.Step("Checking Docker Host %s", docker.SSHAddress())
+	if _, err := remoteTest(docker, "true"); err != nil {
+		return fmt.Errorf("Unable to connect to Docker host %s. Is Docker running? Run 'parity doctor' for details (%v)", docker.SSHAddress(), err.Error())
+	}
+	if ok, err := remoteTest(docker, "sudo -n true"); err != nil || !ok {
+		return fmt.Errorf("Parity requires passwordless sudo for user '%s' on the Docker host", docker.SSHUser)
+	}
+	if ok, err := remoteTest(docker, fmt.Sprintf("test -d %s", bootDir)); err != nil || !ok {
+		return fmt.Errorf("Parity can only be installed into a boot2docker Docker host (%s not found)", bootDir)
+	}
+	return nil
+}
+
+// hostEntryStep maps the dev hostname to the Docker host in Parity's block
+// of the hosts file
+type hostEntryStep struct {
+	host     string // IP address or hostname of the Docker host
+	hostname string
+	file     string
+}
+
+func (s *hostEntryStep) Name() string {
+	return "hosts"
+}
+
+func (s *hostEntryStep) Description() string {
+	return fmt.Sprintf("Create host entry: %s -> %s", s.host, s.hostname)
+}
+
+func (s *hostEntryStep) Check(state multistep.StateBag) (bool, error) {
+	ip, err := hosts.ResolveIP(s.host)
+	if err != nil {
+		return false, err
+	}
+	f, err := hosts.Load(s.file)
+	if err != nil {
+		return false, err
+	}
+	return f.Has(ip, s.hostname), nil
+}
+
+func (s *hostEntryStep) Apply(state multistep.StateBag) error {
+	ip, err := hosts.ResolveIP(s.host)
+	if err != nil {
+		return err
+	}
+	f, err := hosts.Load(s.file)
+	if err != nil {
+		return err
+	}
+	f.Add(ip, s.hostname)
+	return f.Save()
+}
+
+func (s *hostEntryStep) Rollback(state multistep.StateBag) error {
+	f, err := hosts.Load(s.file)
+	if err != nil {
+		return err
+	}
+	if f.Remove(s.hostname) == 0 {
+		return nil
+	}
+	return f.Save()
+}
+
+// certificatesStep installs the mirror daemon's certificates
+type certificatesStep struct {
+	docker  *utils.DockerEnvironment
+	devHost string
+}
+
+func (s *certificatesStep) Name() string {
+	return "certificates"
+}
+
+func (s *certificatesStep) Description() string {
+	return "Install certificates on Docker Host"
+}
+
+// Check compares the CA on the Docker host with the local one
+func (s *certificatesStep) Check(state multistep.StateBag) (bool, error) {
+	c := certs.New()
+	if !c.Exists() {
+		return false, nil
+	}
+	local, err := ioutil.ReadFile(c.Config().CaCertPath)
+	if err != nil {
+		return false, err
+	}
+
+	var remote bytes.Buffer
+	err = s.docker.Run(fmt.Sprintf("sudo cat %s", path.Join(remoteMirrorHome, "ca/ca.pem")), utils.CommandOptions{Stdout: &remote})
+	if _, ok := err.(*utils.CommandError); ok {
+		return false, nil
+	}
+	return bytes.Equal(local, remote.Bytes()), err
+}
+
+func (s *certificatesStep) Apply(state multistep.StateBag) error {
+	if err := InstallCertificates(s.docker, s.devHost, false); err != nil {
+		return err
+	}
+	state.Put(stateRestart, true)
+	return nil
+}
+
+func (s *certificatesStep) Rollback(state multistep.StateBag) error {
+	return s.docker.RunCommandWithDefaults(fmt.Sprintf("sudo rm -rf %s", remoteMirrorHome))
+}
+
+// mirrorStep starts the mirror daemon
+type mirrorStep struct {
+	host Host
+}
+
+func (s *mirrorStep) Name() string {
+	return "mirror"
+}
+
+func (s *mirrorStep) Description() string {
+	return "Start file sync daemon (parity mirror-daemon)"
+}
+
+func (s *mirrorStep) Check(state multistep.StateBag) (bool, error) {
+	if _, ok := state.GetOk(stateRestart); ok {
+		return false, nil
+	}
+	return remoteTest(s.host, fmt.Sprintf("sudo %s/mirror-daemon.sh status", bootDir))
+}
+
+func (s *mirrorStep) Apply(state multistep.StateBag) error {
+	command := fmt.Sprintf("(sudo %[1]s/mirror-daemon.sh stop || true) && sudo %[1]s/bootlocal.sh", bootDir)
+	if err := s.host.Run(command, utils.CommandOptions{}); err != nil {
+		return err
+	}
+	state.Put(stateRestart, true)
+	return nil
+}
+
+func (s *mirrorStep) Rollback(state multistep.StateBag) error {
+	command := fmt.Sprintf("sudo %[1]s/mirror-daemon.sh stop; sudo rm -f /usr/bin/parity /usr/bin/mirror %[1]s/mirror %[1]s/linux_amd64.zip", bootDir)
+	return s.host.Run(command, utils.CommandOptions{})
+}
+
+// restartStep restarts the Docker host, ensuring the mirror daemon starts
+// on boot
+type restartStep struct {
+	docker *utils.DockerEnvironment
+}
+
+func (s *restartStep) Name() string {
+	return "restart"
+}
+
+func (s *restartStep) Description() string {
+	return "Restart Docker"
+}
+
+func (s *restartStep) Check(state multistep.StateBag) (bool, error) {
+	if _, ok := state.GetOk(stateRestart); ok {
+		return false, nil
+	}
+	conn, err := net.DialTimeout("tcp", s.docker.MirrorAddress(), 2*time.Second)
+	if err != nil {
+		return false, nil
+	}
+	conn.Close()
+	return true, nil
+}
+
+func (s *restartStep) Apply(state multistep.StateBag) error {
+	// The connection drops as the host shuts down
+	s.docker.RunCommandWithDefaults("sudo shutdown -r now")
+	s.docker.CloseSSH()
+
+	if err := utils.AwaitNetwork("docker", s.docker.SSHAddress(), 120*time.Second); err != nil {
+		return err
+	}
+	return utils.AwaitNetwork("mirror", s.docker.MirrorAddress(), 120*time.Second)
+}
+
+func (s *restartStep) Rollback(state multistep.StateBag) error {
+	return nil
+}
+
+// sharedFoldersStep unmounts VirtualBox shared folders, which would
+// otherwise hide the synced files
+type sharedFoldersStep struct {
+	docker *utils.DockerEnvironment
+}
+
+func (s *sharedFoldersStep) Name() string {
+	return "shared folders"
+}
+
+func (s *sharedFoldersStep) Description() string {
+	return "Unmount Virtualbox shared folders"
+}
+
+func (s *sharedFoldersStep) Check(state multistep.StateBag) (bool, error) {
+	return len(s.docker.FindSharedFolders()) == 0, nil
+}
+
+func (s *sharedFoldersStep) Apply(state multistep.StateBag) error {
+	s.docker.UnmountSharedFolders()
+	return nil
+}
+
+// Rollback does nothing, boot2docker mounts shared folders again on boot
+func (s *sharedFoldersStep) Rollback(state multistep.StateBag) error {
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/mgutz/ansi"
 )
@@ -89,11 +92,11 @@ func (m *ParityLogger) Info(format string, v ...interface{}) {
 }
 
 func (m *ParityLogger) Stage(format string, v ...interface{}) {
-	log.Printf("Stage : "+format+"\n", v...)
+	log.Printf("Stage : %s\n", mask(fmt.Sprintf(format, v...)))
 }
 
 func (m *ParityLogger) Step(format string, v ...interface{}) {
-	log.Printf(" ---> "+format+"\n", v...)
+	log.Printf(" ---> %s\n", mask(fmt.Sprintf(format, v...)))
 }
 
 func (m *ParityLogger) Warn(format string, v ...interface{}) {
@@ -106,13 +109,13 @@ func (m *ParityLogger) Error(format string, v ...interface{}) {
 
 func (m *ParityLogger) Fatal(v ...interface{}) {
 	s := fmt.Sprint(v...)
-	m.Log(FATAL, s)
+	m.Log(FATAL, "%s", s)
 	os.Exit(1)
 }
 
 func (m *ParityLogger) Fatalf(format string, v ...interface{}) {
 	s := fmt.Sprintf(format, v...)
-	m.Log(FATAL, s)
+	m.Log(FATAL, "%s", s)
 	os.Exit(1)
 }
 
@@ -137,7 +140,7 @@ func (m *ParityLogger) Log(l LogLevel, format string, v ...interface{}) {
 			colorFormat = coloursMap[LIGHTRED]
 		}
 
-		log.Printf("      "+"["+level+"] "+colorFormat+format+ansi.Reset+"\n", v...)
+		log.Printf("      "+"["+level+"] "+colorFormat+"%s"+ansi.Reset+"\n", mask(fmt.Sprintf(format, v...)))
 		// log.Printf(colorFormat+format+ansi.Reset+"\n", v...)
 		// log.Printf("["+level+"]\t\t"+colorFormat+format+ansi.Reset+"\n", v...)
 	}
@@ -147,6 +150,39 @@ func (m *ParityLogger) SetLevel(l LogLevel) {
 	m.Level = l
 }
 
+// minMaskLength is the shortest value masked, as masking shorter values
+// would garble unrelated output
+const minMaskLength = 4
+
+var masked struct {
+	sync.RWMutex
+	values []string
+}
+
+// Mask hides values, e.g. passwords, in all further log output
+func Mask(values ...string) {
+	masked.Lock()
+	defer masked.Unlock()
+	for _, value := range values {
+		if len(value) >= minMaskLength {
+			masked.values = append(masked.values, value)
+		}
+	}
+
+	// Longest first, so no part of a value containing another is shown
+	sort.Slice(masked.values, func(i, j int) bool { return len(masked.values[i]) > len(masked.values[j]) })
+}
+
+// mask replaces any masked values in s
+func mask(s string) string {
+	masked.RLock()
+	defer masked.RUnlock()
+	for _, value := range masked.values {
+		s = strings.Replace(s, value, "********", -1)
+	}
+	return s
+}
+
 func Colorize(colour Colour, format string) string {
 	return fmt.Sprintf("%s%s%s", coloursMap[colour], format, ansi.Reset)
 }
@@ -1,7 +1,10 @@
 package log
 
 import (
+	"bytes"
 	"log"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -52,3 +55,23 @@ func TestLogColour(t *testing.T) {
 	logger.Log(INFO, "Info %s", Colorize(LIGHTRED, " some words "))
 	logger.Log(INFO, "Info something else not in colour")
 }
+
+func TestMask(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Mask("hunter22", "hunter22-extended", "abc")
+	logger := &ParityLogger{Level: INFO}
+	logger.Info("DB_PASSWORD=%s", "hunter22")
+	logger.Step("Connecting with hunter22-extended")
+	logger.Info("abc is too short to mask")
+
+	output := buf.String()
+	if strings.Contains(output, "hunter22") || strings.Contains(output, "extended") {
+		t.Fatalf("Expected the secrets to be masked, got '%s'", output)
+	}
+	if !strings.Contains(output, "DB_PASSWORD=********") || !strings.Contains(output, "abc is too short") {
+		t.Fatalf("Expected the rest of the output to be logged, got '%s'", output)
+	}
+}
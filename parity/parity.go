@@ -8,7 +8,11 @@ import (
 	"sync"
 
 	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/env"
+	"github.com/mefellows/parity/forward"
 	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/secrets"
+	"github.com/mefellows/parity/utils"
 	"github.com/mefellows/plugo/plugo"
 )
 
@@ -33,12 +37,53 @@ type Parity struct {
 	pluginConfig *PluginConfig
 	errorChan    chan error
 	plugins      []Plugin
+	forwards     []*forward.Forward
 }
 
 // LoadPlugins loads all plugins referenced in the parity.yml file
 // from those registered at runtime
 func (p *Parity) LoadPlugins() {
 	log.Debug("loading plugins")
+	c, confLoader := p.loadConfig()
+	p.loadSyncPlugins(c, confLoader)
+	p.loadForwards(c)
+
+	// Run plugins
+	p.RunPlugins = make([]Run, len(c.Run))
+	runPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Run)
+
+	for i, pl := range runPlugins {
+		log.Debug("Loading Run Plugin\t%s", log.Colorize(log.YELLOW, c.Run[i].Name))
+		p.RunPlugins[i] = pl.(Run)
+		p.RunPlugins[i].Configure(p.pluginConfig)
+		p.plugins = append(p.plugins, p.RunPlugins[i])
+	}
+
+	// Build plugins
+	p.BuildPlugins = make([]Builder, len(c.Build))
+	buildPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Build)
+
+	for i, pl := range buildPlugins {
+		log.Debug("Loading Build Plugin\t%s", log.Colorize(log.YELLOW, c.Build[i].Name))
+		p.BuildPlugins[i] = pl.(Builder)
+		p.BuildPlugins[i].Configure(p.pluginConfig)
+		p.plugins = append(p.plugins, p.BuildPlugins[i])
+	}
+
+	// Shell plugins
+	p.ShellPlugins = make([]Shell, len(c.Shell))
+	shellPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Shell)
+
+	for i, pl := range shellPlugins {
+		log.Debug("Loading Shell Plugin\t%s", log.Colorize(log.YELLOW, c.Shell[i].Name))
+		p.ShellPlugins[i] = pl.(Shell)
+		p.ShellPlugins[i].Configure(p.pluginConfig)
+		p.plugins = append(p.plugins, p.ShellPlugins[i])
+	}
+}
+
+// loadConfig reads the parity.yml file and sets up the shared plugin configuration
+func (p *Parity) loadConfig() (*config.RootConfig, *plugo.ConfigLoader) {
 	var err error
 	var confLoader *plugo.ConfigLoader
 	c := &config.RootConfig{}
@@ -55,55 +100,104 @@ func (p *Parity) LoadPlugins() {
 	log.SetLevel(log.LogLevel(c.LogLevel))
 
 	// Load all plugins
-	p.pluginConfig = &PluginConfig{Ui: p.config.Ui}
+	p.pluginConfig = &PluginConfig{Ui: p.config.Ui, Snapshot: p.config.Snapshot}
 
 	// Set project name
 	p.pluginConfig.ProjectName = c.Name
 	p.pluginConfig.ProjectNameSafe = strings.Replace(strings.ToLower(c.Name), " ", "", -1)
 
-	// Sync plugins
+	if p.pluginConfig.Docker, err = utils.ResolveDockerEnvironment(c.Host); err != nil {
+		log.Fatalf("Unable to find the Docker host: %s", err.Error())
+	}
+	log.Debug("Using Docker host '%s' (endpoint: '%s', native: %t)", p.pluginConfig.Docker.Host, p.pluginConfig.Docker.Endpoint, p.pluginConfig.Docker.Native)
+
+	if p.pluginConfig.Env, p.pluginConfig.ServiceEnv, err = loadEnv(c, os.LookupEnv); err != nil {
+		log.Fatalf("Invalid environment: %s", err.Error())
+	}
+	log.Mask(env.Secrets(p.pluginConfig.Env)...)
+	for _, vars := range p.pluginConfig.ServiceEnv {
+		log.Mask(env.Secrets(vars)...)
+	}
+
+	p.pluginConfig.Secrets = c.Secrets
+	p.pluginConfig.SecretsContext = NewSecretsContext(c)
+
+	return c, confLoader
+}
+
+// NewSecretsContext describes the project to secrets providers
+func NewSecretsContext(c *config.RootConfig) *secrets.Context {
+	return &secrets.Context{
+		Project: utils.ProjectNameSafe(c.Name),
+		File:    c.SecretsFile,
+		Lookup:  os.LookupEnv,
+	}
+}
+
+// loadEnv reads the project's environment: the .env file, overridden by
+// the 'env' section, and the environment of each service in the 'services'
+// section. Values may refer to variables set earlier, or found by lookup.
+func loadEnv(c *config.RootConfig, lookup env.Lookup) ([]string, map[string][]string, error) {
+	file := c.EnvFile
+	if file == "" {
+		file = env.DefaultFile
+	} else if _, err := os.Stat(file); err != nil {
+		return nil, nil, fmt.Errorf("Unable to read env_file: %s", err.Error())
+	}
+	vars, err := env.ReadFile(file, lookup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	layered := env.Layered(&vars, lookup)
+	project, err := env.FromMap(c.Env, layered)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars = env.Merge(vars, project)
+
+	services := map[string][]string{}
+	for name, s := range c.Services {
+		if services[name], err = env.FromMap(s.Env, layered); err != nil {
+			return nil, nil, fmt.Errorf("Service '%s': %s", name, err.Error())
+		}
+	}
+	return vars, services, nil
+}
+
+// loadSyncPlugins loads and configures the Sync plugins
+func (p *Parity) loadSyncPlugins(c *config.RootConfig, confLoader *plugo.ConfigLoader) {
 	p.SyncPlugins = make([]Sync, len(c.Sync))
 	syncPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Sync)
 
 	for i, pl := range syncPlugins {
-		log.Debug("Loading Sync Plugin\t" + log.Colorize(log.YELLOW, c.Sync[i].Name))
+		log.Debug("Loading Sync Plugin\t%s", log.Colorize(log.YELLOW, c.Sync[i].Name))
 		p.SyncPlugins[i] = pl.(Sync)
 		p.SyncPlugins[i].Configure(p.pluginConfig)
 		p.plugins = append(p.plugins, p.SyncPlugins[i])
 	}
+}
 
-	// Run plugins
-	p.RunPlugins = make([]Run, len(c.Run))
-	runPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Run)
-
-	for i, pl := range runPlugins {
-		log.Debug("Loading Run Plugin\t" + log.Colorize(log.YELLOW, c.Run[i].Name))
-		p.RunPlugins[i] = pl.(Run)
-		p.RunPlugins[i].Configure(p.pluginConfig)
-		p.plugins = append(p.plugins, p.RunPlugins[i])
-	}
-
-	// Build plugins
-	p.BuildPlugins = make([]Builder, len(c.Build))
-	buildPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Build)
-
-	for i, pl := range buildPlugins {
-		log.Debug("Loading Build Plugin\t" + log.Colorize(log.YELLOW, c.Build[i].Name))
-		p.BuildPlugins[i] = pl.(Builder)
-		p.BuildPlugins[i].Configure(p.pluginConfig)
-		p.plugins = append(p.plugins, p.BuildPlugins[i])
+// loadForwards creates the port forwards in the 'forwards' section
+func (p *Parity) loadForwards(c *config.RootConfig) {
+	dial := forward.ContainerDialer(p.pluginConfig.Docker, p.pluginConfig.ProjectNameSafe)
+	for _, fc := range c.Forwards {
+		f, err := newForward(fc)
+		if err != nil {
+			log.Fatalf("Invalid forward: %s", err.Error())
+		}
+		f.Dial = dial
+		p.forwards = append(p.forwards, f)
 	}
+}
 
-	// Shell plugins
-	p.ShellPlugins = make([]Shell, len(c.Shell))
-	shellPlugins := plugo.LoadPluginsWithConfig(confLoader, c.Shell)
-
-	for i, pl := range shellPlugins {
-		log.Debug("Loading Shell Plugin\t" + log.Colorize(log.YELLOW, c.Shell[i].Name))
-		p.ShellPlugins[i] = pl.(Shell)
-		p.ShellPlugins[i].Configure(p.pluginConfig)
-		p.plugins = append(p.plugins, p.ShellPlugins[i])
+// newForward creates a forward, named after its listen address by default
+func newForward(fc config.ForwardConfig) (*forward.Forward, error) {
+	name := fc.Name
+	if name == "" {
+		name = fc.Listen
 	}
+	return forward.New(name, fc.Listen, fc.Target)
 }
 
 // GetPlugin gets a plugin by name (no type)
@@ -129,6 +223,89 @@ func (p *Parity) mergeConfig() {
 	// https://github.com/imdario/mergo -> MergeWithOverride
 }
 
+// LoadConfig reads configFile, returning an empty configuration if it
+// doesn't exist
+func LoadConfig(configFile string) (*config.RootConfig, error) {
+	c := &config.RootConfig{}
+	if _, err := os.Stat(configFile); err == nil {
+		if err := (&plugo.ConfigLoader{}).LoadFromFile(configFile, &c); err != nil {
+			return nil, fmt.Errorf("Unable to read configuration file: %s", err.Error())
+		}
+	}
+	return c, nil
+}
+
+// LoadDockerEnvironment resolves the Docker host, using the 'host' settings
+// in configFile if it exists
+func LoadDockerEnvironment(configFile string) (*utils.DockerEnvironment, error) {
+	c, err := LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ResolveDockerEnvironment(c.Host)
+}
+
+// ValidateConfig checks the log level and plugins of a parity.yml
+// configuration, returning a problem for each invalid setting. Plugins are
+// validated without being configured.
+func ValidateConfig(c *config.RootConfig) []error {
+	var errs []error
+	if c.LogLevel < int(log.TRACE) || c.LogLevel > int(log.FATAL) {
+		errs = append(errs, fmt.Errorf("Invalid loglevel %d, expected 0 (trace) to 5 (fatal)", c.LogLevel))
+	}
+
+	for _, fc := range c.Forwards {
+		if _, err := newForward(fc); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid forward: %s", err.Error()))
+		}
+	}
+
+	if _, _, err := loadEnv(c, os.LookupEnv); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid environment: %s", err.Error()))
+	}
+	for name, sc := range c.Secrets {
+		if err := secrets.Validate(name, sc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	loader := &plugo.ConfigLoader{}
+	kinds := []struct {
+		name       string
+		plugins    []plugo.PluginConfig
+		implements func(interface{}) bool
+	}{
+		{"sync", c.Sync, func(pl interface{}) bool { _, ok := pl.(Sync); return ok }},
+		{"run", c.Run, func(pl interface{}) bool { _, ok := pl.(Run); return ok }},
+		{"build", c.Build, func(pl interface{}) bool { _, ok := pl.(Builder); return ok }},
+		{"shell", c.Shell, func(pl interface{}) bool { _, ok := pl.(Shell); return ok }},
+	}
+	for _, kind := range kinds {
+		for _, pc := range kind.plugins {
+			factory, ok := plugo.PluginFactories.Lookup(pc.Name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("Unknown %s plugin '%s'", kind.name, pc.Name))
+				continue
+			}
+			pl, err := factory()
+			if err == nil {
+				err = loader.ApplyConfig(pc.Config, pl)
+			}
+			if err == nil {
+				err = loader.Validate(pl)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Invalid configuration for %s plugin '%s': %s", kind.name, pc.Name, err.Error()))
+				continue
+			}
+			if !kind.implements(pl) {
+				errs = append(errs, fmt.Errorf("Plugin '%s' is not a %s plugin", pc.Name, kind.name))
+			}
+		}
+	}
+	return errs
+}
+
 // New creates a default instance of Parity, using the provided config
 func New(config *config.Config) *Parity {
 	return &Parity{config: config}
@@ -153,6 +330,61 @@ func (p *Parity) Build() error {
 	return nil
 }
 
+// Verify checks the Docker host is in sync with the local file tree,
+// optionally repairing any drift. Only Sync plugins are loaded.
+func (p *Parity) Verify(repair bool) (int, error) {
+	log.Debug("Loading sync plugins...")
+	c, confLoader := p.loadConfig()
+	p.loadSyncPlugins(c, confLoader)
+
+	drift := 0
+	for _, pl := range p.SyncPlugins {
+		v, ok := pl.(Verifier)
+		if !ok {
+			log.Warn("Sync plugin '%s' does not support verification, skipping", pl.Name())
+			continue
+		}
+		n, err := v.Verify(repair)
+		drift += n
+		if err != nil {
+			return drift, err
+		}
+	}
+	return drift, nil
+}
+
+// Sync runs only the Sync plugins, performing an initial sync and
+// optionally watching for changes until interrupted
+func (p *Parity) Sync(opts SyncOptions) error {
+	log.Debug("Loading sync plugins...")
+	c, confLoader := p.loadConfig()
+	p.loadSyncPlugins(c, confLoader)
+
+	group := &sync.WaitGroup{}
+	errs := make(chan error, len(p.SyncPlugins))
+	for _, pl := range p.SyncPlugins {
+		s, ok := pl.(StandaloneSync)
+		if !ok {
+			log.Warn("Sync plugin '%s' does not support standalone sync, skipping", pl.Name())
+			continue
+		}
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if err := s.SyncWithOptions(opts); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	group.Wait()
+	close(errs)
+
+	for _, pl := range p.SyncPlugins {
+		pl.Teardown()
+	}
+	return <-errs
+}
+
 // Run Parity - the main application entrypoint
 func (p *Parity) Run() {
 	log.Banner(banner)
@@ -172,6 +404,14 @@ func (p *Parity) Run() {
 		p.runAsync(pl.Run)
 	}
 
+	for _, f := range p.forwards {
+		if err := f.Start(); err != nil {
+			log.Error("%s", err.Error())
+			continue
+		}
+		log.Info("Forwarding %s to %s", f.Addr(), f.Target)
+	}
+
 	// Interrupt handler
 	sigChan := make(chan os.Signal, 1)
 	p.errorChan = make(chan error)
@@ -179,7 +419,7 @@ func (p *Parity) Run() {
 
 	select {
 	case e := <-p.errorChan:
-		log.Error(e.Error())
+		log.Error("%s", e.Error())
 	case <-sigChan:
 		log.Debug("Received interrupt, shutting down.")
 		p.Teardown()
@@ -205,7 +445,21 @@ func (p *Parity) Teardown() {
 	for _, pl := range p.RunPlugins {
 		p.runGroupAsync(group, pl.Teardown)
 	}
+	for _, f := range p.forwards {
+		group.Add(1)
+		go func(f *forward.Forward) {
+			defer group.Done()
+			f.Close()
+		}(f)
+	}
 	group.Wait()
+	for _, f := range p.forwards {
+		log.Info("Forward %s", f.Stats())
+	}
+
+	if p.pluginConfig != nil && p.pluginConfig.Docker != nil {
+		p.pluginConfig.Docker.Close()
+	}
 }
 
 func (p *Parity) runGroupAsync(group *sync.WaitGroup, f func() error) {
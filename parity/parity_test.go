@@ -1 +1,101 @@
 package parity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/plugo/plugo"
+)
+
+// validatedSync is a Sync plugin with a required setting
+type validatedSync struct {
+	Dest string `required:"true" mapstructure:"dest"`
+}
+
+func (s *validatedSync) Configure(*PluginConfig) {}
+func (s *validatedSync) Teardown() error         { return nil }
+func (s *validatedSync) Name() string            { return "validated" }
+func (s *validatedSync) Sync() error             { return nil }
+
+func init() {
+	plugo.PluginFactories.Register(func() (interface{}, error) {
+		return &validatedSync{}, nil
+	}, "validated")
+}
+
+func TestValidateConfig(t *testing.T) {
+	c := &config.RootConfig{
+		LogLevel: 2,
+		Sync:     []plugo.PluginConfig{{Name: "validated", Config: plugo.RawConfig{"dest": "/app"}}},
+		Forwards: []config.ForwardConfig{{Name: "db", Listen: "127.0.0.1:5432", Target: "container://db:5432"}},
+	}
+	if errs := ValidateConfig(c); len(errs) != 0 {
+		t.Fatalf("Expected valid configuration, got %v", errs)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dev.env")
+	ioutil.WriteFile(file, []byte("DB_HOST=db\nDB_USER=${USER}\nLEVEL=debug\n"), 0600)
+
+	c := &config.RootConfig{
+		EnvFile: file,
+		Env:     map[string]string{"LEVEL": "info", "DB_URL": "postgres://${DB_USER}@${DB_HOST}"},
+		Services: map[string]config.ServiceConfig{
+			"worker": {Env: map[string]string{"LEVEL": "warn", "QUEUE": "${DB_HOST}/jobs"}},
+		},
+	}
+	lookup := func(key string) (string, bool) {
+		if key == "USER" {
+			return "dev", true
+		}
+		return "", false
+	}
+	vars, services, err := loadEnv(c, lookup)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []string{"DB_HOST=db", "DB_USER=dev", "LEVEL=info", "DB_URL=postgres://dev@db"}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("Expected %q, got %q", expected, vars)
+	}
+	if worker := services["worker"]; !reflect.DeepEqual(worker, []string{"LEVEL=warn", "QUEUE=db/jobs"}) {
+		t.Fatalf("Expected the worker's environment, got %q", worker)
+	}
+
+	// The default .env file is optional
+	if vars, _, err := loadEnv(&config.RootConfig{EnvFile: ""}, lookup); err != nil || len(vars) != 0 {
+		t.Fatalf("Expected no variables, got %q (%v)", vars, err)
+	}
+}
+
+func TestValidateConfig_Invalid(t *testing.T) {
+	c := &config.RootConfig{
+		LogLevel: 9,
+		Sync: []plugo.PluginConfig{
+			{Name: "validated"},
+			{Name: "unknown"},
+		},
+		Run:      []plugo.PluginConfig{{Name: "validated", Config: plugo.RawConfig{"dest": "/app"}}},
+		Forwards: []config.ForwardConfig{{Listen: "127.0.0.1:5432", Target: "db:postgres"}},
+		EnvFile:  "missing.env",
+		Secrets:  map[string]config.SecretConfig{"DB_PASSWORD": {As: "volume"}},
+	}
+	errs := ValidateConfig(c)
+	expected := []string{"loglevel", "Invalid forward", "Invalid environment", "'as' must be", "Mandatory field 'Dest'", "Unknown sync plugin 'unknown'", "not a run plugin"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), errs)
+	}
+	for i, e := range expected {
+		if !strings.Contains(errs[i].Error(), e) {
+			t.Fatalf("Expected problem '%s', got '%s'", e, errs[i].Error())
+		}
+	}
+}
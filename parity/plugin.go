@@ -1,11 +1,72 @@
 package parity
 
-import "github.com/mitchellh/cli"
+import (
+	"path/filepath"
+	"strings"
+
+	mutils "github.com/mefellows/mirror/filesystem/utils"
+	"github.com/mefellows/parity/config"
+	"github.com/mefellows/parity/secrets"
+	"github.com/mefellows/parity/utils"
+	"github.com/mitchellh/cli"
+)
 
 type PluginConfig struct {
 	Ui              cli.Ui
 	ProjectName     string
 	ProjectNameSafe string
+
+	// Docker describes how to reach the Docker host
+	Docker *utils.DockerEnvironment
+
+	// Mappings are registered by Sync plugins, so that Run plugins
+	// can mount the synchronised location on the Docker host
+	Mappings []VolumeMapping
+
+	// Env is the project's environment (.env and parity.yml's 'env'), for
+	// Run plugins to set in containers
+	Env []string
+
+	// ServiceEnv is parity.yml's environment for individual services, by
+	// service name, which takes precedence over any other
+	ServiceEnv map[string][]string
+
+	// Secrets are parity.yml's secrets, which Run plugins resolve (see
+	// secrets.Resolve) with SecretsContext when starting containers
+	Secrets        map[string]config.SecretConfig
+	SecretsContext *secrets.Context
+
+	// Snapshot is restored into the project's volumes before Run plugins
+	// start containers, see the snapshot package
+	Snapshot string
+}
+
+// VolumeMapping maps a directory on the host to its synchronised
+// location on the Docker host
+type VolumeMapping struct {
+	Local  string
+	Remote string
+}
+
+// RemotePath returns the location of the local path on the Docker host,
+// using the most specific mapping. Paths that are not mapped are
+// returned unchanged.
+func (c *PluginConfig) RemotePath(path string) string {
+	local := mutils.LinuxPath(filepath.Clean(path))
+	remote := path
+	longest := -1
+	for _, m := range c.Mappings {
+		base := strings.TrimSuffix(mutils.LinuxPath(filepath.Clean(m.Local)), "/")
+		if len(base) <= longest || (local != base && !strings.HasPrefix(local, base+"/")) {
+			continue
+		}
+		longest = len(base)
+		remote = strings.TrimSuffix(m.Remote, "/") + strings.TrimPrefix(local, base)
+		if remote == "" {
+			remote = "/"
+		}
+	}
+	return remote
 }
 
 type Plugin interface {
@@ -1 +1,23 @@
 package parity
+
+import "testing"
+
+func TestPluginConfig_RemotePath(t *testing.T) {
+	c := &PluginConfig{Mappings: []VolumeMapping{
+		{Local: "/Users/dev/app", Remote: "/parity/app"},
+		{Local: "/Users/dev/app/vendor", Remote: "/parity/vendor/"},
+	}}
+
+	cases := map[string]string{
+		"/Users/dev/app":             "/parity/app",
+		"/Users/dev/app/src/main.go": "/parity/app/src/main.go",
+		"/Users/dev/app/vendor/lib":  "/parity/vendor/lib",
+		"/Users/dev/application":     "/Users/dev/application",
+		"/var/log":                   "/var/log",
+	}
+	for local, expected := range cases {
+		if res := c.RemotePath(local); res != expected {
+			t.Fatalf("Expected '%s' to map to '%s', got '%s'", local, expected, res)
+		}
+	}
+}
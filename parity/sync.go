@@ -1,6 +1,65 @@
 package parity
 
+import (
+	"fmt"
+	"time"
+)
+
 type Sync interface {
 	Plugin
 	Sync() error
 }
+
+// Verifier is implemented by Sync plugins that can check the Docker host
+// is in sync with the local file tree
+type Verifier interface {
+	Sync
+
+	// Verify reports any drift, repairing it if requested, and returns
+	// the number of files that differ
+	Verify(repair bool) (int, error)
+}
+
+// SyncOptions configure a standalone sync, i.e. without running the
+// Run plugins
+type SyncOptions struct {
+	// Paths to sync instead of the configured volumes
+	Paths []string
+
+	// Watch keeps synchronising changes after the initial sync
+	Watch bool
+
+	// Progress, if provided, is called as the initial sync progresses
+	Progress func(SyncProgress)
+}
+
+// StandaloneSync is implemented by Sync plugins that can be run with
+// 'parity sync'
+type StandaloneSync interface {
+	Sync
+	SyncWithOptions(SyncOptions) error
+}
+
+// SyncProgress describes how far through the initial sync of a path we are
+type SyncProgress struct {
+	Path       string
+	Files      int
+	TotalFiles int
+	Bytes      int64
+	TotalBytes int64
+	Elapsed    time.Duration
+}
+
+// ETA estimates the time remaining, based on the throughput so far
+func (p SyncProgress) ETA() time.Duration {
+	if p.Bytes == 0 || p.Elapsed <= 0 {
+		return 0
+	}
+	rate := float64(p.Bytes) / p.Elapsed.Seconds()
+	return time.Duration(float64(p.TotalBytes-p.Bytes) / rate * float64(time.Second))
+}
+
+func (p SyncProgress) String() string {
+	return fmt.Sprintf("%s: %d/%d files, %d/%d bytes, ETA %s",
+		p.Path, p.Files, p.TotalFiles, p.Bytes, p.TotalBytes, p.ETA().Truncate(time.Second))
+}
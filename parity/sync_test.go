@@ -1 +1,18 @@
 package parity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyncProgress_ETA(t *testing.T) {
+	p := SyncProgress{Bytes: 1000, TotalBytes: 4000, Elapsed: 2 * time.Second}
+	if eta := p.ETA(); eta != 6*time.Second {
+		t.Fatalf("Expected an ETA of 6s, got %s", eta)
+	}
+
+	p = SyncProgress{TotalBytes: 4000}
+	if eta := p.ETA(); eta != 0 {
+		t.Fatalf("Expected no ETA before any bytes are sent, got %s", eta)
+	}
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+
+	"github.com/mefellows/parity/hosts"
+)
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Parity</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #333; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.3em 1em 0.3em 0; }
+th { border-bottom: 1px solid #ccc; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>Parity</h1>
+{{if .Missing}}<p>There is no running service for <strong>{{.Missing}}</strong>.</p>{{end}}
+{{if .Routes}}
+<table>
+<tr><th>Hostname</th><th>Project</th><th>Service</th><th>Backend</th></tr>
+{{range .Routes}}<tr><td><a href="{{$.Scheme}}://{{.Hostname}}{{$.Port}}/">{{.Hostname}}</a></td><td>{{.Project}}</td><td>{{.Service}}</td><td class="muted">{{.Backend}}</td></tr>
+{{end}}</table>
+{{else}}
+<p class="muted">No services are running. Start a project with 'parity run'.</p>
+{{end}}
+</body>
+</html>
+`))
+
+type indexData struct {
+	Routes  []Route
+	Missing string
+	Scheme  string
+	Port    string // e.g. ":8080", so that links use the router's port
+}
+
+// index lists the routes. Requests for a hostname under the domain that
+// has no route are answered with a 404, anything else (e.g. the domain
+// itself, or localhost) with the index.
+func (r *Router) index(w http.ResponseWriter, req *http.Request) {
+	data := indexData{Routes: r.Routes(), Scheme: "http"}
+	if req.TLS != nil {
+		data.Scheme = "https"
+	}
+
+	host := req.Host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		host, data.Port = h, ":"+port
+	}
+	status := http.StatusOK
+	if hosts.InDomain(host, r.Domain) && host != r.Domain {
+		status = http.StatusNotFound
+		data.Missing = host
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	indexTemplate.Execute(w, data)
+}
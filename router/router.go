@@ -0,0 +1,222 @@
+// Package router is a reverse proxy that routes requests to Compose
+// services by hostname, e.g. web.myproject.parity.local, so that services
+// can be reached without remembering the ports they are published on.
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+)
+
+// Container labels that customise a service's routes
+const (
+	// LabelEnable set to "false" excludes the service from the router
+	LabelEnable = "parity.router.enable"
+
+	// LabelPort is the container port to route to, when the service
+	// exposes more than one
+	LabelPort = "parity.router.port"
+
+	// LabelHostnames is a comma separated list of extra hostnames for the
+	// service
+	LabelHostnames = "parity.router.hostnames"
+)
+
+// preferredPorts are chosen, in order, when a service exposes several ports
+// and doesn't have a LabelPort
+var preferredPorts = []int64{80, 8080, 3000, 5000, 8000, 4000, 9000}
+
+// Route sends requests for a hostname to a backend
+type Route struct {
+	Hostname string `json:"hostname"`
+	Project  string `json:"project"`
+	Service  string `json:"service"`
+	Backend  string `json:"backend"` // host:port
+}
+
+// Routes derives the routes to each running Compose service. Services are
+// reached on the Docker host at their published port, or when Docker runs
+// natively, directly on the container's address.
+func Routes(services []utils.ComposeService, domain string, dockerHost string, native bool) []Route {
+	var routes []Route
+	for _, s := range services {
+		labels := s.Container.Labels
+		if strings.EqualFold(labels[LabelEnable], "false") {
+			continue
+		}
+		backend, err := backendAddress(s, dockerHost, native)
+		if err != nil {
+			log.Debug("Not routing to %s/%s: %s", s.Project, s.Service, err.Error())
+			continue
+		}
+
+		hostnames := hosts.ServiceHostnames(s.Project, domain, []string{s.Service})[1:]
+		for _, h := range strings.Split(labels[LabelHostnames], ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				hostnames = append(hostnames, h)
+			}
+		}
+		for _, h := range hostnames {
+			routes = append(routes, Route{Hostname: h, Project: s.Project, Service: s.Service, Backend: backend})
+		}
+	}
+	return routes
+}
+
+// backendAddress picks the address to reach a service's HTTP port on
+func backendAddress(s utils.ComposeService, dockerHost string, native bool) (string, error) {
+	var want int64
+	if label := s.Container.Labels[LabelPort]; label != "" {
+		port, err := strconv.ParseInt(label, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s label '%s'", LabelPort, label)
+		}
+		want = port
+	}
+
+	// Index the container's TCP ports by private port
+	ports := make(map[int64]int64)
+	var private []int64
+	for _, p := range s.Container.Ports {
+		if p.Type != "" && p.Type != "tcp" {
+			continue
+		}
+		if _, ok := ports[p.PrivatePort]; !ok {
+			private = append(private, p.PrivatePort)
+		}
+		if p.PublicPort != 0 || ports[p.PrivatePort] == 0 {
+			ports[p.PrivatePort] = p.PublicPort
+		}
+	}
+	sort.Slice(private, func(i, j int) bool { return private[i] < private[j] })
+
+	reachable := func(port int64) bool {
+		public, ok := ports[port]
+		return ok && (native || public != 0)
+	}
+	if want == 0 {
+		for _, p := range append(append([]int64{}, preferredPorts...), private...) {
+			if reachable(p) {
+				want = p
+				break
+			}
+		}
+	}
+	if want == 0 {
+		return "", fmt.Errorf("no published ports")
+	}
+
+	if native {
+		if ip := s.IP(); ip != "" {
+			return net.JoinHostPort(ip, strconv.FormatInt(want, 10)), nil
+		}
+	}
+	if ports[want] == 0 {
+		return "", fmt.Errorf("port %d is not published", want)
+	}
+	return net.JoinHostPort(dockerHost, strconv.FormatInt(ports[want], 10)), nil
+}
+
+type contextKey int
+
+const routeKey contextKey = 0
+
+// Router is an http.Handler proxying requests to the route for their Host.
+// Requests that don't match a route are shown an index of the routes.
+type Router struct {
+	Domain string
+
+	mutex  sync.RWMutex
+	routes map[string]Route
+	proxy  *httputil.ReverseProxy
+}
+
+// New creates a Router for the hostnames under domain
+func New(domain string) *Router {
+	r := &Router{Domain: domain, routes: make(map[string]Route)}
+	r.proxy = &httputil.ReverseProxy{
+		Director:     r.direct,
+		ErrorHandler: r.proxyError,
+	}
+	return r
+}
+
+// SetRoutes replaces the router's routes
+func (r *Router) SetRoutes(routes []Route) {
+	m := make(map[string]Route, len(routes))
+	for _, route := range routes {
+		m[strings.ToLower(route.Hostname)] = route
+	}
+	r.mutex.Lock()
+	r.routes = m
+	r.mutex.Unlock()
+}
+
+// Routes returns the router's routes, ordered by hostname
+func (r *Router) Routes() []Route {
+	r.mutex.RLock()
+	routes := make([]Route, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, route)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Hostname < routes[j].Hostname })
+	return routes
+}
+
+// Lookup finds the route for a Host header, which may include a port
+func (r *Router) Lookup(host string) (Route, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	route, ok := r.routes[strings.ToLower(strings.TrimSuffix(host, "."))]
+	return route, ok
+}
+
+// ServeHTTP proxies the request, including websocket upgrades, to its route
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	route, ok := r.Lookup(req.Host)
+	if !ok {
+		r.index(w, req)
+		return
+	}
+	log.Trace("Router: %s %s%s -> %s", req.Method, req.Host, req.URL.Path, route.Backend)
+	r.proxy.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), routeKey, route)))
+}
+
+// direct points the request at its backend, keeping the original Host
+// header so that applications generate the right URLs
+func (r *Router) direct(req *http.Request) {
+	route := req.Context().Value(routeKey).(Route)
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	req.URL.Scheme = "http"
+	req.URL.Host = route.Backend
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// Stop the default Go user agent being sent
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+func (r *Router) proxyError(w http.ResponseWriter, req *http.Request, err error) {
+	route := req.Context().Value(routeKey).(Route)
+	log.Debug("Router: %s unavailable: %s", route.Backend, err.Error())
+	http.Error(w, fmt.Sprintf("Service '%s' of project '%s' is not responding on %s: %s", route.Service, route.Project, route.Backend, err.Error()), http.StatusBadGateway)
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/utils"
+)
+
+func service(name string, labels map[string]string, ports ...dockerclient.APIPort) utils.ComposeService {
+	return utils.ComposeService{
+		Project: "myproject",
+		Service: name,
+		Container: dockerclient.APIContainers{
+			Labels: labels,
+			Ports:  ports,
+			Networks: dockerclient.NetworkList{
+				Networks: map[string]dockerclient.ContainerNetwork{"bridge": {IPAddress: "172.17.0.2"}},
+			},
+		},
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	services := []utils.ComposeService{
+		service("web", nil, dockerclient.APIPort{PrivatePort: 22, PublicPort: 32768, Type: "tcp"}, dockerclient.APIPort{PrivatePort: 80, PublicPort: 32769, Type: "tcp"}),
+		service("api", map[string]string{LabelPort: "9292", LabelHostnames: "API.example.test, "}, dockerclient.APIPort{PrivatePort: 80, PublicPort: 32770}, dockerclient.APIPort{PrivatePort: 9292, PublicPort: 32771}),
+		service("hidden", map[string]string{LabelEnable: "false"}, dockerclient.APIPort{PrivatePort: 80, PublicPort: 32772}),
+		service("db", nil, dockerclient.APIPort{PrivatePort: 5432}),
+	}
+
+	routes := Routes(services, "parity.local", "192.168.99.100", false)
+	expected := []Route{
+		{Hostname: "web.myproject.parity.local", Project: "myproject", Service: "web", Backend: "192.168.99.100:32769"},
+		{Hostname: "api.myproject.parity.local", Project: "myproject", Service: "api", Backend: "192.168.99.100:32771"},
+		{Hostname: "api.example.test", Project: "myproject", Service: "api", Backend: "192.168.99.100:32771"},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("Expected %d routes, got %+v", len(expected), routes)
+	}
+	for i, r := range routes {
+		if r != expected[i] {
+			t.Fatalf("Expected route %+v, got %+v", expected[i], r)
+		}
+	}
+
+	routes = Routes(services, "parity.local", "127.0.0.1", true)
+	if len(routes) != 4 || routes[0].Backend != "172.17.0.2:80" || routes[3].Backend != "172.17.0.2:5432" {
+		t.Fatalf("Expected routes to the container addresses when running natively, got %+v", routes)
+	}
+}
+
+func TestRoutes_InvalidPortLabel(t *testing.T) {
+	services := []utils.ComposeService{
+		service("web", map[string]string{LabelPort: "http"}, dockerclient.APIPort{PrivatePort: 80, PublicPort: 32769}),
+	}
+	if routes := Routes(services, "parity.local", "192.168.99.100", false); len(routes) != 0 {
+		t.Fatalf("Expected no routes, got %+v", routes)
+	}
+}
+
+func newRouter(backend string) *Router {
+	r := New("parity.local")
+	r.SetRoutes([]Route{{Hostname: "web.myproject.parity.local", Project: "myproject", Service: "web", Backend: backend}})
+	return r
+}
+
+func TestRouter_Proxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Host + " " + req.Header.Get("X-Forwarded-Host") + " " + req.Header.Get("X-Forwarded-Proto") + " " + req.URL.Path))
+	}))
+	defer backend.Close()
+	proxy := httptest.NewServer(newRouter(strings.TrimPrefix(backend.URL, "http://")))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/users", nil)
+	req.Host = "Web.MyProject.parity.local:8080"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", res.StatusCode)
+	}
+	if expected := "Web.MyProject.parity.local:8080 Web.MyProject.parity.local:8080 http /users"; string(body) != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, body)
+	}
+}
+
+func TestRouter_BackendDown(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	req := httptest.NewRequest("GET", "http://web.myproject.parity.local/", nil)
+	w := httptest.NewRecorder()
+	newRouter(addr).ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("Expected status 502, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "'web' of project 'myproject' is not responding") {
+		t.Fatalf("Expected an explanation, got '%s'", w.Body.String())
+	}
+}
+
+func TestRouter_Index(t *testing.T) {
+	r := newRouter("127.0.0.1:1")
+
+	req := httptest.NewRequest("GET", "http://parity.local:8080/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `href="http://web.myproject.parity.local:8080/"`) {
+		t.Fatalf("Expected a link to the route, got '%s'", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "http://api.myproject.parity.local/", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "no running service for <strong>api.myproject.parity.local</strong>") {
+		t.Fatalf("Expected the missing hostname, got '%s'", w.Body.String())
+	}
+}
+
+func TestRouter_Websocket(t *testing.T) {
+	// An echo server that switches protocols, as a websocket server would
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "Expected an upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString("echo: " + line)
+		rw.Flush()
+	}))
+	defer backend.Close()
+	proxy := httptest.NewServer(newRouter(strings.TrimPrefix(backend.URL, "http://")))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxy.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /socket HTTP/1.1\r\nHost: web.myproject.parity.local\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", res.StatusCode)
+	}
+	conn.Write([]byte("hello\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "echo: hello\n" {
+		t.Fatalf("Expected 'echo: hello', got '%s' (%v)", line, err)
+	}
+}
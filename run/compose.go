@@ -5,12 +5,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
@@ -28,8 +26,12 @@ import (
 	"github.com/docker/libcompose/project"
 	dockerclient "github.com/fsouza/go-dockerclient"
 	"github.com/imdario/mergo"
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/parity/env"
 	"github.com/mefellows/parity/log"
 	"github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/secrets"
+	"github.com/mefellows/parity/snapshot"
 	"github.com/mefellows/parity/utils"
 	"github.com/mefellows/plugo/plugo"
 	"golang.org/x/net/context"
@@ -38,11 +40,14 @@ import (
 // DockerCompose is a type of Run Plugin, that uses Docker Compose
 // to run a local development environment
 type DockerCompose struct {
-	ComposeFile  string `default:"docker-compose.yml" required:"true" mapstructure:"composefile"`
-	XProxyPort   int    `default:"6000" required:"true" mapstructure:"x_proxy_port"`
-	ImageName    string `mapstructure:"image_name"`
-	pluginConfig *parity.PluginConfig
-	project      *project.Project
+	ComposeFile   string `default:"docker-compose.yml" required:"true" mapstructure:"composefile"`
+	XProxyPort    int    `default:"6000" required:"true" mapstructure:"x_proxy_port"`
+	ImageName     string `mapstructure:"image_name"`
+	pluginConfig  *parity.PluginConfig
+	project       *project.Project
+	xSession      *XSession
+	secretsHelper *utils.HelperContainer
+	secretVolumes []string
 }
 
 func init() {
@@ -56,77 +61,138 @@ func (c *DockerCompose) Name() string {
 	return "compose"
 }
 
-// XServerProxy creates a TCP proxy on port 6000 to a the Unix
-// socket that XQuartz is listening on.
-//
-// NOTE: this function does not start/install the XQuartz service
-func XServerProxy(port int) {
-	if runtime.GOOS != "darwin" {
-		log.Debug("Not running an OSX environment, skip run X Server Proxy")
-		return
+// injectEnvironmentVariable adds envVars to each service's environment,
+// without overriding any variables the service already sets
+func injectEnvironmentVariable(envVars []string, p *project.Project) {
+	for _, conf := range p.Configs {
+		conf.Environment = mergeEnvironmentArrays(envVars, conf.Environment.Slice())
 	}
+}
 
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatal(err)
+// injectEnvironment sets the project's environment in each service. The
+// Compose file's environment takes precedence over it, and parity.yml's
+// environment for the service over both.
+func injectEnvironment(p *project.Project, pc *parity.PluginConfig) {
+	for name, conf := range p.Configs {
+		conf.Environment = mergeEnvironmentArrays(pc.Env, env.Merge(conf.Environment.Slice(), pc.ServiceEnv[name]))
+		log.Debug("Service '%s': environment %v", name, envNames(conf.Environment.Slice()))
+	}
+	for name := range pc.ServiceEnv {
+		if _, ok := p.Configs[name]; !ok {
+			log.Warn("parity.yml sets the environment of service '%s', which is not in the Compose file", name)
+		}
 	}
-	defer l.Close()
+}
 
-	// Send all traffic back to unix $DISPLAY socket on a running XQuartz server
-	addr, err := net.ResolveUnixAddr("unix", os.Getenv("DISPLAY"))
-	if err != nil {
-		log.Error("Error: ", err.Error())
+// envNames returns the names of vars, so that they can be logged without
+// their values, which may be secrets
+func envNames(vars []string) []string {
+	names := make([]string, 0, len(vars))
+	for _, v := range vars {
+		key, _, _ := env.Split(v)
+		names = append(names, key)
 	}
-	log.Info("X Service Proxy available on all network interfaces on port %d", port)
-	if host, err := utils.DockerVMHost(); err == nil {
-		log.Info("Parity has detected your Docker environment and recommends running 'export DISPLAY=%s:0' in your container to forward the X display", host)
+	return names
+}
+
+// envLookup resolves variables in the Compose file, and services' variables
+// without a value, from the project's environment before the host's
+type envLookup struct {
+	vars []string
+}
+
+func (l *envLookup) Lookup(key, serviceName string, config *project.ServiceConfig) []string {
+	value, ok := env.Layered(&l.vars, os.LookupEnv)(key)
+	if !ok {
+		return []string{}
 	}
+	return []string{key + "=" + value}
+}
 
-	for {
-		xServerClient, err := net.DialUnix("unix", nil, addr)
-		if err != nil {
-			log.Error("Error: ", err.Error())
-		}
-		defer xServerClient.Close()
+// runXServerProxy runs the X Server, including setting any Environment
+// variables (e.g. DISPLAY)
+func (c *DockerCompose) runXServerProxy() {
+	session, err := XServerProxy(c.pluginConfig.Docker, c.XProxyPort, c.xauthorityFile())
+	if err != nil {
+		log.Warn("Unable to share the X display with containers: %s", err.Error())
+		return
+	}
+	source, err := c.xauthoritySource(session, true)
+	if err != nil {
+		log.Warn("Unable to share the X display's cookie with containers: %s", err.Error())
+		source = ""
+	}
+	c.xSession = session
+	injectXSession(session, source, c.project)
+}
 
-		conn, err := l.Accept()
-		log.Debug("X Service Proxy connected to client on: %s (remote: %s)", conn.LocalAddr(), conn.RemoteAddr())
-		if err != nil {
-			log.Fatal(err)
-		}
-		go func(c net.Conn, s *net.UnixConn) {
-			buf := make([]byte, 8092)
-			io.CopyBuffer(s, c, buf)
-			s.CloseWrite()
-		}(conn, xServerClient)
-
-		go func(c net.Conn, s *net.UnixConn) {
-			buf := make([]byte, 8092)
-			io.CopyBuffer(c, s, buf)
-			c.Close()
-		}(conn, xServerClient)
+// xauthoritySource returns the directory or volume on the Docker host that
+// containers mount to find the session's Xauthority file. Natively, that's
+// the file's own directory. Otherwise the file is copied into a volume on
+// the Docker host, if write is set.
+func (c *DockerCompose) xauthoritySource(session *XSession, write bool) (string, error) {
+	if session.Xauthority == "" {
+		return "", nil
+	}
+	if c.pluginConfig.Docker.Native {
+		return filepath.Dir(session.Xauthority), nil
+	}
+	volume := xauthorityVolume(c.pluginConfig.ProjectNameSafe)
+	if !write {
+		return volume, nil
+	}
+	client, err := c.pluginConfig.Docker.Client()
+	if err != nil {
+		return "", err
 	}
+	return volume, writeXauthorityVolume(client, volume, session)
 }
 
-func injectDisplayEnvironmentVariables(p *project.Project) {
-	if host, err := utils.DockerVMHost(); err == nil {
-		injectEnvironmentVariable([]string{fmt.Sprintf("DISPLAY=%s:0", host)}, p)
+// restoreSnapshot seeds the project's volumes from the snapshot given with
+// 'parity run --from-snapshot', once its containers have been removed
+func (c *DockerCompose) restoreSnapshot() error {
+	if c.pluginConfig.Snapshot == "" {
+		return nil
 	}
+	log.Step("Restoring snapshot '%s'", c.pluginConfig.Snapshot)
+	client, err := c.pluginConfig.Docker.Client()
+	if err != nil {
+		return err
+	}
+	_, err = snapshot.Restore(client, snapshot.NewStore(c.pluginConfig.ProjectNameSafe), c.pluginConfig.Snapshot)
+	return err
 }
 
-func injectEnvironmentVariable(envVars []string, p *project.Project) {
-	for _, conf := range p.Configs {
-		existing := conf.Environment.Slice()
-		envVars = append(envVars, existing...)
-		conf.Environment = project.NewMaporEqualSlice(envVars)
+// injectSecrets resolves the project's secrets, and delivers them to the
+// services as environment variables or files
+func (c *DockerCompose) injectSecrets() error {
+	if len(c.pluginConfig.Secrets) == 0 {
+		return nil
+	}
+	log.Step("Resolving secrets")
+	resolved, err := secrets.Resolve(c.pluginConfig.Secrets, c.pluginConfig.SecretsContext)
+	if err != nil {
+		return err
+	}
+	log.Mask(secrets.Values(resolved)...)
+
+	files := injectSecrets(resolved, c.project, c.pluginConfig.ProjectNameSafe)
+	if len(files) == 0 {
+		return nil
+	}
+	client, err := c.pluginConfig.Docker.Client()
+	if err != nil {
+		return err
 	}
+	c.secretsHelper, c.secretVolumes, err = writeSecrets(client, c.pluginConfig.ProjectNameSafe, files)
+	return err
 }
 
-// runXServerProxy runs the X Server, including setting any Environment
-// variables (e.g. DISPLAY)
-func (c *DockerCompose) runXServerProxy() {
-	XServerProxy(c.XProxyPort)
-	injectDisplayEnvironmentVariables(c.project)
+// xauthorityFile is where the cookie containers use to connect to the X
+// display is written, outside the project so that it's never synced or
+// committed with it
+func (c *DockerCompose) xauthorityFile() string {
+	return filepath.Join(mirror.GetHomeDir(), ".parity", "x11", c.pluginConfig.ProjectNameSafe, "Xauthority")
 }
 
 // Run the Docker Compose Run Plugin
@@ -143,11 +209,23 @@ func (c *DockerCompose) Run() (err error) {
 	if c.project != nil {
 		log.Debug("Compose - starting docker compose services")
 
-		go c.runXServerProxy()
+		c.runXServerProxy()
 
 		c.project.Delete()
+		if err = c.restoreSnapshot(); err != nil {
+			return err
+		}
+		if err = c.injectSecrets(); err != nil {
+			return err
+		}
 		c.project.Build()
 		c.project.Up()
+
+		// The services now keep their secret volumes mounted
+		if c.secretsHelper != nil {
+			c.secretsHelper.Remove()
+			c.secretsHelper = nil
+		}
 	}
 
 	log.Debug("Docker Compose Run() finished")
@@ -159,8 +237,9 @@ func (c *DockerCompose) GetProject() (p *project.Project, err error) {
 	if _, err = os.Stat(c.ComposeFile); err == nil {
 		p, err = docker.NewProject(&docker.Context{
 			Context: project.Context{
-				ComposeFiles: []string{c.ComposeFile},
-				ProjectName:  fmt.Sprintf("parity-%s", c.pluginConfig.ProjectNameSafe),
+				ComposeFiles:      []string{c.ComposeFile},
+				ProjectName:       fmt.Sprintf("parity-%s", c.pluginConfig.ProjectNameSafe),
+				EnvironmentLookup: &envLookup{vars: c.pluginConfig.Env},
 			},
 		})
 
@@ -184,7 +263,10 @@ func (c *DockerCompose) Attach(config parity.ShellConfig) (err error) {
 	mergedConfig := *parity.DEFAULT_INTERACTIVE_SHELL_OPTIONS
 	mergo.MergeWithOverwrite(&mergedConfig, &config)
 
-	client := utils.DockerClient()
+	client, err := c.pluginConfig.Docker.Client()
+	if err != nil {
+		return err
+	}
 	container := fmt.Sprintf("parity-%s_%s_1", c.pluginConfig.ProjectNameSafe, mergedConfig.Service)
 
 	opts := dockerclient.AttachToContainerOptions{
@@ -222,8 +304,10 @@ func (c *DockerCompose) Attach(config parity.ShellConfig) (err error) {
 	return err
 }
 
-func (c *DockerCompose) mergeEnvironmentArrays(new, existing []string) *project.MaporEqualSlice {
-	return nil
+// mergeEnvironmentArrays adds new variables to an existing environment,
+// keeping the existing value of any variable set in both
+func mergeEnvironmentArrays(new, existing []string) project.MaporEqualSlice {
+	return project.NewMaporEqualSlice(env.Merge(new, existing))
 }
 
 // Shell creates an interactive Docker session to the specified service
@@ -241,12 +325,20 @@ func (c *DockerCompose) Shell(config parity.ShellConfig) (err error) {
 	if c.project != nil {
 		log.Step("Starting compose services")
 
-		injectDisplayEnvironmentVariables(c.project)
+		if session, err := XDisplay(c.pluginConfig.Docker, c.XProxyPort, c.xauthorityFile()); err == nil {
+			source, _ := c.xauthoritySource(session, false)
+			injectXSession(session, source, c.project)
+		} else {
+			log.Debug("Not sharing the X display: %s", err.Error())
+		}
 	}
 
 	container := fmt.Sprintf("parity-%s_%s_1", c.pluginConfig.ProjectNameSafe, mergedConfig.Service)
 
-	client := utils.DockerClient()
+	client, err := c.pluginConfig.Docker.Client()
+	if err != nil {
+		return err
+	}
 
 	createExecOptions := dockerclient.CreateExecOptions{
 		AttachStdin:  true,
@@ -313,19 +405,69 @@ func (c *DockerCompose) Publish() error {
 func (c *DockerCompose) Configure(pc *parity.PluginConfig) {
 	log.Debug("Configuring 'Docker Machine' 'Run\\Build\\Shell' plugin")
 	c.pluginConfig = pc
+
+	// libcompose only reads the Docker host from the environment
+	if err := pc.Docker.Setenv(); err != nil {
+		log.Fatalf("Unable to connect to Docker host: %s. Run 'parity doctor' for details", err.Error())
+	}
+
 	var err error
 	if c.project, err = c.GetProject(); err != nil {
 		log.Fatalf("Unable to create Compose Project: %s", err.Error())
 	}
+	rewriteVolumes(c.project, pc)
+	injectEnvironment(c.project, pc)
+}
+
+// rewriteVolumes points any volumes synced to a different location on the
+// Docker host at that location, so containers mount the synced files
+func rewriteVolumes(p *project.Project, pc *parity.PluginConfig) {
+	if len(pc.Mappings) == 0 {
+		return
+	}
+	for name, conf := range p.Configs {
+		for i, v := range conf.Volumes {
+			host, rest := utils.SplitVolume(v)
+
+			// Skip container only and named volumes
+			if rest == "" || (host != "." && !strings.ContainsAny(host, "/\\")) {
+				continue
+			}
+			remote := pc.RemotePath(utils.ResolveVolumePath(host))
+			if remote == utils.ResolveVolumePath(host) {
+				continue
+			}
+			log.Debug("Service '%s': mounting '%s' from '%s' on Docker host", name, host, remote)
+			conf.Volumes[i] = fmt.Sprintf("%s:%s", remote, rest)
+		}
+	}
 }
 
 // Teardown stops any running projects before Parity exits
 func (c *DockerCompose) Teardown() error {
 	log.Debug("Tearing down 'Docker Machine' 'Run' plugin")
 
+	if c.xSession != nil {
+		c.xSession.Close()
+	}
 	if c.project != nil {
 		c.project.Down()
 	}
+	if c.xSession != nil && c.xSession.Xauthority != "" && !c.pluginConfig.Docker.Native {
+		if client, err := c.pluginConfig.Docker.Client(); err == nil {
+			client.RemoveVolume(xauthorityVolume(c.pluginConfig.ProjectNameSafe))
+		}
+	}
+	if len(c.secretVolumes) > 0 {
+		if client, err := c.pluginConfig.Docker.Client(); err == nil {
+			if c.secretsHelper != nil {
+				c.secretsHelper.Remove()
+			}
+			for _, volume := range c.secretVolumes {
+				client.RemoveVolume(volume)
+			}
+		}
+	}
 	return nil
 }
 
@@ -471,7 +613,7 @@ func (c *DockerCompose) Build() error {
 	})
 
 	if err != nil {
-		log.Error(err.Error())
+		log.Error("%s", err.Error())
 		return err
 	}
 
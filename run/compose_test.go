@@ -3,7 +3,12 @@ package run
 import (
 	"io/ioutil"
 	"os"
+	"reflect"
+	"sort"
 	"testing"
+
+	"github.com/docker/libcompose/project"
+	"github.com/mefellows/parity/parity"
 )
 
 func TestGenerateContainerVersion_NoFiles(t *testing.T) {
@@ -63,3 +68,63 @@ func TestGenerateContainerVersion_WithFiles(t *testing.T) {
 		t.Fatalf("Expected 'fcc849bd02e7f688f1704e82e1c3751a', got '%s'", res)
 	}
 }
+
+func TestRewriteVolumes(t *testing.T) {
+	p := &project.Project{Configs: map[string]*project.ServiceConfig{
+		"web": &project.ServiceConfig{Volumes: []string{"/Users/dev/app/src:/app:ro", "/var/log:/var/log", "data:/data", "/tmp"}},
+	}}
+	pc := &parity.PluginConfig{Mappings: []parity.VolumeMapping{{Local: "/Users/dev/app", Remote: "/parity/app"}}}
+	rewriteVolumes(p, pc)
+
+	expected := []string{"/parity/app/src:/app:ro", "/var/log:/var/log", "data:/data", "/tmp"}
+	for i, v := range p.Configs["web"].Volumes {
+		if v != expected[i] {
+			t.Fatalf("Expected volume '%s', got '%s'", expected[i], v)
+		}
+	}
+}
+
+func TestInjectEnvironment(t *testing.T) {
+	p := &project.Project{Configs: map[string]*project.ServiceConfig{
+		"web":    &project.ServiceConfig{Environment: project.NewMaporEqualSlice([]string{"LEVEL=debug", "PORT=80"})},
+		"worker": &project.ServiceConfig{},
+	}}
+	pc := &parity.PluginConfig{
+		Env:        []string{"LEVEL=info", "DB_HOST=db"},
+		ServiceEnv: map[string][]string{"web": {"PORT=8080"}},
+	}
+	injectEnvironment(p, pc)
+	injectEnvironmentVariable([]string{"DISPLAY=:0", "DB_HOST=ignored"}, p)
+
+	for name, expected := range map[string][]string{
+		"web":    {"DISPLAY=:0", "DB_HOST=db", "LEVEL=debug", "PORT=8080"},
+		"worker": {"DISPLAY=:0", "DB_HOST=db", "LEVEL=info"},
+	} {
+		env := p.Configs[name].Environment.Slice()
+		sort.Strings(env)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("Expected %s's environment to be %q, got %q", name, expected, env)
+		}
+	}
+}
+
+func TestEnvNames(t *testing.T) {
+	names := envNames([]string{"POSTGRES_PASSWORD=hunter2", "HOME"})
+	if !reflect.DeepEqual(names, []string{"POSTGRES_PASSWORD", "HOME"}) {
+		t.Fatalf("Expected only the variables' names, got %q", names)
+	}
+}
+
+func TestEnvLookup(t *testing.T) {
+	os.Setenv("PARITY_TEST_HOST_VAR", "host")
+	defer os.Unsetenv("PARITY_TEST_HOST_VAR")
+
+	l := &envLookup{vars: []string{"PARITY_TEST_HOST_VAR=project"}}
+	if vars := l.Lookup("PARITY_TEST_HOST_VAR", "web", nil); len(vars) != 1 || vars[0] != "PARITY_TEST_HOST_VAR=project" {
+		t.Fatalf("Expected the project's value, got %q", vars)
+	}
+	if vars := l.Lookup("PARITY_TEST_UNSET", "web", nil); len(vars) != 0 {
+		t.Fatalf("Expected no value, got %q", vars)
+	}
+}
@@ -0,0 +1,184 @@
+package run
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/hosts"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/parity"
+	"github.com/mefellows/parity/router"
+	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/plugo/plugo"
+)
+
+// Router is a type of Run Plugin, that runs a reverse proxy routing
+// requests to Compose services by hostname (e.g. web.myproject.parity.local)
+type Router struct {
+	Listen    string `default:"127.0.0.1:8080" required:"true" mapstructure:"listen"`
+	TLSListen string `mapstructure:"tls_listen"`
+	CertFile  string `mapstructure:"cert_file"`
+	KeyFile   string `mapstructure:"key_file"`
+	Domain    string `default:"parity.local" required:"true" mapstructure:"domain"`
+	Refresh   int    `default:"5" required:"true" mapstructure:"refresh"` // Seconds between route updates
+
+	pluginConfig *parity.PluginConfig
+	router       *router.Router
+	servers      []*http.Server
+	stop         chan struct{}
+}
+
+func init() {
+	plugo.PluginFactories.Register(func() (interface{}, error) {
+		return &Router{}, nil
+	}, "router")
+}
+
+// Name of this Plugin
+func (r *Router) Name() string {
+	return "router"
+}
+
+// Configure sets up this plugin with initial state
+func (r *Router) Configure(pc *parity.PluginConfig) {
+	log.Debug("Configuring 'Router' 'Run' plugin")
+	if r.Refresh <= 0 {
+		log.Fatalf("Invalid refresh '%d' for router plugin. Must be a positive number of seconds", r.Refresh)
+	}
+	r.pluginConfig = pc
+	r.router = router.New(r.Domain)
+	r.stop = make(chan struct{})
+}
+
+// Run starts the proxy, and keeps its routes up to date with the running
+// Compose services until Teardown
+func (r *Router) Run() error {
+	log.Stage("Run Router")
+	if err := r.refresh(); err != nil {
+		log.Warn("Unable to find running Compose services: %s", err.Error())
+	}
+
+	l, err := net.Listen("tcp", r.Listen)
+	if err != nil {
+		return fmt.Errorf("Router unable to listen on %s: %s", r.Listen, err.Error())
+	}
+	r.serve(l, "http")
+
+	if r.TLSListen != "" {
+		config, err := r.tlsConfig()
+		if err != nil {
+			return err
+		}
+		l, err := tls.Listen("tcp", r.TLSListen, config)
+		if err != nil {
+			return fmt.Errorf("Router unable to listen on %s: %s", r.TLSListen, err.Error())
+		}
+		r.serve(l, "https")
+	}
+
+	log.Info("Point *.%s at %s, e.g. with 'parity dns serve --ip %s' or 'parity hosts sync --ip %s'",
+		r.Domain, r.listenIP(), r.listenIP(), r.listenIP())
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(r.Refresh) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if err := r.refresh(); err != nil {
+					log.Debug("Unable to refresh routes: %s", err.Error())
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// tlsConfig loads the certificate served for HTTPS. Without one,
+// certificates are issued for each hostname by Parity's development CA.
+func (r *Router) tlsConfig() (*tls.Config, error) {
+	if r.CertFile == "" && r.KeyFile == "" {
+		ca := certs.NewDevCA()
+		if err := ca.Init(); err != nil {
+			return nil, err
+		}
+		log.Info("Serving HTTPS with certificates from Parity's development CA, see 'parity certs trust' to trust it")
+		return &tls.Config{GetCertificate: ca.GetCertificate(r.Domain)}, nil
+	}
+	if r.CertFile == "" || r.KeyFile == "" {
+		return nil, fmt.Errorf("Router requires both 'cert_file' and 'key_file' to listen on %s", r.TLSListen)
+	}
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Router unable to load certificate: %s", err.Error())
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// serve handles requests on l in the background
+func (r *Router) serve(l net.Listener, scheme string) {
+	server := &http.Server{Handler: r.router}
+	r.servers = append(r.servers, server)
+	log.Info("Router listening on %s://%s", scheme, l.Addr())
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Error("Router stopped: %s", err.Error())
+		}
+	}()
+}
+
+// refresh updates the routes from the running Compose services
+func (r *Router) refresh() error {
+	docker := r.pluginConfig.Docker
+	client, err := docker.Client()
+	if err != nil {
+		return err
+	}
+	services, err := utils.RunningComposeServices(client)
+	if err != nil {
+		return err
+	}
+	host := docker.Host
+	if docker.Native || host == "" {
+		host = "127.0.0.1"
+	}
+	r.router.SetRoutes(router.Routes(services, r.Domain, host, docker.Native))
+	return nil
+}
+
+// listenIP is the address hostnames should resolve to, to reach the router
+func (r *Router) listenIP() string {
+	host, _, err := net.SplitHostPort(r.Listen)
+	if err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+		return "127.0.0.1"
+	}
+	if ip, err := hosts.ResolveIP(host); err == nil {
+		return ip
+	}
+	return host
+}
+
+// Teardown stops the proxy
+func (r *Router) Teardown() error {
+	log.Debug("Tearing down 'Router' 'Run' plugin")
+	select {
+	case <-r.stop:
+		return nil
+	default:
+		close(r.stop)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, s := range r.servers {
+		s.Shutdown(ctx)
+	}
+	return nil
+}
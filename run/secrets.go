@@ -0,0 +1,121 @@
+package run
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/docker/libcompose/project"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/env"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/secrets"
+	"github.com/mefellows/parity/utils"
+)
+
+// secretsVolume is the tmpfs volume holding a service's secret files
+func secretsVolume(projectName string, service string) string {
+	return fmt.Sprintf("parity-%s-secrets-%s", projectName, service)
+}
+
+// injectSecrets sets each service's secrets in its environment, over any
+// other value, and mounts the volume holding its secret files. It returns
+// the secret files of each service.
+func injectSecrets(s []secrets.Secret, p *project.Project, projectName string) map[string][]secrets.Secret {
+	files := map[string][]secrets.Secret{}
+	for name, conf := range p.Configs {
+		var vars []string
+		for _, secret := range s {
+			if !secret.For(name) {
+				continue
+			}
+			if secret.As == secrets.AsFile {
+				files[name] = append(files[name], secret)
+			} else {
+				vars = append(vars, secret.Name+"="+secret.Value)
+			}
+		}
+		conf.Environment = project.NewMaporEqualSlice(env.Merge(conf.Environment.Slice(), vars))
+		if len(files[name]) > 0 {
+			conf.Volumes = append(conf.Volumes, fmt.Sprintf("%s:%s:ro", secretsVolume(projectName, name), secrets.Dir))
+		}
+	}
+
+	for _, secret := range s {
+		for _, service := range secret.Services {
+			if _, ok := p.Configs[service]; !ok {
+				log.Warn("Secret '%s' is for service '%s', which is not in the Compose file", secret.Name, service)
+			}
+		}
+	}
+	return files
+}
+
+// secretsTar archives each service's secret files, in a directory named
+// after the service, in memory
+func secretsTar(files map[string][]secrets.Secret) (*bytes.Buffer, error) {
+	var services []string
+	for service := range files {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, service := range services {
+		for _, secret := range files[service] {
+			header := &tar.Header{
+				Name: path.Join(service, path.Base(secret.File)),
+				Mode: 0444,
+				Size: int64(len(secret.Value)),
+			}
+			if err := w.WriteHeader(header); err != nil {
+				return nil, err
+			}
+			if _, err := w.Write([]byte(secret.Value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &buf, w.Close()
+}
+
+// writeSecrets creates a tmpfs volume for each service's secret files, so
+// that they're never written to the Docker host's disk, and writes them
+// through a helper container. A tmpfs volume's files only last while it's
+// mounted, so the helper must keep running until the services have started.
+func writeSecrets(client *dockerclient.Client, projectName string, files map[string][]secrets.Secret) (*utils.HelperContainer, []string, error) {
+	var volumes, binds []string
+	for service := range files {
+		volume := secretsVolume(projectName, service)
+
+		// Start afresh, in case a previous run's volume is still mounted
+		client.RemoveVolume(volume)
+		_, err := client.CreateVolume(dockerclient.CreateVolumeOptions{
+			Name:       volume,
+			Driver:     "local",
+			DriverOpts: map[string]string{"type": "tmpfs", "device": "tmpfs", "o": "size=1m,mode=0755"},
+		})
+		if err != nil {
+			return nil, volumes, fmt.Errorf("Unable to create volume %s: %s", volume, err.Error())
+		}
+		volumes = append(volumes, volume)
+		binds = append(binds, fmt.Sprintf("%s:/secrets/%s", volume, service))
+	}
+
+	archive, err := secretsTar(files)
+	if err != nil {
+		return nil, volumes, err
+	}
+	helper, err := utils.StartHelper(client, fmt.Sprintf("parity-%s-secrets", projectName), binds)
+	if err != nil {
+		return nil, volumes, err
+	}
+	if err := helper.Upload("/secrets", archive); err != nil {
+		helper.Remove()
+		return nil, volumes, fmt.Errorf("Unable to write secrets: %s", err.Error())
+	}
+	return helper, volumes, nil
+}
@@ -0,0 +1,66 @@
+package run
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/docker/libcompose/project"
+	"github.com/mefellows/parity/secrets"
+)
+
+func TestInjectSecrets(t *testing.T) {
+	p := &project.Project{Configs: map[string]*project.ServiceConfig{
+		"web":    &project.ServiceConfig{Environment: project.NewMaporEqualSlice([]string{"DB_PASSWORD=insecure", "PORT=80"})},
+		"worker": &project.ServiceConfig{},
+	}}
+	files := injectSecrets([]secrets.Secret{
+		{Name: "DB_PASSWORD", Value: "hunter22", As: secrets.AsEnv},
+		{Name: "TLS_KEY", Value: "-----BEGIN", As: secrets.AsFile, File: "/run/secrets/tls_key", Services: []string{"web"}},
+	}, p, "myproject")
+
+	env := p.Configs["web"].Environment.Slice()
+	sort.Strings(env)
+	if !reflect.DeepEqual(env, []string{"DB_PASSWORD=hunter22", "PORT=80"}) {
+		t.Fatalf("Expected the secret to override the Compose file, got %q", env)
+	}
+	if env := p.Configs["worker"].Environment.Slice(); !reflect.DeepEqual(env, []string{"DB_PASSWORD=hunter22"}) {
+		t.Fatalf("Expected the secret in all services, got %q", env)
+	}
+	if volumes := p.Configs["web"].Volumes; !reflect.DeepEqual(volumes, []string{"parity-myproject-secrets-web:/run/secrets:ro"}) {
+		t.Fatalf("Expected the secrets volume to be mounted, got %q", volumes)
+	}
+	if volumes := p.Configs["worker"].Volumes; len(volumes) != 0 {
+		t.Fatalf("Expected no secrets volume for the worker, got %q", volumes)
+	}
+	if len(files) != 1 || len(files["web"]) != 1 || files["web"][0].Name != "TLS_KEY" {
+		t.Fatalf("Expected the web service's secret file, got %+v", files)
+	}
+}
+
+func TestSecretsTar(t *testing.T) {
+	buf, err := secretsTar(map[string][]secrets.Secret{
+		"worker": {{Name: "API_TOKEN", Value: "abc123", File: "/run/secrets/token"}},
+		"web":    {{Name: "TLS_KEY", Value: "-----BEGIN", File: "/run/secrets/tls_key"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	r := tar.NewReader(buf)
+	for _, expected := range []struct{ name, contents string }{
+		{"web/tls_key", "-----BEGIN"},
+		{"worker/token", "abc123"},
+	} {
+		header, err := r.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		contents, _ := ioutil.ReadAll(r)
+		if header.Name != expected.name || string(contents) != expected.contents || header.Mode != 0444 {
+			t.Fatalf("Expected %s to contain '%s', got %s (%o): '%s'", expected.name, expected.contents, header.Name, header.Mode, contents)
+		}
+	}
+}
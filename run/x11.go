@@ -0,0 +1,190 @@
+package run
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libcompose/project"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/forward"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/parity/x11"
+)
+
+// containerXauthorityDir is where containers mount the directory holding
+// the X session's Xauthority file
+const containerXauthorityDir = "/tmp/.parity.x11"
+
+// XSession describes how containers reach the host's X display
+type XSession struct {
+	Display    string           // DISPLAY for containers
+	Cookie     []byte           // Cookie containers authenticate with, if any
+	Xauthority string           // Xauthority file containing Cookie
+	Volumes    []string         // Volumes containers need, e.g. the X11 sockets
+	Proxy      *forward.Forward // Forwards the display, when containers can't reach it directly
+}
+
+// XServerProxy shares the host's X display ($DISPLAY) with containers.
+//
+// When Docker runs natively and the display is local (e.g. ":0" on Xorg or
+// Xwayland), containers use its unix socket directly. Otherwise, e.g. with
+// XQuartz or a TCP display, a proxy listens on port, only on the interface
+// the Docker host reaches this machine on. Containers authenticate to the
+// proxy with a cookie of their own, written to xauthority, so that the X
+// server's cookie never leaves the host.
+//
+// NOTE: this function does not start/install the X server (e.g. XQuartz)
+func XServerProxy(docker *utils.DockerEnvironment, port int, xauthority string) (*XSession, error) {
+	return xSession(docker, os.Getenv("DISPLAY"), port, xauthority, true)
+}
+
+// XDisplay describes how containers reach the X display without starting a
+// proxy, for containers started while 'parity run' or 'parity x' is
+// running
+func XDisplay(docker *utils.DockerEnvironment, port int, xauthority string) (*XSession, error) {
+	return xSession(docker, os.Getenv("DISPLAY"), port, xauthority, false)
+}
+
+func xSession(docker *utils.DockerEnvironment, display string, port int, xauthority string, start bool) (*XSession, error) {
+	if display == "" {
+		return nil, fmt.Errorf("DISPLAY is not set, is an X server (e.g. XQuartz) running?")
+	}
+	d, err := x11.ParseDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := x11.ReadXauthority(x11.XauthorityFile())
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	serverCookie := x11.Cookie(entries, d, hostname)
+
+	s := &XSession{}
+	if docker.Native && strings.HasPrefix(d.Socket, x11.SocketDir+"/") {
+		log.Debug("Docker is running natively, containers use the host X display (%s) directly", display)
+		s.Display = display
+		s.Volumes = []string{fmt.Sprintf("%[1]s:%[1]s", x11.SocketDir)}
+		s.Cookie = serverCookie
+		return s, s.writeXauthority(xauthority, d.Number)
+	}
+
+	if port < x11.BasePort {
+		return nil, fmt.Errorf("The X Server Proxy port must be %d or above, got %d", x11.BasePort, port)
+	}
+	host, err := docker.VMHost()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find this machine's address on the Docker host's network: %s", err.Error())
+	}
+	number := port - x11.BasePort
+	s.Display = fmt.Sprintf("%s:%d", host, number)
+	if !start {
+		if _, err := os.Stat(xauthority); err == nil {
+			s.Xauthority = xauthority
+		}
+		return s, nil
+	}
+
+	if s.Cookie, err = x11.NewCookie(); err != nil {
+		return nil, err
+	}
+	s.Proxy = &forward.Forward{
+		Name:      "x11",
+		Listen:    forward.Endpoint{Network: forward.TCP, Address: net.JoinHostPort(host, strconv.Itoa(port))},
+		Target:    d.Endpoint(),
+		Handshake: x11.Handshake(s.Cookie, serverCookie),
+	}
+	if err := s.Proxy.Start(); err != nil {
+		return nil, err
+	}
+	if err := s.writeXauthority(xauthority, number); err != nil {
+		s.Proxy.Close()
+		return nil, err
+	}
+	log.Info("X Service Proxy available on %s, forwarding to %s", s.Proxy.Addr(), s.Proxy.Target)
+	return s, nil
+}
+
+// writeXauthority writes the session's cookie, if any, for containers
+func (s *XSession) writeXauthority(file string, number int) error {
+	if s.Cookie == nil {
+		return nil
+	}
+	if err := x11.ContainerXauthority(file, number, s.Cookie); err != nil {
+		return fmt.Errorf("Unable to write Xauthority file %s: %s", file, err.Error())
+	}
+	s.Xauthority = file
+	return nil
+}
+
+// Close stops the session's proxy, if any
+func (s *XSession) Close() error {
+	if s.Proxy == nil {
+		return nil
+	}
+	return s.Proxy.Close()
+}
+
+// xauthorityVolume is the volume holding the X session's Xauthority file on
+// the Docker host, when Docker isn't running natively
+func xauthorityVolume(projectName string) string {
+	return fmt.Sprintf("parity-%s-x11", projectName)
+}
+
+// writeXauthorityVolume copies the session's Xauthority file into volume,
+// through a helper container, so that it never has to be synced with the
+// project's files
+func writeXauthorityVolume(client *dockerclient.Client, volume string, s *XSession) error {
+	data, err := ioutil.ReadFile(s.Xauthority)
+	if err != nil {
+		return err
+	}
+	if _, err := client.CreateVolume(dockerclient.CreateVolumeOptions{Name: volume, Driver: "local"}); err != nil {
+		return fmt.Errorf("Unable to create volume %s: %s", volume, err.Error())
+	}
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	if err := w.WriteHeader(&tar.Header{Name: filepath.Base(s.Xauthority), Mode: 0444, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	helper, err := utils.StartHelper(client, volume, []string{volume + ":/x11"})
+	if err != nil {
+		return err
+	}
+	defer helper.Remove()
+	if err := helper.Upload("/x11", &buf); err != nil {
+		return fmt.Errorf("Unable to write Xauthority file: %s", err.Error())
+	}
+	return nil
+}
+
+// injectXSession sets DISPLAY and mounts the session's volumes and cookie
+// in each service. source is the directory or volume on the Docker host
+// holding the session's Xauthority file.
+func injectXSession(s *XSession, source string, p *project.Project) {
+	env := []string{"DISPLAY=" + s.Display}
+	volumes := s.Volumes
+	if s.Xauthority != "" && source != "" {
+		env = append(env, "XAUTHORITY="+path.Join(containerXauthorityDir, filepath.Base(s.Xauthority)))
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", source, containerXauthorityDir))
+	}
+	injectEnvironmentVariable(env, p)
+	for _, conf := range p.Configs {
+		conf.Volumes = append(conf.Volumes, volumes...)
+	}
+}
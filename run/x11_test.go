@@ -0,0 +1,155 @@
+package run
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/docker/libcompose/project"
+	"github.com/mefellows/parity/utils"
+	"github.com/mefellows/parity/x11"
+)
+
+// setupXauthority points XAUTHORITY at a file containing the X server's
+// cookie for display 0
+func setupXauthority(t *testing.T, dir string, cookie []byte) func() {
+	hostname, _ := os.Hostname()
+	file := filepath.Join(dir, "host.Xauthority")
+	x11.WriteXauthority(file, []x11.AuthEntry{{Family: x11.FamilyLocal, Address: []byte(hostname), Number: "0", Name: x11.MagicCookie, Data: cookie}})
+	previous := os.Getenv("XAUTHORITY")
+	os.Setenv("XAUTHORITY", file)
+	return func() { os.Setenv("XAUTHORITY", previous) }
+}
+
+func TestXSession_Native(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-x11")
+	defer os.RemoveAll(dir)
+	defer setupXauthority(t, dir, []byte("server-cookie-16"))()
+
+	xauthority := filepath.Join(dir, "Xauthority")
+	s, err := xSession(&utils.DockerEnvironment{Native: true}, ":0", 6000, xauthority, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Display != ":0" || s.Proxy != nil || len(s.Volumes) != 1 || s.Volumes[0] != "/tmp/.X11-unix:/tmp/.X11-unix" {
+		t.Fatalf("Expected the X11 sockets to be shared directly, got %+v", s)
+	}
+	entries, _ := x11.ReadXauthority(xauthority)
+	if s.Xauthority != xauthority || len(entries) != 1 || entries[0].Family != x11.FamilyWild || string(entries[0].Data) != "server-cookie-16" {
+		t.Fatalf("Expected the X server's cookie to be shared for any host, got %+v", entries)
+	}
+
+	p := &project.Project{Configs: map[string]*project.ServiceConfig{
+		"web": &project.ServiceConfig{Volumes: []string{"/src:/app"}},
+	}}
+	injectXSession(s, dir, p)
+	conf := p.Configs["web"]
+	if env := conf.Environment.Slice(); len(env) != 2 || env[0] != "DISPLAY=:0" || env[1] != "XAUTHORITY=/tmp/.parity.x11/Xauthority" {
+		t.Fatalf("Expected DISPLAY and XAUTHORITY, got '%v'", env)
+	}
+	if len(conf.Volumes) != 3 || conf.Volumes[2] != dir+":/tmp/.parity.x11:ro" {
+		t.Fatalf("Expected the X11 sockets and Xauthority file to be mounted, got '%v'", conf.Volumes)
+	}
+
+	// Without anywhere to mount the cookie from, only DISPLAY is set
+	p.Configs["web"] = &project.ServiceConfig{}
+	injectXSession(s, "", p)
+	if env := p.Configs["web"].Environment.Slice(); len(env) != 1 || env[0] != "DISPLAY=:0" {
+		t.Fatalf("Expected only DISPLAY, got '%v'", env)
+	}
+}
+
+func TestXSession_Unset(t *testing.T) {
+	if _, err := xSession(&utils.DockerEnvironment{Native: true}, "", 6000, "", true); err == nil {
+		t.Fatalf("Expected an error when DISPLAY is not set")
+	}
+	if _, err := xSession(&utils.DockerEnvironment{Host: "127.0.0.1"}, ":0", 5999, "", true); err == nil {
+		t.Fatalf("Expected an error for a port below 6000")
+	}
+}
+
+// freePort finds an unused TCP port
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestXSession_Proxy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-x11")
+	defer os.RemoveAll(dir)
+	defer setupXauthority(t, dir, []byte("server-cookie-16"))()
+
+	// An X server on a launchd style socket, as XQuartz listens on, that
+	// sends back the connection setup it received
+	socket := filepath.Join(dir, "org.xquartz:0")
+	server, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	defer server.Close()
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	port := freePort(t)
+	xauthority := filepath.Join(dir, "Xauthority")
+	s, err := xSession(&utils.DockerEnvironment{Host: "127.0.0.1"}, socket, port, xauthority, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer s.Close()
+	if s.Display != "127.0.0.1:"+strconv.Itoa(port-6000) || len(s.Volumes) != 0 {
+		t.Fatalf("Expected containers to use the proxy's display, got %+v", s)
+	}
+	if addr := s.Proxy.Addr().String(); addr != "127.0.0.1:"+strconv.Itoa(port) {
+		t.Fatalf("Expected the proxy to listen only on the Docker host's network, got %s", addr)
+	}
+
+	// Containers connect with the cookie in the Xauthority file, which the
+	// X server sees replaced with its own
+	entries, _ := x11.ReadXauthority(xauthority)
+	if len(entries) != 1 || entries[0].Number != strconv.Itoa(port-6000) || bytes.Equal(entries[0].Data, []byte("server-cookie-16")) {
+		t.Fatalf("Expected a new cookie for the proxy's display, got %+v", entries)
+	}
+	conn, err := net.Dial("tcp", s.Proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %s", err.Error())
+	}
+	defer conn.Close()
+	setup := []byte{'l', 0, 11, 0, 0, 0, 18, 0, 16, 0, 0, 0}
+	setup = append(setup, x11.MagicCookie+"\x00\x00"...)
+	conn.Write(append(setup, entries[0].Data...))
+
+	expected := append(append([]byte{'l', 0, 11, 0, 0, 0, 18, 0, 16, 0, 0, 0}, x11.MagicCookie+"\x00\x00"...), "server-cookie-16"...)
+	received := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !bytes.Equal(received, expected) {
+		t.Fatalf("Expected the X server to receive its own cookie, got %q", received)
+	}
+
+	// Without a proxy, containers use the existing Xauthority file
+	display, err := xSession(&utils.DockerEnvironment{Host: "127.0.0.1"}, socket, port, xauthority, false)
+	if err != nil || display.Proxy != nil || display.Xauthority != xauthority || display.Display != s.Display {
+		t.Fatalf("Expected the running proxy's display, got %+v (%v)", display, err)
+	}
+}
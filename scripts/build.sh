@@ -26,6 +26,29 @@ echo "==> Embedding binary assets"
 go get github.com/jteeuwen/go-bindata/...
 go-bindata  --pkg install --o install/assets.go templates/
 
+echo "==> Removing old directory..."
+rm -f bin/*
+rm -rf pkg/*
+mkdir -p bin/
+
+# The mirror daemon on the Docker host is Parity's own linux_amd64 binary
+# ('parity mirror-daemon'). Build it first, unless provided, and embed it
+# for offline installs. go-bindata names the asset after the file, so it
+# must be named "mirror". scripts/dist.sh publishes this same binary.
+mkdir -p pkg/daemon
+if [ -z "${MIRROR_BINARY}" ]; then
+    echo "==> Building mirror daemon"
+    GOOS=linux GOARCH=amd64 go build -o pkg/daemon/mirror .
+else
+    cp ${MIRROR_BINARY} pkg/daemon/mirror
+fi
+echo "==> Embedding mirror daemon"
+go-bindata -tags embedmirror --pkg install --o install/mirror_assets.go -prefix pkg/daemon pkg/daemon/mirror
+BUILD_TAGS="embedmirror"
+
+# Pin the daemon's checksum, so that downloaded daemons are verified against it
+MIRROR_SHA256=$(shasum -a 256 pkg/daemon/mirror | cut -d" " -f1)
+
 # Determine the arch/os combos we're building for
 XC_ARCH=${XC_ARCH:-"386 amd64"}
 XC_OS=${XC_OS:-linux darwin windows freebsd}
@@ -36,17 +59,13 @@ echo "==> Go version ${VERSION}"
 echo "==> Getting dependencies..."
 export GO15VENDOREXPERIMENT=1
 
-echo "==> Removing old directory..."
-rm -f bin/*
-rm -rf pkg/*
-mkdir -p bin/
-
 echo "==> Building..."
 set +e
 gox \
     -os="${XC_OS}" \
     -arch="${XC_ARCH}" \
-    -ldflags "-X main.GitCommit ${GIT_COMMIT}${GIT_DIRTY}" \
+    -tags="${BUILD_TAGS}" \
+    -ldflags "-X main.GitCommit ${GIT_COMMIT}${GIT_DIRTY} -X github.com/mefellows/parity/version.MirrorSHA256=${MIRROR_SHA256}" \
     -output "pkg/{{.OS}}_{{.Arch}}/{{.Dir}}" \
     .
 set -e
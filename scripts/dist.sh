@@ -29,7 +29,7 @@ mkdir -p ./pkg/dist
 for PLATFORM in $(find ./pkg -mindepth 1 -maxdepth 1 -type d); do
     OSARCH=$(basename ${PLATFORM})
 
-    if [ $OSARCH = "dist" ]; then
+    if [ $OSARCH = "dist" ] || [ $OSARCH = "daemon" ]; then
         continue
     fi
 
@@ -39,6 +39,18 @@ for PLATFORM in $(find ./pkg -mindepth 1 -maxdepth 1 -type d); do
     popd >/dev/null 2>&1
 done
 
+# Publish the mirror daemon that 'parity install' downloads. Its checksum
+# is pinned in every build (see scripts/build.sh), so check that they match.
+echo "==> Mirror daemon"
+cp ./pkg/daemon/mirror ./pkg/dist/mirror-daemon_linux_amd64
+MIRROR_SHA256=$(shasum -a 256 ./pkg/dist/mirror-daemon_linux_amd64 | cut -d" " -f1)
+for BINARY in $(find ./pkg -mindepth 2 -maxdepth 2 -type f -name 'parity*' -not -path './pkg/dist/*' -not -path './pkg/daemon/*'); do
+    if ! grep -q ${MIRROR_SHA256} ${BINARY}; then
+        echo "${BINARY} does not pin the checksum of the published mirror daemon (${MIRROR_SHA256})"
+        exit 1
+    fi
+done
+
 # Make the checksums
 echo "==> Checksumming..."
 pushd ./pkg/dist >/dev/null 2>&1
@@ -0,0 +1,242 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/parity/log"
+)
+
+// DefaultFile is the project's encrypted secrets file, which is safe to
+// commit
+const DefaultFile = ".parity/secrets.json"
+
+// KeyEnv is the environment variable the key to the project's secrets file
+// may be given in, e.g. on CI, instead of a key file
+const KeyEnv = "PARITY_SECRETS_KEY"
+
+// keyLength is the length of an AES-256 key
+const keyLength = 32
+
+func init() {
+	Register("file", func(ctx *Context) (Provider, error) {
+		file := ctx.File
+		if file == "" {
+			file = DefaultFile
+		}
+		return &EncryptedFile{
+			Path:    file,
+			KeyFile: filepath.Join(mirror.GetHomeDir(), ".parity", "secrets", ctx.Project+".key"),
+			KeyEnv:  KeyEnv,
+			Lookup:  ctx.Lookup,
+		}, nil
+	})
+
+	// A stand-in for the OS keychain: secrets are kept in the user's home
+	// directory, encrypted with a key only the user can read
+	Register("keychain", func(ctx *Context) (Provider, error) {
+		dir := filepath.Join(mirror.GetHomeDir(), ".parity", "keychain")
+		return &EncryptedFile{
+			Path:    filepath.Join(dir, ctx.Project+".json"),
+			KeyFile: filepath.Join(dir, "key"),
+		}, nil
+	})
+}
+
+// EncryptedFile is a Store of secrets encrypted with AES-256-GCM, each
+// separately, so that names can be listed without the key and changes to
+// one secret don't change the others
+type EncryptedFile struct {
+	Path    string
+	KeyFile string                      // Read, or created on the first Set
+	KeyEnv  string                      // Optional variable containing the key, base64 encoded
+	Lookup  func(string) (string, bool) // Finds KeyEnv, e.g. os.LookupEnv
+}
+
+// encryptedFile is the file's format
+type encryptedFile struct {
+	Version int               `json:"version"`
+	Secrets map[string]string `json:"secrets"` // Base64 encoded nonce and ciphertext, by name
+}
+
+// Get decrypts a secret
+func (f *EncryptedFile) Get(name string, from string) (string, error) {
+	if from != "" {
+		name = from
+	}
+	contents, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	sealed, ok := contents.Secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	key, err := f.key(false)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("%s is corrupt: %s", f.Path, err.Error())
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("%s is corrupt", f.Path)
+	}
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("Unable to decrypt %s, was it encrypted with a different key than %s?", f.Path, f.keySource())
+	}
+	return string(value), nil
+}
+
+// Set encrypts a secret, creating the key if there isn't one
+func (f *EncryptedFile) Set(name string, value string) error {
+	contents, err := f.read()
+	if err != nil {
+		return err
+	}
+	key, err := f.key(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	contents.Secrets[name] = base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), []byte(name)))
+	return f.write(contents)
+}
+
+// Remove deletes a secret
+func (f *EncryptedFile) Remove(name string) error {
+	contents, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := contents.Secrets[name]; !ok {
+		return ErrNotFound
+	}
+	delete(contents.Secrets, name)
+	return f.write(contents)
+}
+
+// List returns the names of the secrets in the file
+func (f *EncryptedFile) List() ([]string, error) {
+	contents, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range contents.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// read reads the file. A missing file has no secrets.
+func (f *EncryptedFile) read() (*encryptedFile, error) {
+	contents := &encryptedFile{Version: 1, Secrets: map[string]string{}}
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return contents, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, contents); err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %s", f.Path, err.Error())
+	}
+	if contents.Version != 1 {
+		return nil, fmt.Errorf("Unsupported version %d of %s, is Parity out of date?", contents.Version, f.Path)
+	}
+	if contents.Secrets == nil {
+		contents.Secrets = map[string]string{}
+	}
+	return contents, nil
+}
+
+func (f *EncryptedFile) write(contents *encryptedFile) error {
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Path, append(data, '\n'), 0644)
+}
+
+// key reads the key from KeyEnv or KeyFile, optionally creating KeyFile
+func (f *EncryptedFile) key(create bool) ([]byte, error) {
+	if f.KeyEnv != "" && f.Lookup != nil {
+		if encoded, ok := f.Lookup(f.KeyEnv); ok && encoded != "" {
+			return decodeKey(encoded, f.KeyEnv)
+		}
+	}
+
+	data, err := ioutil.ReadFile(f.KeyFile)
+	if err == nil {
+		return decodeKey(string(data), f.KeyFile)
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("Unable to read the key to %s from %s: %s", f.Path, f.keySource(), err.Error())
+	}
+
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.KeyFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(f.KeyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	log.Info("Created a new key for %s in %s", f.Path, f.KeyFile)
+	return key, nil
+}
+
+// keySource describes where the key is read from, for errors
+func (f *EncryptedFile) keySource() string {
+	if f.KeyEnv != "" {
+		return fmt.Sprintf("$%s or %s", f.KeyEnv, f.KeyFile)
+	}
+	return f.KeyFile
+}
+
+func decodeKey(encoded string, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != keyLength {
+		return nil, fmt.Errorf("Invalid key in %s, expected %d base64 encoded bytes", source, keyLength)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
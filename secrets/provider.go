@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func init() {
+	Register("env", func(ctx *Context) (Provider, error) {
+		lookup := ctx.Lookup
+		if lookup == nil {
+			lookup = os.LookupEnv
+		}
+		return &EnvProvider{Lookup: lookup}, nil
+	})
+	Register("command", func(ctx *Context) (Provider, error) {
+		return &CommandProvider{}, nil
+	})
+}
+
+// EnvProvider reads secrets from the host's environment, from the variable
+// named by 'from' or the secret's name
+type EnvProvider struct {
+	Lookup func(string) (string, bool)
+}
+
+// Get reads the secret's variable
+func (p *EnvProvider) Get(name string, from string) (string, error) {
+	if from != "" {
+		name = from
+	}
+	value, ok := p.Lookup(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// CommandProvider runs the shell command in 'from', e.g. a password
+// manager's CLI, and uses its output without the trailing newline. The
+// command's errors and prompts are shown to the user.
+type CommandProvider struct{}
+
+// Get runs the secret's command
+func (p *CommandProvider) Get(name string, from string) (string, error) {
+	if from == "" {
+		return "", fmt.Errorf("the command provider requires a command in 'from'")
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", from)
+	} else {
+		cmd = exec.Command("sh", "-c", from)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PARITY_SECRET="+name)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("'%s' failed: %s", from, err.Error())
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
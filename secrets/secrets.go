@@ -0,0 +1,205 @@
+// Package secrets provides the values of the secrets in parity.yml's
+// 'secrets' section, from pluggable providers: an encrypted file kept in
+// the project, a per user keychain, the host's environment or a command's
+// output. Secrets are only ever decrypted in memory.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mefellows/parity/config"
+)
+
+// DefaultProvider is used by secrets that don't specify a provider
+const DefaultProvider = "file"
+
+// Dir is where containers find secrets delivered as files
+const Dir = "/run/secrets"
+
+// Delivery methods, see config.SecretConfig
+const (
+	AsEnv  = "env"
+	AsFile = "file"
+)
+
+// ErrNotFound is returned by providers that don't have a secret
+var ErrNotFound = errors.New("secret not found")
+
+// Context is what providers need to know about the project
+type Context struct {
+	Project string                     // Safe project name, see utils.ProjectNameSafe
+	File    string                     // Encrypted file, see DefaultFile
+	Lookup  func(string) (string, bool) // The host's environment, e.g. os.LookupEnv
+}
+
+// Provider provides the values of secrets
+type Provider interface {
+	// Get returns a secret's value, or ErrNotFound. from tells the provider
+	// where to find it, e.g. an environment variable or a command, and may
+	// be empty.
+	Get(name string, from string) (string, error)
+}
+
+// Store is a Provider that secrets can be saved in, e.g. by
+// 'parity secrets set'
+type Store interface {
+	Provider
+	Set(name string, value string) error
+	Remove(name string) error
+	List() ([]string, error)
+}
+
+// ProviderFactory creates a provider for a project
+type ProviderFactory func(ctx *Context) (Provider, error)
+
+var providers = map[string]ProviderFactory{}
+
+// Register makes a provider available to the 'secrets' section by name
+func Register(name string, factory ProviderFactory) {
+	providers[name] = factory
+}
+
+// Providers lists the names of the registered providers
+func Providers() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider creates the named provider
+func NewProvider(name string, ctx *Context) (Provider, error) {
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown secrets provider '%s', expected one of %s", name, strings.Join(Providers(), ", "))
+	}
+	return factory(ctx)
+}
+
+// NewStore creates the named provider, if secrets can be saved in it
+func NewStore(name string, ctx *Context) (Store, error) {
+	p, err := NewProvider(name, ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, ok := p.(Store)
+	if !ok {
+		return nil, fmt.Errorf("Secrets can't be saved with the '%s' provider", name)
+	}
+	return store, nil
+}
+
+// Secret is a secret's value, and how containers receive it
+type Secret struct {
+	Name     string
+	Value    string
+	As       string   // AsEnv or AsFile
+	File     string   // Path in containers, for AsFile
+	Services []string // Services that receive the secret, or all if empty
+}
+
+// For reports whether a service receives the secret
+func (s Secret) For(service string) bool {
+	if len(s.Services) == 0 {
+		return true
+	}
+	for _, name := range s.Services {
+		if name == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a secret's configuration, without looking it up
+func Validate(name string, c config.SecretConfig) error {
+	if name == "" || strings.ContainsAny(name, "=/\\ ") {
+		return fmt.Errorf("Invalid secret name '%s'", name)
+	}
+	provider := c.Provider
+	if provider == "" {
+		provider = DefaultProvider
+	}
+	if _, ok := providers[provider]; !ok {
+		return fmt.Errorf("Secret '%s': unknown provider '%s', expected one of %s", name, provider, strings.Join(Providers(), ", "))
+	}
+	switch c.As {
+	case "", AsEnv:
+		if c.File != "" {
+			return fmt.Errorf("Secret '%s': 'file' requires 'as: file'", name)
+		}
+	case AsFile:
+		if strings.ContainsAny(c.File, "/\\") || c.File == "." || c.File == ".." {
+			return fmt.Errorf("Secret '%s': 'file' must be a file name in %s, got '%s'", name, Dir, c.File)
+		}
+	default:
+		return fmt.Errorf("Secret '%s': 'as' must be '%s' or '%s', got '%s'", name, AsEnv, AsFile, c.As)
+	}
+	return nil
+}
+
+// Resolve looks up the value of each secret in the 'secrets' section, in
+// name order
+func Resolve(configs map[string]config.SecretConfig, ctx *Context) ([]Secret, error) {
+	var names []string
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	created := map[string]Provider{}
+	var resolved []Secret
+	for _, name := range names {
+		c := configs[name]
+		if err := Validate(name, c); err != nil {
+			return nil, err
+		}
+		provider := c.Provider
+		if provider == "" {
+			provider = DefaultProvider
+		}
+		p, ok := created[provider]
+		if !ok {
+			var err error
+			if p, err = NewProvider(provider, ctx); err != nil {
+				return nil, err
+			}
+			created[provider] = p
+		}
+
+		value, err := p.Get(name, c.From)
+		if err == ErrNotFound {
+			return nil, fmt.Errorf("Secret '%s' not found by the '%s' provider", name, provider)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Secret '%s': %s", name, err.Error())
+		}
+
+		s := Secret{Name: name, Value: value, As: AsEnv, Services: c.Services}
+		if c.As == AsFile {
+			s.As = AsFile
+			s.File = c.File
+			if s.File == "" {
+				s.File = strings.ToLower(name)
+			}
+			s.File = path.Join(Dir, s.File)
+		}
+		resolved = append(resolved, s)
+	}
+	return resolved, nil
+}
+
+// Values returns the secrets' values, e.g. to mask in logs
+func Values(secrets []Secret) []string {
+	values := make([]string, len(secrets))
+	for i, s := range secrets {
+		values[i] = s.Value
+	}
+	return values
+}
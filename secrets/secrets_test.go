@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mefellows/parity/config"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "parity-secrets")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	return dir
+}
+
+func TestEncryptedFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	f := &EncryptedFile{Path: filepath.Join(dir, "project", "secrets.json"), KeyFile: filepath.Join(dir, "home", "project.key")}
+	if _, err := f.Get("DB_PASSWORD", ""); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if err := f.Set("DB_PASSWORD", "hunter22"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	f.Set("API_TOKEN", "abc123")
+
+	if info, err := os.Stat(f.KeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private key file to be created, got %v", err)
+	}
+	data, _ := ioutil.ReadFile(f.Path)
+	if strings.Contains(string(data), "hunter22") || !strings.Contains(string(data), "DB_PASSWORD") {
+		t.Fatalf("Expected only the names in plain text, got %s", data)
+	}
+
+	if value, err := f.Get("DB_PASSWORD", ""); err != nil || value != "hunter22" {
+		t.Fatalf("Expected the secret to be decrypted, got '%s' (%v)", value, err)
+	}
+	if value, _ := f.Get("ignored", "API_TOKEN"); value != "abc123" {
+		t.Fatalf("Expected the secret named by from, got '%s'", value)
+	}
+	if names, _ := f.List(); !reflect.DeepEqual(names, []string{"API_TOKEN", "DB_PASSWORD"}) {
+		t.Fatalf("Expected both secrets, got %v", names)
+	}
+	if err := f.Remove("API_TOKEN"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if err := f.Remove("API_TOKEN"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEncryptedFile_Key(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key := base64.StdEncoding.EncodeToString(make([]byte, keyLength))
+	lookup := func(name string) (string, bool) { return key, name == KeyEnv }
+	f := &EncryptedFile{Path: filepath.Join(dir, "secrets.json"), KeyFile: filepath.Join(dir, "missing.key"), KeyEnv: KeyEnv, Lookup: lookup}
+	if err := f.Set("DB_PASSWORD", "hunter22"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, err := os.Stat(f.KeyFile); err == nil {
+		t.Fatalf("Expected the key from the environment to be used")
+	}
+
+	// A different key can't decrypt the file, and no key is created to try
+	other := &EncryptedFile{Path: f.Path, KeyFile: filepath.Join(dir, "other.key")}
+	if _, err := other.Get("DB_PASSWORD", ""); err == nil || !strings.Contains(err.Error(), "other.key") {
+		t.Fatalf("Expected an error reading the missing key, got %v", err)
+	}
+	other.Set("OTHER", "value")
+	if _, err := other.Get("DB_PASSWORD", ""); err == nil || !strings.Contains(err.Error(), "different key") {
+		t.Fatalf("Expected an error decrypting with the wrong key, got %v", err)
+	}
+
+	// Secrets can't be swapped between names
+	contents, _ := f.read()
+	contents.Secrets["API_TOKEN"] = contents.Secrets["DB_PASSWORD"]
+	f.write(contents)
+	if _, err := f.Get("API_TOKEN", ""); err == nil {
+		t.Fatalf("Expected an error decrypting a secret stored under another name")
+	}
+
+	ioutil.WriteFile(f.KeyFile, []byte("short"), 0600)
+	f.KeyEnv = ""
+	if _, err := f.Get("DB_PASSWORD", ""); err == nil || !strings.Contains(err.Error(), "Invalid key") {
+		t.Fatalf("Expected an invalid key error, got %v", err)
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	p := &EnvProvider{Lookup: func(name string) (string, bool) { return "from-env", name == "GH_TOKEN" }}
+	if value, err := p.Get("GITHUB_TOKEN", "GH_TOKEN"); err != nil || value != "from-env" {
+		t.Fatalf("Expected the variable named by from, got '%s' (%v)", value, err)
+	}
+	if _, err := p.Get("GITHUB_TOKEN", ""); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCommandProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Requires sh")
+	}
+	p := &CommandProvider{}
+	if value, err := p.Get("DB_PASSWORD", `printf '%s\n' "$PARITY_SECRET-value"`); err != nil || value != "DB_PASSWORD-value" {
+		t.Fatalf("Expected the command's output, got '%s' (%v)", value, err)
+	}
+	if _, err := p.Get("DB_PASSWORD", "exit 3"); err == nil {
+		t.Fatalf("Expected an error for a failing command")
+	}
+	if _, err := p.Get("DB_PASSWORD", ""); err == nil {
+		t.Fatalf("Expected an error without a command")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	Register("test", func(ctx *Context) (Provider, error) {
+		return &EnvProvider{Lookup: func(name string) (string, bool) { return "value-of-" + name, name != "MISSING" }}, nil
+	})
+	defer delete(providers, "test")
+
+	resolved, err := Resolve(map[string]config.SecretConfig{
+		"DB_PASSWORD": {Provider: "test"},
+		"TLS_KEY":     {Provider: "test", From: "KEY_PEM", As: AsFile, Services: []string{"web"}},
+		"API_TOKEN":   {Provider: "test", As: AsFile, File: "token"},
+	}, &Context{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []Secret{
+		{Name: "API_TOKEN", Value: "value-of-API_TOKEN", As: AsFile, File: "/run/secrets/token"},
+		{Name: "DB_PASSWORD", Value: "value-of-DB_PASSWORD", As: AsEnv},
+		{Name: "TLS_KEY", Value: "value-of-KEY_PEM", As: AsFile, File: "/run/secrets/tls_key", Services: []string{"web"}},
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, resolved)
+	}
+	if !resolved[2].For("web") || resolved[2].For("worker") || !resolved[1].For("worker") {
+		t.Fatalf("Expected TLS_KEY only for web, and DB_PASSWORD for all services")
+	}
+
+	if _, err := Resolve(map[string]config.SecretConfig{"MISSING": {Provider: "test"}}, &Context{}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, c := range map[string]config.SecretConfig{
+		"DB_PASSWORD": {},
+		"API_TOKEN":   {Provider: "env", As: AsFile, File: "token"},
+	} {
+		if err := Validate(name, c); err != nil {
+			t.Fatalf("Expected %s to be valid, got %s", name, err.Error())
+		}
+	}
+	for name, c := range map[string]config.SecretConfig{
+		"BAD=NAME":  {},
+		"UNKNOWN":   {Provider: "vault"},
+		"BAD_AS":    {As: "volume"},
+		"FILE_ONLY": {File: "token"},
+		"PATH":      {As: AsFile, File: "../etc/passwd"},
+	} {
+		if err := Validate(name, c); err == nil {
+			t.Fatalf("Expected %s to be invalid", name)
+		}
+	}
+}
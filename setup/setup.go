@@ -46,14 +46,14 @@ func tempFile(reader io.Reader, templateData interface{}) (*os.File, error) {
 	i, err := reader.Read(buffer)
 	tmpl, err := template.New("").Parse(string(buffer[:i]))
 	if err != nil {
-		return nil, fmt.Errorf("Template parsing failed:", err.Error())
+		return nil, fmt.Errorf("Template parsing failed: %s", err.Error())
 	}
 	file, _ := ioutil.TempFile("/tmp", "parity")
 	file.Chmod(0655)
 
 	err = tmpl.Execute(file, templateData)
 	if err != nil {
-		return nil, fmt.Errorf("Template failed:", err.Error())
+		return nil, fmt.Errorf("Template failed: %s", err.Error())
 	}
 
 	return file, nil
@@ -185,7 +185,7 @@ func SetupParityProject(config *Config) error {
 
 	select {
 	case e := <-errors:
-		log.Error(e.Error())
+		log.Error("%s", e.Error())
 		return e
 	case <-done:
 		log.Debug("Finished installing template")
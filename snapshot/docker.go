@@ -0,0 +1,200 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/utils"
+)
+
+// volumesDir is where the helper container mounts volumes
+const volumesDir = "/volumes"
+
+// Select returns the named volumes of the given services, or of all
+// services if none are given, merging volumes shared by several services
+func Select(named []utils.NamedVolume, services []string) ([]Volume, error) {
+	selected := map[string]bool{}
+	for _, service := range services {
+		selected[service] = true
+	}
+
+	var volumes []Volume
+	index := map[string]int{}
+	for _, nv := range named {
+		if len(services) > 0 && !selected[nv.Service] {
+			continue
+		}
+		delete(selected, nv.Service)
+		if i, ok := index[nv.Name]; ok {
+			volumes[i].Services = append(volumes[i].Services, nv.Service)
+			continue
+		}
+		index[nv.Name] = len(volumes)
+		volumes = append(volumes, Volume{Name: nv.Name, Services: []string{nv.Service}})
+	}
+
+	// Services that were asked for, but have no named volumes
+	for _, service := range services {
+		if selected[service] {
+			return nil, fmt.Errorf("Service '%s' has no named volumes", service)
+		}
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("There are no named volumes to save")
+	}
+	return volumes, nil
+}
+
+// Save archives the volumes into a new snapshot, through a helper
+// container. The project's running containers that use the volumes are
+// paused meanwhile, so that their files are consistent.
+func Save(client *dockerclient.Client, store *Store, name string, project string, volumes []Volume, overwrite bool) (*Snapshot, error) {
+	w, err := store.Create(name, project, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	var binds []string
+	for _, v := range volumes {
+		binds = append(binds, fmt.Sprintf("%s:%s:ro", v.Name, path.Join(volumesDir, v.Name)))
+	}
+	unpause, err := pause(client, project, volumes)
+	defer unpause()
+	if err != nil {
+		w.Discard()
+		return nil, err
+	}
+
+	helper, err := utils.StartHelper(client, fmt.Sprintf("parity-%s-snapshot", project), binds)
+	if err != nil {
+		w.Discard()
+		return nil, err
+	}
+	defer helper.Remove()
+
+	for _, v := range volumes {
+		log.Step("Saving volume %s", v.Name)
+		if info, err := client.InspectVolume(v.Name); err == nil {
+			v.Driver = info.Driver
+		}
+		err := w.Add(v, func(out io.Writer) error {
+			return helper.Download(path.Join(volumesDir, v.Name), out)
+		})
+		if err != nil {
+			w.Discard()
+			return nil, err
+		}
+	}
+	return w.Commit()
+}
+
+// pause pauses the project's running containers of the services using the
+// volumes, returning a function that unpauses them
+func pause(client *dockerclient.Client, project string, volumes []Volume) (func(), error) {
+	services := map[string]bool{}
+	for _, v := range volumes {
+		for _, service := range v.Services {
+			services[service] = true
+		}
+	}
+
+	var paused []string
+	unpause := func() {
+		for _, id := range paused {
+			client.UnpauseContainer(id)
+		}
+	}
+	running, err := utils.RunningComposeServices(client)
+	if err != nil {
+		return unpause, err
+	}
+	for _, s := range running {
+		if s.Project != project || !services[s.Service] {
+			continue
+		}
+		log.Debug("Pausing service '%s' while its volumes are saved", s.Service)
+		if err := client.PauseContainer(s.Container.ID); err != nil {
+			return unpause, fmt.Errorf("Unable to pause service '%s': %s", s.Service, err.Error())
+		}
+		paused = append(paused, s.Container.ID)
+	}
+	return unpause, nil
+}
+
+// Restore replaces the snapshot's volumes with their saved contents. The
+// volumes must not be in use. Nothing is replaced unless every archive can
+// be read and none of the volumes are in use.
+func Restore(client *dockerclient.Client, store *Store, name string) (*Snapshot, error) {
+	snapshot, err := store.Get(name)
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("Snapshot '%s' not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Verify(snapshot); err != nil {
+		return nil, err
+	}
+	for _, v := range snapshot.Volumes {
+		containers, err := client.ListContainers(dockerclient.ListContainersOptions{
+			All:     true,
+			Filters: map[string][]string{"volume": []string{v.Name}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to check whether volume %s is in use: %s", v.Name, err.Error())
+		}
+		if len(containers) > 0 {
+			return nil, fmt.Errorf("Volume %s is in use, remove the containers of %s first (e.g. with 'docker-compose down')", v.Name, serviceList(v.Services))
+		}
+	}
+
+	var binds []string
+	for _, v := range snapshot.Volumes {
+		switch err := client.RemoveVolume(v.Name); err {
+		case nil, dockerclient.ErrNoSuchVolume:
+		case dockerclient.ErrVolumeInUse:
+			return nil, fmt.Errorf("Volume %s is in use, remove the containers of %s first (e.g. with 'docker-compose down')", v.Name, serviceList(v.Services))
+		default:
+			return nil, fmt.Errorf("Unable to remove volume %s: %s", v.Name, err.Error())
+		}
+		if _, err := client.CreateVolume(dockerclient.CreateVolumeOptions{Name: v.Name, Driver: v.Driver}); err != nil {
+			return nil, fmt.Errorf("Unable to create volume %s: %s", v.Name, err.Error())
+		}
+		binds = append(binds, fmt.Sprintf("%s:%s", v.Name, path.Join(volumesDir, v.Name)))
+	}
+
+	helper, err := utils.StartHelper(client, fmt.Sprintf("parity-%s-snapshot", snapshot.Project), binds)
+	if err != nil {
+		return nil, err
+	}
+	defer helper.Remove()
+
+	for _, v := range snapshot.Volumes {
+		log.Step("Restoring volume %s", v.Name)
+		archive, err := store.Open(snapshot, v)
+		if err != nil {
+			return nil, err
+		}
+		err = helper.Upload(volumesDir, archive)
+		archive.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to restore volume %s: %s", v.Name, err.Error())
+		}
+	}
+	return snapshot, nil
+}
+
+// serviceList quotes and joins service names, for messages
+func serviceList(services []string) string {
+	quoted := make([]string, len(services))
+	for i, s := range services {
+		quoted[i] = "'" + s + "'"
+	}
+	sort.Strings(quoted)
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,197 @@
+package snapshot
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mefellows/parity/utils"
+)
+
+func tempStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "parity-snapshot")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	return &Store{Dir: dir}
+}
+
+func save(t *testing.T, store *Store, name string, contents map[string]string) *Snapshot {
+	w, err := store.Create(name, "myproject", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for volume, data := range contents {
+		err := w.Add(Volume{Name: volume, Services: []string{"db"}}, func(out io.Writer) error {
+			_, err := io.WriteString(out, data)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+	}
+	snapshot, err := w.Commit()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return snapshot
+}
+
+func TestStore(t *testing.T) {
+	store := tempStore(t)
+	defer os.RemoveAll(store.Dir)
+
+	if snapshots, err := store.List(); err != nil || len(snapshots) != 0 {
+		t.Fatalf("Expected no snapshots, got %v (%v)", snapshots, err)
+	}
+	save(t, store, "seed", map[string]string{"pgdata": "database files"})
+	time.Sleep(10 * time.Millisecond)
+	save(t, store, "after-migration", map[string]string{"pgdata": "migrated files"})
+
+	snapshots, err := store.List()
+	if err != nil || len(snapshots) != 2 || snapshots[0].Name != "seed" || snapshots[1].Name != "after-migration" {
+		t.Fatalf("Expected both snapshots, oldest first, got %v (%v)", snapshots, err)
+	}
+	snapshot, err := store.Get("seed")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if snapshot.Project != "myproject" || len(snapshot.Volumes) != 1 || snapshot.Volumes[0].File != "pgdata.tar.gz" || snapshot.Size() == 0 {
+		t.Fatalf("Expected the snapshot's metadata, got %+v", snapshot)
+	}
+
+	r, err := store.Open(snapshot, snapshot.Volumes[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "database files" {
+		t.Fatalf("Expected the volume's archive, got '%s'", data)
+	}
+
+	if _, err := store.Create("seed", "myproject", false); err == nil {
+		t.Fatalf("Expected an error creating an existing snapshot")
+	}
+	if err := store.Remove("seed"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, err := store.Get("seed"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.Remove("seed"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_Overwrite(t *testing.T) {
+	store := tempStore(t)
+	defer os.RemoveAll(store.Dir)
+
+	save(t, store, "seed", map[string]string{"pgdata": "old", "uploads": "old"})
+	w, err := store.Create("seed", "myproject", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	// Until committed, the existing snapshot is kept
+	w.Add(Volume{Name: "pgdata"}, func(out io.Writer) error { return nil })
+	if snapshot, _ := store.Get("seed"); len(snapshot.Volumes) != 2 {
+		t.Fatalf("Expected the existing snapshot, got %+v", snapshot)
+	}
+	if snapshots, _ := store.List(); len(snapshots) != 1 {
+		t.Fatalf("Expected the incomplete snapshot not to be listed, got %v", snapshots)
+	}
+	w.Commit()
+	if snapshot, _ := store.Get("seed"); len(snapshot.Volumes) != 1 {
+		t.Fatalf("Expected the snapshot to be replaced, got %+v", snapshot)
+	}
+
+	// A failed volume discards nothing but the new snapshot
+	w, _ = store.Create("seed", "myproject", true)
+	if err := w.Add(Volume{Name: "pgdata"}, func(out io.Writer) error { return io.ErrUnexpectedEOF }); err == nil {
+		t.Fatalf("Expected the archive's error")
+	}
+	w.Discard()
+	if entries, _ := ioutil.ReadDir(store.Dir); len(entries) != 1 {
+		t.Fatalf("Expected only the existing snapshot, got %d entries", len(entries))
+	}
+}
+
+func TestStore_Verify(t *testing.T) {
+	store := tempStore(t)
+	defer os.RemoveAll(store.Dir)
+	snapshot := save(t, store, "seed", map[string]string{"pgdata": "database files", "uploads": "images"})
+	if err := store.Verify(snapshot); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	// Truncated and missing archives are found before anything is restored
+	file := filepath.Join(store.Dir, "seed", "uploads.tar.gz")
+	data, _ := ioutil.ReadFile(file)
+	ioutil.WriteFile(file, data[:len(data)-4], 0644)
+	if err := store.Verify(snapshot); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Fatalf("Expected a corrupt archive to be found, got '%v'", err)
+	}
+	os.Remove(file)
+	if err := store.Verify(snapshot); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("Expected a missing archive to be found, got '%v'", err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"seed", "v1.2", "after_migration-2"} {
+		if err := ValidateName(name); err != nil {
+			t.Fatalf("Expected '%s' to be valid, got %s", name, err.Error())
+		}
+	}
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", "with space"} {
+		if err := ValidateName(name); err == nil {
+			t.Fatalf("Expected '%s' to be invalid", name)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	named := []utils.NamedVolume{
+		{Name: "pgdata", Service: "db"},
+		{Name: "uploads", Service: "web"},
+		{Name: "uploads", Service: "worker"},
+	}
+	volumes, err := Select(named, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []Volume{
+		{Name: "pgdata", Services: []string{"db"}},
+		{Name: "uploads", Services: []string{"web", "worker"}},
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, volumes)
+	}
+
+	if volumes, _ := Select(named, []string{"db"}); len(volumes) != 1 || volumes[0].Name != "pgdata" {
+		t.Fatalf("Expected only the db's volume, got %+v", volumes)
+	}
+	if _, err := Select(named, []string{"db", "cache"}); err == nil || !strings.Contains(err.Error(), "'cache'") {
+		t.Fatalf("Expected an error for a service without volumes, got %v", err)
+	}
+	if _, err := Select(nil, nil); err == nil {
+		t.Fatalf("Expected an error without volumes")
+	}
+}
+
+func TestSnapshot_Services(t *testing.T) {
+	s := &Snapshot{Volumes: []Volume{{Services: []string{"worker", "web"}}, {Services: []string{"db", "web"}}}}
+	if services := s.Services(); !reflect.DeepEqual(services, []string{"db", "web", "worker"}) {
+		t.Fatalf("Expected each service once, got %v", services)
+	}
+	if serviceList([]string{"worker", "db"}) != "'db', 'worker'" {
+		t.Fatalf("Expected a sorted, quoted list, got %s", serviceList([]string{"worker", "db"}))
+	}
+}
@@ -0,0 +1,270 @@
+// Package snapshot saves the named volumes of a project's Compose services,
+// e.g. a database's data, so that they can be restored to a known state.
+// Snapshots are stored locally, as a gzipped tar stream of each volume and
+// metadata describing them.
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/mefellows/mirror/mirror"
+)
+
+// metadataFile is the name of a snapshot's metadata, in its directory
+const metadataFile = "snapshot.json"
+
+// ErrNotFound is returned for snapshots that don't exist
+var ErrNotFound = errors.New("snapshot not found")
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Snapshot describes a saved snapshot
+type Snapshot struct {
+	Name    string    `json:"name"`
+	Project string    `json:"project"`
+	Created time.Time `json:"created"`
+	Volumes []Volume  `json:"volumes"`
+}
+
+// Volume is a volume saved in a snapshot
+type Volume struct {
+	Name     string   `json:"name"`
+	Driver   string   `json:"driver,omitempty"`
+	Services []string `json:"services"` // Services that mount the volume
+	File     string   `json:"file"`     // Archive, in the snapshot's directory
+	Size     int64    `json:"size"`     // Of the archive
+}
+
+// Services lists the services whose volumes were saved
+func (s *Snapshot) Services() []string {
+	seen := map[string]bool{}
+	var services []string
+	for _, v := range s.Volumes {
+		for _, service := range v.Services {
+			if !seen[service] {
+				seen[service] = true
+				services = append(services, service)
+			}
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// Size is the total size of the snapshot's archives
+func (s *Snapshot) Size() int64 {
+	var size int64
+	for _, v := range s.Volumes {
+		size += v.Size
+	}
+	return size
+}
+
+// Store keeps a project's snapshots in a directory
+type Store struct {
+	Dir string
+}
+
+// NewStore creates the store for a project's snapshots, in
+// ~/.parity/snapshots
+func NewStore(project string) *Store {
+	return &Store{Dir: filepath.Join(mirror.GetHomeDir(), ".parity", "snapshots", project)}
+}
+
+// ValidateName checks a snapshot's name can be used as a directory name
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("Invalid snapshot name '%s', use letters, numbers, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// Get reads a snapshot's metadata
+func (s *Store) Get(name string) (*Snapshot, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, name, metadataFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("Unable to read snapshot '%s': %s", name, err.Error())
+	}
+	return snapshot, nil
+}
+
+// List returns the project's snapshots, oldest first. Incomplete snapshots,
+// e.g. interrupted while being saved, are skipped.
+func (s *Store) List() ([]*Snapshot, error) {
+	entries, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	for _, e := range entries {
+		if !e.IsDir() || !validName.MatchString(e.Name()) {
+			continue
+		}
+		snapshot, err := s.Get(e.Name())
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created.Before(snapshots[j].Created) })
+	return snapshots, nil
+}
+
+// Remove deletes a snapshot
+func (s *Store) Remove(name string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.Dir, name))
+}
+
+// Open reads a volume's archive, uncompressed
+func (s *Store) Open(snapshot *Snapshot, v Volume) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.Dir, snapshot.Name, v.File))
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Unable to read the archive of volume %s: %s", v.Name, err.Error())
+	}
+	return &archiveReader{Reader: r, file: f}, nil
+}
+
+// Verify reads each of the snapshot's archives through, so that missing or
+// corrupt archives are found before any volume is replaced
+func (s *Store) Verify(snapshot *Snapshot) error {
+	for _, v := range snapshot.Volumes {
+		r, err := s.Open(snapshot, v)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("The archive of volume %s is missing from snapshot '%s'", v.Name, snapshot.Name)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(ioutil.Discard, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("The archive of volume %s in snapshot '%s' is corrupt: %s", v.Name, snapshot.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+type archiveReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *archiveReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// Writer saves a new snapshot, which only appears in the store once
+// committed
+type Writer struct {
+	store    *Store
+	dir      string
+	snapshot *Snapshot
+}
+
+// Create starts saving a snapshot. Unless overwrite is set, the name must
+// not be in use.
+func (s *Store) Create(name string, project string, overwrite bool) (*Writer, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if _, err := s.Get(name); err == nil && !overwrite {
+		return nil, fmt.Errorf("Snapshot '%s' already exists", name)
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(s.Dir, "."+name+"-")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		store:    s,
+		dir:      dir,
+		snapshot: &Snapshot{Name: name, Project: project, Created: time.Now().UTC()},
+	}, nil
+}
+
+// Add saves a volume's archive, as written by write
+func (w *Writer) Add(v Volume, write func(io.Writer) error) error {
+	v.File = v.Name + ".tar.gz"
+	f, err := os.OpenFile(filepath.Join(w.dir, v.File), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	if err := write(gz); err != nil {
+		return fmt.Errorf("Unable to archive volume %s: %s", v.Name, err.Error())
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	v.Size = info.Size()
+	w.snapshot.Volumes = append(w.snapshot.Volumes, v)
+	return nil
+}
+
+// Commit writes the snapshot's metadata and adds it to the store,
+// replacing any snapshot of the same name
+func (w *Writer) Commit() (*Snapshot, error) {
+	data, err := json.MarshalIndent(w.snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(w.dir, metadataFile), append(data, '\n'), 0600); err != nil {
+		return nil, err
+	}
+	dest := filepath.Join(w.store.Dir, w.snapshot.Name)
+	if err := os.RemoveAll(dest); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(w.dir, dest); err != nil {
+		return nil, err
+	}
+	return w.snapshot, nil
+}
+
+// Discard abandons the snapshot
+func (w *Writer) Discard() error {
+	return os.RemoveAll(w.dir)
+}
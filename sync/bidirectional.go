@@ -0,0 +1,414 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/mefellows/mirror/filesystem"
+	"github.com/mefellows/parity/log"
+)
+
+// ConflictPolicy decides which side wins when a file has been
+// modified both on the host and in the Docker VM
+type ConflictPolicy string
+
+const (
+	// HostWins always keeps the host copy of a conflicting file
+	HostWins ConflictPolicy = "host-wins"
+
+	// LastWriterWins keeps the most recently modified copy of a conflicting file
+	LastWriterWins ConflictPolicy = "last-writer-wins"
+)
+
+// BidirectionalPath opts a path into two-way synchronisation, so that
+// files generated inside containers (migrations, lock files etc.) are
+// copied back to the host.
+type BidirectionalPath struct {
+	Path    string         `mapstructure:"path"`
+	Policy  ConflictPolicy `mapstructure:"policy"`
+	Exclude []string       `mapstructure:"exclude"`
+}
+
+// Conflict records a file that changed on both sides of a two-way sync
+type Conflict struct {
+	Path       string
+	Policy     ConflictPolicy
+	Winner     string
+	LocalHash  string
+	RemoteHash string
+	Time       time.Time
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s conflict path=%s policy=%s winner=%s local=%s remote=%s",
+		c.Time.Format(time.RFC3339), c.Path, c.Policy, c.Winner, c.LocalHash, c.RemoteHash)
+}
+
+// conflictLog appends detected conflicts to a file on the host
+type conflictLog struct {
+	gosync.Mutex
+	path string
+}
+
+func (l *conflictLog) Record(c Conflict) error {
+	log.Warn("Sync conflict on '%s', %s copy kept (%s)", c.Path, c.Winner, c.Policy)
+	if l == nil || l.path == "" {
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	os.MkdirAll(filepath.Dir(l.path), 0755)
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, c.String())
+	return err
+}
+
+// baseline records the hash of the copy of each file that both sides of a
+// two-way sync last agreed on, keyed by its path on the Docker host. It is
+// kept up to date by the transport as files are sent, starting with the
+// initial sync, so that the reconciler can tell which side changed without
+// reading every file. Only files under roots are recorded.
+type baseline struct {
+	gosync.Mutex
+	roots  []string
+	hashes map[string]string
+}
+
+func newBaseline(roots ...string) *baseline {
+	return &baseline{roots: roots, hashes: make(map[string]string)}
+}
+
+// Get returns the agreed hash of the file at path, if it's known
+func (b *baseline) Get(path string) (string, bool) {
+	if b == nil {
+		return "", false
+	}
+	b.Lock()
+	defer b.Unlock()
+	sum, ok := b.hashes[path]
+	return sum, ok
+}
+
+// Set records the agreed hash of the file at path
+func (b *baseline) Set(path string, sum string) {
+	if !b.tracks(path) {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.hashes[path] = sum
+}
+
+// Delete forgets the file at path, or everything in the directory at path
+func (b *baseline) Delete(path string) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	for p := range b.hashes {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(b.hashes, p)
+		}
+	}
+}
+
+func (b *baseline) tracks(path string) bool {
+	if b == nil {
+		return false
+	}
+	for _, root := range b.roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// reconciler watches the remote side of a two-way synced path and
+// copies changes back to the host.
+//
+// The mirror daemon cannot push change notifications, so the remote
+// side is polled and compared against the last seen snapshot. Changes on
+// the host are left to the regular (one-way) mirror watch. The first poll
+// only records the snapshot, as the initial sync has just brought both
+// sides into agreement.
+type reconciler struct {
+	local      filesystem.FileSystem
+	remote     filesystem.FileSystem
+	localRoot  string
+	remoteRoot string
+	policy     ConflictPolicy
+	filter     *Filter
+	conflicts  *conflictLog
+
+	localState  filesystem.FileMap
+	remoteState filesystem.FileMap
+	baseline    *baseline
+}
+
+func newReconciler(local, remote filesystem.FileSystem, localRoot, remoteRoot string, policy ConflictPolicy, filter *Filter, conflicts *conflictLog, base *baseline) *reconciler {
+	if policy == "" {
+		policy = HostWins
+	}
+	if base == nil {
+		base = newBaseline(remoteRoot)
+	}
+	return &reconciler{
+		local:      local,
+		remote:     remote,
+		localRoot:  localRoot,
+		remoteRoot: remoteRoot,
+		policy:     policy,
+		filter:     filter,
+		conflicts:  conflicts,
+		baseline:   base,
+	}
+}
+
+// Watch polls the remote side every interval until done is closed
+func (r *reconciler) Watch(interval time.Duration, done <-chan struct{}) {
+	for {
+		if err := r.Reconcile(); err != nil {
+			log.Error("Error synchronising '%s' from Docker host: %s", r.remoteRoot, err.Error())
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Reconcile performs a single pass of remote -> host synchronisation
+func (r *reconciler) Reconcile() error {
+	localMap, err := fileMap(r.local, r.localRoot)
+	if err != nil {
+		return err
+	}
+	remoteMap, err := fileMap(r.remote, r.remoteRoot)
+	if err != nil {
+		return err
+	}
+
+	for path, remoteFile := range remoteMap {
+		if path == "" || r.filter.Ignore(path, remoteFile.IsDir()) {
+			continue
+		}
+		if prev, ok := r.remoteState[path]; ok && !fileChanged(prev, remoteFile) {
+			continue
+		}
+
+		localFile, existsLocally := localMap[path]
+		if !existsLocally {
+			// Removed on the host: the forward sync will remove the remote copy
+			if _, known := r.localState[path]; known {
+				continue
+			}
+			if err := r.pull(path, remoteFile); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The initial sync has just brought both sides into agreement
+		if remoteFile.IsDir() || localFile.IsDir() || r.remoteState == nil {
+			continue
+		}
+
+		if err := r.compare(path, localFile, remoteFile); err != nil {
+			return err
+		}
+	}
+
+	// Remove host copies of files deleted in the VM, provided the host
+	// copy hasn't changed since both sides last agreed
+	for path := range r.remoteState {
+		if _, ok := remoteMap[path]; ok || r.filter.Ignore(path, r.remoteState[path].IsDir()) {
+			continue
+		}
+		localFile, ok := localMap[path]
+		if !ok {
+			continue
+		}
+		if !localFile.IsDir() {
+			if !r.inSync(path, localFile) {
+				continue
+			}
+		} else if !r.unchanged(path, localMap) {
+			// Deleting the directory would lose files only on the host
+			conflict := Conflict{Path: path, Policy: r.policy, Winner: "host", Time: time.Now()}
+			if err := r.conflicts.Record(conflict); err != nil {
+				log.Error("Unable to record sync conflict: %s", err.Error())
+			}
+			continue
+		}
+		log.Debug("Removing '%s' from host, deleted on Docker host", localFile.Path())
+		if err := r.local.Delete(localFile.Path()); err != nil {
+			return err
+		}
+		r.baseline.Delete(r.remotePath(path))
+		for p := range localMap {
+			if p == path || strings.HasPrefix(p, path+"/") {
+				delete(localMap, p)
+			}
+		}
+	}
+
+	r.localState = localMap
+	r.remoteState = remoteMap
+	return nil
+}
+
+// unchanged reports whether every file in a host directory still matches
+// the copy last synced with the Docker host, so that it can be deleted
+func (r *reconciler) unchanged(dir string, localMap filesystem.FileMap) bool {
+	for path, f := range localMap {
+		if !strings.HasPrefix(path, dir+"/") || f.IsDir() {
+			continue
+		}
+		if !r.inSync(path, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// inSync reports whether the host copy of a file is the one both sides
+// last agreed on. Files the initial sync didn't need to send have no
+// recorded hash, and are in sync if they haven't changed since the last
+// poll.
+func (r *reconciler) inSync(path string, localFile filesystem.File) bool {
+	if sum, ok := r.baseline.Get(r.remotePath(path)); ok {
+		data, err := r.local.Read(localFile)
+		return err == nil && hash(data) == sum
+	}
+	prev, ok := r.localState[path]
+	return ok && !fileChanged(prev, localFile)
+}
+
+// compare checks a file that exists on both sides, and changed remotely
+func (r *reconciler) compare(path string, localFile, remoteFile filesystem.File) error {
+	// Look up the agreed hash before reading the remote copy: if a send of
+	// the host copy finished in between, the older remote copy would
+	// otherwise look like a change made in the VM
+	base, known := r.baseline.Get(r.remotePath(path))
+
+	remoteData, err := r.remote.Read(remoteFile)
+	if err != nil {
+		return err
+	}
+	localData, err := r.local.Read(localFile)
+	if err != nil {
+		return err
+	}
+
+	remoteHash := hash(remoteData)
+	localHash := hash(localData)
+	if remoteHash == localHash {
+		r.baseline.Set(r.remotePath(path), localHash)
+		return nil
+	}
+
+	// Only the host copy moved on, the forward sync will send it
+	if known && base == remoteHash {
+		return nil
+	}
+
+	// Only the remote copy moved on since we last agreed. Without a
+	// recorded hash, the host copy is unchanged if it's the same as at the
+	// last poll.
+	prev, seen := r.localState[path]
+	if (known && base == localHash) || (!known && seen && !fileChanged(prev, localFile)) {
+		return r.write(r.local, r.localPath(path), remoteData, remoteFile.Mode(), path, remoteHash)
+	}
+
+	conflict := Conflict{
+		Path:       path,
+		Policy:     r.policy,
+		Winner:     "host",
+		LocalHash:  localHash,
+		RemoteHash: remoteHash,
+		Time:       time.Now(),
+	}
+	if r.policy == LastWriterWins && remoteFile.ModTime().After(localFile.ModTime()) {
+		conflict.Winner = "remote"
+	}
+	if err := r.conflicts.Record(conflict); err != nil {
+		log.Error("Unable to record sync conflict: %s", err.Error())
+	}
+
+	if conflict.Winner == "remote" {
+		return r.write(r.local, r.localPath(path), remoteData, remoteFile.Mode(), path, remoteHash)
+	}
+	return r.write(r.remote, r.remotePath(path), localData, localFile.Mode(), path, localHash)
+}
+
+// pull copies a file that only exists remotely back to the host
+func (r *reconciler) pull(path string, remoteFile filesystem.File) error {
+	if remoteFile.IsDir() {
+		log.Debug("Creating directory '%s' on host", r.localPath(path))
+		return r.local.MkDir(filesystem.File{FilePath: r.localPath(path), FileMode: remoteFile.Mode()})
+	}
+	data, err := r.remote.Read(remoteFile)
+	if err != nil {
+		return err
+	}
+	return r.write(r.local, r.localPath(path), data, remoteFile.Mode(), path, hash(data))
+}
+
+func (r *reconciler) write(fs filesystem.FileSystem, dest string, data []byte, perm os.FileMode, path string, sum string) error {
+	log.Debug("Copying '%s' -> '%s'", path, dest)
+	file := filesystem.File{
+		FileName: filepath.Base(dest),
+		FilePath: dest,
+		FileMode: perm,
+		FileSize: int64(len(data)),
+	}
+	if err := fs.Write(file, data, perm); err != nil {
+		return err
+	}
+	r.baseline.Set(r.remotePath(path), sum)
+	return nil
+}
+
+func (r *reconciler) localPath(path string) string {
+	return r.localRoot + path
+}
+
+func (r *reconciler) remotePath(path string) string {
+	return r.remoteRoot + path
+}
+
+// fileMap returns the flattened file hierarchy of root, keyed by the
+// path relative to root
+func fileMap(fs filesystem.FileSystem, root string) (filesystem.FileMap, error) {
+	rootFile, err := fs.ReadFile(root)
+	if err != nil {
+		return nil, err
+	}
+	m := fs.FileMap(rootFile)
+	if m == nil {
+		return nil, fmt.Errorf("Unable to list files in '%s'", root)
+	}
+	return m, nil
+}
+
+func fileChanged(prev, cur filesystem.File) bool {
+	return !prev.ModTime().Equal(cur.ModTime()) || prev.Size() != cur.Size() || prev.Mode() != cur.Mode()
+}
+
+func hash(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
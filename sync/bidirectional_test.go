@@ -0,0 +1,245 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mefellows/mirror/filesystem"
+	"github.com/mefellows/mirror/filesystem/fs"
+)
+
+func setupReconciler(t *testing.T, policy ConflictPolicy, filter *Filter) (*reconciler, string, string, func()) {
+	dir, err := ioutil.TempDir("", "parity-sync")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	local := filepath.Join(dir, "local")
+	remote := filepath.Join(dir, "remote")
+	os.Mkdir(local, 0755)
+	os.Mkdir(remote, 0755)
+
+	localFs, _ := fs.NewStdFileSystem(local)
+	remoteFs, _ := fs.NewStdFileSystem(remote)
+	conflicts := &conflictLog{path: filepath.Join(dir, "conflicts.log")}
+	r := newReconciler(localFs, remoteFs, local, remote, policy, filter, conflicts, nil)
+
+	return r, local, remote, func() { os.RemoveAll(dir) }
+}
+
+func readString(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read '%s': %s", path, err.Error())
+	}
+	return string(data)
+}
+
+func TestReconcile_PullsRemoteFiles(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(remote, "db/migrate"), 0755)
+	ioutil.WriteFile(filepath.Join(remote, "db/migrate/001_init.rb"), []byte("migration"), 0644)
+
+	if err := r.Reconcile(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if res := readString(t, filepath.Join(local, "db/migrate/001_init.rb")); res != "migration" {
+		t.Fatalf("Expected 'migration', got '%s'", res)
+	}
+}
+
+func TestReconcile_RemoteChange(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	ioutil.WriteFile(filepath.Join(local, "Gemfile.lock"), []byte("v1"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "Gemfile.lock"), []byte("v1"), 0644)
+	r.Reconcile()
+
+	ioutil.WriteFile(filepath.Join(remote, "Gemfile.lock"), []byte("v2"), 0644)
+	os.Chtimes(filepath.Join(remote, "Gemfile.lock"), time.Now(), time.Now().Add(time.Minute))
+	r.Reconcile()
+
+	if res := readString(t, filepath.Join(local, "Gemfile.lock")); res != "v2" {
+		t.Fatalf("Expected remote change to be pulled, got '%s'", res)
+	}
+	if _, err := os.Stat(r.conflicts.path); err == nil {
+		t.Fatalf("Expected no conflicts to be recorded")
+	}
+}
+
+func TestReconcile_ConflictHostWins(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	ioutil.WriteFile(filepath.Join(local, "schema.rb"), []byte("base"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "schema.rb"), []byte("base"), 0644)
+	r.baseline.Set(filepath.Join(remote, "schema.rb"), hash([]byte("base")))
+	r.Reconcile()
+
+	ioutil.WriteFile(filepath.Join(local, "schema.rb"), []byte("host"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "schema.rb"), []byte("remote"), 0644)
+	os.Chtimes(filepath.Join(remote, "schema.rb"), time.Now(), time.Now().Add(time.Minute))
+	r.Reconcile()
+
+	if res := readString(t, filepath.Join(local, "schema.rb")); res != "host" {
+		t.Fatalf("Expected host copy to be kept, got '%s'", res)
+	}
+	if res := readString(t, filepath.Join(remote, "schema.rb")); res != "host" {
+		t.Fatalf("Expected host copy to be pushed to remote, got '%s'", res)
+	}
+	if res := readString(t, r.conflicts.path); !strings.Contains(res, "path=/schema.rb policy=host-wins winner=host") {
+		t.Fatalf("Expected conflict to be logged, got '%s'", res)
+	}
+}
+
+func TestReconcile_ConflictLastWriterWins(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, LastWriterWins, nil)
+	defer cleanup()
+
+	ioutil.WriteFile(filepath.Join(local, "schema.rb"), []byte("base"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "schema.rb"), []byte("base"), 0644)
+	r.baseline.Set(filepath.Join(remote, "schema.rb"), hash([]byte("base")))
+	r.Reconcile()
+
+	ioutil.WriteFile(filepath.Join(local, "schema.rb"), []byte("host"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "schema.rb"), []byte("remote"), 0644)
+	os.Chtimes(filepath.Join(remote, "schema.rb"), time.Now(), time.Now().Add(time.Minute))
+	r.Reconcile()
+
+	if res := readString(t, filepath.Join(local, "schema.rb")); res != "remote" {
+		t.Fatalf("Expected newer remote copy to win, got '%s'", res)
+	}
+	if res := readString(t, r.conflicts.path); !strings.Contains(res, "winner=remote") {
+		t.Fatalf("Expected conflict to be logged, got '%s'", res)
+	}
+}
+
+// readCounter counts the files read from a file system
+type readCounter struct {
+	filesystem.FileSystem
+	reads int
+}
+
+func (c *readCounter) Read(f filesystem.File) ([]byte, error) {
+	c.reads++
+	return c.FileSystem.Read(f)
+}
+
+func TestReconcile_FirstPoll(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+	counter := &readCounter{FileSystem: r.remote}
+	r.remote = counter
+
+	ioutil.WriteFile(filepath.Join(local, "app.js"), []byte("app"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "app.js"), []byte("app"), 0644)
+	if err := r.Reconcile(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if counter.reads != 0 {
+		t.Fatalf("Expected files synced by the initial sync not to be read, read %d", counter.reads)
+	}
+}
+
+func TestReconcile_HostChangedTwice(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	ioutil.WriteFile(filepath.Join(local, "app.js"), []byte("v0"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "app.js"), []byte("v0"), 0644)
+	r.baseline.Set(filepath.Join(remote, "app.js"), hash([]byte("v0")))
+	r.Reconcile()
+
+	// The forward sync has sent the first change, but not yet the second
+	ioutil.WriteFile(filepath.Join(remote, "app.js"), []byte("v1"), 0644)
+	os.Chtimes(filepath.Join(remote, "app.js"), time.Now(), time.Now().Add(time.Minute))
+	r.baseline.Set(filepath.Join(remote, "app.js"), hash([]byte("v1")))
+	ioutil.WriteFile(filepath.Join(local, "app.js"), []byte("v2"), 0644)
+	r.Reconcile()
+
+	if res := readString(t, filepath.Join(local, "app.js")); res != "v2" {
+		t.Fatalf("Expected host copy to be kept, got '%s'", res)
+	}
+	if _, err := os.Stat(r.conflicts.path); err == nil {
+		t.Fatalf("Expected no conflicts to be recorded")
+	}
+}
+
+func TestReconcile_RemoteDelete(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	ioutil.WriteFile(filepath.Join(local, "generated.js"), []byte("code"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "generated.js"), []byte("code"), 0644)
+	r.Reconcile()
+
+	os.Remove(filepath.Join(remote, "generated.js"))
+	r.Reconcile()
+
+	if _, err := os.Stat(filepath.Join(local, "generated.js")); err == nil {
+		t.Fatalf("Expected file deleted remotely to be removed from host")
+	}
+}
+
+func TestReconcile_RemoteDeleteDir(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(local, "tmp/cache"), 0755)
+	os.MkdirAll(filepath.Join(remote, "tmp/cache"), 0755)
+	ioutil.WriteFile(filepath.Join(local, "tmp/cache/a"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "tmp/cache/a"), []byte("a"), 0644)
+	r.Reconcile()
+
+	os.RemoveAll(filepath.Join(remote, "tmp"))
+	r.Reconcile()
+
+	if _, err := os.Stat(filepath.Join(local, "tmp")); err == nil {
+		t.Fatalf("Expected directory deleted remotely to be removed from host")
+	}
+}
+
+func TestReconcile_RemoteDeleteDirWithNewFile(t *testing.T) {
+	r, local, remote, cleanup := setupReconciler(t, HostWins, nil)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(local, "uploads"), 0755)
+	os.MkdirAll(filepath.Join(remote, "uploads"), 0755)
+	ioutil.WriteFile(filepath.Join(local, "uploads/old.png"), []byte("old"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "uploads/old.png"), []byte("old"), 0644)
+	r.Reconcile()
+
+	// A new file on the host, not yet synced, when the directory is deleted remotely
+	ioutil.WriteFile(filepath.Join(local, "uploads/new.png"), []byte("new"), 0644)
+	os.RemoveAll(filepath.Join(remote, "uploads"))
+	if err := r.Reconcile(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	if res := readString(t, filepath.Join(local, "uploads/new.png")); res != "new" {
+		t.Fatalf("Expected new file on host to be kept, got '%s'", res)
+	}
+	if res := readString(t, r.conflicts.path); !strings.Contains(res, "path=/uploads ") {
+		t.Fatalf("Expected a conflict to be recorded for the directory, got '%s'", res)
+	}
+}
+
+func TestReconcile_Excludes(t *testing.T) {
+	filter, _ := NewFilter([]string{"dist/"}, nil)
+	r, local, remote, cleanup := setupReconciler(t, HostWins, filter)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(remote, "dist"), 0755)
+	ioutil.WriteFile(filepath.Join(remote, "dist/bundle.js"), []byte("bundle"), 0644)
+	r.Reconcile()
+
+	if _, err := os.Stat(filepath.Join(local, "dist/bundle.js")); err == nil {
+		t.Fatalf("Expected excluded build output not to be copied to host")
+	}
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"crypto/tls"
+	"net"
+	"net/rpc"
+
+	"github.com/mefellows/mirror/filesystem/remote"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/version"
+)
+
+// DefaultDaemonAddress is where the mirror daemon listens on the Docker host
+const DefaultDaemonAddress = "0.0.0.0:8123"
+
+// Daemon is the mirror daemon run on the Docker host by
+// 'parity mirror-daemon'. It serves mirror's remote file system, along with
+// Parity's extensions to the protocol, to clients presenting a certificate
+// signed by Parity's CA.
+type Daemon struct {
+	Address   string
+	TLSConfig *tls.Config
+}
+
+// services returns the RPC services provided by the daemon
+func (d *Daemon) services() []interface{} {
+	return []interface{}{
+		&remote.RemoteFileSystem{},
+		&DeltaService{},
+		&BatchService{},
+		&HashService{},
+		&VersionService{Release: version.Version},
+	}
+}
+
+// server creates the RPC server providing the daemon's services
+func (d *Daemon) server() (*rpc.Server, error) {
+	server := rpc.NewServer()
+	for _, s := range d.services() {
+		if err := server.Register(s); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// Serve accepts connections until the listener fails
+func (d *Daemon) Serve() error {
+	server, err := d.server()
+	if err != nil {
+		return err
+	}
+	l, err := tls.Listen("tcp", d.Address, d.TLSConfig)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	log.Info("Mirror daemon listening on %s", d.Address)
+	return serve(l, server)
+}
+
+// serve handles each connection accepted by l in its own goroutine
+func serve(l net.Listener, server *rpc.Server) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		log.Debug("Accepted connection from %s", conn.RemoteAddr())
+		go server.ServeConn(conn)
+	}
+}
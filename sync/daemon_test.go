@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/mirror/filesystem/remote"
+	"github.com/mefellows/parity/version"
+)
+
+// setupDaemon serves the daemon's services on a local port, without TLS
+func setupDaemon(t *testing.T) (*rpc.Client, func()) {
+	server, err := (&Daemon{}).server()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	go serve(l, server)
+
+	client, err := rpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect to daemon: %s", err.Error())
+	}
+	return client, func() {
+		client.Close()
+		l.Close()
+	}
+}
+
+func TestDaemon_Services(t *testing.T) {
+	client, cleanup := setupDaemon(t)
+	defer cleanup()
+	dir, _ := ioutil.TempDir("", "parity-daemon")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "bundle.js")
+	ioutil.WriteFile(file, randomBytes(64*1024), 0644)
+
+	// mirror's own file system
+	res := &remote.ReadFileResponse{}
+	if err := client.Call("RemoteFileSystem.RemoteReadFile", &remote.ReadFileRequest{File: file}, res); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if res.File.Size() != 64*1024 {
+		t.Fatalf("Expected file to be read, got %v", res.File)
+	}
+
+	// Parity's extensions
+	sig := &SignatureResponse{}
+	if err := client.Call("DeltaService.Signature", &SignatureRequest{Path: file, BlockSize: 4096}, sig); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(sig.Signature.Blocks) != 16 {
+		t.Fatalf("Expected 16 block signatures, got %d", len(sig.Signature.Blocks))
+	}
+	hashes := &HashResponse{}
+	if err := client.Call("HashService.Hashes", &HashRequest{Paths: []string{file}}, hashes); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if hashes.Hashes[file] == "" {
+		t.Fatalf("Expected file to be hashed")
+	}
+	v := &VersionResponse{}
+	if err := client.Call("VersionService.Version", &VersionRequest{}, v); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if v.Protocol != ProtocolVersion || v.Release != version.Version {
+		t.Fatalf("Expected daemon to report its version, got %v", v)
+	}
+	req, _ := encodeBatch([]BatchOp{{Kind: OpDelete, Path: file}}, true)
+	if err := client.Call("BatchService.Apply", req, &BatchResponse{}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("Expected batch to be applied")
+	}
+}
+
+func TestMirrorClient(t *testing.T) {
+	client, cleanup := setupDaemon(t)
+	defer cleanup()
+	dir, _ := ioutil.TempDir("", "parity-daemon")
+	defer os.RemoveAll(dir)
+
+	// mirror's file system and Parity's extensions share the connection
+	f := newRemoteFileSystemWithClient(&mirrorClient{client: client}, client)
+	path := filepath.Join(dir, "app.js")
+	writeFile(t, f, path, []byte("console.log('parity');"))
+	file, err := f.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if data, err := f.Read(file); err != nil || string(data) != "console.log('parity');" {
+		t.Fatalf("Expected file to be read, got '%s' (%v)", data, err)
+	}
+	root, _ := f.ReadFile(dir)
+	if files := f.FileMap(root); len(files) != 1 || files["/app.js"].Size() != 22 {
+		t.Fatalf("Expected the file to be listed, got %v", files)
+	}
+	if _, err := f.version(); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if err := f.Delete(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	// Once closed, calls fail rather than exiting
+	f.Close()
+	if _, err := f.ReadFile(dir); err == nil {
+		t.Fatalf("Expected calls on a closed connection to fail")
+	}
+}
+
+func TestNewRemoteFileSystem_Unreachable(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := l.Addr().String()
+	l.Close()
+
+	if _, err := newRemoteFileSystem("parity://" + address + "/app"); err == nil {
+		t.Fatalf("Expected an error connecting to a daemon that isn't running")
+	}
+}
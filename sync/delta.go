@@ -0,0 +1,283 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Delta transfer, based on the rsync algorithm.
+//
+// The receiver splits its copy of a file into fixed size blocks and sends
+// a weak (rolling) and strong checksum of each block to the sender. The
+// sender slides a window over the new contents looking for matching
+// blocks, and sends back a list of operations: references to blocks the
+// receiver already has, and literal data for everything else.
+
+const (
+	minBlockSize = 512
+	maxBlockSize = 64 * 1024
+
+	// Files smaller than this are always sent whole
+	deltaThreshold = 32 * 1024
+
+	// Approximate wire cost of a block reference
+	blockRefSize = 8
+)
+
+// BlockSignature is the checksum pair of a single block of a file
+type BlockSignature struct {
+	Index  int
+	Weak   uint32
+	Strong [md5.Size]byte
+}
+
+// Signature describes the contents of a file as a list of block checksums
+type Signature struct {
+	BlockSize int
+	Size      int64
+	Blocks    []BlockSignature
+}
+
+// DeltaOp is a single instruction to rebuild a file from its previous
+// version. If Data is nil, block Block is copied from the previous version.
+type DeltaOp struct {
+	Block int
+	Data  []byte
+}
+
+// blockSizeFor picks a block size for a file of the given length
+func blockSizeFor(size int) int {
+	bs := int(math.Sqrt(float64(size)))
+	if bs < minBlockSize {
+		return minBlockSize
+	}
+	if bs > maxBlockSize {
+		return maxBlockSize
+	}
+	return bs
+}
+
+// weakChecksum computes the rsync rolling checksum of a block
+func weakChecksum(block []byte) (a, b uint32) {
+	l := uint32(len(block))
+	for i, c := range block {
+		a += uint32(c)
+		b += (l - uint32(i)) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+// roll moves the checksum window on by one byte
+func roll(a, b uint32, out, in byte, blockSize int) (uint32, uint32) {
+	a = (a - uint32(out) + uint32(in)) & 0xffff
+	b = (b - uint32(blockSize)*uint32(out) + a) & 0xffff
+	return a, b
+}
+
+// ComputeSignature calculates the block signatures of data
+func ComputeSignature(data []byte, blockSize int) Signature {
+	sig := Signature{BlockSize: blockSize, Size: int64(len(data))}
+	for i := 0; i*blockSize < len(data); i++ {
+		end := (i + 1) * blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		block := data[i*blockSize : end]
+		a, b := weakChecksum(block)
+		sig.Blocks = append(sig.Blocks, BlockSignature{
+			Index:  i,
+			Weak:   a | b<<16,
+			Strong: md5.Sum(block),
+		})
+	}
+	return sig
+}
+
+// ComputeDelta calculates the operations required to turn the file
+// described by sig into data
+func ComputeDelta(sig Signature, data []byte) []DeltaOp {
+	bs := sig.BlockSize
+	index := make(map[uint32][]BlockSignature)
+	for _, block := range sig.Blocks {
+		index[block.Weak] = append(index[block.Weak], block)
+	}
+
+	var ops []DeltaOp
+	literalStart := 0
+	flush := func(end int) {
+		if end > literalStart {
+			ops = append(ops, DeltaOp{Block: -1, Data: data[literalStart:end]})
+		}
+	}
+	match := func(weak uint32, block []byte) (int, bool) {
+		candidates, ok := index[weak]
+		if !ok {
+			return 0, false
+		}
+		strong := md5.Sum(block)
+		for _, c := range candidates {
+			if c.Strong == strong && blockLen(sig, c.Index) == len(block) {
+				return c.Index, true
+			}
+		}
+		return 0, false
+	}
+
+	i := 0
+	var a, b uint32
+	if len(data) >= bs {
+		a, b = weakChecksum(data[:bs])
+	}
+	for i+bs <= len(data) {
+		if idx, ok := match(a|b<<16, data[i:i+bs]); ok {
+			flush(i)
+			ops = append(ops, DeltaOp{Block: idx})
+			i += bs
+			literalStart = i
+			if i+bs <= len(data) {
+				a, b = weakChecksum(data[i : i+bs])
+			}
+			continue
+		}
+		if i+bs < len(data) {
+			a, b = roll(a, b, data[i], data[i+bs], bs)
+		}
+		i++
+	}
+
+	// The final block of the previous version may be shorter than the rest
+	if tail := data[i:]; len(tail) > 0 {
+		ta, tb := weakChecksum(tail)
+		if idx, ok := match(ta|tb<<16, tail); ok {
+			flush(i)
+			ops = append(ops, DeltaOp{Block: idx})
+			literalStart = len(data)
+		}
+	}
+	flush(len(data))
+
+	return ops
+}
+
+// ApplyDelta rebuilds a file from its previous version and a list of operations
+func ApplyDelta(base []byte, ops []DeltaOp, blockSize int) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, op := range ops {
+		if op.Data != nil {
+			buf.Write(op.Data)
+			continue
+		}
+		start := op.Block * blockSize
+		if op.Block < 0 || start >= len(base) {
+			return nil, fmt.Errorf("Delta references block %d beyond the end of the file", op.Block)
+		}
+		end := start + blockSize
+		if end > len(base) {
+			end = len(base)
+		}
+		buf.Write(base[start:end])
+	}
+	return buf.Bytes(), nil
+}
+
+// DeltaSize returns the approximate number of bytes needed to send ops
+func DeltaSize(ops []DeltaOp) int {
+	size := 0
+	for _, op := range ops {
+		if op.Data != nil {
+			size += len(op.Data)
+		} else {
+			size += blockRefSize
+		}
+	}
+	return size
+}
+
+func blockLen(sig Signature, index int) int {
+	if remaining := int(sig.Size) - index*sig.BlockSize; remaining < sig.BlockSize {
+		return remaining
+	}
+	return sig.BlockSize
+}
+
+// Remote RPC types for the delta protocol
+
+// SignatureRequest asks for the signature of a file on the remote host
+type SignatureRequest struct {
+	Path      string
+	BlockSize int
+}
+
+// SignatureResponse contains the signature of a remote file
+type SignatureResponse struct {
+	Signature Signature
+}
+
+// PatchRequest asks the remote host to rebuild a file from a delta
+type PatchRequest struct {
+	Path      string
+	BlockSize int
+	Ops       []DeltaOp
+	Perm      os.FileMode
+	Checksum  string
+}
+
+// PatchResponse is the result of applying a delta
+type PatchResponse struct {
+	Size int64
+}
+
+// DeltaService is the server side of the delta protocol, provided by
+// Parity's mirror daemon (see Daemon). Clients fall back to full copies
+// with other daemons.
+type DeltaService struct{}
+
+// Signature computes the signature of a file on this host
+func (s *DeltaService) Signature(req *SignatureRequest, res *SignatureResponse) error {
+	data, err := ioutil.ReadFile(req.Path)
+	if err != nil {
+		return err
+	}
+	res.Signature = ComputeSignature(data, req.BlockSize)
+	return nil
+}
+
+// Patch applies a delta to a file on this host
+func (s *DeltaService) Patch(req *PatchRequest, res *PatchResponse) error {
+	base, err := ioutil.ReadFile(req.Path)
+	if err != nil {
+		return err
+	}
+	data, err := ApplyDelta(base, req.Ops, req.BlockSize)
+	if err != nil {
+		return err
+	}
+	if hash(data) != req.Checksum {
+		return fmt.Errorf("Checksum mismatch patching '%s'", req.Path)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(req.Path), ".parity-delta")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err = os.Chmod(tmp.Name(), req.Perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), req.Path); err != nil {
+		return err
+	}
+
+	res.Size = int64(len(data))
+	return nil
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomBytes(size int) []byte {
+	r := rand.New(rand.NewSource(42))
+	data := make([]byte, size)
+	r.Read(data)
+	return data
+}
+
+func roundTrip(t testing.TB, base, data []byte) []DeltaOp {
+	bs := blockSizeFor(len(data))
+	ops := ComputeDelta(ComputeSignature(base, bs), data)
+	res, err := ApplyDelta(base, ops, bs)
+	if err != nil {
+		t.Fatalf("Unexpected error applying delta: %s", err.Error())
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatalf("Expected patched file to match new contents")
+	}
+	return ops
+}
+
+func TestDelta_Unchanged(t *testing.T) {
+	data := randomBytes(100 * 1024)
+	ops := roundTrip(t, data, data)
+	for _, op := range ops {
+		if op.Data != nil {
+			t.Fatalf("Expected no literal data for an unchanged file, got %d bytes", len(op.Data))
+		}
+	}
+}
+
+func TestDelta_Edits(t *testing.T) {
+	base := randomBytes(256*1024 + 17)
+
+	edits := map[string][]byte{
+		"append":   append(append([]byte{}, base...), []byte("appended")...),
+		"prepend":  append([]byte("prepended"), base...),
+		"truncate": base[:len(base)/2],
+		"insert":   append(append(append([]byte{}, base[:1000]...), []byte("inserted")...), base[1000:]...),
+		"empty":    []byte{},
+	}
+	for name, data := range edits {
+		ops := roundTrip(t, base, data)
+		if name != "empty" && DeltaSize(ops) > len(data)/10 {
+			t.Fatalf("Expected delta for '%s' to be small, got %d bytes", name, DeltaSize(ops))
+		}
+	}
+}
+
+func TestDelta_NewFile(t *testing.T) {
+	data := randomBytes(64 * 1024)
+	ops := roundTrip(t, []byte{}, data)
+	if DeltaSize(ops) != len(data) {
+		t.Fatalf("Expected whole file to be sent, got %d bytes", DeltaSize(ops))
+	}
+}
+
+func TestApplyDelta_InvalidBlock(t *testing.T) {
+	if _, err := ApplyDelta([]byte("base"), []DeltaOp{{Block: 10}}, 512); err == nil {
+		t.Fatalf("Expected error for block beyond the end of the file")
+	}
+}
+
+// Benchmarks report the bytes sent for typical edits to a 1MB file,
+// compared to sending the whole file
+func benchmarkEdit(b *testing.B, edit func([]byte) []byte) {
+	base := randomBytes(1024 * 1024)
+	data := edit(append([]byte{}, base...))
+	var ops []DeltaOp
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ops = roundTrip(b, base, data)
+	}
+	b.ReportMetric(float64(DeltaSize(ops)), "sent-bytes")
+	b.ReportMetric(float64(len(data)), "full-bytes")
+}
+
+func BenchmarkDelta_ByteChange(b *testing.B) {
+	benchmarkEdit(b, func(data []byte) []byte {
+		data[len(data)/2] ^= 0xff
+		return data
+	})
+}
+
+func BenchmarkDelta_Append(b *testing.B) {
+	benchmarkEdit(b, func(data []byte) []byte {
+		return append(data, randomBytes(4096)...)
+	})
+}
+
+func BenchmarkDelta_Insert(b *testing.B) {
+	benchmarkEdit(b, func(data []byte) []byte {
+		return append(append(append([]byte{}, data[:300000]...), []byte("INSERT INTO users VALUES (1, 'parity');")...), data[300000:]...)
+	})
+}
+
+func BenchmarkDelta_Delete(b *testing.B) {
+	benchmarkEdit(b, func(data []byte) []byte {
+		return append(data[:500000], data[510000:]...)
+	})
+}
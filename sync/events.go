@@ -0,0 +1,63 @@
+package sync
+
+import (
+	gosync "sync"
+	"time"
+)
+
+// EventType is the kind of a sync Event
+type EventType string
+
+const (
+	// BatchEvent is published after a batch of changes has been sent
+	BatchEvent EventType = "batch"
+
+	// ErrorEvent is published when a batch of changes failed to send
+	ErrorEvent EventType = "error"
+)
+
+// Event is published on the sync event stream
+type Event struct {
+	Type  EventType
+	Time  time.Time
+	Path  string // Root of the synced volume
+	Batch BatchMetrics
+	Err   error
+}
+
+// EventStream fans out sync events to any number of subscribers.
+// Slow subscribers miss events rather than blocking the sync.
+type EventStream struct {
+	gosync.Mutex
+	subscribers []chan Event
+	dropped     int64
+}
+
+// Subscribe returns a channel receiving all subsequent events
+func (s *EventStream) Subscribe() <-chan Event {
+	s.Lock()
+	defer s.Unlock()
+	c := make(chan Event, 100)
+	s.subscribers = append(s.subscribers, c)
+	return c
+}
+
+// Publish sends an event to all subscribers
+func (s *EventStream) Publish(e Event) {
+	s.Lock()
+	defer s.Unlock()
+	for _, c := range s.subscribers {
+		select {
+		case c <- e:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// Dropped returns the number of events missed by slow subscribers
+func (s *EventStream) Dropped() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.dropped
+}
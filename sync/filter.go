@@ -0,0 +1,250 @@
+package sync
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	mutils "github.com/mefellows/mirror/filesystem/utils"
+)
+
+// pattern is a single compiled gitignore style pattern
+type pattern struct {
+	raw      string
+	negate   bool
+	dirOnly  bool
+	segments []string
+}
+
+// Matcher matches paths against an ordered list of gitignore style
+// patterns. As with .gitignore files:
+//
+//   - Patterns without a slash match a file or directory at any depth
+//   - Patterns containing a slash (e.g. /tmp or app/assets) are anchored
+//     to the root being synced
+//   - A trailing slash only matches directories
+//   - '**' matches any number of directories
+//   - A leading '!' re-includes a path excluded by an earlier pattern
+//   - The last matching pattern wins, and the contents of an excluded
+//     directory are always excluded
+type Matcher struct {
+	patterns []pattern
+}
+
+// NewMatcher compiles a list of gitignore style patterns
+func NewMatcher(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, raw := range patterns {
+		p, err := compilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+func compilePattern(raw string) (pattern, error) {
+	p := pattern{raw: raw}
+	s := strings.TrimRight(raw, " ")
+
+	if strings.HasPrefix(s, "!") {
+		p.negate = true
+		s = s[1:]
+	} else if strings.HasPrefix(s, `\!`) || strings.HasPrefix(s, `\#`) {
+		s = s[1:]
+	}
+	if strings.HasSuffix(s, "/") {
+		p.dirOnly = true
+		s = strings.TrimRight(s, "/")
+	}
+	if s == "" {
+		return p, fmt.Errorf("Invalid pattern '%s': pattern is empty", raw)
+	}
+
+	// Patterns without a slash match at any depth
+	if !strings.Contains(s, "/") {
+		s = "**/" + s
+	}
+	s = strings.TrimPrefix(s, "/")
+
+	p.segments = strings.Split(s, "/")
+	for _, seg := range p.segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return p, fmt.Errorf("Invalid pattern '%s': %s", raw, err.Error())
+		}
+	}
+	return p, nil
+}
+
+// Match returns true if path (relative to the root, '/' separated)
+// is matched by the patterns
+func (m *Matcher) Match(path string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	segments := splitPath(path)
+	if len(segments) == 0 {
+		return false
+	}
+
+	// The contents of a matched directory are always matched
+	for i := 1; i < len(segments); i++ {
+		if m.match(segments[:i], true) {
+			return true
+		}
+	}
+	return m.match(segments, isDir)
+}
+
+func (m *Matcher) match(segments []string, isDir bool) bool {
+	matched := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, segments) {
+			matched = !p.negate
+		}
+	}
+	return matched
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func splitPath(p string) []string {
+	var segments []string
+	for _, s := range strings.Split(mutils.LinuxPath(p), "/") {
+		if s != "" && s != "." {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// Filter decides which paths are synchronised, based on a list of
+// exclude patterns and an optional allowlist of include patterns
+type Filter struct {
+	exclude  []string
+	include  []string
+	excludes *Matcher
+	includes *Matcher
+}
+
+// NewFilter compiles a Filter from gitignore style exclude and include
+// patterns. If include is empty, all files not excluded are synchronised.
+func NewFilter(exclude, include []string) (*Filter, error) {
+	if err := checkPatterns(exclude); err != nil {
+		return nil, err
+	}
+	if err := checkPatterns(include); err != nil {
+		return nil, err
+	}
+	return newFilter(exclude, include)
+}
+
+// checkPatterns rejects patterns that look like regular expressions, e.g.
+// '\.log$', which Parity used to accept but which now silently match nothing
+func checkPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if strings.Contains(p, `\.`) || strings.HasPrefix(p, "^") || strings.HasSuffix(p, "$") {
+			return fmt.Errorf("Invalid pattern '%s': patterns are .gitignore style, not regular expressions (e.g. '*.log' rather than '\\.log$', '.git/' rather than '\\.git')", p)
+		}
+	}
+	return nil
+}
+
+func newFilter(exclude, include []string) (*Filter, error) {
+	f := &Filter{exclude: exclude, include: include}
+	var err error
+	if f.excludes, err = NewMatcher(exclude); err != nil {
+		return nil, err
+	}
+	if len(include) > 0 {
+		if f.includes, err = NewMatcher(include); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// WithExcludes returns a copy of the Filter with additional exclude patterns
+func (f *Filter) WithExcludes(exclude []string) (*Filter, error) {
+	if err := checkPatterns(exclude); err != nil {
+		return nil, err
+	}
+	return newFilter(append(append([]string{}, f.exclude...), exclude...), f.include)
+}
+
+// WithGitIgnore returns a copy of the Filter that also honours the
+// .gitignore file in dir, if present. Patterns configured in Parity take
+// precedence over those in .gitignore.
+func (f *Filter) WithGitIgnore(dir string) (*Filter, error) {
+	patterns, err := ReadIgnoreFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, err
+	}
+	return newFilter(append(patterns, f.exclude...), f.include)
+}
+
+// Ignore returns true if path (relative to the synced root) should not be synchronised
+func (f *Filter) Ignore(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	if f.excludes.Match(path, isDir) {
+		return true
+	}
+
+	// Directories are always traversed, so that included files within them are found
+	return f.includes != nil && !isDir && !f.includes.Match(path, false)
+}
+
+// ReadIgnoreFile reads the patterns from a .gitignore style file
+func ReadIgnoreFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{[]string{"*.log"}, "/development.log", false, true},
+		{[]string{"*.log"}, "/log/nested/test.log", false, true},
+		{[]string{"*.log"}, "/app.js", false, false},
+		{[]string{"tmp"}, "/app/tmp", true, true},
+		{[]string{"tmp"}, "/app/tmp/cache/file", false, true},
+		{[]string{"/tmp"}, "/app/tmp", true, false},
+		{[]string{"/tmp"}, "/tmp/pids/server.pid", false, true},
+		{[]string{"build/"}, "/build", false, false},
+		{[]string{"build/"}, "/build", true, true},
+		{[]string{"build/"}, "/build/app.js", false, true},
+		{[]string{"app/assets"}, "/app/assets/logo.png", false, true},
+		{[]string{"app/assets"}, "/lib/app/assets", true, false},
+		{[]string{"**/node_modules"}, "/a/b/node_modules", true, true},
+		{[]string{"docs/**/*.md"}, "/docs/README.md", false, true},
+		{[]string{"docs/**/*.md"}, "/docs/a/b/guide.md", false, true},
+		{[]string{"vendor/**"}, "/vendor", true, false},
+		{[]string{"vendor/**"}, "/vendor/lib.go", false, true},
+		{[]string{"*.log", "!important.log"}, "/important.log", false, false},
+		{[]string{"*.log", "!important.log"}, "/other.log", false, true},
+		{[]string{"!important.log", "*.log"}, "/important.log", false, true},
+		{[]string{`\!bang`}, "/!bang", false, true},
+	}
+
+	for _, c := range cases {
+		m, err := NewMatcher(c.patterns)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if res := m.Match(c.path, c.isDir); res != c.expected {
+			t.Fatalf("Expected %v for '%s' with patterns %v, got %v", c.expected, c.path, c.patterns, res)
+		}
+	}
+}
+
+func TestNewMatcher_InvalidPattern(t *testing.T) {
+	for _, p := range []string{"[abc", "/", "!"} {
+		if _, err := NewMatcher([]string{p}); err == nil {
+			t.Fatalf("Expected error for pattern '%s'", p)
+		}
+	}
+}
+
+func TestNewFilter_RegexPattern(t *testing.T) {
+	for _, p := range []string{`\.log$`, `\.git`, "^tmp"} {
+		if _, err := NewFilter([]string{p}, nil); err == nil {
+			t.Fatalf("Expected error for regex pattern '%s'", p)
+		}
+		if _, err := (&Filter{}).WithExcludes([]string{p}); err == nil {
+			t.Fatalf("Expected error for regex exclude '%s'", p)
+		}
+	}
+	if _, err := NewFilter([]string{"*.log", ".git/", `\#notes`}, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestFilter_Include(t *testing.T) {
+	f, err := NewFilter([]string{"*.test.js"}, []string{"src/", "package.json"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	cases := map[string]bool{
+		"/src/app.js":      false,
+		"/src/app.test.js": true,
+		"/package.json":    false,
+		"/README.md":       true,
+	}
+	for path, expected := range cases {
+		if res := f.Ignore(path, false); res != expected {
+			t.Fatalf("Expected Ignore('%s') to be %v, got %v", path, expected, res)
+		}
+	}
+	if f.Ignore("/docs", true) {
+		t.Fatalf("Expected directories to be traversed when using includes")
+	}
+}
+
+func TestFilter_WithGitIgnore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-filter")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("# Build output\ndist/\n*.env\n\n"), 0644)
+
+	f, _ := NewFilter([]string{"!production.env"}, nil)
+	f, err := f.WithGitIgnore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !f.Ignore("/dist", true) || !f.Ignore("/local.env", false) {
+		t.Fatalf("Expected .gitignore patterns to be honoured")
+	}
+	if f.Ignore("/production.env", false) {
+		t.Fatalf("Expected configured patterns to take precedence over .gitignore")
+	}
+}
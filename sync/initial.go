@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mefellows/mirror/filesystem"
+	mutils "github.com/mefellows/mirror/filesystem/utils"
+	"github.com/mefellows/parity/log"
+	"github.com/mefellows/parity/parity"
+)
+
+const (
+	// Number of bytes read into memory before flushing them to the remote host
+	initialSyncChunkBytes = 4 * maxBatchBytes
+
+	// Number of files read before flushing them to the remote host
+	initialSyncChunkFiles = 1000
+)
+
+// initialSync copies every file in src that is missing or older in dest
+// on the remote host, skipping anything excluded by filter. If provided,
+// progress is called after each chunk of files is sent.
+func initialSync(src, dest string, filter *Filter, t *transport, progress func(parity.SyncProgress)) (BatchMetrics, error) {
+	metrics := BatchMetrics{}
+	local, err := mutils.GetFileSystemFromFile(src)
+	if err != nil {
+		return metrics, err
+	}
+	localMap, err := fileMap(local, src)
+	if err != nil {
+		return metrics, err
+	}
+
+	// The destination may not exist yet
+	remoteMap, err := fileMap(t.fs, dest)
+	if err != nil {
+		log.Debug("Unable to list '%s' on Docker host, copying all files: %s", dest, err.Error())
+		remoteMap = filesystem.FileMap{}
+	}
+
+	status := parity.SyncProgress{Path: src}
+	paths := make([]string, 0, len(localMap))
+	for path, file := range localMap {
+		if path == "" || filter.Ignore(path, file.IsDir()) {
+			continue
+		}
+		if !filesystem.ModifiedComparator(file, remoteMap[path]) {
+			paths = append(paths, path)
+			if !file.IsDir() {
+				status.TotalFiles++
+				status.TotalBytes += file.Size()
+			}
+		}
+	}
+
+	// Parent directories sort before their contents
+	sort.Strings(paths)
+
+	start := time.Now()
+	var ops []BatchOp
+	size := 0
+	flush := func() error {
+		m, err := t.Send(ops)
+		metrics.add(m)
+		ops = nil
+		size = 0
+
+		status.Files += m.Writes
+		status.Bytes += m.Bytes
+		status.Elapsed = time.Since(start)
+		if progress != nil {
+			progress(status)
+		}
+		return err
+	}
+
+	for _, path := range paths {
+		file := localMap[path]
+		if file.IsDir() {
+			ops = append(ops, BatchOp{Kind: OpMkDir, Path: dest + path, Perm: file.Mode()})
+			continue
+		}
+		data, err := local.Read(file)
+		if err != nil {
+			log.Error("Unable to read '%s': %s", file.Path(), err.Error())
+			continue
+		}
+		ops = append(ops, BatchOp{Kind: OpWrite, Path: dest + path, Data: data, Perm: file.Mode()})
+		size += len(data)
+
+		if size >= initialSyncChunkBytes || len(ops) >= initialSyncChunkFiles {
+			if err := flush(); err != nil {
+				return metrics, err
+			}
+		}
+	}
+	if len(ops) > 0 {
+		return metrics, flush()
+	}
+	return metrics, nil
+}
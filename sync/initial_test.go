@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/parity/parity"
+)
+
+func TestInitialSync(t *testing.T) {
+	f, dest, cleanup := setupRemoteFileSystem(t, &BatchService{})
+	defer cleanup()
+
+	src, _ := ioutil.TempDir("", "parity-initial")
+	defer os.RemoveAll(src)
+	os.MkdirAll(filepath.Join(src, "app/models"), 0755)
+	os.MkdirAll(filepath.Join(src, "tmp/cache"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "app/models/user.rb"), []byte("class User; end"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "tmp/cache/page.html"), []byte("cached"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "Gemfile"), []byte("gem 'rails'"), 0644)
+
+	filter, _ := NewFilter([]string{"tmp/"}, nil)
+	var progress parity.SyncProgress
+	metrics, err := initialSync(src, dest, filter, newTransport(f, true), func(p parity.SyncProgress) {
+		progress = p
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if metrics.Writes != 2 {
+		t.Fatalf("Expected 2 files to be written, got %d", metrics.Writes)
+	}
+	if progress.Files != 2 || progress.TotalFiles != 2 || progress.Bytes != progress.TotalBytes {
+		t.Fatalf("Expected progress to report all files sent, got '%s'", progress)
+	}
+	if res := readString(t, filepath.Join(dest, "app/models/user.rb")); res != "class User; end" {
+		t.Fatalf("Expected nested file to be synced, got '%s'", res)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "tmp")); err == nil {
+		t.Fatalf("Expected excluded directory not to be synced")
+	}
+
+	// Nothing has changed, so nothing should be sent
+	metrics, _ = initialSync(src, dest, filter, newTransport(f, true), nil)
+	if metrics.Writes != 0 {
+		t.Fatalf("Expected up to date files to be skipped, got %d writes", metrics.Writes)
+	}
+}
@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/mefellows/parity/log"
+)
+
+// Upper bounds (in milliseconds) of the latency histogram buckets
+var latencyBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Histogram counts observed latencies in fixed buckets
+type Histogram struct {
+	Buckets []float64 `json:"buckets"` // Upper bound of each bucket, in ms
+	Counts  []int64   `json:"counts"`  // Observations per bucket, plus one for anything slower
+	Count   int64     `json:"count"`
+	Sum     float64   `json:"sum"` // Total of all observations, in ms
+	Max     float64   `json:"max"`
+}
+
+func newHistogram() Histogram {
+	return Histogram{Buckets: latencyBuckets, Counts: make([]int64, len(latencyBuckets)+1)}
+}
+
+// Observe records a single latency
+func (h *Histogram) Observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := 0
+	for i < len(h.Buckets) && ms > h.Buckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += ms
+	if ms > h.Max {
+		h.Max = ms
+	}
+}
+
+// Mean returns the average latency, in ms
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Quantile estimates the latency (in ms) below which q of observations
+// fall, using the upper bound of the matching bucket
+func (h Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	target := int64(q*float64(h.Count) + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i, c := range h.Counts {
+		seen += c
+		if seen >= target {
+			if i < len(h.Buckets) && h.Buckets[i] < h.Max {
+				return h.Buckets[i]
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+func (h Histogram) String() string {
+	return fmt.Sprintf("count=%d mean=%.1fms p50=%.0fms p90=%.0fms p99=%.0fms max=%.1fms",
+		h.Count, h.Mean(), h.Quantile(0.5), h.Quantile(0.9), h.Quantile(0.99), h.Max)
+}
+
+// Stats is a point in time view of the sync metrics
+type Stats struct {
+	Since         time.Time      `json:"since"`
+	Files         int64          `json:"files"`          // Files written or deleted
+	Batches       int64          `json:"batches"`        // Batches sent
+	Bytes         int64          `json:"bytes"`          // Uncompressed bytes sent
+	WireBytes     int64          `json:"wire_bytes"`     // Bytes actually sent
+	Errors        int64          `json:"errors"`         // Failed batches and watch errors
+	DroppedEvents int64          `json:"dropped_events"` // Events missed by slow subscribers
+	QueueDepth    int            `json:"queue_depth"`    // Changes waiting to be sent
+	Queues        map[string]int `json:"queues"`         // Changes waiting, per synced directory
+	FileLatency   Histogram      `json:"file_latency"`   // Time from a change being seen to it being sent
+	BatchLatency  Histogram      `json:"batch_latency"`  // Time taken to send each batch
+	LastError     string         `json:"last_error,omitempty"`
+	LastErrorTime time.Time      `json:"last_error_time,omitempty"`
+}
+
+func (s Stats) String() string {
+	lines := []string{
+		fmt.Sprintf("Since:          %s (%s)", s.Since.Format(time.RFC3339), time.Since(s.Since).Truncate(time.Second)),
+		fmt.Sprintf("Files:          %d in %d batches", s.Files, s.Batches),
+		fmt.Sprintf("Bytes:          %d (%d sent)", s.Bytes, s.WireBytes),
+		fmt.Sprintf("Queue depth:    %d", s.QueueDepth),
+	}
+	paths := make([]string, 0, len(s.Queues))
+	for path := range s.Queues {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		lines = append(lines, fmt.Sprintf("  %-12d  %s", s.Queues[path], path))
+	}
+	lines = append(lines,
+		fmt.Sprintf("File latency:   %s", s.FileLatency),
+		fmt.Sprintf("Batch latency:  %s", s.BatchLatency),
+		fmt.Sprintf("Dropped events: %d", s.DroppedEvents),
+		fmt.Sprintf("Errors:         %d", s.Errors),
+	)
+	if s.LastError != "" {
+		lines = append(lines, fmt.Sprintf("Last error:     %s (%s)", s.LastError, s.LastErrorTime.Format(time.RFC3339)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Metrics records the throughput and latency of the sync. All methods
+// are safe to call on a nil *Metrics.
+type Metrics struct {
+	gosync.Mutex
+	stats Stats
+}
+
+// NewMetrics creates an empty set of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{stats: Stats{
+		Since:        time.Now(),
+		Queues:       make(map[string]int),
+		FileLatency:  newHistogram(),
+		BatchLatency: newHistogram(),
+	}}
+}
+
+// RecordBatch records a batch sent to the Docker host. seen is the time
+// each file in the batch was first changed.
+func (m *Metrics) RecordBatch(b BatchMetrics, seen []time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	m.stats.Batches++
+	m.stats.Files += int64(b.Writes + b.Deletes)
+	m.stats.Bytes += b.Bytes
+	m.stats.WireBytes += b.WireBytes
+	m.stats.BatchLatency.Observe(b.Duration)
+	for _, t := range seen {
+		m.stats.FileLatency.Observe(now.Sub(t))
+	}
+	if err != nil {
+		m.recordError(err)
+	}
+}
+
+// RecordError records a sync error
+func (m *Metrics) RecordError(err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.recordError(err)
+}
+
+func (m *Metrics) recordError(err error) {
+	m.stats.Errors++
+	m.stats.LastError = err.Error()
+	m.stats.LastErrorTime = time.Now()
+}
+
+// SetQueueDepth records the number of changes waiting to be sent for path
+func (m *Metrics) SetQueueDepth(path string, depth int) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.stats.Queues[path] = depth
+}
+
+// Stats returns a copy of the current metrics
+func (m *Metrics) Stats() Stats {
+	if m == nil {
+		return NewMetrics().Stats()
+	}
+	m.Lock()
+	defer m.Unlock()
+	s := m.stats
+	s.Queues = make(map[string]int)
+	for k, v := range m.stats.Queues {
+		s.Queues[k] = v
+		s.QueueDepth += v
+	}
+	s.FileLatency.Counts = append([]int64{}, m.stats.FileLatency.Counts...)
+	s.BatchLatency.Counts = append([]int64{}, m.stats.BatchLatency.Counts...)
+	return s
+}
+
+// ServeMetrics exposes the stats returned by stats as JSON on a local
+// HTTP endpoint (/stats) until done is closed
+func ServeMetrics(address string, stats func() Stats, done <-chan struct{}) (net.Addr, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats())
+	})
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-done
+		l.Close()
+	}()
+	log.Debug("Serving sync metrics on http://%s/stats", l.Addr())
+	go server.Serve(l)
+	return l.Addr(), nil
+}
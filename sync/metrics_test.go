@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := newHistogram()
+	for i := 0; i < 90; i++ {
+		h.Observe(3 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe(400 * time.Millisecond)
+	}
+
+	if h.Count != 100 {
+		t.Fatalf("Expected 100 observations, got %d", h.Count)
+	}
+	if q := h.Quantile(0.5); q != 5 {
+		t.Fatalf("Expected p50 to be 5ms, got %f", q)
+	}
+	if q := h.Quantile(0.99); q != 400 {
+		t.Fatalf("Expected p99 to be capped at the max of 400ms, got %f", q)
+	}
+	if m := h.Mean(); m != 42.7 {
+		t.Fatalf("Expected mean of 42.7ms, got %f", m)
+	}
+}
+
+func TestHistogram_Overflow(t *testing.T) {
+	h := newHistogram()
+	h.Observe(time.Minute)
+	if h.Counts[len(h.Counts)-1] != 1 {
+		t.Fatalf("Expected slow observation in the overflow bucket, got %v", h.Counts)
+	}
+	if q := h.Quantile(0.5); q != 60000 {
+		t.Fatalf("Expected p50 to be the max, got %f", q)
+	}
+}
+
+func TestMetrics_Stats(t *testing.T) {
+	m := NewMetrics()
+	seen := []time.Time{time.Now().Add(-20 * time.Millisecond), time.Now()}
+	m.RecordBatch(BatchMetrics{Writes: 2, Bytes: 100, WireBytes: 40, Duration: 10 * time.Millisecond}, seen, nil)
+	m.RecordBatch(BatchMetrics{Deletes: 1}, nil, errors.New("connection refused"))
+	m.SetQueueDepth("/app", 3)
+	m.SetQueueDepth("/lib", 2)
+
+	s := m.Stats()
+	if s.Files != 3 || s.Batches != 2 || s.Bytes != 100 || s.WireBytes != 40 {
+		t.Fatalf("Expected batch totals to be recorded, got %+v", s)
+	}
+	if s.Errors != 1 || s.LastError != "connection refused" {
+		t.Fatalf("Expected error to be recorded, got %d '%s'", s.Errors, s.LastError)
+	}
+	if s.QueueDepth != 5 {
+		t.Fatalf("Expected total queue depth of 5, got %d", s.QueueDepth)
+	}
+	if s.FileLatency.Count != 2 || s.BatchLatency.Count != 2 {
+		t.Fatalf("Expected latencies to be observed, got %d files and %d batches", s.FileLatency.Count, s.BatchLatency.Count)
+	}
+
+	// The snapshot must not change as more is recorded
+	m.SetQueueDepth("/app", 0)
+	if s.Queues["/app"] != 3 {
+		t.Fatalf("Expected stats to be a copy, got queue depth %d", s.Queues["/app"])
+	}
+
+	var nilMetrics *Metrics
+	nilMetrics.RecordBatch(BatchMetrics{}, nil, nil)
+	nilMetrics.SetQueueDepth("/app", 1)
+	nilMetrics.RecordError(errors.New("connection refused"))
+	if s := nilMetrics.Stats(); s.Files != 0 || s.Errors != 0 || s.String() == "" {
+		t.Fatalf("Expected empty stats, got %v", s)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.RecordBatch(BatchMetrics{Writes: 1, Bytes: 10}, nil, nil)
+	done := make(chan struct{})
+	defer close(done)
+
+	addr, err := ServeMetrics("127.0.0.1:0", m.Stats, done)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	res, err := http.Get(fmt.Sprintf("http://%s/stats", addr))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	var s Stats
+	if err := json.NewDecoder(res.Body).Decode(&s); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Files != 1 || s.Bytes != 10 {
+		t.Fatalf("Expected served stats to match, got %+v", s)
+	}
+}
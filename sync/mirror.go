@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"regexp"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/mefellows/parity/certs"
 	"github.com/mefellows/parity/log"
 	"github.com/mefellows/parity/parity"
 	"github.com/mefellows/plugo/plugo"
@@ -16,17 +20,41 @@ import (
 	_ "github.com/mefellows/mirror/filesystem/remote"
 	mutils "github.com/mefellows/mirror/filesystem/utils"
 	pki "github.com/mefellows/mirror/pki"
-	sync "github.com/mefellows/mirror/sync"
 	"github.com/mefellows/parity/utils"
 )
 
 type Mirror struct {
-	Dest         string
-	Src          string
-	Filters      []string
-	Exclude      []string
-	Verbose      bool
-	pluginConfig *parity.PluginConfig
+	Dest           string
+	Src            string
+	Filters        []string
+	Exclude        []string
+	Include        []string `mapstructure:"include"`
+	GitIgnore      bool     `mapstructure:"gitignore"`
+	Verbose        bool
+	Mappings       []Mapping           `mapstructure:"mappings"`
+	Bidirectional  []BidirectionalPath `mapstructure:"bidirectional"`
+	ConflictLog    string              `default:".parity/conflicts.log" mapstructure:"conflict_log"`
+	PollInterval   int                 `default:"2" mapstructure:"poll_interval"`
+	Debounce       int                 `default:"100" mapstructure:"debounce"`
+	Compression    string              `default:"gzip" mapstructure:"compression"`
+	SkipVerify     bool                `mapstructure:"skip_verify"`
+	VerifyInterval int                 `mapstructure:"verify_interval"`
+	AutoRepair     bool                `mapstructure:"auto_repair"`
+	StatsAddress   string              `default:"127.0.0.1:8124" mapstructure:"stats_address"`
+	pluginConfig   *parity.PluginConfig
+	done           chan struct{}
+	events         *EventStream
+	metrics        *Metrics
+	filter         *Filter
+	native         bool
+}
+
+// Mapping syncs a directory on the host to an explicit location on the
+// Docker host, instead of the identical path
+type Mapping struct {
+	Local   string   `mapstructure:"local"`
+	Remote  string   `mapstructure:"remote"`
+	Exclude []string `mapstructure:"exclude"`
 }
 
 func init() {
@@ -40,79 +68,527 @@ func (p *Mirror) Name() string {
 }
 
 func (p *Mirror) Sync() error {
+	return p.SyncWithOptions(parity.SyncOptions{Watch: true})
+}
+
+// SyncWithOptions performs the initial sync of the configured volumes (or
+// the given paths), and watches them for changes if requested
+func (p *Mirror) SyncWithOptions(opts parity.SyncOptions) error {
 	log.Stage("Synchronising source/dest folders")
-	pkiMgr, err := pki.New()
-	pkiMgr.Config.Insecure = true
+	if p.native {
+		log.Step("Docker is running natively, volumes are bind mounted directly and no sync is required")
+		return nil
+	}
+	if err := p.setupTLS(); err != nil {
+		return err
+	}
+
+	// Removing shared folders
+	if p.pluginConfig.Docker.CheckSharedFolders() {
+		p.pluginConfig.Docker.UnmountSharedFolders()
+	}
+
+	mappings := p.mappings()
+	if len(opts.Paths) > 0 {
+		var err error
+		if mappings, err = pathMappings(opts.Paths, mappings); err != nil {
+			return err
+		}
+	}
+
+	// Sync and watch all volumes
+	var base *baseline
+	if opts.Watch {
+		base = p.newBaseline(mappings)
+	}
+	var syncErr error
+	checked := false
+	for _, m := range mappings {
+		filter, remote, err := p.connect(m)
+		if err != nil {
+			log.Error("Unable to sync '%s': %s", m.Local, err.Error())
+			syncErr = err
+			continue
+		}
+		if !checked {
+			if err := checkProtocol(remote); err != nil {
+				log.Warn("%s", err.Error())
+			}
+			checked = true
+		}
+		t := newTransport(remote, p.Compression != "none")
+		t.baseline = base
+
+		log.Step("Syncing contents of '%s' -> '%s'", m.Local, p.remoteURL(m.Remote))
+		metrics, err := initialSync(m.Local, m.Remote, filter, t, opts.Progress)
+		if err != nil {
+			log.Error("Error during initial file sync: %v", err)
+			syncErr = err
+		} else {
+			log.Debug("Initial sync of '%s': %s", m.Local, metrics)
+		}
+
+		if !p.SkipVerify {
+			log.Step("Verifying contents of '%s'", p.remoteURL(m.Remote))
+			p.check(m, filter, remote, t)
+		}
+		if !opts.Watch {
+			remote.Close()
+			continue
+		}
+		go closeOnDone(remote, p.done)
+		if p.VerifyInterval > 0 {
+			go p.watchDrift(m, filter, remote, t)
+		}
+
+		log.Step("Monitoring '%s' for changes", m.Local)
+		w := &watcher{
+			src:       m.Local,
+			dest:      m.Remote,
+			filter:    filter,
+			debounce:  time.Duration(p.Debounce) * time.Millisecond,
+			transport: t,
+			events:    p.events,
+			metrics:   p.metrics,
+		}
+		go w.Watch(p.done)
+	}
+	if !opts.Watch {
+		return syncErr
+	}
+	go p.logEvents(p.events.Subscribe())
+	if p.StatsAddress != "off" {
+		if _, err := ServeMetrics(p.StatsAddress, p.Stats, p.done); err != nil {
+			log.Warn("Unable to serve sync metrics on %s: %s", p.StatsAddress, err.Error())
+		}
+	}
+
+	// Copy changes made inside the Docker host back for two-way paths
+	p.watchRemote(mappings, base)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, os.Kill)
+
+	<-sigChan
+	log.Debug("Interrupt received, shutting down")
+
+	return nil
+}
 
+// Verify compares the contents of each synced directory with the Docker
+// host, reporting (and optionally repairing) any drift. It returns the
+// number of files that differ.
+func (p *Mirror) Verify(fix bool) (int, error) {
+	if p.native {
+		p.pluginConfig.Ui.Output("Docker is running natively, volumes are bind mounted directly and cannot drift")
+		return 0, nil
+	}
+	if err := p.setupTLS(); err != nil {
+		return 0, err
+	}
+
+	drift := 0
+	for _, m := range p.mappings() {
+		n, err := p.verifyMapping(m, fix)
+		drift += n
+		if err != nil {
+			return drift, err
+		}
+	}
+	return drift, nil
+}
+
+// verifyMapping reports (and optionally repairs) the drift of a single
+// mapping, returning the number of files that differ
+func (p *Mirror) verifyMapping(m Mapping, fix bool) (int, error) {
+	filter, remote, err := p.connect(m)
 	if err != nil {
-		p.pluginConfig.Ui.Error(fmt.Sprintf("Unable to setup public key infrastructure: %s", err.Error()))
+		return 0, err
 	}
+	defer remote.Close()
 
-	Config, err := pkiMgr.GetClientTLSConfig()
+	report, err := p.verify(m, filter, remote)
 	if err != nil {
-		p.pluginConfig.Ui.Error(fmt.Sprintf("%v", err))
+		return 0, err
 	}
+	p.pluginConfig.Ui.Output(report.String())
 
-	// Removing shared folders
-	if utils.CheckSharedFolders() {
-		utils.UnmountSharedFolders()
+	if fix && len(report.Drift) > 0 {
+		metrics, err := repair(report, newTransport(remote, p.Compression != "none"), true)
+		if err != nil {
+			return len(report.Drift), err
+		}
+		p.pluginConfig.Ui.Output(fmt.Sprintf("Repaired '%s': %s", m.Remote, metrics))
 	}
+	return len(report.Drift), nil
+}
 
-	// Read volumes for share/watching
-	var volumes []string
+// verify checks a single mapping, ignoring files that only exist on the
+// Docker host within bidirectional paths (they will be copied back)
+func (p *Mirror) verify(m Mapping, filter *Filter, remote *remoteFileSystem) (*DriftReport, error) {
+	local, err := mutils.GetFileSystemFromFile(m.Local)
+	if err != nil {
+		return nil, err
+	}
+	report, err := verify(local, remote, m.Local, m.Remote, filter)
+	if err != nil {
+		return nil, err
+	}
 
-	// Exclude non-local volumes (e.g. might want to mount a dir on the VM guest)
-	for _, v := range utils.ReadComposeVolumes() {
-		if _, err := os.Stat(v); err == nil {
-			volumes = append(volumes, v)
+	dir, _ := os.Getwd()
+	var drift []Drift
+	for _, d := range report.Drift {
+		bidirectional := false
+		for _, b := range p.Bidirectional {
+			path := b.Path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			if _, ok := within(path, m.Local+d.Path); ok {
+				bidirectional = true
+			}
+		}
+		if d.Kind != DriftExtra || !bidirectional {
+			drift = append(drift, d)
 		}
 	}
-	// Add PWD if nothing in compose
+	report.Drift = drift
+	return report, nil
+}
+
+// check verifies a mapping, reporting any drift found. Missing and
+// modified files are only repaired if auto_repair is enabled, and files that
+// only exist on the Docker host (e.g. written by containers) are never
+// deleted, as they may not be recoverable.
+func (p *Mirror) check(m Mapping, filter *Filter, remote *remoteFileSystem, t *transport) {
+	report, err := p.verify(m, filter, remote)
+	if err != nil {
+		log.Error("Unable to verify '%s': %s", m.Remote, err.Error())
+		return
+	}
+	if len(report.Drift) == 0 {
+		log.Debug("%s", report.String())
+		return
+	}
+
+	log.Warn("%s", report.String())
+	if extra := report.extra(); extra > 0 {
+		log.Warn("%d file(s) only exist on the Docker host and were left in place, run 'parity sync --verify --repair' to delete them", extra)
+	}
+	if !p.AutoRepair {
+		if len(report.Drift) > report.extra() {
+			log.Warn("Run 'parity sync --verify --repair' to repair '%s', or set 'auto_repair' for the mirror sync plugin", m.Remote)
+		}
+		return
+	}
+	metrics, err := repair(report, t, false)
+	if err != nil {
+		log.Error("Unable to repair '%s': %s", m.Remote, err.Error())
+		return
+	}
+	log.Info("Repaired '%s': %s", m.Remote, metrics)
+}
+
+// watchDrift periodically verifies a mapping until the plugin is torn down
+func (p *Mirror) watchDrift(m Mapping, filter *Filter, remote *remoteFileSystem, t *transport) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(time.Duration(p.VerifyInterval) * time.Second):
+			p.check(m, filter, remote, t)
+		}
+	}
+}
+
+// closeOnDone closes the connection to the Docker host once the plugin
+// is torn down
+func closeOnDone(remote *remoteFileSystem, done <-chan struct{}) {
+	<-done
+	remote.Close()
+}
+
+// setupTLS configures the mirror client to verify the daemon's certificate
+// and present Parity's client certificate
+func (p *Mirror) setupTLS() error {
+	config, err := certs.New().ClientTLSConfig()
+	if err != nil {
+		return fmt.Errorf("Unable to setup public key infrastructure: %s", err.Error())
+	}
+	pki.MirrorConfig.SetClientTLSConfig(config)
+	return nil
+}
+
+// connect returns the filter and remote file system for a mapping
+func (p *Mirror) connect(m Mapping) (*Filter, *remoteFileSystem, error) {
+	filter, err := p.mappingFilter(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	remote, err := newRemoteFileSystem(p.remoteURL(m.Remote))
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, remote.(*remoteFileSystem), nil
+}
+
+// Events returns the stream of sync events for this plugin
+func (m *Mirror) Events() *EventStream {
+	return m.events
+}
+
+// Stats returns the current sync metrics for this plugin
+func (m *Mirror) Stats() Stats {
+	s := m.metrics.Stats()
+	s.DroppedEvents = m.events.Dropped()
+	return s
+}
+
+// logEvents logs the metrics of each batch sent to the Docker host
+func (m *Mirror) logEvents(events <-chan Event) {
+	for e := range events {
+		switch e.Type {
+		case ErrorEvent:
+			log.Debug("Failed to sync batch from '%s': %s", e.Path, e.Err)
+		case BatchEvent:
+			if m.Verbose {
+				log.Info("Synced '%s': %s", e.Path, e.Batch)
+			} else {
+				log.Debug("Synced '%s': %s", e.Path, e.Batch)
+			}
+		}
+	}
+}
+
+// bidirectionalPath returns the location of a two-way synced path on the
+// host and on the Docker host, if it's within one of the mappings
+func bidirectionalPath(b BidirectionalPath, mappings []Mapping) (string, string, bool) {
+	path := b.Path
+	if !filepath.IsAbs(path) {
+		dir, _ := os.Getwd()
+		path = filepath.Join(dir, path)
+	}
+	path = mutils.LinuxPath(path)
+	remotePath, ok := mapPath(path, mappings)
+	return path, remotePath, ok
+}
+
+// newBaseline returns a baseline that records the files sent to each
+// two-way synced path on the Docker host
+func (m *Mirror) newBaseline(mappings []Mapping) *baseline {
+	var roots []string
+	for _, b := range m.Bidirectional {
+		if _, remotePath, ok := bidirectionalPath(b, mappings); ok {
+			roots = append(roots, remotePath)
+		}
+	}
+	return newBaseline(roots...)
+}
+
+// watchRemote starts a two-way sync for each configured bidirectional path
+func (m *Mirror) watchRemote(mappings []Mapping, base *baseline) {
 	dir, _ := os.Getwd()
-	if len(volumes) == 0 {
-		volumes = append(volumes, mutils.LinuxPath(dir))
+	conflicts := &conflictLog{path: m.ConflictLog}
+	if conflicts.path != "" && !filepath.IsAbs(conflicts.path) {
+		conflicts.path = filepath.Join(dir, conflicts.path)
 	}
 
-	pki.MirrorConfig.ClientTlsConfig = Config
-	excludes := make([]regexp.Regexp, len(p.Exclude))
-	for i, v := range p.Exclude {
-		r, err := regexp.CompilePOSIX(v)
-		if err == nil {
-			excludes[i] = *r
+	for _, b := range m.Bidirectional {
+		path, remotePath, ok := bidirectionalPath(b, mappings)
+		if !ok {
+			log.Warn("Bidirectional path '%s' is not within a synced volume, skipping", b.Path)
+			continue
+		}
+
+		local, err := mutils.GetFileSystemFromFile(path)
+		if err != nil {
+			log.Error("Unable to setup two-way sync for '%s': %s", path, err.Error())
+			continue
+		}
+		remote, err := mutils.GetFileSystemFromFile(m.remoteURL(remotePath))
+		if err != nil {
+			log.Error("Unable to setup two-way sync for '%s': %s", path, err.Error())
+			continue
+		}
+
+		log.Step("Monitoring '%s' on Docker host for changes (%s)", path, b.Policy)
+		filter, err := m.filter.WithExcludes(b.Exclude)
+		if err != nil {
+			log.Error("Unable to setup two-way sync for '%s': %s", path, err.Error())
+			closeFileSystem(remote)
+			continue
+		}
+		if m.GitIgnore {
+			if filter, err = filter.WithGitIgnore(path); err != nil {
+				log.Error("Unable to read ignore file in '%s': %s", path, err.Error())
+				closeFileSystem(remote)
+				continue
+			}
+		}
+		r := newReconciler(local, remote, path, remotePath, b.Policy, filter, conflicts, base)
+		go func() {
+			r.Watch(time.Duration(m.PollInterval)*time.Second, m.done)
+			closeFileSystem(r.remote)
+		}()
+	}
+}
+
+// remoteURL returns the location of path on the Docker host's mirror daemon
+func (m *Mirror) remoteURL(path string) string {
+	return fmt.Sprintf("parity://%s%s", m.pluginConfig.Docker.MirrorAddress(), path)
+}
+
+// mapPath returns the location of path on the Docker host, if it is
+// one of, or is nested in, the given mappings. As with
+// PluginConfig.RemotePath, the most specific mapping wins.
+func mapPath(path string, mappings []Mapping) (string, bool) {
+	remote := ""
+	longest := -1
+	for _, m := range mappings {
+		rel, ok := within(m.Local, path)
+		if !ok || len(filepath.Clean(m.Local)) <= longest {
+			continue
+		}
+		longest = len(filepath.Clean(m.Local))
+		if rel == "." {
+			remote = m.Remote
 		} else {
-			log.Error("Error parsing Regex:", err.Error())
+			remote = strings.TrimSuffix(m.Remote, "/") + "/" + mutils.LinuxPath(rel)
 		}
 	}
+	return remote, longest >= 0
+}
 
-	options := &sync.Options{Exclude: excludes, Verbose: p.Verbose}
+// within returns the path relative to dir, if path is dir or nested in it
+func within(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
 
-	// Sync and watch all volumes
-	for _, v := range volumes {
-		log.Step("Syncing contents of '%s' -> '%s'", v, fmt.Sprintf("mirror://%s%s", utils.MirrorHost(), v))
-		err = sync.Sync(v, fmt.Sprintf("mirror://%s%s", utils.MirrorHost(), v), options)
+// pathMappings returns mappings for the given local directories, using the
+// location of any configured mapping that contains them
+func pathMappings(paths []string, mappings []Mapping) ([]Mapping, error) {
+	var res []Mapping
+	for _, p := range paths {
+		path, err := filepath.Abs(p)
 		if err != nil {
-			log.Error("Error during initial file sync: %v", err)
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("Unable to sync '%s': only directories can be synced, e.g. '%s'", p, filepath.Dir(p))
 		}
+		remote, ok := mapPath(path, mappings)
+		if !ok {
+			remote = mutils.LinuxPath(path)
+		}
+		res = append(res, Mapping{Local: path, Remote: remote})
+	}
+	return res, nil
+}
 
-		log.Step("Monitoring '%s' for changes", v)
-		go sync.Watch(v, fmt.Sprintf("mirror://%s%s", utils.MirrorHost(), v), options)
+// mappings returns the directories to sync. Unless mappings are
+// configured, each local compose volume is synced to the same path on
+// the Docker host, falling back to the current directory.
+func (m *Mirror) mappings() []Mapping {
+	if len(m.Mappings) > 0 {
+		var mappings []Mapping
+		for _, v := range m.Mappings {
+			if _, err := os.Stat(v.Local); err != nil {
+				log.Warn("Unable to sync '%s': %s", v.Local, err.Error())
+				continue
+			}
+			mappings = append(mappings, v)
+		}
+		return mappings
 	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, os.Kill)
+	var mappings []Mapping
 
-	<-sigChan
-	log.Debug("Interrupt received, shutting down")
+	// Exclude non-local volumes (e.g. might want to mount a dir on the VM guest)
+	for _, v := range utils.ReadComposeVolumes() {
+		if _, err := os.Stat(v); err == nil {
+			mappings = append(mappings, Mapping{Local: v, Remote: v})
+		}
+	}
+	// Add PWD if nothing in compose
+	if len(mappings) == 0 {
+		dir, _ := os.Getwd()
+		mappings = append(mappings, Mapping{Local: mutils.LinuxPath(dir), Remote: mutils.LinuxPath(dir)})
+	}
+	return mappings
+}
 
-	return nil
+// mappingFilter returns the filter for a synced directory, including any
+// mapping specific excludes and its .gitignore patterns if enabled
+func (m *Mirror) mappingFilter(mapping Mapping) (*Filter, error) {
+	filter, err := m.filter.WithExcludes(mapping.Exclude)
+	if err != nil || !m.GitIgnore {
+		return filter, err
+	}
+	return filter.WithGitIgnore(mapping.Local)
 }
 
 func (m *Mirror) Configure(c *parity.PluginConfig) {
 	log.Debug("Configuring mirror sync plugin")
 	m.pluginConfig = c
+	m.done = make(chan struct{})
+	m.events = &EventStream{}
+	m.metrics = NewMetrics()
+	m.native = c.Docker.Native
+
+	if m.Compression != "gzip" && m.Compression != "none" {
+		log.Fatalf("Invalid compression '%s' for mirror sync plugin. Must be one of 'gzip' or 'none'", m.Compression)
+	}
+
+	var err error
+	if m.filter, err = NewFilter(m.Exclude, m.Include); err != nil {
+		log.Fatalf("Invalid exclude/include for mirror sync plugin: %s", err.Error())
+	}
+
+	dir, _ := os.Getwd()
+	for i, v := range m.Mappings {
+		if v.Local == "" || v.Remote == "" {
+			log.Fatalf("Invalid mapping for mirror sync plugin: both 'local' and 'remote' paths are required")
+		}
+		if !strings.HasPrefix(v.Remote, "/") {
+			log.Fatalf("Invalid mapping '%s' for mirror sync plugin: remote path '%s' must be absolute", v.Local, v.Remote)
+		}
+		if _, err := m.filter.WithExcludes(v.Exclude); err != nil {
+			log.Fatalf("Invalid exclude for mapping '%s': %s", v.Local, err.Error())
+		}
+		if !filepath.IsAbs(v.Local) {
+			m.Mappings[i].Local = filepath.Join(dir, v.Local)
+		}
+		m.Mappings[i].Remote = path.Clean(v.Remote)
+
+		// Natively, containers mount the local directory itself
+		if !m.native {
+			c.Mappings = append(c.Mappings, parity.VolumeMapping{Local: m.Mappings[i].Local, Remote: m.Mappings[i].Remote})
+		}
+	}
+
+	for _, b := range m.Bidirectional {
+		if _, err := m.filter.WithExcludes(b.Exclude); err != nil {
+			log.Fatalf("Invalid exclude for bidirectional path '%s': %s", b.Path, err.Error())
+		}
+		if b.Policy != "" && b.Policy != HostWins && b.Policy != LastWriterWins {
+			log.Fatalf("Invalid conflict policy '%s' for bidirectional path '%s'. Must be one of '%s' or '%s'", b.Policy, b.Path, HostWins, LastWriterWins)
+		}
+	}
 }
 
 func (m *Mirror) Teardown() error {
 	log.Debug("Tearing down mirror sync plugin")
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
 	return nil
 }
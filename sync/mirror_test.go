@@ -1 +1,61 @@
 package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapPath(t *testing.T) {
+	mappings := []Mapping{
+		{Local: "/src/app", Remote: "/app"},
+		{Local: "/src/app/vendor", Remote: "/vendor"},
+		{Local: "/src/app/web", Remote: "/var/www/"},
+	}
+	cases := []struct {
+		path   string
+		remote string
+		ok     bool
+	}{
+		{"/src/app", "/app", true},
+		{"/src/app/lib/a.go", "/app/lib/a.go", true},
+		{"/src/app/vendor", "/vendor", true},
+		{"/src/app/vendor/pkg/b.go", "/vendor/pkg/b.go", true},
+		{"/src/app/vendorx/c.go", "/app/vendorx/c.go", true},
+		{"/src/app/web/index.html", "/var/www/index.html", true},
+		{"/src/other", "", false},
+	}
+	for _, c := range cases {
+		if remote, ok := mapPath(c.path, mappings); remote != c.remote || ok != c.ok {
+			t.Fatalf("Expected '%s' to map to '%s' (%v), got '%s' (%v)", c.path, c.remote, c.ok, remote, ok)
+		}
+	}
+
+	// The order of the mappings doesn't matter
+	reversed := []Mapping{mappings[2], mappings[1], mappings[0]}
+	if remote, _ := mapPath("/src/app/vendor/pkg/b.go", reversed); remote != "/vendor/pkg/b.go" {
+		t.Fatalf("Expected the most specific mapping to win, got '%s'", remote)
+	}
+}
+
+func TestPathMappings(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-mappings")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("app"), 0644)
+	mappings := []Mapping{{Local: dir, Remote: "/app"}}
+
+	res, err := pathMappings([]string{filepath.Join(dir, "lib")}, mappings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(res) != 1 || res[0].Remote != "/app/lib" {
+		t.Fatalf("Expected directory to be mapped, got %v", res)
+	}
+
+	// Files are rejected, rather than failing during the sync
+	if _, err := pathMappings([]string{filepath.Join(dir, "app.js")}, mappings); err == nil {
+		t.Fatalf("Expected file to be rejected")
+	}
+}
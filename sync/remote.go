@@ -0,0 +1,238 @@
+package sync
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	neturl "net/url"
+	"os"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/mefellows/mirror/filesystem"
+	"github.com/mefellows/mirror/filesystem/remote"
+	"github.com/mefellows/mirror/mirror"
+	"github.com/mefellows/mirror/pki"
+	"github.com/mefellows/parity/log"
+)
+
+// remoteFileSystem wraps mirror's remote file system, adding Parity's
+// extensions to the mirror daemon protocol (e.g. delta transfers).
+//
+// It is registered for the "parity" protocol, so that it can be used
+// with mirror's sync functions, e.g. parity://192.168.99.100:8123/foo
+type remoteFileSystem struct {
+	filesystem.FileSystem
+	client *rpc.Client
+
+	gosync.Mutex
+	delta bool
+	stats TransferStats
+}
+
+// TransferStats records how much data has been sent to the remote host
+type TransferStats struct {
+	Files      int64 // Files written
+	DeltaFiles int64 // Files written using a delta
+	Bytes      int64 // Bytes sent over the wire
+	FullBytes  int64 // Bytes that would have been sent without deltas
+}
+
+func init() {
+	mirror.FileSystemFactories.Register(newRemoteFileSystem, "parity")
+}
+
+// dialTimeout limits how long connecting to the mirror daemon may take
+const dialTimeout = 5 * time.Second
+
+// newRemoteFileSystem connects to the mirror daemon at url. Its single
+// connection serves both mirror's file system and Parity's extensions,
+// until Close.
+func newRemoteFileSystem(url string) (filesystem.FileSystem, error) {
+	uri, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	host := uri.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = fmt.Sprintf("%s:8123", host)
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", host, pki.MirrorConfig.ClientTlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to mirror daemon: %s", err.Error())
+	}
+
+	client := rpc.NewClient(conn)
+	return newRemoteFileSystemWithClient(&mirrorClient{client: client}, client), nil
+}
+
+func newRemoteFileSystemWithClient(fs filesystem.FileSystem, client *rpc.Client) *remoteFileSystem {
+	return &remoteFileSystem{FileSystem: fs, client: client, delta: true}
+}
+
+// Close closes the connection to the mirror daemon
+func (f *remoteFileSystem) Close() error {
+	return f.client.Close()
+}
+
+// closeFileSystem closes fs, if it holds a connection
+func closeFileSystem(fs filesystem.FileSystem) {
+	if c, ok := fs.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// mirrorClient is the client side of mirror's remote file system. Unlike
+// mirror's own client, it shares its connection with Parity's extensions,
+// and reports errors rather than exiting when it can't connect.
+type mirrorClient struct {
+	client *rpc.Client
+}
+
+func (c *mirrorClient) Dir(dir string) ([]filesystem.File, error) {
+	var res remote.DirResponse
+	if err := c.client.Call("RemoteFileSystem.RemoteDir", &remote.DirRequest{File: dir}, &res); err != nil {
+		return nil, err
+	}
+	return res.Files, res.Error
+}
+
+func (c *mirrorClient) Read(file filesystem.File) ([]byte, error) {
+	var res remote.ReadResponse
+	if err := c.client.Call("RemoteFileSystem.RemoteRead", &remote.ReadRequest{File: file}, &res); err != nil {
+		return nil, err
+	}
+	return res.Data, res.Error
+}
+
+func (c *mirrorClient) ReadFile(file string) (filesystem.File, error) {
+	var res remote.ReadFileResponse
+	if err := c.client.Call("RemoteFileSystem.RemoteReadFile", &remote.ReadFileRequest{File: file}, &res); err != nil {
+		return filesystem.File{}, err
+	}
+	return res.File, res.Error
+}
+
+func (c *mirrorClient) Write(file filesystem.File, data []byte, perm os.FileMode) error {
+	return c.client.Call("RemoteFileSystem.RemoteWrite", &remote.WriteRequest{File: file, Data: data, Perm: perm}, &remote.RemoteResponse{})
+}
+
+func (c *mirrorClient) FileTree(root filesystem.File) *filesystem.FileTree {
+	var res remote.FileTreeResponse
+	c.client.Call("RemoteFileSystem.RemoteFileTree", &remote.FileTreeRequest{File: root}, &res)
+	return res.FileTree
+}
+
+func (c *mirrorClient) FileMap(root filesystem.File) filesystem.FileMap {
+	var res remote.FileMapResponse
+	c.client.Call("RemoteFileSystem.RemoteFileMap", &remote.FileMapRequest{File: root}, &res)
+	return res.FileMap
+}
+
+func (c *mirrorClient) MkDir(file filesystem.File) error {
+	return c.client.Call("RemoteFileSystem.RemoteMkDir", &remote.MkDirRequest{File: file}, &remote.MkDirResponse{})
+}
+
+func (c *mirrorClient) Delete(file string) error {
+	var res remote.DeleteResponse
+	if err := c.client.Call("RemoteFileSystem.RemoteDelete", &remote.DeleteRequest{File: file}, &res); err != nil {
+		return err
+	}
+	return res.Error
+}
+
+// Write sends a file to the remote host, sending only the changed
+// blocks of large files that already exist remotely
+func (f *remoteFileSystem) Write(file filesystem.File, data []byte, perm os.FileMode) error {
+	_, err := f.send(file, data, perm)
+	return err
+}
+
+// send writes a file to the remote host, returning the number of bytes sent
+func (f *remoteFileSystem) send(file filesystem.File, data []byte, perm os.FileMode) (int, error) {
+	if len(data) >= deltaThreshold && f.deltaSupported() {
+		sent, err := f.writeDelta(file, data, perm)
+		if err == nil {
+			f.record(len(data), sent, true)
+			return sent, nil
+		}
+		log.Debug("Delta transfer of '%s' failed, sending whole file: %s", file.Path(), err.Error())
+	}
+
+	if err := f.FileSystem.Write(file, data, perm); err != nil {
+		return 0, err
+	}
+	f.record(len(data), len(data), false)
+	return len(data), nil
+}
+
+// Stats returns the transfer statistics for this file system
+func (f *remoteFileSystem) Stats() TransferStats {
+	f.Lock()
+	defer f.Unlock()
+	return f.stats
+}
+
+func (f *remoteFileSystem) writeDelta(file filesystem.File, data []byte, perm os.FileMode) (int, error) {
+	var sig SignatureResponse
+	req := &SignatureRequest{Path: file.Path(), BlockSize: blockSizeFor(len(data))}
+	if err := f.call("DeltaService.Signature", req, &sig); err != nil {
+		return 0, err
+	}
+
+	ops := ComputeDelta(sig.Signature, data)
+	sent := DeltaSize(ops)
+	if sent >= len(data) {
+		return 0, fmt.Errorf("delta (%d bytes) is no smaller than the file", sent)
+	}
+
+	patch := &PatchRequest{
+		Path:      file.Path(),
+		BlockSize: sig.Signature.BlockSize,
+		Ops:       ops,
+		Perm:      perm,
+		Checksum:  hash(data),
+	}
+	log.Debug("Sending delta for '%s': %d of %d bytes", file.Path(), sent, len(data))
+	return sent, f.call("DeltaService.Patch", patch, &PatchResponse{})
+}
+
+// call invokes a Parity protocol extension on the daemon, disabling
+// delta transfers if the daemon doesn't support them
+func (f *remoteFileSystem) call(method string, args interface{}, reply interface{}) error {
+	err := f.client.Call(method, args, reply)
+	if isUnsupported(err) {
+		log.Debug("Mirror daemon does not support delta transfers, falling back to full copies")
+		f.Lock()
+		f.delta = false
+		f.Unlock()
+	}
+	return err
+}
+
+// isUnsupported returns true if err indicates the daemon does not
+// provide the requested RPC service
+func isUnsupported(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't find")
+}
+
+func (f *remoteFileSystem) deltaSupported() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.delta
+}
+
+func (f *remoteFileSystem) record(size, sent int, delta bool) {
+	f.Lock()
+	defer f.Unlock()
+	f.stats.Files++
+	f.stats.Bytes += int64(sent)
+	f.stats.FullBytes += int64(size)
+	if delta {
+		f.stats.DeltaFiles++
+	}
+}
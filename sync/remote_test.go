@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/mirror/filesystem"
+	"github.com/mefellows/mirror/filesystem/fs"
+)
+
+// setupRemoteFileSystem creates a remoteFileSystem connected to an
+// in-process RPC server providing the given services
+func setupRemoteFileSystem(t *testing.T, services ...interface{}) (*remoteFileSystem, string, func()) {
+	dir, err := ioutil.TempDir("", "parity-remote")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+
+	server := rpc.NewServer()
+	for _, s := range services {
+		server.Register(s)
+	}
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	stdFs, _ := fs.NewStdFileSystem(dir)
+	f := newRemoteFileSystemWithClient(stdFs, rpc.NewClient(clientConn))
+
+	return f, dir, func() {
+		clientConn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func writeFile(t *testing.T, f filesystem.FileSystem, path string, data []byte) {
+	file := filesystem.File{FileName: filepath.Base(path), FilePath: path, FileMode: 0644}
+	if err := f.Write(file, data, 0644); err != nil {
+		t.Fatalf("Unexpected error writing '%s': %s", path, err.Error())
+	}
+}
+
+func TestRemoteFileSystem_DeltaWrite(t *testing.T) {
+	f, dir, cleanup := setupRemoteFileSystem(t, &DeltaService{})
+	defer cleanup()
+
+	path := filepath.Join(dir, "bundle.js")
+	data := randomBytes(512 * 1024)
+	writeFile(t, f, path, data)
+
+	data[1000] ^= 0xff
+	writeFile(t, f, path, data)
+
+	res, _ := ioutil.ReadFile(path)
+	if !bytes.Equal(res, data) {
+		t.Fatalf("Expected remote file to match after delta write")
+	}
+
+	stats := f.Stats()
+	if stats.Files != 2 || stats.DeltaFiles != 1 {
+		t.Fatalf("Expected 2 files with 1 delta, got %d files with %d deltas", stats.Files, stats.DeltaFiles)
+	}
+	if stats.Bytes >= stats.FullBytes*3/4 {
+		t.Fatalf("Expected delta to reduce bytes sent, sent %d of %d", stats.Bytes, stats.FullBytes)
+	}
+}
+
+func TestRemoteFileSystem_FallbackWithoutDeltaSupport(t *testing.T) {
+	f, dir, cleanup := setupRemoteFileSystem(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "db.sqlite3")
+	data := randomBytes(128 * 1024)
+	writeFile(t, f, path, data)
+	data[0] ^= 0xff
+	writeFile(t, f, path, data)
+
+	res, _ := ioutil.ReadFile(path)
+	if !bytes.Equal(res, data) {
+		t.Fatalf("Expected remote file to match after full write")
+	}
+	if f.deltaSupported() {
+		t.Fatalf("Expected delta transfers to be disabled")
+	}
+	if stats := f.Stats(); stats.DeltaFiles != 0 || stats.Bytes != stats.FullBytes {
+		t.Fatalf("Expected only full copies, got %+v", stats)
+	}
+}
+
+func TestCheckProtocol(t *testing.T) {
+	f, _, cleanup := setupRemoteFileSystem(t, &VersionService{Release: "1.0.0"})
+	defer cleanup()
+	if err := checkProtocol(f); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	// Daemons without Parity's extensions are still supported
+	legacy, _, cleanup := setupRemoteFileSystem(t)
+	defer cleanup()
+	if err := checkProtocol(legacy); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+// futureVersionService reports a newer protocol version
+type futureVersionService struct{}
+
+func (s *futureVersionService) Version(req *VersionRequest, res *VersionResponse) error {
+	res.Release = "2.0.0"
+	res.Protocol = ProtocolVersion + 1
+	return nil
+}
+
+func TestCheckProtocol_Mismatch(t *testing.T) {
+	server := rpc.NewServer()
+	server.RegisterName("VersionService", &futureVersionService{})
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	defer clientConn.Close()
+
+	f := newRemoteFileSystemWithClient(nil, rpc.NewClient(clientConn))
+	if err := checkProtocol(f); err == nil {
+		t.Fatalf("Expected protocol mismatch to be reported")
+	}
+}
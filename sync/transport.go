@@ -0,0 +1,361 @@
+package sync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/mefellows/mirror/filesystem"
+	"github.com/mefellows/mirror/filesystem/fs"
+	"github.com/mefellows/mirror/filesystem/remote"
+	"github.com/mefellows/parity/log"
+)
+
+const (
+	// Maximum uncompressed payload of a single batch request
+	maxBatchBytes = 4 * 1024 * 1024
+
+	// Maximum number of requests in flight at once
+	maxInFlight = 16
+)
+
+// OpKind is the type of change in a batch
+type OpKind int
+
+const (
+	OpWrite OpKind = iota
+	OpDelete
+	OpMkDir
+)
+
+// BatchOp is a single change to apply on the remote host
+type BatchOp struct {
+	Kind OpKind
+	Path string
+	Data []byte
+	Perm os.FileMode
+}
+
+// BatchRequest carries a gob encoded, optionally gzipped, list of BatchOps
+type BatchRequest struct {
+	Compressed bool
+	Payload    []byte
+}
+
+// BatchResponse lists any operations that failed on the remote host
+type BatchResponse struct {
+	Errors map[string]string
+}
+
+// BatchMetrics describe a batch of changes sent to the remote host
+type BatchMetrics struct {
+	Writes    int
+	Deletes   int
+	Requests  int           // Round trips used to send the batch
+	Bytes     int64         // Uncompressed size of the changes
+	WireBytes int64         // Bytes actually sent
+	Duration  time.Duration // Time taken to send the batch
+}
+
+// Throughput returns the effective rate of the batch in bytes per second
+func (m BatchMetrics) Throughput() float64 {
+	if m.Duration <= 0 {
+		return 0
+	}
+	return float64(m.Bytes) / m.Duration.Seconds()
+}
+
+// add accumulates the metrics of another batch
+func (m *BatchMetrics) add(o BatchMetrics) {
+	m.Writes += o.Writes
+	m.Deletes += o.Deletes
+	m.Requests += o.Requests
+	m.Bytes += o.Bytes
+	m.WireBytes += o.WireBytes
+	m.Duration += o.Duration
+}
+
+func (m BatchMetrics) String() string {
+	return fmt.Sprintf("%d writes, %d deletes, %d bytes (%d sent) in %d requests, %s (%.0f bytes/s)",
+		m.Writes, m.Deletes, m.Bytes, m.WireBytes, m.Requests, m.Duration, m.Throughput())
+}
+
+// BatchService is the server side of the batch protocol, provided by
+// Parity's mirror daemon (see Daemon). Clients fall back to pipelining
+// individual mirror requests with other daemons.
+type BatchService struct{}
+
+// Apply decodes and applies a batch of changes on this host
+func (s *BatchService) Apply(req *BatchRequest, res *BatchResponse) error {
+	ops, err := decodeBatch(req)
+	if err != nil {
+		return err
+	}
+
+	fsys := fs.StdFileSystem{}
+	res.Errors = make(map[string]string)
+	for _, op := range ops {
+		var err error
+		switch op.Kind {
+		case OpDelete:
+			err = fsys.Delete(op.Path)
+		case OpMkDir:
+			err = fsys.MkDir(filesystem.File{FilePath: op.Path, FileMode: op.Perm})
+		default:
+			err = fsys.Write(filesystem.File{FilePath: op.Path, FileMode: op.Perm}, op.Data, op.Perm)
+		}
+		if err != nil {
+			res.Errors[op.Path] = err.Error()
+		}
+	}
+	return nil
+}
+
+func encodeBatch(ops []BatchOp, compress bool) (*BatchRequest, error) {
+	var buf bytes.Buffer
+	var err error
+	if compress {
+		gz := gzip.NewWriter(&buf)
+		err = gob.NewEncoder(gz).Encode(ops)
+		gz.Close()
+	} else {
+		err = gob.NewEncoder(&buf).Encode(ops)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BatchRequest{Compressed: compress, Payload: buf.Bytes()}, nil
+}
+
+func decodeBatch(req *BatchRequest) ([]BatchOp, error) {
+	var ops []BatchOp
+	data := req.Payload
+	if req.Compressed {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(gz); err != nil {
+			return nil, err
+		}
+	}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ops)
+	return ops, err
+}
+
+// transport sends batches of changes to the mirror daemon, using the
+// batch protocol where available and pipelined mirror requests otherwise
+type transport struct {
+	fs       *remoteFileSystem
+	compress bool
+	baseline *baseline
+
+	gosync.Mutex
+	batch bool
+}
+
+func newTransport(f *remoteFileSystem, compress bool) *transport {
+	return &transport{fs: f, compress: compress, batch: true}
+}
+
+// Send applies ops on the remote host. Deletes are applied before
+// any writes.
+func (t *transport) Send(ops []BatchOp) (BatchMetrics, error) {
+	start := time.Now()
+	metrics := BatchMetrics{}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Kind == OpDelete && ops[j].Kind != OpDelete
+	})
+
+	var small []BatchOp
+	var large []BatchOp
+	for _, op := range ops {
+		if op.Kind == OpDelete {
+			metrics.Deletes++
+		} else if op.Kind == OpWrite {
+			metrics.Writes++
+		}
+		metrics.Bytes += int64(len(op.Data))
+
+		// Large files go through the (delta capable) file system
+		if op.Kind == OpWrite && len(op.Data) >= deltaThreshold {
+			large = append(large, op)
+		} else {
+			small = append(small, op)
+		}
+	}
+
+	var err error
+	if t.batchSupported() {
+		err = t.sendBatches(small, &metrics)
+		if err != nil && !t.batchSupported() {
+			err = t.sendPipelined(small, &metrics)
+		}
+	} else {
+		err = t.sendPipelined(small, &metrics)
+	}
+	if err == nil {
+		err = t.sendLarge(large, &metrics)
+	}
+
+	metrics.Duration = time.Since(start)
+	return metrics, err
+}
+
+// sendBatches sends ops in chunks of up to maxBatchBytes. Chunks are sent
+// one after the other, so that ops on the same path are applied in order.
+func (t *transport) sendBatches(ops []BatchOp, metrics *BatchMetrics) error {
+	var chunks [][]BatchOp
+	var chunk []BatchOp
+	size := 0
+	for _, op := range ops {
+		if size+len(op.Data) > maxBatchBytes && len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+			chunk = nil
+			size = 0
+		}
+		chunk = append(chunk, op)
+		size += len(op.Data)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	var err error
+	for _, c := range chunks {
+		req, e := encodeBatch(c, t.compress)
+		if e != nil {
+			return e
+		}
+		metrics.Requests++
+		metrics.WireBytes += int64(len(req.Payload))
+
+		resp := &BatchResponse{}
+		if e := t.fs.client.Call("BatchService.Apply", req, resp); e != nil {
+			if isUnsupported(e) {
+				log.Debug("Mirror daemon does not support batches, falling back to pipelined requests")
+				t.Lock()
+				t.batch = false
+				t.Unlock()
+				return e
+			}
+			err = e
+			continue
+		}
+		for path, e := range resp.Errors {
+			log.Error("Error syncing '%s': %s", path, e)
+		}
+		for _, op := range c {
+			if _, failed := resp.Errors[op.Path]; !failed {
+				t.record(op)
+			}
+		}
+	}
+	return err
+}
+
+// sendPipelined sends each op as an individual mirror request, keeping
+// up to maxInFlight requests in flight. Deletes complete before writes start.
+func (t *transport) sendPipelined(ops []BatchOp, metrics *BatchMetrics) error {
+	var err error
+	var calls []*rpc.Call
+	var sent []BatchOp
+	wait := func() {
+		for i, call := range calls {
+			<-call.Done
+			if call.Error != nil {
+				err = call.Error
+			} else {
+				t.record(sent[i])
+			}
+		}
+		calls = nil
+		sent = nil
+	}
+
+	for i, op := range ops {
+		if i > 0 && op.Kind != OpDelete && ops[i-1].Kind == OpDelete {
+			wait()
+		}
+		if len(calls) >= maxInFlight {
+			wait()
+		}
+
+		file := filesystem.File{FilePath: op.Path, FileMode: op.Perm, FileSize: int64(len(op.Data))}
+		var call *rpc.Call
+		switch op.Kind {
+		case OpDelete:
+			call = t.fs.client.Go("RemoteFileSystem.RemoteDelete", &remote.DeleteRequest{File: op.Path}, &remote.DeleteResponse{}, nil)
+		case OpMkDir:
+			call = t.fs.client.Go("RemoteFileSystem.RemoteMkDir", &remote.MkDirRequest{File: file}, &remote.MkDirResponse{}, nil)
+		default:
+			call = t.fs.client.Go("RemoteFileSystem.RemoteWrite", &remote.WriteRequest{File: file, Data: op.Data, Perm: op.Perm}, &remote.RemoteResponse{}, nil)
+		}
+		calls = append(calls, call)
+		sent = append(sent, op)
+		metrics.Requests++
+		metrics.WireBytes += int64(len(op.Data))
+	}
+	wait()
+
+	return err
+}
+
+// sendLarge writes large files concurrently via the file system
+func (t *transport) sendLarge(ops []BatchOp, metrics *BatchMetrics) error {
+	var wg gosync.WaitGroup
+	var mutex gosync.Mutex
+	var err error
+	sem := make(chan struct{}, maxInFlight)
+
+	for _, op := range ops {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(op BatchOp) {
+			defer func() { <-sem; wg.Done() }()
+
+			file := filesystem.File{FilePath: op.Path, FileMode: op.Perm, FileSize: int64(len(op.Data))}
+			sent, e := t.fs.send(file, op.Data, op.Perm)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			metrics.Requests++
+			metrics.WireBytes += int64(sent)
+			if e != nil {
+				err = e
+			} else {
+				t.record(op)
+			}
+		}(op)
+	}
+	wg.Wait()
+
+	return err
+}
+
+// record updates the baseline of two-way synced files with an op that was
+// applied on the remote host
+func (t *transport) record(op BatchOp) {
+	switch op.Kind {
+	case OpWrite:
+		if t.baseline.tracks(op.Path) {
+			t.baseline.Set(op.Path, hash(op.Data))
+		}
+	case OpDelete:
+		t.baseline.Delete(op.Path)
+	}
+}
+
+func (t *transport) batchSupported() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.batch
+}
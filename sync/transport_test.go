@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/mirror/filesystem/remote"
+)
+
+func testOps(dir string) []BatchOp {
+	var ops []BatchOp
+	for i := 0; i < 100; i++ {
+		ops = append(ops, BatchOp{
+			Kind: OpWrite,
+			Path: filepath.Join(dir, fmt.Sprintf("src/file%d.js", i)),
+			Data: bytes.Repeat([]byte("console.log('parity');\n"), 50),
+			Perm: 0644,
+		})
+	}
+	ops = append(ops, BatchOp{Kind: OpDelete, Path: filepath.Join(dir, "old.js")})
+	return ops
+}
+
+func checkOps(t *testing.T, dir string) {
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("src/file%d.js", i))); err != nil {
+			t.Fatalf("Expected file%d.js to be written: %s", i, err.Error())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.js")); err == nil {
+		t.Fatalf("Expected old.js to be deleted")
+	}
+}
+
+func TestTransport_Batch(t *testing.T) {
+	f, dir, cleanup := setupRemoteFileSystem(t, &BatchService{})
+	defer cleanup()
+	ioutil.WriteFile(filepath.Join(dir, "old.js"), []byte("old"), 0644)
+
+	tr := newTransport(f, true)
+	tr.baseline = newBaseline(filepath.Join(dir, "src"))
+	metrics, err := tr.Send(testOps(dir))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	checkOps(t, dir)
+
+	file, _ := ioutil.ReadFile(filepath.Join(dir, "src/file0.js"))
+	if sum, _ := tr.baseline.Get(filepath.Join(dir, "src/file0.js")); sum != hash(file) {
+		t.Fatalf("Expected the hash of the files sent to be recorded")
+	}
+	if metrics.Writes != 100 || metrics.Deletes != 1 {
+		t.Fatalf("Expected 100 writes and 1 delete, got %d writes and %d deletes", metrics.Writes, metrics.Deletes)
+	}
+	if metrics.Requests != 1 {
+		t.Fatalf("Expected a single request, got %d", metrics.Requests)
+	}
+	if metrics.WireBytes >= metrics.Bytes/10 {
+		t.Fatalf("Expected payload to be compressed, sent %d of %d bytes", metrics.WireBytes, metrics.Bytes)
+	}
+}
+
+func TestTransport_BatchOrder(t *testing.T) {
+	f, dir, cleanup := setupRemoteFileSystem(t, &BatchService{})
+	defer cleanup()
+
+	// Enough versions of a file to span several batches
+	file := filepath.Join(dir, "app.js")
+	var ops []BatchOp
+	for i := 0; i < 4*maxBatchBytes/(deltaThreshold-1); i++ {
+		ops = append(ops, BatchOp{
+			Kind: OpWrite,
+			Path: file,
+			Data: bytes.Repeat([]byte(fmt.Sprintf("%08d", i)), (deltaThreshold-1)/8),
+			Perm: 0644,
+		})
+	}
+
+	tr := newTransport(f, true)
+	metrics, err := tr.Send(ops)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if metrics.Requests < 4 {
+		t.Fatalf("Expected several batches, got %d", metrics.Requests)
+	}
+	data, _ := ioutil.ReadFile(file)
+	if !bytes.Equal(data, ops[len(ops)-1].Data) {
+		t.Fatalf("Expected the last version of app.js to be written, got %.8s", data)
+	}
+}
+
+func TestTransport_FallbackToPipelined(t *testing.T) {
+	f, dir, cleanup := setupRemoteFileSystem(t, &remote.RemoteFileSystem{})
+	defer cleanup()
+	ioutil.WriteFile(filepath.Join(dir, "old.js"), []byte("old"), 0644)
+
+	tr := newTransport(f, true)
+	metrics, err := tr.Send(testOps(dir))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	checkOps(t, dir)
+
+	if tr.batchSupported() {
+		t.Fatalf("Expected batches to be disabled")
+	}
+	if metrics.Requests != 102 {
+		t.Fatalf("Expected 1 failed batch and 101 individual requests, got %d", metrics.Requests)
+	}
+}
+
+func TestBatch_EncodeDecode(t *testing.T) {
+	ops := testOps("/tmp")
+	for _, compress := range []bool{true, false} {
+		req, err := encodeBatch(ops, compress)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		res, err := decodeBatch(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if len(res) != len(ops) || res[0].Path != ops[0].Path || !bytes.Equal(res[0].Data, ops[0].Data) {
+			t.Fatalf("Expected decoded batch to match")
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package sync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mefellows/mirror/filesystem"
+	"github.com/mefellows/parity/log"
+)
+
+// Maximum number of files hashed in a single request
+const maxHashFiles = 500
+
+// DriftKind describes how a file on the Docker host differs from the host
+type DriftKind string
+
+const (
+	// DriftMissing files exist on the host but not on the Docker host
+	DriftMissing DriftKind = "missing"
+
+	// DriftModified files have different contents on the Docker host
+	DriftModified DriftKind = "modified"
+
+	// DriftExtra files only exist on the Docker host
+	DriftExtra DriftKind = "extra"
+)
+
+// Drift is a single file that differs between the host and the Docker host
+type Drift struct {
+	Path string
+	Kind DriftKind
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%-8s %s", d.Kind, d.Path)
+}
+
+// DriftReport is the result of verifying a synced directory
+type DriftReport struct {
+	Local   string
+	Remote  string
+	Checked int
+	Drift   []Drift
+}
+
+func (r *DriftReport) String() string {
+	if len(r.Drift) == 0 {
+		return fmt.Sprintf("'%s' is in sync with '%s' (%d files checked)", r.Local, r.Remote, r.Checked)
+	}
+	lines := []string{fmt.Sprintf("'%s' has drifted from '%s' (%d of %d files differ):", r.Local, r.Remote, len(r.Drift), r.Checked)}
+	for _, d := range r.Drift {
+		lines = append(lines, "  "+d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// extra returns the number of files that only exist on the Docker host
+func (r *DriftReport) extra() int {
+	n := 0
+	for _, d := range r.Drift {
+		if d.Kind == DriftExtra {
+			n++
+		}
+	}
+	return n
+}
+
+// HashRequest asks the remote host for the content hashes of files
+type HashRequest struct {
+	Paths []string
+}
+
+// HashResponse contains the sha256 of each file that could be read
+type HashResponse struct {
+	Hashes map[string]string
+}
+
+// HashService is the server side of the verification protocol, provided by
+// Parity's mirror daemon (see Daemon). With other daemons, every file is
+// downloaded to verify it.
+type HashService struct{}
+
+// Hashes computes the content hash of each requested file on this host
+func (s *HashService) Hashes(req *HashRequest, res *HashResponse) error {
+	res.Hashes = make(map[string]string)
+	for _, p := range req.Paths {
+		if data, err := ioutil.ReadFile(p); err == nil {
+			res.Hashes[p] = hash(data)
+		}
+	}
+	return nil
+}
+
+// verify compares the content of localRoot with remoteRoot, skipping
+// anything excluded by filter
+func verify(local, remote filesystem.FileSystem, localRoot, remoteRoot string, filter *Filter) (*DriftReport, error) {
+	report := &DriftReport{Local: localRoot, Remote: remoteRoot}
+	localMap, err := fileMap(local, localRoot)
+	if err != nil {
+		return nil, err
+	}
+	remoteMap, err := fileMap(remote, remoteRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	localFiles := files(localMap, filter)
+	remoteFiles := files(remoteMap, filter)
+	report.Checked = len(localFiles)
+
+	exists := func(left, right filesystem.File) bool {
+		return right.Path() != ""
+	}
+	missing, _ := filesystem.FileMapDiff(localFiles, remoteFiles, exists)
+	extra, _ := filesystem.FileMapDiff(remoteFiles, localFiles, exists)
+	report.Drift = append(report.Drift, drifts(localFiles, missing, DriftMissing)...)
+	report.Drift = append(report.Drift, drifts(remoteFiles, extra, DriftExtra)...)
+
+	// Compare the contents of files on both sides, skipping the
+	// (expensive) hash if the sizes already differ
+	var candidates []string
+	for path, f := range localFiles {
+		r, ok := remoteFiles[path]
+		if !ok {
+			continue
+		}
+		if f.Size() != r.Size() {
+			report.Drift = append(report.Drift, Drift{Path: path, Kind: DriftModified})
+			continue
+		}
+		candidates = append(candidates, path)
+	}
+	sort.Strings(candidates)
+
+	localHashes, err := fileHashes(local, localFiles, candidates)
+	if err != nil {
+		return nil, err
+	}
+	remoteHashes, err := fileHashes(remote, remoteFiles, candidates)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range candidates {
+		if localHashes[path] != remoteHashes[path] {
+			report.Drift = append(report.Drift, Drift{Path: path, Kind: DriftModified})
+		}
+	}
+
+	sort.Slice(report.Drift, func(i, j int) bool {
+		return report.Drift[i].Path < report.Drift[j].Path
+	})
+	return report, nil
+}
+
+// repair sends the changes required to resolve drift on the Docker host.
+// Files that only exist on the Docker host, e.g. written by containers, are
+// only deleted if deleteExtra is set.
+func repair(report *DriftReport, t *transport, deleteExtra bool) (BatchMetrics, error) {
+	var ops []BatchOp
+	for _, d := range report.Drift {
+		local := report.Local + d.Path
+		dest := report.Remote + d.Path
+		if d.Kind == DriftExtra {
+			if deleteExtra {
+				ops = append(ops, BatchOp{Kind: OpDelete, Path: dest})
+			}
+			continue
+		}
+		info, err := os.Stat(local)
+		if err != nil {
+			log.Error("Unable to read '%s': %s", local, err.Error())
+			continue
+		}
+		data, err := ioutil.ReadFile(local)
+		if err != nil {
+			log.Error("Unable to read '%s': %s", local, err.Error())
+			continue
+		}
+		ops = append(ops, BatchOp{Kind: OpWrite, Path: dest, Data: data, Perm: info.Mode()})
+	}
+	if len(ops) == 0 {
+		return BatchMetrics{}, nil
+	}
+	return t.Send(ops)
+}
+
+// files returns the regular files in a FileMap that aren't excluded
+func files(m filesystem.FileMap, filter *Filter) filesystem.FileMap {
+	res := filesystem.FileMap{}
+	for path, f := range m {
+		if path == "" || f.IsDir() || filter.Ignore(path, false) {
+			continue
+		}
+		res[path] = f
+	}
+	return res
+}
+
+// drifts converts the result of a FileMapDiff on m into Drift
+func drifts(m filesystem.FileMap, diff []filesystem.File, kind DriftKind) []Drift {
+	paths := make(map[string]bool)
+	for _, f := range diff {
+		paths[f.Path()] = true
+	}
+	var res []Drift
+	for path, f := range m {
+		if paths[f.Path()] {
+			res = append(res, Drift{Path: path, Kind: kind})
+		}
+	}
+	return res
+}
+
+// fileHashes returns the content hash of each path, asking the mirror
+// daemon to compute them where supported
+func fileHashes(fs filesystem.FileSystem, m filesystem.FileMap, paths []string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	if r, ok := fs.(*remoteFileSystem); ok {
+		for i := 0; i < len(paths); i += maxHashFiles {
+			end := i + maxHashFiles
+			if end > len(paths) {
+				end = len(paths)
+			}
+			req := &HashRequest{}
+			for _, p := range paths[i:end] {
+				req.Paths = append(req.Paths, m[p].Path())
+			}
+			res := &HashResponse{}
+			err := r.client.Call("HashService.Hashes", req, res)
+			if isUnsupported(err) {
+				log.Debug("Mirror daemon does not support hashing, downloading files to verify")
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			for _, p := range paths[i:end] {
+				hashes[p] = res.Hashes[m[p].Path()]
+			}
+		}
+		if len(hashes) == len(paths) {
+			return hashes, nil
+		}
+	}
+
+	for _, p := range paths {
+		if _, ok := hashes[p]; ok {
+			continue
+		}
+		data, err := fs.Read(m[p])
+		if err != nil {
+			return nil, err
+		}
+		hashes[p] = hash(data)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/mirror/filesystem/fs"
+)
+
+func setupDrift(t *testing.T, src, dest string) {
+	os.MkdirAll(filepath.Join(src, "app"), 0755)
+	os.MkdirAll(filepath.Join(dest, "app"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "app/same.rb"), []byte("same"), 0644)
+	ioutil.WriteFile(filepath.Join(dest, "app/same.rb"), []byte("same"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "app/changed.rb"), []byte("local"), 0644)
+	ioutil.WriteFile(filepath.Join(dest, "app/changed.rb"), []byte("stale"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "missing.rb"), []byte("missing"), 0644)
+	ioutil.WriteFile(filepath.Join(dest, "extra.rb"), []byte("extra"), 0644)
+	ioutil.WriteFile(filepath.Join(dest, "ignored.log"), []byte("log"), 0644)
+}
+
+func TestVerify_ReportsDrift(t *testing.T) {
+	for _, services := range [][]interface{}{{&HashService{}}, {}} {
+		f, dest, cleanup := setupRemoteFileSystem(t, services...)
+		src, _ := ioutil.TempDir("", "parity-verify")
+		setupDrift(t, src, dest)
+
+		local, _ := fs.NewStdFileSystem(src)
+		filter, _ := NewFilter([]string{"*.log"}, nil)
+		report, err := verify(local, f, src, dest, filter)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+
+		expected := []Drift{
+			{Path: "/app/changed.rb", Kind: DriftModified},
+			{Path: "/extra.rb", Kind: DriftExtra},
+			{Path: "/missing.rb", Kind: DriftMissing},
+		}
+		if len(report.Drift) != len(expected) {
+			t.Fatalf("Expected %d files to have drifted, got %v", len(expected), report.Drift)
+		}
+		for i, d := range expected {
+			if report.Drift[i] != d {
+				t.Fatalf("Expected drift '%s', got '%s'", d, report.Drift[i])
+			}
+		}
+		if report.Checked != 3 {
+			t.Fatalf("Expected 3 files to be checked, got %d", report.Checked)
+		}
+
+		cleanup()
+		os.RemoveAll(src)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	f, dest, cleanup := setupRemoteFileSystem(t, &BatchService{}, &HashService{})
+	defer cleanup()
+	src, _ := ioutil.TempDir("", "parity-verify")
+	defer os.RemoveAll(src)
+	setupDrift(t, src, dest)
+
+	local, _ := fs.NewStdFileSystem(src)
+	filter, _ := NewFilter([]string{"*.log"}, nil)
+	report, _ := verify(local, f, src, dest, filter)
+	if _, err := repair(report, newTransport(f, true), true); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	report, _ = verify(local, f, src, dest, filter)
+	if len(report.Drift) != 0 {
+		t.Fatalf("Expected no drift after repair, got %v", report.Drift)
+	}
+	if res := readString(t, filepath.Join(dest, "app/changed.rb")); res != "local" {
+		t.Fatalf("Expected modified file to be repaired, got '%s'", res)
+	}
+}
+
+func TestRepair_KeepsExtra(t *testing.T) {
+	f, dest, cleanup := setupRemoteFileSystem(t, &BatchService{}, &HashService{})
+	defer cleanup()
+	src, _ := ioutil.TempDir("", "parity-verify")
+	defer os.RemoveAll(src)
+	setupDrift(t, src, dest)
+
+	local, _ := fs.NewStdFileSystem(src)
+	filter, _ := NewFilter([]string{"*.log"}, nil)
+	report, _ := verify(local, f, src, dest, filter)
+	if _, err := repair(report, newTransport(f, true), false); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	report, _ = verify(local, f, src, dest, filter)
+	if len(report.Drift) != 1 || report.Drift[0].Kind != DriftExtra {
+		t.Fatalf("Expected only the extra file to remain, got %v", report.Drift)
+	}
+	if res := readString(t, filepath.Join(dest, "extra.rb")); res != "extra" {
+		t.Fatalf("Expected extra file to be kept, got '%s'", res)
+	}
+}
@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/rpc"
+	"time"
+
+	"github.com/mefellows/parity/certs"
+	"github.com/mefellows/parity/log"
+)
+
+// ProtocolVersion is the version of Parity's extensions to the mirror
+// daemon protocol (the delta, batch, hash and version services). It must
+// be increased whenever they change incompatibly.
+const ProtocolVersion = 1
+
+// VersionRequest asks the mirror daemon for its version
+type VersionRequest struct{}
+
+// VersionResponse contains the mirror daemon's release and protocol version
+type VersionResponse struct {
+	Release  string
+	Protocol int
+}
+
+// VersionService is the server side of version negotiation, provided by
+// Parity's mirror daemon (see Daemon). Other daemons are treated as protocol
+// version 0.
+type VersionService struct {
+	Release string
+}
+
+// Version returns this daemon's release and protocol version
+func (s *VersionService) Version(req *VersionRequest, res *VersionResponse) error {
+	res.Release = s.Release
+	res.Protocol = ProtocolVersion
+	return nil
+}
+
+// DaemonVersion connects to the mirror daemon at address using Parity's
+// certificates, and asks for its release and protocol version
+func DaemonVersion(address string) (*VersionResponse, error) {
+	config, err := certs.New().ClientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", address, config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to mirror daemon: %s", err.Error())
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+	return (&remoteFileSystem{client: client}).version()
+}
+
+// version asks the daemon for its release and protocol version
+func (f *remoteFileSystem) version() (*VersionResponse, error) {
+	res := &VersionResponse{}
+	err := f.client.Call("VersionService.Version", &VersionRequest{}, res)
+	if isUnsupported(err) {
+		return res, nil
+	}
+	return res, err
+}
+
+// checkProtocol warns if the daemon speaks a different version of the
+// protocol to this client
+func checkProtocol(remote *remoteFileSystem) error {
+	v, err := remote.version()
+	if err != nil {
+		return err
+	}
+	switch {
+	case v.Protocol == 0:
+		log.Info("Mirror daemon is not the one installed by Parity and lacks its protocol extensions, some features are unavailable. Run 'parity install' to replace it.")
+	case v.Protocol != ProtocolVersion:
+		return fmt.Errorf("Mirror daemon %s uses protocol version %d, but Parity uses version %d. Run 'parity install' to upgrade it.",
+			v.Release, v.Protocol, ProtocolVersion)
+	default:
+		log.Debug("Mirror daemon %s uses protocol version %d", v.Release, v.Protocol)
+	}
+	return nil
+}
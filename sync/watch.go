@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	mutils "github.com/mefellows/mirror/filesystem/utils"
+	"github.com/mefellows/parity/log"
+	"gopkg.in/fsnotify.v1"
+)
+
+// watcher monitors a local directory and sends changes to the remote
+// host in batches, coalescing all events within a debounce window.
+type watcher struct {
+	src       string
+	dest      string
+	filter    *Filter
+	debounce  time.Duration
+	transport *transport
+	events    *EventStream
+	metrics   *Metrics
+}
+
+// Watch monitors the source directory until done is closed
+func (w *watcher) Watch(done <-chan struct{}) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if err = w.addDir(fw, w.src, nil); err != nil {
+		return err
+	}
+
+	pending := make(map[string]time.Time)
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-done:
+			return nil
+		case event := <-fw.Events:
+			info, err := os.Stat(event.Name)
+			if w.ignore(event.Name, err == nil && info.IsDir()) {
+				continue
+			}
+			if _, ok := pending[event.Name]; !ok {
+				pending[event.Name] = time.Now()
+			}
+
+			// Watch new directories, including anything created in them
+			// before the watch was in place
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if err == nil && info.IsDir() {
+					w.addDir(fw, event.Name, pending)
+				}
+			}
+			w.metrics.SetQueueDepth(w.src, len(pending))
+			if flush == nil {
+				flush = time.After(w.debounce)
+			}
+		case err := <-fw.Errors:
+			log.Error("Watch error: %s", err.Error())
+			w.metrics.RecordError(err)
+		case <-flush:
+			flush = nil
+			w.send(pending)
+			pending = make(map[string]time.Time)
+			w.metrics.SetQueueDepth(w.src, 0)
+		}
+	}
+}
+
+// addDir watches dir and all directories beneath it. Any files found are
+// added to pending, if provided.
+func (w *watcher) addDir(fw *fsnotify.Watcher, dir string, pending map[string]time.Time) error {
+	return filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if w.ignore(path, f.IsDir()) {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := pending[path]; pending != nil && !ok {
+			pending[path] = time.Now()
+		}
+		if f.IsDir() {
+			return fw.Add(path)
+		}
+		return nil
+	})
+}
+
+// ignore returns true if the local path is excluded from the sync
+func (w *watcher) ignore(path string, isDir bool) bool {
+	return w.filter.Ignore(strings.TrimPrefix(mutils.LinuxPath(path), mutils.LinuxPath(w.src)), isDir)
+}
+
+// send sends the current state of all pending paths to the remote host
+func (w *watcher) send(pending map[string]time.Time) {
+	ops := w.batch(pending)
+	if len(ops) == 0 {
+		return
+	}
+
+	seen := make([]time.Time, 0, len(pending))
+	for _, t := range pending {
+		seen = append(seen, t)
+	}
+	metrics, err := w.transport.Send(ops)
+	w.metrics.RecordBatch(metrics, seen, err)
+	event := Event{Type: BatchEvent, Time: time.Now(), Path: w.src, Batch: metrics}
+	if err != nil {
+		log.Error("Error syncing changes to Docker host: %s", err.Error())
+		event.Type = ErrorEvent
+		event.Err = err
+	}
+	if w.events != nil {
+		w.events.Publish(event)
+	}
+}
+
+// batch converts a set of changed paths into operations for the remote host
+func (w *watcher) batch(pending map[string]time.Time) []BatchOp {
+	paths := make([]string, 0, len(pending))
+	for path := range pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var ops []BatchOp
+	for _, path := range paths {
+		dest := mutils.RelativeFilePath(w.src, w.dest, path)
+		info, err := os.Lstat(path)
+		switch {
+		case os.IsNotExist(err):
+			ops = append(ops, BatchOp{Kind: OpDelete, Path: dest})
+		case err != nil:
+			log.Error("Unable to read '%s': %s", path, err.Error())
+		case info.IsDir():
+			ops = append(ops, BatchOp{Kind: OpMkDir, Path: dest, Perm: info.Mode()})
+		default:
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Error("Unable to read '%s': %s", path, err.Error())
+				continue
+			}
+			ops = append(ops, BatchOp{Kind: OpWrite, Path: dest, Data: data, Perm: info.Mode()})
+		}
+	}
+	return ops
+}
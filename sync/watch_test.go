@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_CoalescesEvents(t *testing.T) {
+	f, dest, cleanup := setupRemoteFileSystem(t, &BatchService{})
+	defer cleanup()
+
+	src, _ := ioutil.TempDir("", "parity-watch")
+	defer os.RemoveAll(src)
+
+	filter, _ := NewFilter([]string{"*.log"}, nil)
+	events := &EventStream{}
+	sub := events.Subscribe()
+	w := &watcher{
+		src:       src,
+		dest:      dest,
+		filter:    filter,
+		debounce:  200 * time.Millisecond,
+		transport: newTransport(f, true),
+		events:    events,
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go w.Watch(done)
+	time.Sleep(100 * time.Millisecond)
+
+	os.MkdirAll(filepath.Join(src, "app/models"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "app/models/user.rb"), []byte("class User; end"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "Gemfile"), []byte("gem 'rails'"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "Gemfile"), []byte("gem 'rails', '5.0'"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "development.log"), []byte("log"), 0644)
+
+	select {
+	case e := <-sub:
+		if e.Type != BatchEvent {
+			t.Fatalf("Expected a batch event, got '%s': %v", e.Type, e.Err)
+		}
+		if e.Batch.Requests != 1 {
+			t.Fatalf("Expected changes to be sent in a single request, got %d", e.Batch.Requests)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a batch to be sent")
+	}
+
+	if res := readString(t, filepath.Join(dest, "Gemfile")); res != "gem 'rails', '5.0'" {
+		t.Fatalf("Expected latest Gemfile to be synced, got '%s'", res)
+	}
+	if res := readString(t, filepath.Join(dest, "app/models/user.rb")); res != "class User; end" {
+		t.Fatalf("Expected nested file to be synced, got '%s'", res)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "development.log")); err == nil {
+		t.Fatalf("Expected excluded file not to be synced")
+	}
+}
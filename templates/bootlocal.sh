@@ -2,10 +2,7 @@
 
 cd /var/lib/boot2docker/
 
-if [ ! -f "./mirror" ]; then
-  wget https://github.com/mefellows/mirror/releases/download/{{.Version}}/linux_amd64.zip
-  unzip linux_amd64.zip
-fi
-
-sudo cp -f ./mirror /usr/bin/mirror
+# Parity's linux_amd64 binary, which runs the mirror daemon, is uploaded by
+# 'parity install'
+sudo cp -f ./parity/parity /usr/bin/parity
 ./mirror-daemon.sh start
@@ -1,7 +1,7 @@
 #!/bin/sh
 #
 # /etc/init.d/mysystem
-# Subsystem file for "mirror" server
+# Subsystem file for the mirror server ('parity mirror-daemon')
 #
 # chkconfig: 2345 95 05	(1)
 # description: mirror server daemon
@@ -13,7 +13,10 @@
 
 NAME="mirror"
 : ${MIRROR_LOGFILE:=/var/log/mirror.log}
-: ${DAEMONOPTS:="--insecure"}
+: ${DAEMONOPTS:=""}
+# Certificates installed by 'parity install' / 'parity certs rotate'
+: ${MIRROR_HOME:=/var/lib/boot2docker/parity/mirror.d}
+export MIRROR_HOME
 PIDFILE=/var/run/mirror.pid
 
 # source function library
@@ -26,8 +29,10 @@ RETVAL=0
 
 start() {
 	echo -n "Starting $NAME: "
-	mirror daemon ${DAEMONOPTS} >> "${MIRROR_LOGFILE}" 2>&1 &
-	PID=$(ps -ef | grep mirror | grep daemon | awk -F" " '{print $2}')
+	parity mirror-daemon ${DAEMONOPTS} >> "${MIRROR_LOGFILE}" 2>&1 &
+	PID=$!
+	sleep 1
+	kill -0 "$PID" 2>/dev/null || PID=""
   if [ -z "$PID" ]; then
       printf "%s\n" "Fail"
   else
@@ -0,0 +1,447 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/mefellows/parity/config"
+)
+
+const (
+	defaultSSHUser    = "docker"
+	defaultSSHPort    = 22
+	defaultMirrorPort = 8123
+)
+
+// DockerEnvironment describes how to reach the Docker host: its API, the
+// SSH connection used to manage it and the mirror daemon running on it.
+//
+// It is resolved once, see ResolveDockerEnvironment, and shared with
+// plugins via the PluginConfig.
+type DockerEnvironment struct {
+	Endpoint   string // Docker API endpoint, e.g. tcp://192.168.99.100:2376
+	Host       string // Hostname or IP address of the Docker host
+	TLSVerify  bool   // Verify the Docker API using the certificates in CertPath
+	CertPath   string // Directory containing ca.pem, cert.pem and key.pem
+	Machine    string // Name of the Docker Machine, if any
+	SSHUser    string
+	SSHKey     string // Path to the private key used to SSH into the Docker host
+	SSHPort    int
+	MirrorPort int
+
+	// KnownHosts is the known_hosts file used to verify the Docker host's
+	// SSH key. Unless StrictHostKeys is set, unknown hosts are trusted (and
+	// added) on first use.
+	KnownHosts     string
+	StrictHostKeys bool
+
+	Native  bool   // Docker is running natively on this (Linux) host, without a VM
+	Context string // Name of the Docker context the endpoint was read from, if any
+
+	tunnel *sshTunnel
+	mutex  sync.Mutex
+}
+
+// ResolveDockerEnvironment works out how to reach the Docker host. In order
+// of precedence, it uses:
+//
+//  1. The 'host' settings in parity.yml
+//  2. The DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH variables
+//  3. The current Docker context
+//  4. The Docker Machine named by 'host.machine' or DOCKER_MACHINE_NAME
+//
+// If none of these are set, Docker is assumed to be running natively.
+func ResolveDockerEnvironment(host config.HostConfig) (*DockerEnvironment, error) {
+	return resolveDockerEnvironment(host, os.Getenv)
+}
+
+func resolveDockerEnvironment(host config.HostConfig, getenv func(string) string) (*DockerEnvironment, error) {
+	e := &DockerEnvironment{
+		SSHUser:    defaultSSHUser,
+		SSHPort:    defaultSSHPort,
+		MirrorPort: defaultMirrorPort,
+	}
+
+	e.Machine = host.Machine
+	if e.Machine == "" {
+		e.Machine = getenv("DOCKER_MACHINE_NAME")
+	}
+	if e.Machine != "" {
+		if err := e.loadMachine(filepath.Join(machineStorageDir(getenv), "machines", e.Machine), host.Machine != ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if host.Context != "" || getenv("DOCKER_HOST") == "" {
+		if err := e.loadContext(dockerConfigDir(getenv), host.Context, getenv); err != nil {
+			return nil, err
+		}
+	}
+	if host.Context == "" && getenv("DOCKER_HOST") != "" {
+		e.Endpoint = getenv("DOCKER_HOST")
+		e.TLSVerify = getenv("DOCKER_TLS_VERIFY") != ""
+		if path := getenv("DOCKER_CERT_PATH"); path != "" {
+			e.CertPath = path
+		}
+	}
+
+	if err := e.apply(host, getenv); err != nil {
+		return nil, err
+	}
+	if err := e.applyEndpoint(host, getenv); err != nil {
+		return nil, err
+	}
+	if e.KnownHosts == "" {
+		e.KnownHosts = filepath.Join(homeDir(getenv), ".parity", "known_hosts")
+	}
+	if e.SSHKey == "" && e.CertPath != "" {
+		e.SSHKey = filepath.Join(e.CertPath, "id_rsa")
+	}
+	e.Native = host.Address == "" && nativeDaemon(runtime.GOOS, e.Endpoint, fileExists)
+
+	return e, nil
+}
+
+// apply overrides the detected environment with the parity.yml settings
+func (e *DockerEnvironment) apply(host config.HostConfig, getenv func(string) string) error {
+	if host.Address != "" {
+		if strings.Contains(host.Address, "://") {
+			if _, err := url.Parse(host.Address); err != nil {
+				return fmt.Errorf("Invalid host address '%s': %s", host.Address, err.Error())
+			}
+			e.Endpoint = host.Address
+			e.Host = ""
+		} else {
+			e.Host = host.Address
+		}
+	}
+	if host.CertPath != "" {
+		e.CertPath = expandHome(host.CertPath, getenv)
+		e.TLSVerify = true
+	}
+	if host.SSHUser != "" {
+		e.SSHUser = host.SSHUser
+	}
+	if host.SSHKey != "" {
+		e.SSHKey = expandHome(host.SSHKey, getenv)
+	}
+	if host.SSHPort != 0 {
+		e.SSHPort = host.SSHPort
+	}
+	if host.MirrorPort != 0 {
+		e.MirrorPort = host.MirrorPort
+	}
+	if host.KnownHosts != "" {
+		e.KnownHosts = expandHome(host.KnownHosts, getenv)
+	}
+	e.StrictHostKeys = host.StrictHostKeys
+	return nil
+}
+
+// applyEndpoint fills in the Docker host's address (and for ssh:// endpoints,
+// the SSH settings) from the API endpoint, unless set in parity.yml
+func (e *DockerEnvironment) applyEndpoint(host config.HostConfig, getenv func(string) string) error {
+	if e.Endpoint == "" {
+		if e.Host == "" {
+			e.Host = "localhost"
+		}
+		return nil
+	}
+	u, err := url.Parse(e.Endpoint)
+	if err != nil {
+		return fmt.Errorf("Invalid Docker endpoint '%s': %s", e.Endpoint, err.Error())
+	}
+
+	switch u.Scheme {
+	case "unix", "npipe":
+		// The daemon is on this machine
+		if e.Host == "" {
+			e.Host = "localhost"
+		}
+	case "ssh":
+		if e.Host == "" {
+			e.Host = u.Hostname()
+		}
+		if u.User != nil && u.User.Username() != "" && host.SSHUser == "" {
+			e.SSHUser = u.User.Username()
+		}
+		if u.Port() != "" && host.SSHPort == 0 {
+			port, err := strconv.Atoi(u.Port())
+			if err != nil {
+				return fmt.Errorf("Invalid SSH port in Docker endpoint '%s'", e.Endpoint)
+			}
+			e.SSHPort = port
+		}
+		if e.SSHKey == "" && e.CertPath == "" {
+			e.SSHKey = filepath.Join(homeDir(getenv), ".ssh", "id_rsa")
+		}
+		e.TLSVerify = false
+	case "tcp", "http", "https":
+		if e.Host == "" {
+			e.Host = u.Hostname()
+		}
+	default:
+		return fmt.Errorf("Unsupported Docker endpoint '%s'. Must be one of tcp://, unix://, npipe:// or ssh://", e.Endpoint)
+	}
+	if e.Host == "" {
+		return fmt.Errorf("Invalid Docker endpoint '%s': no host", e.Endpoint)
+	}
+	return nil
+}
+
+// machineConfig is the subset of a Docker Machine's config.json used by Parity
+type machineConfig struct {
+	DriverName string
+	Driver     struct {
+		IPAddress  string
+		SSHUser    string
+		SSHPort    int
+		SSHKeyPath string
+	}
+}
+
+// loadMachine reads the connection details of a Docker Machine from its
+// storage directory. A missing machine is an error if required, i.e. named
+// in parity.yml, and otherwise ignored.
+func (e *DockerEnvironment) loadMachine(dir string, required bool) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		if required {
+			return fmt.Errorf("Docker Machine '%s' not found in %s. Check 'host.machine' in parity.yml, or run 'docker-machine ls'", e.Machine, filepath.Dir(dir))
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var m machineConfig
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("Unable to read Docker Machine '%s': %s", e.Machine, err.Error())
+	}
+
+	if m.Driver.IPAddress != "" {
+		e.Endpoint = fmt.Sprintf("tcp://%s:2376", m.Driver.IPAddress)
+		e.TLSVerify = true
+		e.CertPath = dir
+	}
+	if m.Driver.SSHUser != "" {
+		e.SSHUser = m.Driver.SSHUser
+	}
+	if m.Driver.SSHKeyPath != "" {
+		e.SSHKey = m.Driver.SSHKeyPath
+	}
+
+	// VirtualBox forwards a random port on localhost, whereas Parity
+	// connects to the VM's own address
+	if m.Driver.SSHPort != 0 && m.DriverName != "virtualbox" {
+		e.SSHPort = m.Driver.SSHPort
+	}
+	return nil
+}
+
+// contextMeta is the metadata stored for a Docker context
+type contextMeta struct {
+	Name      string
+	Endpoints map[string]struct {
+		Host          string
+		SkipTLSVerify bool
+	}
+}
+
+// loadContext reads the Docker API endpoint of a Docker context. If name
+// is empty, DOCKER_CONTEXT or the Docker CLI's current context is used.
+func (e *DockerEnvironment) loadContext(dir string, name string, getenv func(string) string) error {
+	if name == "" {
+		name = getenv("DOCKER_CONTEXT")
+	}
+	if name == "" {
+		var err error
+		if name, err = currentContext(dir); err != nil {
+			return err
+		}
+	}
+	if name == "" || name == "default" {
+		return nil
+	}
+
+	// Contexts are stored by the digest of their name
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return fmt.Errorf("Unable to read Docker context '%s': %s", name, err.Error())
+	}
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("Unable to read Docker context '%s': %s", name, err.Error())
+	}
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return fmt.Errorf("Docker context '%s' has no Docker endpoint", name)
+	}
+
+	e.Context = name
+	e.Endpoint = endpoint.Host
+	e.TLSVerify = false
+	tls := filepath.Join(dir, "contexts", "tls", id, "docker")
+	if fileExists(filepath.Join(tls, "ca.pem")) {
+		e.CertPath = tls
+		e.TLSVerify = !endpoint.SkipTLSVerify
+	}
+	return nil
+}
+
+// currentContext returns the Docker CLI's current context, if any
+func currentContext(dir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	var conf struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return "", fmt.Errorf("Unable to read Docker configuration: %s", err.Error())
+	}
+	return conf.CurrentContext, nil
+}
+
+// SSHAddress is the host:port of the Docker host's SSH server
+func (e *DockerEnvironment) SSHAddress() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.SSHPort))
+}
+
+// MirrorAddress is the host:port of the mirror daemon on the Docker host
+func (e *DockerEnvironment) MirrorAddress() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.MirrorPort))
+}
+
+// VMHost gets the IP address of this machine on the network shared with the
+// Docker host, i.e. the address containers can reach it on. When running
+// natively, this is the host's address on the Docker bridge network.
+func (e *DockerEnvironment) VMHost() (string, error) {
+	if e.Native {
+		return DockerBridgeGateway(e)
+	}
+	ip, _, err := FindNetwork(e.Host)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// APIEndpoint returns the address used to connect to the Docker API. For
+// ssh:// endpoints, this is a local tunnel to the daemon on the Docker host.
+func (e *DockerEnvironment) APIEndpoint() (string, error) {
+	if e.Endpoint == "" {
+		return "unix://" + defaultDockerSocket, nil
+	}
+	if !strings.HasPrefix(e.Endpoint, "ssh://") {
+		return e.Endpoint, nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.tunnel == nil {
+		tunnel, err := newSSHTunnel(e)
+		if err != nil {
+			return "", err
+		}
+		e.tunnel = tunnel
+	}
+	return "unix://" + e.tunnel.Addr(), nil
+}
+
+// Client creates a Docker API client for this environment
+func (e *DockerEnvironment) Client() (*dockerclient.Client, error) {
+	endpoint, err := e.APIEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	var client *dockerclient.Client
+	if e.TLSVerify {
+		client, err = dockerclient.NewTLSClient(endpoint,
+			filepath.Join(e.CertPath, "cert.pem"),
+			filepath.Join(e.CertPath, "key.pem"),
+			filepath.Join(e.CertPath, "ca.pem"))
+	} else {
+		client, err = dockerclient.NewClient(endpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.SkipServerVersionCheck = true
+	return client, nil
+}
+
+// Setenv exports this environment as DOCKER_HOST, DOCKER_TLS_VERIFY and
+// DOCKER_CERT_PATH, for libraries that only read the environment (e.g.
+// libcompose)
+func (e *DockerEnvironment) Setenv() error {
+	endpoint, err := e.APIEndpoint()
+	if err != nil {
+		return err
+	}
+	os.Setenv("DOCKER_HOST", endpoint)
+	if e.TLSVerify {
+		os.Setenv("DOCKER_TLS_VERIFY", "1")
+		os.Setenv("DOCKER_CERT_PATH", e.CertPath)
+	} else {
+		os.Unsetenv("DOCKER_TLS_VERIFY")
+	}
+	return nil
+}
+
+// Close stops any tunnel to the Docker API and closes the SSH connection
+// to the Docker host
+func (e *DockerEnvironment) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.CloseSSH()
+	if e.tunnel == nil {
+		return nil
+	}
+	err := e.tunnel.Close()
+	e.tunnel = nil
+	return err
+}
+
+func homeDir(getenv func(string) string) string {
+	if home := getenv("HOME"); home != "" {
+		return home
+	}
+	return getenv("USERPROFILE")
+}
+
+func expandHome(path string, getenv func(string) string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir(getenv), path[2:])
+	}
+	return path
+}
+
+func dockerConfigDir(getenv func(string) string) string {
+	if dir := getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	return filepath.Join(homeDir(getenv), ".docker")
+}
+
+func machineStorageDir(getenv func(string) string) string {
+	if dir := getenv("MACHINE_STORAGE_PATH"); dir != "" {
+		return dir
+	}
+	return filepath.Join(homeDir(getenv), ".docker", "machine")
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mefellows/parity/config"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestResolveDockerEnvironment_Env(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+
+	e, err := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{
+		"HOME":              home,
+		"DOCKER_HOST":       "tcp://192.168.99.100:2376",
+		"DOCKER_TLS_VERIFY": "1",
+		"DOCKER_CERT_PATH":  "/certs",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if e.Host != "192.168.99.100" || !e.TLSVerify || e.CertPath != "/certs" {
+		t.Fatalf("Expected environment to be read from DOCKER_* variables, got %+v", e)
+	}
+	if e.SSHUser != "docker" || e.SSHKey != "/certs/id_rsa" || e.SSHAddress() != "192.168.99.100:22" {
+		t.Fatalf("Expected default SSH settings, got %+v", e)
+	}
+	if e.MirrorAddress() != "192.168.99.100:8123" {
+		t.Fatalf("Expected default mirror address, got '%s'", e.MirrorAddress())
+	}
+	if e.Native {
+		t.Fatalf("Expected a remote Docker host not to be native")
+	}
+}
+
+func TestResolveDockerEnvironment_Machine(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+	dir := filepath.Join(home, ".docker", "machine", "machines", "dev")
+	os.MkdirAll(dir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{
+		"DriverName": "generic",
+		"Driver": {"IPAddress": "10.0.0.5", "SSHUser": "ubuntu", "SSHPort": 2222, "SSHKeyPath": "/keys/dev"}
+	}`), 0644)
+
+	e, err := resolveDockerEnvironment(config.HostConfig{Machine: "dev"}, env(map[string]string{"HOME": home}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if e.Endpoint != "tcp://10.0.0.5:2376" || e.CertPath != dir || !e.TLSVerify {
+		t.Fatalf("Expected API endpoint from Docker Machine, got %+v", e)
+	}
+	if e.SSHAddress() != "10.0.0.5:2222" || e.SSHUser != "ubuntu" || e.SSHKey != "/keys/dev" {
+		t.Fatalf("Expected SSH settings from Docker Machine, got %+v", e)
+	}
+}
+
+func TestResolveDockerEnvironment_MissingMachine(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+
+	// A machine named in parity.yml must exist
+	if _, err := resolveDockerEnvironment(config.HostConfig{Machine: "dev"}, env(map[string]string{"HOME": home})); err == nil {
+		t.Fatalf("Expected an error for a missing Docker Machine")
+	}
+
+	// DOCKER_MACHINE_NAME may be left over from another shell
+	if _, err := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{"HOME": home, "DOCKER_MACHINE_NAME": "dev"})); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+}
+
+func writeContext(home, name, endpoint string) {
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+	meta := filepath.Join(home, ".docker", "contexts", "meta", id)
+	os.MkdirAll(meta, 0755)
+	ioutil.WriteFile(filepath.Join(meta, "meta.json"), []byte(fmt.Sprintf(`{
+		"Name": "%s",
+		"Endpoints": {"docker": {"Host": "%s", "SkipTLSVerify": false}}
+	}`, name, endpoint)), 0644)
+}
+
+func TestResolveDockerEnvironment_Context(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+	writeContext(home, "remote", "tcp://10.0.0.7:2376")
+	ioutil.WriteFile(filepath.Join(home, ".docker", "config.json"), []byte(`{"currentContext": "remote"}`), 0644)
+
+	e, err := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{"HOME": home}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if e.Endpoint != "tcp://10.0.0.7:2376" || e.Host != "10.0.0.7" || e.Context != "remote" {
+		t.Fatalf("Expected endpoint from the current Docker context, got %+v", e)
+	}
+}
+
+func TestResolveDockerEnvironment_NamedContext(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+	writeContext(home, "remote", "tcp://10.0.0.7:2376")
+	writeContext(home, "staging", "ssh://deploy@10.0.0.8")
+	ioutil.WriteFile(filepath.Join(home, ".docker", "config.json"), []byte(`{"currentContext": "remote"}`), 0644)
+
+	e, _ := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{"HOME": home, "DOCKER_CONTEXT": "staging"}))
+	if e.Context != "staging" || e.Host != "10.0.0.8" {
+		t.Fatalf("Expected DOCKER_CONTEXT to override the current context, got %+v", e)
+	}
+
+	e, _ = resolveDockerEnvironment(config.HostConfig{Context: "remote"}, env(map[string]string{
+		"HOME":        home,
+		"DOCKER_HOST": "tcp://192.168.99.100:2376",
+	}))
+	if e.Context != "remote" || e.Host != "10.0.0.7" {
+		t.Fatalf("Expected context in parity.yml to override DOCKER_HOST, got %+v", e)
+	}
+
+	if _, err := resolveDockerEnvironment(config.HostConfig{Context: "missing"}, env(map[string]string{"HOME": home})); err == nil {
+		t.Fatalf("Expected an error for a missing context")
+	}
+}
+
+func TestResolveDockerEnvironment_Schemes(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+
+	cases := map[string]string{
+		"unix:///var/run/docker.sock":    "localhost:22",
+		"npipe:////./pipe/docker_engine": "localhost:22",
+		"tcp://10.0.0.5:2376":            "10.0.0.5:22",
+		"ssh://ubuntu@10.0.0.6:2222":     "10.0.0.6:2222",
+		"ssh://10.0.0.7":                 "10.0.0.7:22",
+	}
+	for endpoint, ssh := range cases {
+		e, err := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{"HOME": home, "DOCKER_HOST": endpoint}))
+		if err != nil {
+			t.Fatalf("Unexpected error for '%s': %s", endpoint, err.Error())
+		}
+		if e.SSHAddress() != ssh {
+			t.Fatalf("Expected SSH address for '%s' to be '%s', got '%s'", endpoint, ssh, e.SSHAddress())
+		}
+	}
+
+	e, _ := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{"HOME": home, "DOCKER_HOST": "ssh://ubuntu@10.0.0.6"}))
+	if e.SSHUser != "ubuntu" || e.SSHKey != filepath.Join(home, ".ssh", "id_rsa") {
+		t.Fatalf("Expected SSH user and key for ssh:// endpoint, got %+v", e)
+	}
+	e, _ = resolveDockerEnvironment(config.HostConfig{SSHUser: "core"}, env(map[string]string{"HOME": home, "DOCKER_HOST": "ssh://ubuntu@10.0.0.6"}))
+	if e.SSHUser != "core" {
+		t.Fatalf("Expected SSH user in parity.yml to take precedence, got '%s'", e.SSHUser)
+	}
+
+	if _, err := resolveDockerEnvironment(config.HostConfig{}, env(map[string]string{"HOME": home, "DOCKER_HOST": "fd://"})); err == nil {
+		t.Fatalf("Expected an error for an unsupported scheme")
+	}
+}
+
+func TestDockerEnvironment_APIEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"":                        "unix:///var/run/docker.sock",
+		"tcp://10.0.0.5:2376":     "tcp://10.0.0.5:2376",
+		"unix:///run/docker.sock": "unix:///run/docker.sock",
+	}
+	for endpoint, expected := range cases {
+		e := &DockerEnvironment{Endpoint: endpoint}
+		if api, _ := e.APIEndpoint(); api != expected {
+			t.Fatalf("Expected API endpoint for '%s' to be '%s', got '%s'", endpoint, expected, api)
+		}
+	}
+}
+
+func TestResolveDockerEnvironment_Config(t *testing.T) {
+	home, _ := ioutil.TempDir("", "parity-env")
+	defer os.RemoveAll(home)
+
+	host := config.HostConfig{
+		Address:    "parity.local",
+		SSHUser:    "core",
+		SSHKey:     "~/.ssh/id_ed25519",
+		SSHPort:    2200,
+		MirrorPort: 9000,
+	}
+	e, err := resolveDockerEnvironment(host, env(map[string]string{
+		"HOME":        home,
+		"DOCKER_HOST": "tcp://192.168.99.100:2376",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if e.Host != "parity.local" || e.SSHAddress() != "parity.local:2200" || e.MirrorAddress() != "parity.local:9000" {
+		t.Fatalf("Expected parity.yml to override the environment, got %+v", e)
+	}
+	if e.SSHUser != "core" || e.SSHKey != filepath.Join(home, ".ssh/id_ed25519") {
+		t.Fatalf("Expected SSH settings from parity.yml, got %+v", e)
+	}
+	if e.Endpoint != "tcp://192.168.99.100:2376" {
+		t.Fatalf("Expected API endpoint to be kept, got '%s'", e.Endpoint)
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+// HelperImage is the image helper containers run
+const HelperImage = "busybox:latest"
+
+// HelperContainer is a short lived container that mounts volumes, so that
+// files can be copied in and out of them as tar streams through the Docker
+// API
+type HelperContainer struct {
+	client *dockerclient.Client
+	ID     string
+}
+
+// StartHelper starts a helper container with the given binds (e.g.
+// "volume:/data"), pulling HelperImage if needed
+func StartHelper(client *dockerclient.Client, name string, binds []string) (*HelperContainer, error) {
+	if _, err := client.InspectImage(HelperImage); err == dockerclient.ErrNoSuchImage {
+		parts := strings.SplitN(HelperImage, ":", 2)
+		if err := client.PullImage(dockerclient.PullImageOptions{Repository: parts[0], Tag: parts[1]}, dockerclient.AuthConfiguration{}); err != nil {
+			return nil, fmt.Errorf("Unable to pull %s: %s", HelperImage, err.Error())
+		}
+	}
+
+	// Remove any helper left behind by a previous run
+	client.RemoveContainer(dockerclient.RemoveContainerOptions{ID: name, Force: true})
+
+	container, err := client.CreateContainer(dockerclient.CreateContainerOptions{
+		Name: name,
+		Config: &dockerclient.Config{
+			Image:  HelperImage,
+			Cmd:    []string{"sleep", "86400"},
+			Labels: map[string]string{"com.github.mefellows.parity.helper": "true"},
+		},
+		HostConfig: &dockerclient.HostConfig{Binds: binds},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create helper container: %s", err.Error())
+	}
+	h := &HelperContainer{client: client, ID: container.ID}
+	if err := client.StartContainer(container.ID, nil); err != nil {
+		h.Remove()
+		return nil, fmt.Errorf("Unable to start helper container: %s", err.Error())
+	}
+	return h, nil
+}
+
+// Upload extracts a tar stream into path, in the container
+func (h *HelperContainer) Upload(path string, r io.Reader) error {
+	return h.client.UploadToContainer(h.ID, dockerclient.UploadToContainerOptions{InputStream: r, Path: path})
+}
+
+// Download writes a tar stream of path, in the container, to w
+func (h *HelperContainer) Download(path string, w io.Writer) error {
+	return h.client.DownloadFromContainer(h.ID, dockerclient.DownloadFromContainerOptions{OutputStream: w, Path: path})
+}
+
+// Remove stops and removes the container
+func (h *HelperContainer) Remove() error {
+	return h.client.RemoveContainer(dockerclient.RemoveContainerOptions{ID: h.ID, Force: true})
+}
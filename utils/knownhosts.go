@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mefellows/parity/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// knownHostsMutex serialises updates to known hosts files
+var knownHostsMutex sync.Mutex
+
+// KnownHosts verifies SSH host keys against an OpenSSH known_hosts file
+type KnownHosts struct {
+	File string
+
+	// TrustOnFirstUse adds the key of a host that isn't in File, instead
+	// of rejecting it. Hosts presenting a different key are always rejected.
+	TrustOnFirstUse bool
+}
+
+// HostKeyCallback checks the host key presented during an SSH handshake.
+// It can be used as an ssh.ClientConfig HostKeyCallback.
+func (k *KnownHosts) HostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsMutex.Lock()
+	defer knownHostsMutex.Unlock()
+
+	name := knownHostName(hostname)
+	data, err := ioutil.ReadFile(k.File)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	known := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		// Comments, blank and invalid lines are skipped
+		marker, hosts, pub, _, _, err := ssh.ParseKnownHosts(line)
+		if err != nil || !matchesHost(hosts, name) {
+			continue
+		}
+		same := bytes.Equal(pub.Marshal(), key.Marshal())
+		switch {
+		case marker == "revoked" && same:
+			return fmt.Errorf("The host key for %s (%s %s) has been revoked", name, key.Type(), fingerprint(key))
+		case marker != "":
+			continue
+		case same:
+			return nil
+		default:
+			// As with OpenSSH, a host with a recorded key must present
+			// it, rather than a key of another type
+			known = true
+		}
+	}
+
+	if known {
+		return fmt.Errorf("The host key for %s has changed (%s %s). If the Docker host has been recreated, remove it from %s",
+			name, key.Type(), fingerprint(key), k.File)
+	}
+	if !k.TrustOnFirstUse {
+		return fmt.Errorf("Unknown host key for %s (%s %s). Add it to %s to trust it", name, key.Type(), fingerprint(key), k.File)
+	}
+
+	log.Warn("Permanently added %s (%s %s) to the list of known hosts", name, key.Type(), fingerprint(key))
+	return k.add(name, key)
+}
+
+// KeyTypes returns the types of the keys recorded for the host at addr,
+// to negotiate during the handshake, so that the host presents a recorded
+// key rather than one of another type
+func (k *KnownHosts) KeyTypes(addr string) ([]string, error) {
+	knownHostsMutex.Lock()
+	defer knownHostsMutex.Unlock()
+
+	name := knownHostName(addr)
+	data, err := ioutil.ReadFile(k.File)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var types []string
+	seen := map[string]bool{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		marker, hosts, pub, _, _, err := ssh.ParseKnownHosts(line)
+		if err != nil || marker != "" || !matchesHost(hosts, name) || seen[pub.Type()] {
+			continue
+		}
+		seen[pub.Type()] = true
+		types = append(types, pub.Type())
+	}
+	return types, nil
+}
+
+// add appends a host key to the known hosts file
+func (k *KnownHosts) add(name string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(k.File), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(k.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s %s", name, ssh.MarshalAuthorizedKey(key))
+	return err
+}
+
+// knownHostName converts a host:port address to the form used in
+// known_hosts files, i.e. 'host' for port 22 and '[host]:port' otherwise
+func knownHostName(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if port == "22" {
+		return host
+	}
+	return fmt.Sprintf("[%s]:%s", host, port)
+}
+
+var hostPatternEscaper = strings.NewReplacer(`[`, `\[`, `]`, `\]`, `\`, `\\`)
+
+// matchesHost checks name against the host patterns of a known_hosts
+// line, including hashed hostnames
+func matchesHost(hosts []string, name string) bool {
+	matched := false
+	for _, h := range hosts {
+		negate := strings.HasPrefix(h, "!")
+		h = strings.TrimPrefix(h, "!")
+
+		var ok bool
+		if strings.HasPrefix(h, "|1|") {
+			ok = matchesHash(h, name)
+		} else {
+			// Only '*' and '?' are wildcards, '[host]:port' is literal
+			ok, _ = filepath.Match(hostPatternEscaper.Replace(h), name)
+		}
+		if ok && negate {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// matchesHash checks a hashed hostname (|1|salt|hash)
+func matchesHash(entry string, name string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// fingerprint returns the OpenSSH style SHA256 fingerprint of a key
+func fingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + strings.TrimRight(base64.StdEncoding.EncodeToString(sum[:]), "=")
+}
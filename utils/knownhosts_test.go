@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKnownHosts_TrustOnFirstUse(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-known-hosts")
+	defer os.RemoveAll(dir)
+	key, _ := ssh.NewPublicKey(&newKey(t).PublicKey)
+
+	k := &KnownHosts{File: filepath.Join(dir, "known_hosts"), TrustOnFirstUse: true}
+	if err := k.HostKeyCallback("192.168.99.100:22", nil, key); err != nil {
+		t.Fatalf("Expected unknown host to be trusted, got '%s'", err.Error())
+	}
+	data, _ := ioutil.ReadFile(k.File)
+	if !strings.HasPrefix(string(data), "192.168.99.100 ecdsa-sha2-nistp256 ") {
+		t.Fatalf("Expected host key to be recorded, got '%s'", data)
+	}
+	if err := k.HostKeyCallback("192.168.99.100:22", nil, key); err != nil {
+		t.Fatalf("Expected known host to be accepted, got '%s'", err.Error())
+	}
+
+	// A different key for the same host must be rejected
+	other, _ := ssh.NewPublicKey(&newKey(t).PublicKey)
+	if err := k.HostKeyCallback("192.168.99.100:22", nil, other); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("Expected a changed host key to be rejected, got '%v'", err)
+	}
+}
+
+func TestKnownHosts_OtherKeyType(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-known-hosts")
+	defer os.RemoveAll(dir)
+	key, _ := ssh.NewPublicKey(&newKey(t).PublicKey)
+
+	k := &KnownHosts{File: filepath.Join(dir, "known_hosts"), TrustOnFirstUse: true}
+	ioutil.WriteFile(k.File, []byte("192.168.99.100 "+string(ssh.MarshalAuthorizedKey(key))), 0600)
+
+	// A host with a recorded key can't be trusted again with another type
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	other, _ := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err := k.HostKeyCallback("192.168.99.100:22", nil, other); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("Expected a key of another type to be rejected, got '%v'", err)
+	}
+	if data, _ := ioutil.ReadFile(k.File); strings.Contains(string(data), "ssh-rsa") {
+		t.Fatalf("Expected the other key not to be recorded, got '%s'", data)
+	}
+
+	// Only the recorded key types are negotiated
+	if types, err := k.KeyTypes("192.168.99.100:22"); err != nil || len(types) != 1 || types[0] != key.Type() {
+		t.Fatalf("Expected the recorded key type, got %v (%v)", types, err)
+	}
+	if types, _ := k.KeyTypes("10.0.0.5:22"); len(types) != 0 {
+		t.Fatalf("Expected no key types for an unknown host, got %v", types)
+	}
+}
+
+func TestKnownHosts_Strict(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-known-hosts")
+	defer os.RemoveAll(dir)
+	key, _ := ssh.NewPublicKey(&newKey(t).PublicKey)
+
+	k := &KnownHosts{File: filepath.Join(dir, "known_hosts")}
+	if err := k.HostKeyCallback("10.0.0.5:2222", nil, key); err == nil {
+		t.Fatalf("Expected unknown host to be rejected")
+	}
+	if _, err := os.Stat(k.File); err == nil {
+		t.Fatalf("Expected unknown host not to be recorded")
+	}
+
+	// Hashed hostnames, as written by 'ssh-keyscan -H'
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[10.0.0.5]:2222"))
+	hashed := fmt.Sprintf("|1|%s|%s", base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	ioutil.WriteFile(k.File, []byte("# comment\n"+hashed+" "+string(ssh.MarshalAuthorizedKey(key))), 0600)
+
+	if err := k.HostKeyCallback("10.0.0.5:2222", nil, key); err != nil {
+		t.Fatalf("Expected hashed known host to be accepted, got '%s'", err.Error())
+	}
+}
+
+func TestKnownHosts_Revoked(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-known-hosts")
+	defer os.RemoveAll(dir)
+	key, _ := ssh.NewPublicKey(&newKey(t).PublicKey)
+
+	k := &KnownHosts{File: filepath.Join(dir, "known_hosts"), TrustOnFirstUse: true}
+	ioutil.WriteFile(k.File, []byte("@revoked * "+string(ssh.MarshalAuthorizedKey(key))), 0600)
+	if err := k.HostKeyCallback("192.168.99.100:22", nil, key); err == nil {
+		t.Fatalf("Expected revoked key to be rejected")
+	}
+}
+
+func TestSSHConnection_VerifiesHostKey(t *testing.T) {
+	_, env, cleanup := setupSSHServer(t)
+	defer cleanup()
+
+	// Record a different key for the server
+	other, _ := ssh.NewPublicKey(&newKey(t).PublicKey)
+	ioutil.WriteFile(env.KnownHosts, []byte(fmt.Sprintf("%s %s", knownHostName(env.SSHAddress()), ssh.MarshalAuthorizedKey(other))), 0600)
+
+	if err := env.Run("echo hello", CommandOptions{}); err == nil {
+		t.Fatalf("Expected connection to a host with a changed key to fail")
+	}
+}
+
+func TestMatchesHost(t *testing.T) {
+	cases := []struct {
+		hosts []string
+		name  string
+		match bool
+	}{
+		{[]string{"192.168.99.100"}, "192.168.99.100", true},
+		{[]string{"[127.0.0.1]:2222"}, "[127.0.0.1]:2222", true},
+		{[]string{"[127.0.0.1]:2222"}, "1", false},
+		{[]string{"192.168.99.*"}, "192.168.99.100", true},
+		{[]string{"192.168.99.*", "!192.168.99.100"}, "192.168.99.100", false},
+		{[]string{"other"}, "192.168.99.100", false},
+	}
+	for _, c := range cases {
+		if matchesHost(c.hosts, c.name) != c.match {
+			t.Fatalf("Expected %v matching %s to be %v", c.hosts, c.name, c.match)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Default location of the Docker daemon socket on Linux
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// Name of the network interface of Docker's default bridge network
+const dockerBridgeInterface = "docker0"
+
+// nativeDaemon returns true if Docker is running natively on this host
+// (i.e. Linux with a local daemon socket), rather than inside a Docker
+// Machine VM. In native mode there is no VM to install into or synchronise
+// files with, volumes are bind mounted directly from the host.
+func nativeDaemon(goos string, dockerHost string, exists func(string) bool) bool {
+	if goos != "linux" {
+		return false
+	}
+	socket := DockerSocket(dockerHost)
+	return socket != "" && exists(socket)
+}
+
+// DockerSocket returns the path to the Docker daemon's unix socket, given
+// the value of DOCKER_HOST. An empty DOCKER_HOST uses the default socket,
+// and an empty string is returned for remote (e.g. tcp://) daemons.
+func DockerSocket(dockerHost string) string {
+	if dockerHost == "" {
+		return defaultDockerSocket
+	}
+	u, err := url.Parse(dockerHost)
+	if err != nil || u.Scheme != "unix" {
+		return ""
+	}
+	return u.Path
+}
+
+// DockerBridgeGateway returns the IP address of the host on Docker's default
+// bridge network, which is how containers reach the host in native mode
+func DockerBridgeGateway(e *DockerEnvironment) (string, error) {
+	if i, err := net.InterfaceByName(dockerBridgeInterface); err == nil {
+		if addrs, err := i.Addrs(); err == nil {
+			for _, a := range addrs {
+				if ip, _, err := net.ParseCIDR(a.String()); err == nil && ip.To4() != nil {
+					return ip.String(), nil
+				}
+			}
+		}
+	}
+
+	// Fall back to asking Docker, e.g. if the interface has been renamed
+	client, err := e.Client()
+	if err != nil {
+		return "", err
+	}
+	network, err := client.NetworkInfo("bridge")
+	if err != nil {
+		return "", fmt.Errorf("Unable to find the Docker bridge network: %s", err.Error())
+	}
+	for _, c := range network.IPAM.Config {
+		if c.Gateway != "" {
+			return strings.Split(c.Gateway, "/")[0], nil
+		}
+	}
+	return "", fmt.Errorf("Unable to find the gateway of the Docker bridge network")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
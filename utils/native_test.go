@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestDockerSocket(t *testing.T) {
+	cases := map[string]string{
+		"":                             "/var/run/docker.sock",
+		"unix:///var/run/docker.sock":  "/var/run/docker.sock",
+		"unix:///run/user/1000/docker": "/run/user/1000/docker",
+		"tcp://192.168.99.100:2376":    "",
+	}
+	for host, expected := range cases {
+		if socket := DockerSocket(host); socket != expected {
+			t.Fatalf("Expected socket for '%s' to be '%s', got '%s'", host, expected, socket)
+		}
+	}
+}
+
+func TestNativeDaemon(t *testing.T) {
+	exists := func(path string) bool { return path == "/var/run/docker.sock" }
+
+	if !nativeDaemon("linux", "", exists) {
+		t.Fatalf("Expected a local socket on Linux to be native")
+	}
+	if nativeDaemon("linux", "unix:///missing.sock", exists) {
+		t.Fatalf("Expected a missing socket not to be native")
+	}
+	if nativeDaemon("linux", "tcp://192.168.99.100:2376", exists) {
+		t.Fatalf("Expected a Docker Machine VM not to be native")
+	}
+	if nativeDaemon("darwin", "", exists) {
+		t.Fatalf("Expected Docker on OSX not to be native")
+	}
+}
@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/scp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Maximum time to wait when connecting to the Docker host
+const sshDialTimeout = 10 * time.Second
+
+// CommandOptions configures how a command is run on the Docker host
+type CommandOptions struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// PTY allocates a pseudo terminal, e.g. for interactive commands
+	PTY bool
+}
+
+// CommandError is returned when a command on the Docker host fails
+type CommandError struct {
+	Command    string
+	Host       string
+	ExitStatus int
+	Signal     string
+}
+
+func (e *CommandError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("Command '%s' on %s was killed by signal %s", e.Command, e.Host, e.Signal)
+	}
+	return fmt.Sprintf("Command '%s' on %s failed with exit status %d", e.Command, e.Host, e.ExitStatus)
+}
+
+// sshPool keeps a single SSH connection open per Docker host, so that
+// each command only opens a new session
+type sshPool struct {
+	sync.Mutex
+	clients map[string]*ssh.Client
+}
+
+var pool = &sshPool{clients: make(map[string]*ssh.Client)}
+
+// client returns the open connection to addr, connecting if required
+func (p *sshPool) client(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	key := config.User + "@" + addr
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.clients[key]; ok {
+		return c, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, sshDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dial: %s", err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Failed to connect to %s: %s", addr, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	p.clients[key] = client
+
+	// Forget the connection once it drops, e.g. when the Docker host reboots
+	go func() {
+		client.Wait()
+		p.remove(key, client)
+	}()
+	return client, nil
+}
+
+func (p *sshPool) remove(key string, client *ssh.Client) {
+	p.Lock()
+	defer p.Unlock()
+	if p.clients[key] == client {
+		delete(p.clients, key)
+	}
+}
+
+// close closes the connections to addr
+func (p *sshPool) close(addr string) {
+	p.Lock()
+	defer p.Unlock()
+	for key, c := range p.clients {
+		if strings.HasSuffix(key, "@"+addr) {
+			c.Close()
+			delete(p.clients, key)
+		}
+	}
+}
+
+// SSHSession creates an SSH Session to the Docker host, reusing the open
+// connection to the host if there is one
+func (e *DockerEnvironment) SSHSession() (*ssh.Session, error) {
+	config, err := e.SSHConfig()
+	if err != nil {
+		return nil, err
+	}
+	addr := e.SSHAddress()
+
+	// A pooled connection may have dropped since it was last used
+	for attempt := 0; ; attempt++ {
+		client, err := pool.client(addr, config)
+		if err != nil {
+			return nil, err
+		}
+		session, err := client.NewSession()
+		if err == nil {
+			return session, nil
+		}
+		pool.remove(config.User+"@"+addr, client)
+		client.Close()
+		if attempt > 0 {
+			return nil, fmt.Errorf("Failed to create session: %s", err)
+		}
+	}
+}
+
+// CloseSSH closes any open SSH connection to the Docker host
+func (e *DockerEnvironment) CloseSSH() {
+	pool.close(e.SSHAddress())
+}
+
+// RunCommandWithDefaults runs a command on the Docker host, sending its output to Stdout/Stderr
+func (e *DockerEnvironment) RunCommandWithDefaults(command string) error {
+	return e.Run(command, CommandOptions{Stdout: os.Stdout, Stderr: os.Stderr})
+}
+
+// RunCommandAndReturn runs a command on the Docker host and return the output of Stdout
+func (e *DockerEnvironment) RunCommandAndReturn(command string) (string, error) {
+	var output bytes.Buffer
+	err := e.Run(command, CommandOptions{Stdout: &output, Stderr: os.Stderr})
+	return output.String(), err
+}
+
+// RunCommand runs command on the Docker host over SSH
+func (e *DockerEnvironment) RunCommand(command string, reader io.Reader, stdOut io.Writer, stdErr io.Writer) error {
+	return e.Run(command, CommandOptions{Stdin: reader, Stdout: stdOut, Stderr: stdErr})
+}
+
+// Run runs command on the Docker host over SSH. A non-zero exit status is
+// returned as a *CommandError.
+func (e *DockerEnvironment) Run(command string, opts CommandOptions) error {
+	session, err := e.SSHSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if opts.PTY {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,     // disable echoing
+			ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
+			ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+		}
+		if err := session.RequestPty("xterm", 80, 40, modes); err != nil {
+			return fmt.Errorf("request for pseudo terminal failed: %s", err)
+		}
+	}
+
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+	err = session.Run(command)
+	if exit, ok := err.(*ssh.ExitError); ok {
+		return &CommandError{
+			Command:    command,
+			Host:       e.Host,
+			ExitStatus: exit.ExitStatus(),
+			Signal:     exit.Signal(),
+		}
+	}
+	return err
+}
+
+// CopyFile copies a local file to dest on the Docker host over SCP
+func (e *DockerEnvironment) CopyFile(file string, dest string) error {
+	session, err := e.SSHSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return scp.CopyPath(file, dest, session)
+}
+
+// SSHConfig gets an SSH configuration to the Docker Host, verifying its
+// host key against Parity's known hosts
+func (e *DockerEnvironment) SSHConfig() (*ssh.ClientConfig, error) {
+	auth, err := PublicKeyFile(e.SSHKey)
+	if err != nil {
+		return nil, err
+	}
+	known := &KnownHosts{File: e.KnownHosts, TrustOnFirstUse: !e.StrictHostKeys}
+	types, err := known.KeyTypes(e.SSHAddress())
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:              e.SSHUser,
+		Auth:              []ssh.AuthMethod{auth},
+		HostKeyCallback:   known.HostKeyCallback,
+		HostKeyAlgorithms: types,
+	}, nil
+}
+
+// PublicKeyFile reads a private key and returns an SSH auth method
+func PublicKeyFile(file string) (ssh.AuthMethod, error) {
+	buffer, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read SSH key: %s", err.Error())
+	}
+
+	key, err := ssh.ParsePrivateKey(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read SSH key '%s': %s", file, err.Error())
+	}
+	return ssh.PublicKeys(key), nil
+}
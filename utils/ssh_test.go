@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSSHServer is a minimal SSH server that runs a few canned commands
+type fakeSSHServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.Signer
+	sync.Mutex
+	connections int
+	ptys        int
+	commands    []string
+	conns       []*ssh.ServerConn
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return key
+}
+
+// setupSSHServer starts a fake SSH server accepting clientKey, returning an
+// environment configured to connect to it
+func setupSSHServer(t *testing.T) (*fakeSSHServer, *DockerEnvironment, func()) {
+	dir, _ := ioutil.TempDir("", "parity-ssh")
+
+	clientKey := newKey(t)
+	der, _ := x509.MarshalECPrivateKey(clientKey)
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	clientPub, _ := ssh.NewPublicKey(&clientKey.PublicKey)
+
+	hostKey, _ := ssh.NewSignerFromKey(newKey(t))
+	s := &fakeSSHServer{hostKey: hostKey}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "docker" && string(key.Marshal()) == string(clientPub.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	s.config.AddHostKey(hostKey)
+
+	s.listener, _ = net.Listen("tcp", "127.0.0.1:0")
+	go s.serve()
+
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	env := &DockerEnvironment{
+		Host:       host,
+		SSHUser:    "docker",
+		SSHKey:     keyFile,
+		SSHPort:    p,
+		KnownHosts: filepath.Join(dir, "known_hosts"),
+	}
+	return s, env, func() {
+		env.Close()
+		s.listener.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func (s *fakeSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSSHServer) handle(c net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, s.config)
+	if err != nil {
+		c.Close()
+		return
+	}
+	s.Lock()
+	s.connections++
+	s.conns = append(s.conns, conn)
+	s.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(channel, requests)
+	}
+}
+
+func (s *fakeSSHServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			s.Lock()
+			s.ptys++
+			s.Unlock()
+			req.Reply(true, nil)
+		case "exec":
+			req.Reply(true, nil)
+			command := string(req.Payload[4:])
+			s.Lock()
+			s.commands = append(s.commands, command)
+			s.Unlock()
+
+			status := s.run(command, channel)
+			payload := make([]byte, 4)
+			binary.BigEndian.PutUint32(payload, uint32(status))
+			channel.SendRequest("exit-status", false, payload)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// run executes one of the supported commands, returning its exit status
+func (s *fakeSSHServer) run(command string, channel ssh.Channel) int {
+	switch {
+	case strings.HasPrefix(command, "echo "):
+		fmt.Fprintln(channel, strings.TrimPrefix(command, "echo "))
+	case strings.HasPrefix(command, "exit "):
+		status, _ := strconv.Atoi(strings.TrimPrefix(command, "exit "))
+		return status
+	case command == dialStdioCommand:
+		io.Copy(channel, channel)
+	default:
+		fmt.Fprintf(channel.Stderr(), "%s: command not found\n", command)
+		return 127
+	}
+	return 0
+}
+
+// disconnect drops all client connections, e.g. as if the host rebooted
+func (s *fakeSSHServer) disconnect() {
+	s.Lock()
+	defer s.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func TestRunCommand(t *testing.T) {
+	_, env, cleanup := setupSSHServer(t)
+	defer cleanup()
+
+	out, err := env.RunCommandAndReturn("echo hello")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if out != "hello\n" {
+		t.Fatalf("Expected command output 'hello', got '%s'", out)
+	}
+}
+
+func TestRunCommand_ExitStatus(t *testing.T) {
+	_, env, cleanup := setupSSHServer(t)
+	defer cleanup()
+
+	err := env.Run("exit 3", CommandOptions{})
+	cmdErr, ok := err.(*CommandError)
+	if !ok {
+		t.Fatalf("Expected a CommandError, got '%v'", err)
+	}
+	if cmdErr.ExitStatus != 3 || cmdErr.Command != "exit 3" {
+		t.Fatalf("Expected exit status 3, got %d", cmdErr.ExitStatus)
+	}
+}
+
+func TestRunCommand_Pooled(t *testing.T) {
+	s, env, cleanup := setupSSHServer(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		if err := env.Run(fmt.Sprintf("echo %d", i), CommandOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+	}
+	if s.connections != 1 {
+		t.Fatalf("Expected commands to share a single connection, got %d", s.connections)
+	}
+
+	// The connection is re-established if it drops
+	s.disconnect()
+	if err := env.Run("echo again", CommandOptions{}); err != nil {
+		t.Fatalf("Expected to reconnect, got '%s'", err.Error())
+	}
+	if s.connections != 2 {
+		t.Fatalf("Expected a new connection, got %d connections", s.connections)
+	}
+}
+
+func TestRunCommand_PTY(t *testing.T) {
+	s, env, cleanup := setupSSHServer(t)
+	defer cleanup()
+
+	env.Run("echo no pty", CommandOptions{})
+	if s.ptys != 0 {
+		t.Fatalf("Expected no pseudo terminal by default")
+	}
+	env.Run("echo pty", CommandOptions{PTY: true})
+	if s.ptys != 1 {
+		t.Fatalf("Expected a pseudo terminal to be requested")
+	}
+}
+
+func TestSSHTunnel(t *testing.T) {
+	_, env, cleanup := setupSSHServer(t)
+	defer cleanup()
+	env.Endpoint = fmt.Sprintf("ssh://docker@%s", env.SSHAddress())
+
+	endpoint, err := env.APIEndpoint()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	socket := strings.TrimPrefix(endpoint, "unix://")
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the tunnel to listen on a socket only the user can access, got %s (%v)", endpoint, err)
+	}
+	if info, err := os.Stat(filepath.Dir(socket)); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("Expected the tunnel's socket to be in a private directory (%v)", err)
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, "GET /_ping")
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "GET /_ping" {
+		t.Fatalf("Expected request to be tunneled to the Docker host, got '%s' (%v)", buf, err)
+	}
+
+	env.Close()
+	if _, err := os.Stat(filepath.Dir(socket)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the tunnel's socket to be removed when closed")
+	}
+}
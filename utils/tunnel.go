@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/mefellows/parity/log"
+)
+
+// Command run on the Docker host to connect a session to the Docker API
+const dialStdioCommand = "docker system dial-stdio"
+
+// sshTunnel forwards a local unix socket to the Docker API on an ssh://
+// Docker host. Each connection runs 'docker system dial-stdio' on the Docker
+// host, the same way the Docker CLI connects to ssh:// endpoints.
+//
+// The socket is only accessible to the current user, as it gives the same
+// access to the Docker host as the SSH key does.
+type sshTunnel struct {
+	listener net.Listener
+	dir      string
+	env      *DockerEnvironment
+}
+
+func newSSHTunnel(env *DockerEnvironment) (*sshTunnel, error) {
+	dir, err := ioutil.TempDir("", "parity-docker")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err == nil {
+		err = os.Chmod(socket, 0600)
+	}
+	if err != nil {
+		if l != nil {
+			l.Close()
+		}
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	t := &sshTunnel{listener: l, dir: dir, env: env}
+	log.Debug("Tunneling Docker API on %s to %s", socket, env.Endpoint)
+	go t.serve()
+	return t, nil
+}
+
+// Addr is the path of the tunnel's socket
+func (t *sshTunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// Close stops accepting new connections and removes the socket
+func (t *sshTunnel) Close() error {
+	err := t.listener.Close()
+	os.RemoveAll(t.dir)
+	return err
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(conn)
+	}
+}
+
+func (t *sshTunnel) forward(conn net.Conn) {
+	defer conn.Close()
+	session, err := t.env.SSHSession()
+	if err != nil {
+		log.Error("Unable to tunnel to Docker API on %s: %s", t.env.SSHAddress(), err.Error())
+		return
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		log.Error("Unable to tunnel to Docker API on %s: %s", t.env.SSHAddress(), err.Error())
+		return
+	}
+	session.Stdout = conn
+	if err := session.Start(dialStdioCommand); err != nil {
+		log.Error("Unable to tunnel to Docker API on %s: %s", t.env.SSHAddress(), err.Error())
+		return
+	}
+	go func() {
+		io.Copy(stdin, conn)
+		stdin.Close()
+	}()
+	session.Wait()
+}
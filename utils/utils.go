@@ -1,13 +1,12 @@
 package utils
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
-	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -17,7 +16,6 @@ import (
 	dockerclient "github.com/fsouza/go-dockerclient"
 	mutils "github.com/mefellows/mirror/filesystem/utils"
 	"github.com/mefellows/parity/log"
-	"golang.org/x/crypto/ssh"
 )
 
 const bootlocalTemplateFile = "templates/bootlocal.sh"
@@ -28,12 +26,12 @@ const daemonTemplateFile = "templates/mirror-daemon.sh"
 func CreateTemplateTempFile(data func() ([]byte, error), perms os.FileMode, templateData interface{}) *os.File {
 	daemon, err := data()
 	if err != nil {
-		log.Fatalf("Template failed:", err.Error())
+		log.Fatalf("Template failed: %s", err.Error())
 	}
 
 	tmpl, err := template.New("template file").Parse(string(daemon))
 	if err != nil {
-		log.Fatalf("Template failed:", err.Error())
+		log.Fatalf("Template failed: %s", err.Error())
 	}
 
 	file, _ := ioutil.TempFile("/tmp", "parity")
@@ -47,30 +45,6 @@ func CreateTemplateTempFile(data func() ([]byte, error), perms os.FileMode, temp
 	return file
 }
 
-// TODO: Don't rely on environment variables. If they are set, great, otherwise default
-// to
-
-// Get the hostname (sans protocol/port) of the current Docker Host
-func dockerHost() string {
-	host, _ := url.Parse(os.Getenv("DOCKER_HOST"))
-	return strings.Split(host.Host, ":")[0]
-}
-
-// Get the user required to connect to the remote Docker host
-func dockerUser() string {
-	return "docker"
-}
-
-// Get the name of the current running Docker Machine
-func dockerMachineName() string {
-	return os.Getenv("DOCKER_MACHINE_NAME")
-}
-
-// Get the path to the current Docker Machine's client certificate
-func dockerCertPath() string {
-	return fmt.Sprintf("%s/id_rsa", os.Getenv("DOCKER_CERT_PATH"))
-}
-
 // DefaultParityConfigurationFile gets the default parity configuration file
 func DefaultParityConfigurationFile() string {
 	dir, _ := os.Getwd()
@@ -109,122 +83,6 @@ func FindNetwork(ip string) (net.IP, net.Addr, error) {
 	return nil, nil, fmt.Errorf("Unable to find network for ip %s", ip)
 }
 
-// DockerClient creates a docker client from environment
-func DockerClient() *dockerclient.Client {
-	client, err := dockerclient.NewClientFromEnv()
-	if err != nil {
-		log.Fatalf("Unabled to create a Docker Client: Is Docker Machine installed and running?")
-	}
-	client.SkipServerVersionCheck = true
-	return client
-}
-
-// dockerPort returns the SSH port for Docker
-func dockerPort() string {
-	return "22"
-}
-
-// mirrorPort returns the Mirror daemon port
-func mirrorPort() string {
-	return "8123"
-}
-
-// DockerHost gets the ip:port of the current active Docker Machine
-func DockerHost() string {
-	return fmt.Sprintf("%s:%s", dockerHost(), dockerPort())
-}
-
-// DockerVMHost gets the IP address of the underlying VM for the current active Docker Machine
-func DockerVMHost() (string, error) {
-	ip, _, err := FindNetwork(dockerHost())
-	if err == nil {
-		return ip.String(), nil
-	}
-	return "", err
-}
-
-// MirrorHost gets the ip:port of the current active Docker Machine
-func MirrorHost() string {
-	return fmt.Sprintf("%s:%s", dockerHost(), mirrorPort())
-}
-
-// SSHSession creates an SSH Session for a remote Docker host
-func SSHSession(host string) (session *ssh.Session, err error) {
-	config := SSHConfig()
-	connection, err := ssh.Dial("tcp", host, config)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to dial: %s", err)
-	}
-	session, err = connection.NewSession()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create session: %s", err)
-	}
-	return session, nil
-}
-
-// RunCommandWithDefaults runs a command on a host using the default configuration for I/O redirection
-func RunCommandWithDefaults(host string, command string) error {
-	return RunCommand(host, command, os.Stdin, os.Stdout, os.Stderr)
-}
-
-// RunCommandAndReturn runs a command on a given SSH Connection and return the output of Stdout
-func RunCommandAndReturn(host string, command string) (string, error) {
-	var output bytes.Buffer
-	RunCommand(host, command, os.Stdin, &output, os.Stderr)
-	return output.String(), nil
-}
-
-// RunCommand runs command on a given SSH connection
-func RunCommand(host string, command string, reader io.Reader, stdOut io.Writer, stdErr io.Writer) error {
-	session, err := SSHSession(host)
-	if err != nil {
-		return err
-	}
-	defer session.Close()
-
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          0,     // disable echoing
-		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
-		ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
-	}
-
-	if err := session.RequestPty("xterm", 80, 40, modes); err != nil {
-		session.Close()
-		return fmt.Errorf("request for pseudo terminal failed: %s", err)
-	}
-
-	session.Stdout = stdOut
-	session.Stdin = reader
-	session.Stderr = stdErr
-	err = session.Run(command)
-
-	return nil
-}
-
-// SSHConfig gets an SSH configuration to the Docker Host
-func SSHConfig() *ssh.ClientConfig {
-	return &ssh.ClientConfig{
-		User: dockerUser(),
-		Auth: []ssh.AuthMethod{
-			PublicKeyFile(dockerCertPath()),
-		},
-	}
-}
-
-// PublicKeyFile reads a public key and returns an SSH auth method
-func PublicKeyFile(file string) ssh.AuthMethod {
-	buffer, err := ioutil.ReadFile(file)
-	if err != nil {
-		return nil
-	}
-
-	key, err := ssh.ParsePrivateKey(buffer)
-	if err != nil {
-		return nil
-	}
-	return ssh.PublicKeys(key)
-}
-
 // WaitForNetwork waits for a network connection to become available within a timeout
 func WaitForNetwork(name string, host string) {
 	WaitForNetworkWithTimeout(name, host, 120*time.Second)
@@ -232,39 +90,35 @@ func WaitForNetwork(name string, host string) {
 
 // WaitForNetworkWithTimeout waits for a network connection to become available within a timeout
 func WaitForNetworkWithTimeout(name string, host string, timeout time.Duration) {
-	waitDone := make(chan bool, 1)
-	go func() {
-		log.Info("Waiting for %s to become available (%s)", name, host)
-		for {
-			select {
-			case <-time.After(5 * time.Second):
-			}
-
-			_, err := net.DialTimeout("tcp", host, 10*time.Second)
-			if err != nil {
-				continue
-			}
-			waitDone <- true
-		}
-	}()
+	if err := AwaitNetwork(name, host, timeout); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+}
 
-WaitLoop:
+// AwaitNetwork waits for a network connection to become available, returning
+// an error if it isn't within the timeout
+func AwaitNetwork(name string, host string, timeout time.Duration) error {
+	log.Info("Waiting for %s to become available (%s)", name, host)
+	deadline := time.Now().Add(timeout)
 	for {
-		select {
-		case <-waitDone:
+		time.Sleep(5 * time.Second)
+		if conn, err := net.DialTimeout("tcp", host, 10*time.Second); err == nil {
+			conn.Close()
 			log.Info("Connected to %s", name)
-			break WaitLoop
-		case <-time.After(timeout):
-			log.Fatalf("Unable to connect to %s %s", name, "Is Docker running?")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Unable to connect to %s (%s). Is Docker running? Run 'parity doctor' for details", name, host)
 		}
 	}
-
-	return
 }
 
 // FindSharedFolders gets the list of shared folders on the remote Docker Host
-func FindSharedFolders() []string {
-	sharesRes, err := RunCommandAndReturn(DockerHost(), "mount | grep 'type vboxsf' | awk '{print $3}'")
+func (e *DockerEnvironment) FindSharedFolders() []string {
+	if e.Native {
+		return nil
+	}
+	sharesRes, err := e.RunCommandAndReturn("mount | grep 'type vboxsf' | awk '{print $3}'")
 	if err != nil {
 		log.Warn("Unable to determine Virtualbox shared folders, please manually ensure shared folders are removed to ensure proper operation of Parity")
 	}
@@ -278,17 +132,17 @@ func FindSharedFolders() []string {
 }
 
 // UnmountSharedFolders unmounts all shared folders on the remote Docker host
-func UnmountSharedFolders() {
-	shares := FindSharedFolders()
+func (e *DockerEnvironment) UnmountSharedFolders() {
+	shares := e.FindSharedFolders()
 	for _, s := range shares {
 		share := strings.TrimSpace(s)
-		RunCommandWithDefaults(DockerHost(), fmt.Sprintf(`sudo umount "%s"`, share))
+		e.RunCommandWithDefaults(fmt.Sprintf(`sudo umount "%s"`, share))
 	}
 }
 
 // CheckSharedFolders seturn true if shared folders exist and the user agrees to removing them
-func CheckSharedFolders() bool {
-	shares := FindSharedFolders()
+func (e *DockerEnvironment) CheckSharedFolders() bool {
+	shares := e.FindSharedFolders()
 	if len(shares) > 0 {
 		log.Warn("For Parity to operate properly, Virtualbox shares must be removed. Parity will automatically do this for you")
 		return true
@@ -303,12 +157,8 @@ func FindDockerComposeFiles() []string {
 }
 
 // ReadComposeVolumes reads a docker-compose.yml and return a slice of
-// directories to sync into the Docker Host
-//
-// "." and "./." is converted to the current directory parity is running from.
-// Any volume starting with "/" will be treated as an absolute path.
-// All other volumes (e.g. starting with "./" or without a prefix "/") will be treated as
-// relative paths.
+// directories to sync into the Docker Host. See ResolveVolumePath for how
+// relative volumes are handled.
 func ReadComposeVolumes() []string {
 	var volumes []string
 
@@ -328,15 +178,8 @@ func ReadComposeVolumes() []string {
 
 			for _, c := range project.Configs {
 				for _, v := range c.Volumes {
-					v = strings.SplitN(v, ":", 2)[0]
-
-					if v == "." || v == "./." {
-						v, _ = os.Getwd()
-					} else if strings.Index(v, "/") != 0 {
-						cwd, _ := os.Getwd()
-						v = fmt.Sprintf("%s/%s", cwd, v)
-					}
-					volumes = append(volumes, mutils.LinuxPath(v))
+					host, _ := SplitVolume(v)
+					volumes = append(volumes, mutils.LinuxPath(ResolveVolumePath(host)))
 				}
 			}
 		}
@@ -345,14 +188,171 @@ func ReadComposeVolumes() []string {
 	return volumes
 }
 
+// ReadComposeServices returns the names of the services in a Compose file
+func ReadComposeServices(file string) ([]string, error) {
+	project, err := docker.NewProject(&docker.Context{
+		Context: project.Context{
+			ComposeFiles: []string{file},
+			ProjectName:  "parity",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse Compose file %s: %s", file, err.Error())
+	}
+
+	var services []string
+	for name := range project.Configs {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// NamedVolume is a named volume mounted by a Compose service
+type NamedVolume struct {
+	Name    string
+	Service string
+	Path    string // Where the service mounts the volume
+}
+
+// NamedVolumes returns the named volumes mounted by each service, sorted by
+// volume and service. Bind mounts and container only volumes are skipped.
+func NamedVolumes(configs map[string]*project.ServiceConfig) []NamedVolume {
+	var volumes []NamedVolume
+	for service, conf := range configs {
+		for _, v := range conf.Volumes {
+			host, rest := SplitVolume(v)
+			if rest == "" || host == "." || strings.ContainsAny(host, "/\\") || strings.HasPrefix(host, "~") {
+				continue
+			}
+			path, _ := SplitVolume(rest)
+			volumes = append(volumes, NamedVolume{Name: host, Service: service, Path: path})
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		if volumes[i].Name != volumes[j].Name {
+			return volumes[i].Name < volumes[j].Name
+		}
+		return volumes[i].Service < volumes[j].Service
+	})
+	return volumes
+}
+
+// ReadComposeNamedVolumes returns the named volumes of the services in a
+// Compose file, see NamedVolumes
+func ReadComposeNamedVolumes(file string) ([]NamedVolume, error) {
+	project, err := docker.NewProject(&docker.Context{
+		Context: project.Context{
+			ComposeFiles: []string{file},
+			ProjectName:  "parity",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse Compose file %s: %s", file, err.Error())
+	}
+	return NamedVolumes(project.Configs), nil
+}
+
+// Labels identifying the project and service of a Compose container, as set
+// by libcompose and by docker-compose
+var (
+	composeProjectLabels = []string{"io.docker.compose.project", "com.docker.compose.project"}
+	composeServiceLabels = []string{"io.docker.compose.service", "com.docker.compose.service"}
+)
+
+// ComposeService is a running container of a Compose service
+type ComposeService struct {
+	Project   string // The project name, without Parity's 'parity-' prefix
+	Service   string
+	Container dockerclient.APIContainers
+}
+
+// IP returns the container's address on its first network with one
+func (s ComposeService) IP() string {
+	var names []string
+	for name := range s.Container.Networks.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := s.Container.Networks.Networks[name].IPAddress; ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+// RunningComposeServices lists the running containers of all Compose projects
+func RunningComposeServices(client *dockerclient.Client) ([]ComposeService, error) {
+	containers, err := client.ListContainers(dockerclient.ListContainersOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var services []ComposeService
+	for _, c := range containers {
+		project, service := firstLabel(c.Labels, composeProjectLabels), firstLabel(c.Labels, composeServiceLabels)
+		if project == "" || service == "" {
+			continue
+		}
+		services = append(services, ComposeService{
+			Project:   strings.TrimPrefix(project, "parity-"),
+			Service:   service,
+			Container: c,
+		})
+	}
+	return services, nil
+}
+
+func firstLabel(labels map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v := labels[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// SplitVolume splits a compose volume definition (e.g. "./src:/app:ro")
+// into the host path and the remainder of the definition. Windows drive
+// letters (e.g. "C:\src:/app") are kept as part of the host path.
+func SplitVolume(volume string) (host string, rest string) {
+	offset := 0
+	if len(volume) > 2 && volume[1] == ':' && (volume[2] == '\\' || volume[2] == '/') {
+		offset = 2
+	}
+	if i := strings.Index(volume[offset:], ":"); i >= 0 {
+		return volume[:offset+i], volume[offset+i+1:]
+	}
+	return volume, ""
+}
+
+// ResolveVolumePath converts the host part of a compose volume into an absolute path.
+//
+// "." and "./." is converted to the current directory parity is running from.
+// Any volume starting with "/" (or a Windows drive) will be treated as an absolute path.
+// All other volumes will be treated as relative paths.
+func ResolveVolumePath(host string) string {
+	cwd, _ := os.Getwd()
+	if host == "." || host == "./." {
+		return cwd
+	}
+	if strings.Index(host, "/") == 0 || filepath.IsAbs(host) || (len(host) > 2 && host[1] == ':') {
+		return host
+	}
+	return fmt.Sprintf("%s/%s", cwd, host)
+}
+
 // ProjectNameSafe creates a Docker Compose compatible (safe) name given a string
 func ProjectNameSafe(name string) string {
 	return strings.Replace(strings.ToLower(name), " ", "", -1)
 }
 
 // CleanupDockerContainersList returns a list of containers to be removed
-func CleanupDockerContainersList() ([]dockerclient.APIContainers, error) {
-	client := DockerClient()
+func CleanupDockerContainersList(e *DockerEnvironment) ([]dockerclient.APIContainers, error) {
+	client, err := e.Client()
+	if err != nil {
+		return nil, err
+	}
 	listOpts := dockerclient.ListContainersOptions{
 		Filters: map[string][]string{
 			"status": []string{"exited"},
@@ -363,8 +363,11 @@ func CleanupDockerContainersList() ([]dockerclient.APIContainers, error) {
 }
 
 // CleanupDockerImageList returns a list of images to be removed
-func CleanupDockerImageList() ([]dockerclient.APIImages, error) {
-	client := DockerClient()
+func CleanupDockerImageList(e *DockerEnvironment) ([]dockerclient.APIImages, error) {
+	client, err := e.Client()
+	if err != nil {
+		return nil, err
+	}
 	listOpts := dockerclient.ListImagesOptions{
 		Filters: map[string][]string{
 			"dangling": []string{"true"},
@@ -375,17 +378,21 @@ func CleanupDockerImageList() ([]dockerclient.APIImages, error) {
 }
 
 // Cleanup removes dangling images and exited containers.
-func Cleanup() {
-	client := DockerClient()
-	if list, err := CleanupDockerImageList(); err == nil {
+func Cleanup(e *DockerEnvironment) error {
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	if list, err := CleanupDockerImageList(e); err == nil {
 		for _, i := range list {
 			client.RemoveImage(i.ID)
 		}
 	}
-	if list, err := CleanupDockerContainersList(); err == nil {
+	if list, err := CleanupDockerContainersList(e); err == nil {
 		for _, c := range list {
 			opts := dockerclient.RemoveContainerOptions{ID: c.ID}
 			client.RemoveContainer(opts)
 		}
 	}
+	return nil
 }
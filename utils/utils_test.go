@@ -1 +1,95 @@
 package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+)
+
+func TestReadComposeServices(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-compose")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "docker-compose.yml")
+	ioutil.WriteFile(file, []byte("web:\n  image: nginx\ndb:\n  image: postgres\n"), 0644)
+
+	services, err := ReadComposeServices(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if expected := []string{"db", "web"}; !reflect.DeepEqual(services, expected) {
+		t.Fatalf("Expected %v, got %v", expected, services)
+	}
+
+	if _, err := ReadComposeServices(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Fatalf("Expected an error for a missing Compose file")
+	}
+}
+
+func TestReadComposeNamedVolumes(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "parity-compose")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "docker-compose.yml")
+	ioutil.WriteFile(file, []byte(`db:
+  image: postgres
+  volumes:
+    - pgdata:/var/lib/postgresql/data
+    - ./init:/docker-entrypoint-initdb.d
+    - /tmp
+web:
+  image: nginx
+  volumes:
+    - .:/app
+    - uploads:/app/uploads:ro
+worker:
+  image: ruby
+  volumes:
+    - uploads:/uploads
+`), 0644)
+
+	volumes, err := ReadComposeNamedVolumes(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := []NamedVolume{
+		{Name: "pgdata", Service: "db", Path: "/var/lib/postgresql/data"},
+		{Name: "uploads", Service: "web", Path: "/app/uploads"},
+		{Name: "uploads", Service: "worker", Path: "/uploads"},
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, volumes)
+	}
+}
+
+func TestRunningComposeServices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"Id": "1", "Labels": {"io.docker.compose.project": "parity-myproject", "io.docker.compose.service": "web"},
+			 "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}}}},
+			{"Id": "2", "Labels": {"com.docker.compose.project": "other", "com.docker.compose.service": "db"}},
+			{"Id": "3", "Labels": {}}
+		]`)
+	}))
+	defer server.Close()
+	client, _ := dockerclient.NewClient(server.URL)
+
+	services, err := RunningComposeServices(client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 Compose services, got %d", len(services))
+	}
+	if s := services[0]; s.Project != "myproject" || s.Service != "web" || s.IP() != "172.17.0.2" {
+		t.Fatalf("Unexpected service %+v (IP %s)", s, s.IP())
+	}
+	if s := services[1]; s.Project != "other" || s.Service != "db" || s.IP() != "" {
+		t.Fatalf("Unexpected service %+v", s)
+	}
+}
@@ -1,3 +1,8 @@
 package version
 
 const Version = "pre-release"
+
+// MirrorSHA256 optionally pins the checksum of the linux_amd64 Parity
+// binary installed on the Docker host to run the mirror daemon. It is set
+// at build time with -ldflags.
+var MirrorSHA256 = ""
@@ -0,0 +1,76 @@
+// Package x11 shares an X display with containers: it parses DISPLAY,
+// reads and writes Xauthority files, and authenticates X clients connecting
+// through a proxy with a cookie of their own, so that the display isn't
+// exposed to anyone who can reach the proxy.
+package x11
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mefellows/parity/forward"
+)
+
+// SocketDir is the directory containing the X11 unix sockets on Linux
+const SocketDir = "/tmp/.X11-unix"
+
+// BasePort is the TCP port of display 0
+const BasePort = 6000
+
+// Display is an X display, e.g. ":0", "localhost:10.0" or XQuartz's
+// "/private/tmp/com.apple.launchd.abc/org.xquartz:0"
+type Display struct {
+	Host   string // Hostname of a TCP display
+	Number int
+	Screen int
+	Socket string // Path of a local display's unix socket
+}
+
+// ParseDisplay reads a DISPLAY value
+func ParseDisplay(display string) (Display, error) {
+	var d Display
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return d, fmt.Errorf("Invalid DISPLAY '%s', expected e.g. ':0' or 'localhost:10.0'", display)
+	}
+	host, rest := display[:i], display[i+1:]
+	number := rest
+	if j := strings.Index(rest, "."); j >= 0 {
+		screen, err := strconv.Atoi(rest[j+1:])
+		if err != nil {
+			return d, fmt.Errorf("Invalid screen in DISPLAY '%s'", display)
+		}
+		number, d.Screen = rest[:j], screen
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return d, fmt.Errorf("Invalid display number in DISPLAY '%s'", display)
+	}
+	d.Number = n
+
+	switch {
+	case host == "" || host == "unix":
+		d.Socket = SocketDir + "/X" + number
+	case strings.HasPrefix(host, "/"):
+		// A launchd socket, whose name includes the display number
+		d.Socket = host + ":" + number
+	default:
+		d.Host = strings.Trim(strings.TrimPrefix(host, "tcp/"), "[]")
+	}
+	return d, nil
+}
+
+// Local returns true if the display is reached through a unix socket
+func (d Display) Local() bool {
+	return d.Socket != ""
+}
+
+// Endpoint is the address of the display's X server
+func (d Display) Endpoint() forward.Endpoint {
+	if d.Local() {
+		return forward.Endpoint{Network: forward.Unix, Address: d.Socket}
+	}
+	return forward.Endpoint{Network: forward.TCP, Address: net.JoinHostPort(d.Host, strconv.Itoa(BasePort+d.Number))}
+}
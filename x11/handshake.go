@@ -0,0 +1,102 @@
+package x11
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// handshakeTimeout bounds how long a client may take to send its
+// connection setup
+const handshakeTimeout = 10 * time.Second
+
+// Handshake returns a forward handshake that only lets X clients presenting
+// cookie through, replacing it with the X server's own cookie (or no
+// authentication, if serverCookie is nil). This keeps the server's cookie
+// on the host, as 'ssh -X' does.
+func Handshake(cookie []byte, serverCookie []byte) func(client net.Conn, server net.Conn) error {
+	return func(client net.Conn, server net.Conn) error {
+		client.SetReadDeadline(time.Now().Add(handshakeTimeout))
+		defer client.SetReadDeadline(time.Time{})
+
+		setup, err := readSetup(client)
+		if err != nil {
+			return fmt.Errorf("Invalid X connection setup: %s", err.Error())
+		}
+		if setup.name != MagicCookie || subtle.ConstantTimeCompare(setup.data, cookie) != 1 {
+			return fmt.Errorf("X client %s presented the wrong cookie", client.RemoteAddr())
+		}
+
+		setup.name, setup.data = "", nil
+		if serverCookie != nil {
+			setup.name, setup.data = MagicCookie, serverCookie
+		}
+		_, err = server.Write(setup.bytes())
+		return err
+	}
+}
+
+// setup is the connection setup sent by an X client
+type setup struct {
+	order        binary.ByteOrder
+	major, minor uint16
+	name         string
+	data         []byte
+}
+
+// readSetup reads the client's connection setup: the byte order, protocol
+// version and authentication, padded to multiples of 4 bytes
+func readSetup(r io.Reader) (*setup, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	s := &setup{}
+	switch header[0] {
+	case 'B':
+		s.order = binary.BigEndian
+	case 'l':
+		s.order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("unknown byte order %#x", header[0])
+	}
+	s.major, s.minor = s.order.Uint16(header[2:]), s.order.Uint16(header[4:])
+	nameLength, dataLength := int(s.order.Uint16(header[6:])), int(s.order.Uint16(header[8:]))
+
+	auth := make([]byte, pad(nameLength)+pad(dataLength))
+	if _, err := io.ReadFull(r, auth); err != nil {
+		return nil, err
+	}
+	s.name = string(auth[:nameLength])
+	s.data = auth[pad(nameLength) : pad(nameLength)+dataLength]
+	return s, nil
+}
+
+func (s *setup) bytes() []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 12)
+	if s.order == binary.BigEndian {
+		header[0] = 'B'
+	} else {
+		header[0] = 'l'
+	}
+	s.order.PutUint16(header[2:], s.major)
+	s.order.PutUint16(header[4:], s.minor)
+	s.order.PutUint16(header[6:], uint16(len(s.name)))
+	s.order.PutUint16(header[8:], uint16(len(s.data)))
+	buf.Write(header)
+	buf.WriteString(s.name)
+	buf.Write(make([]byte, pad(len(s.name))-len(s.name)))
+	buf.Write(s.data)
+	buf.Write(make([]byte, pad(len(s.data))-len(s.data)))
+	return buf.Bytes()
+}
+
+// pad rounds n up to a multiple of 4
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
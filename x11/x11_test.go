@@ -0,0 +1,150 @@
+package x11
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDisplay(t *testing.T) {
+	for display, expected := range map[string]Display{
+		":0":             {Socket: "/tmp/.X11-unix/X0"},
+		"unix:1.0":       {Number: 1, Socket: "/tmp/.X11-unix/X1"},
+		"localhost:10.2": {Host: "localhost", Number: 10, Screen: 2},
+		"tcp/10.0.0.5:0": {Host: "10.0.0.5"},
+		"[::1]:3":        {Host: "::1", Number: 3},
+		"/private/tmp/com.apple.launchd.abc/org.xquartz:0": {Socket: "/private/tmp/com.apple.launchd.abc/org.xquartz:0"},
+	} {
+		d, err := ParseDisplay(display)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing '%s': %s", display, err.Error())
+		}
+		if d != expected {
+			t.Fatalf("Expected '%s' to be %+v, got %+v", display, expected, d)
+		}
+	}
+
+	for _, display := range []string{"", "localhost", ":x", ":0.x", ":-1"} {
+		if _, err := ParseDisplay(display); err == nil {
+			t.Fatalf("Expected an error parsing '%s'", display)
+		}
+	}
+}
+
+func TestDisplay_Endpoint(t *testing.T) {
+	d, _ := ParseDisplay("localhost:10.0")
+	if e := d.Endpoint(); e.String() != "tcp://localhost:6010" {
+		t.Fatalf("Expected the display's TCP port, got %s", e)
+	}
+	d, _ = ParseDisplay(":1")
+	if e := d.Endpoint(); e.String() != "unix:///tmp/.X11-unix/X1" {
+		t.Fatalf("Expected the display's socket, got %s", e)
+	}
+}
+
+func TestXauthority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parity-x11")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "Xauthority")
+	entries := []AuthEntry{
+		{Family: FamilyInternet, Address: []byte{10, 0, 0, 5}, Number: "0", Name: MagicCookie, Data: []byte("remote")},
+		{Family: FamilyLocal, Address: []byte("workstation"), Number: "0", Name: MagicCookie, Data: []byte("local")},
+		{Family: FamilyLocal, Address: []byte("workstation"), Number: "1", Name: "XDM-AUTHORIZATION-1", Data: []byte("xdm")},
+	}
+	if err := WriteXauthority(file, entries); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the Xauthority file to be private, got %s", info.Mode())
+	}
+	read, err := ReadXauthority(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(read) != 3 || string(read[1].Address) != "workstation" || read[2].Name != "XDM-AUTHORIZATION-1" {
+		t.Fatalf("Expected the entries to be read back, got %+v", read)
+	}
+
+	if cookie := Cookie(read, Display{Number: 0}, "workstation"); string(cookie) != "local" {
+		t.Fatalf("Expected the cookie for the hostname, got '%s'", cookie)
+	}
+	if cookie := Cookie(read, Display{Number: 0}, "laptop"); string(cookie) != "remote" {
+		t.Fatalf("Expected the first cookie for the display, got '%s'", cookie)
+	}
+	if cookie := Cookie(read, Display{Number: 1}, "workstation"); cookie != nil {
+		t.Fatalf("Expected no MIT-MAGIC-COOKIE-1 for display 1, got '%s'", cookie)
+	}
+
+	if entries, err := ReadXauthority(filepath.Join(dir, "missing")); err != nil || entries != nil {
+		t.Fatalf("Expected no entries for a missing file, got %v (%v)", entries, err)
+	}
+	ioutil.WriteFile(file, []byte{1, 0, 0, 5, 'a'}, 0600)
+	if _, err := ReadXauthority(file); err == nil {
+		t.Fatalf("Expected an error for a truncated file")
+	}
+}
+
+// clientSetup is an X client's connection setup, in little endian
+func clientSetup(name string, data []byte) []byte {
+	s := &setup{order: binary.LittleEndian, major: 11, name: name, data: data}
+	return s.bytes()
+}
+
+func TestHandshake(t *testing.T) {
+	cookie, _ := NewCookie()
+	for _, c := range []struct {
+		server   []byte
+		expected []byte
+	}{
+		{[]byte("server-cookie-16"), clientSetup(MagicCookie, []byte("server-cookie-16"))},
+		{nil, clientSetup("", nil)},
+	} {
+		client, proxy := net.Pipe()
+		server, upstream := net.Pipe()
+		go client.Write(append(clientSetup(MagicCookie, cookie), "request"...))
+
+		errs := make(chan error, 1)
+		go func() { errs <- Handshake(cookie, c.server)(proxy, upstream) }()
+		received := make([]byte, len(c.expected))
+		if _, err := server.Read(received); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if !bytes.Equal(received, c.expected) {
+			t.Fatalf("Expected the server to receive %v, got %v", c.expected, received)
+		}
+
+		// The rest of the connection is left to be forwarded
+		rest := make([]byte, 7)
+		if _, err := proxy.Read(rest); err != nil || string(rest) != "request" {
+			t.Fatalf("Expected the rest of the connection to be unread, got '%s'", rest)
+		}
+	}
+}
+
+func TestHandshake_WrongCookie(t *testing.T) {
+	cookie, _ := NewCookie()
+	other, _ := NewCookie()
+	for _, setup := range [][]byte{
+		clientSetup(MagicCookie, other),
+		clientSetup("", nil),
+		{'x', 0, 11, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		client, proxy := net.Pipe()
+		go client.Write(setup)
+		if err := Handshake(cookie, nil)(proxy, nil); err == nil {
+			t.Fatalf("Expected the client to be rejected")
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package x11
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mefellows/mirror/mirror"
+)
+
+// Address families of Xauthority entries
+const (
+	FamilyInternet = 0
+	FamilyLocal    = 256
+	FamilyWild     = 65535 // Matches any host, so that containers can use the entry
+)
+
+// MagicCookie is the only authentication protocol supported
+const MagicCookie = "MIT-MAGIC-COOKIE-1"
+
+// cookieLength is the length of a MIT-MAGIC-COOKIE-1
+const cookieLength = 16
+
+// AuthEntry is an entry of an Xauthority file
+type AuthEntry struct {
+	Family  uint16
+	Address []byte // Hostname for FamilyLocal, or an IP address
+	Number  string // Display number
+	Name    string // Authentication protocol, e.g. MagicCookie
+	Data    []byte
+}
+
+// XauthorityFile is the user's Xauthority file: $XAUTHORITY or ~/.Xauthority
+func XauthorityFile() string {
+	if file := os.Getenv("XAUTHORITY"); file != "" {
+		return file
+	}
+	return filepath.Join(mirror.GetHomeDir(), ".Xauthority")
+}
+
+// ReadXauthority reads the entries of an Xauthority file. A missing file
+// has no entries.
+func ReadXauthority(file string) ([]AuthEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseXauthority(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Xauthority file %s: %s", file, err.Error())
+	}
+	return entries, nil
+}
+
+func parseXauthority(data []byte) ([]AuthEntry, error) {
+	var entries []AuthEntry
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		var e AuthEntry
+		if err := binary.Read(r, binary.BigEndian, &e.Family); err != nil {
+			return nil, err
+		}
+		fields := make([][]byte, 4)
+		for i := range fields {
+			var length uint16
+			if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			fields[i] = make([]byte, length)
+			if _, err := io.ReadFull(r, fields[i]); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+		}
+		e.Address, e.Number, e.Name, e.Data = fields[0], string(fields[1]), string(fields[2]), fields[3]
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// WriteXauthority writes the entries to an Xauthority file, readable only
+// by the user
+func WriteXauthority(file string, entries []AuthEntry) error {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, e := range entries {
+		binary.Write(w, binary.BigEndian, e.Family)
+		for _, field := range [][]byte{e.Address, []byte(e.Number), []byte(e.Name), e.Data} {
+			binary.Write(w, binary.BigEndian, uint16(len(field)))
+			w.Write(field)
+		}
+	}
+	w.Flush()
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0600)
+}
+
+// Cookie finds the MIT-MAGIC-COOKIE-1 for a display in entries, preferring
+// an entry for hostname (or any host). It returns nil if there is none,
+// e.g. when the X server doesn't require authentication.
+func Cookie(entries []AuthEntry, d Display, hostname string) []byte {
+	var fallback []byte
+	number := strconv.Itoa(d.Number)
+	for _, e := range entries {
+		if e.Number != number || e.Name != MagicCookie {
+			continue
+		}
+		if e.Family == FamilyWild || (e.Family == FamilyLocal && string(e.Address) == hostname) {
+			return e.Data
+		}
+		if fallback == nil {
+			fallback = e.Data
+		}
+	}
+	return fallback
+}
+
+// NewCookie generates a random MIT-MAGIC-COOKIE-1
+func NewCookie() ([]byte, error) {
+	cookie := make([]byte, cookieLength)
+	if _, err := rand.Read(cookie); err != nil {
+		return nil, err
+	}
+	return cookie, nil
+}
+
+// ContainerXauthority writes an Xauthority file with a single entry for the
+// display number on any host, as containers' hostnames differ from the host's
+func ContainerXauthority(file string, number int, cookie []byte) error {
+	return WriteXauthority(file, []AuthEntry{{
+		Family: FamilyWild,
+		Number: strconv.Itoa(number),
+		Name:   MagicCookie,
+		Data:   cookie,
+	}})
+}